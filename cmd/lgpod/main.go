@@ -3,29 +3,75 @@ package main
 import (
     "context"
     "encoding/json"
+    "errors"
     "flag"
     "fmt"
+    "io/fs"
     "os"
     "os/signal"
+    "strconv"
+    "strings"
     "syscall"
     "time"
 
     "github.com/lgpo-org/lgpod/pkg/config"
+    "github.com/lgpo-org/lgpod/pkg/control"
+    "github.com/lgpo-org/lgpod/pkg/inventory"
     "github.com/lgpo-org/lgpod/pkg/log"
+    "github.com/lgpo-org/lgpod/pkg/polkit"
     "github.com/lgpo-org/lgpod/pkg/run"
+    "github.com/lgpo-org/lgpod/pkg/status"
+    "github.com/lgpo-org/lgpod/pkg/version"
 )
 
 func main() {
     cfgPath := flag.String("config", "/etc/lgpo/agent.yaml", "config file")
-    sub := flag.String("sub", "run", "run|status|facts|tags")
+    sub := flag.String("sub", "run", "run|status|metrics|facts|tags|show <name>|drift|plan|reconcile|bundle|audit|explain|doctor|control <cmd>|config")
     once := flag.Bool("once", false, "run once then exit")
     dry := flag.Bool("dry-run", false, "plan only")
+    showVersion := flag.Bool("version", false, "print version and exit")
+    watch := flag.Bool("watch", false, "drift: re-check every interval, exit 1 on first drift")
+    remove := flag.Bool("remove", false, "reconcile: delete the orphaned files found")
+    root := flag.String("root", "", "write managed files under this prefix instead of / (post-steps are skipped)")
+    transactional := flag.Bool("transactional", false, "run: apply all files or none; abort and leave the system untouched if any write or the dconf check fails")
+    force := flag.Bool("force", false, "run: rewrite all desired files and re-run post-steps even if unchanged (first run only)")
+    plan := flag.Bool("plan", false, "tags: show what the next inventory sync would add/remove")
+    action := flag.String("action", "", "explain: polkit action id to simulate")
+    user := flag.String("user", "", "explain: subject user")
+    group := flag.String("group", "", "explain: subject groups, comma-separated")
+    active := flag.String("active", "true", "explain: whether the subject's session is active (true|false)")
+    local := flag.String("local", "true", "explain: whether the subject's session is on a local seat (true|false)")
+    seat := flag.String("seat", "seat0", "explain: the session's seat (empty for none)")
+    unit := flag.String("unit", "", "explain: systemd unit for unit_prefix rules")
+    output := flag.String("o", "text", "plan: output format (text|json)")
+    since := flag.String("since", "", "audit: only records from this time on: a duration back from now (24h, 7d) or an RFC3339 time")
+    printHash := flag.Bool("print-device-hash", false, "print the device hash (for inventory/devices.yml) and exit")
+    withPub := flag.Bool("pubkey", false, "print-device-hash: also print the public key line (for the deploy key)")
     flag.Parse()
 
+    if *showVersion { fmt.Println("lgpod", version.String()); return }
+
     l := log.New()
 
-    cfg, err := config.Load(*cfgPath)
+    // loadConfig reads agent.yaml and applies the flag overrides; the service
+    // calls it again on reload-config.
+    loadConfig := func() (*config.Config, error) {
+        c, err := config.Load(*cfgPath)
+        if err != nil { return nil, err }
+        if *root != "" { c.Root = *root }
+        if *transactional { c.Transactional = true }
+        return c, nil
+    }
+    cfg, err := loadConfig()
+    // enrollment scripts may ask for the hash before agent.yaml is written
+    if err != nil && *printHash && errors.Is(err, fs.ErrNotExist) { os.Exit(printDeviceHash(config.DefaultDeviceKey, *withPub)) }
     if err != nil { fmt.Fprintln(os.Stderr, "config:", err); os.Exit(1) }
+    l.SetDebug(cfg.LogLevel == "debug")
+    if *printHash { os.Exit(printDeviceHash(run.New(cfg, l).DeviceKey(), *withPub)) }
+    if *sub == "config" {
+        b, _ := json.MarshalIndent(cfg.Dump(), "", "  ")
+        fmt.Println(string(b)); return
+    }
     if err := cfg.EnsureDirs(); err != nil { fmt.Fprintln(os.Stderr, "dirs:", err); os.Exit(1) }
 
     r := run.New(cfg, l)
@@ -34,15 +80,93 @@ func main() {
     case "status":
         s, err := r.ReadStatus()
         if err != nil { fmt.Fprintln(os.Stderr, err); os.Exit(1) }
-        b, _ := json.MarshalIndent(s, "", "  ")
-        fmt.Println(string(b))
+        fmt.Print(string(status.Encode(s, cfg.StatusFormat)))
+        if cfg.StatusFormat != status.Compact { fmt.Println() }
+        return
+    case "metrics":
+        s, err := r.ReadStatus()
+        if err != nil { fmt.Fprintln(os.Stderr, err); os.Exit(1) }
+        os.Stdout.Write(status.Metrics(s))
         return
     case "facts":
         b, _ := json.MarshalIndent(r.Facts(), "", "  ")
         fmt.Println(string(b)); return
     case "tags":
+        if *plan {
+            hash, changes, err := r.PlanTags()
+            if err != nil { fmt.Fprintln(os.Stderr, err); os.Exit(1) }
+            printTagPlan(hash, changes)
+            return
+        }
         b, _ := json.MarshalIndent(r.Tags(), "", "  ")
         fmt.Println(string(b)); return
+    case "show":
+        if flag.NArg() != 1 { fmt.Fprintln(os.Stderr, "usage: lgpod -sub show <name>"); os.Exit(2) }
+        res, err := r.Show(flag.Arg(0))
+        if err != nil { fmt.Fprintln(os.Stderr, err); os.Exit(1) }
+        printShow(res)
+        return
+    case "drift":
+        ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+        defer cancel()
+        if !*watch {
+            os.Exit(checkDrift(r.Drift))
+        }
+        os.Exit(watchDrift(ctx, r.Drift, cfg.IntervalWithJitter, l))
+    case "plan":
+        if *output != "text" && *output != "json" { fmt.Fprintln(os.Stderr, "usage: lgpod -sub plan [-o text|json]"); os.Exit(2) }
+        pl, err := r.Plan()
+        if err != nil { fmt.Fprintln(os.Stderr, "plan:", err); os.Exit(1) }
+        if *output == "json" {
+            out, _ := json.MarshalIndent(pl, "", "  ")
+            fmt.Println(string(out)); return
+        }
+        printPlan(pl)
+        return
+    case "reconcile":
+        found, err := r.Reconcile(context.Background(), *remove)
+        if err != nil { fmt.Fprintln(os.Stderr, "reconcile:", err); os.Exit(1) }
+        verb := "orphan "
+        if *remove { verb = "removed" }
+        for _, p := range found { fmt.Printf("%s %s\n", verb, p) }
+        return
+    case "bundle":
+        b, err := r.ReadBundle()
+        if err != nil { fmt.Fprintln(os.Stderr, "bundle:", err); os.Exit(1) }
+        out, _ := json.MarshalIndent(b, "", "  ")
+        fmt.Println(string(out)); return
+    case "audit":
+        var cutoff time.Time
+        if *since != "" {
+            if cutoff, err = run.ParseSince(*since, time.Now()); err != nil { fmt.Fprintln(os.Stderr, "-since:", err); os.Exit(2) }
+        }
+        recs, err := r.ReadAudit(cutoff)
+        if err != nil { fmt.Fprintln(os.Stderr, "audit:", err); os.Exit(1) }
+        for _, rec := range recs { fmt.Println(string(rec)) }
+        return
+    case "explain":
+        if *action == "" { fmt.Fprintln(os.Stderr, "usage: lgpod -sub explain -action <id> [-user u] [-group g1,g2] [-active true|false] [-local true|false] [-seat s] [-unit u]"); os.Exit(2) }
+        act, err := strconv.ParseBool(*active)
+        if err != nil { fmt.Fprintln(os.Stderr, "-active:", err); os.Exit(2) }
+        loc, err := strconv.ParseBool(*local)
+        if err != nil { fmt.Fprintln(os.Stderr, "-local:", err); os.Exit(2) }
+        req := polkit.Request{ActionID: *action, User: *user, Active: act, Local: loc, Seat: *seat, Unit: *unit}
+        if *group != "" { req.Groups = strings.Split(*group, ",") }
+        printExplain(r.Explain(req))
+        return
+    case "control":
+        if flag.NArg() != 1 || !control.Commands[flag.Arg(0)] { fmt.Fprintln(os.Stderr, "usage: lgpod -sub control trigger|status|reload-config"); os.Exit(2) }
+        if cfg.ControlSocket == "" { fmt.Fprintln(os.Stderr, "control: controlSocket is not set in", *cfgPath); os.Exit(1) }
+        timeout := time.Duration(0)
+        if d := cfg.RunTimeout(); d > 0 { timeout = d + time.Minute }
+        resp, err := control.Send(cfg.ControlSocket, flag.Arg(0), timeout)
+        if err != nil { fmt.Fprintln(os.Stderr, "control:", err); os.Exit(1) }
+        b, _ := json.Marshal(resp)
+        fmt.Println(string(b))
+        if !resp.OK { os.Exit(1) }
+        return
+    case "doctor":
+        os.Exit(printDoctor(r.Doctor(context.Background())))
     case "run":
     default:
         fmt.Fprintln(os.Stderr, "unknown sub:", *sub); os.Exit(1)
@@ -51,20 +175,226 @@ func main() {
     ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
     defer cancel()
 
+    // Each run gets its own deadline so a hung step can't overlap the next timer.
+    runOnce := func(trigger string) (*run.RunResult, error) {
+        rctx := ctx
+        if d := cfg.RunTimeout(); d > 0 {
+            var stop context.CancelFunc
+            rctx, stop = context.WithTimeout(ctx, d)
+            defer stop()
+        }
+        return r.RunOnce(rctx, *dry, trigger)
+    }
+
+    r.SetForce(*force)
     if *once {
-        if err := r.RunOnce(ctx, *dry, "once"); err != nil { fmt.Fprintln(os.Stderr, err); os.Exit(1) }
+        res, err := runOnce("once")
+        for _, e := range res.Errors { fmt.Fprintln(os.Stderr, "error:", e) }
+        if err != nil { fmt.Fprintln(os.Stderr, err); os.Exit(1) }
+        fmt.Printf("%s: changed=%d removed=%d failed=%d in %s\n", res.Result, res.Changed, res.Removed, res.Failed, res.Duration.Round(time.Millisecond))
         return
     }
 
-    if err := r.RunOnce(ctx, *dry, "boot"); err != nil { l.Warn("initial run", err.Error()) }
-    t := time.NewTimer(cfg.IntervalWithJitter())
+    // After consecutive failures the next run is pushed out (interval doubled
+    // per failure, up to backoffMax) so a broken upstream isn't hammered.
+    backoff := func(next time.Time) time.Time {
+        d := cfg.Backoff(r.FailureStreak())
+        if b := cfg.Now().Add(d); d > 0 && b.After(next) {
+            l.Warn("backoff", "failures", fmt.Sprint(r.FailureStreak()), "next", b.UTC().Format(time.RFC3339))
+            r.Defer(b)
+            return b
+        }
+        return next
+    }
+
+    // Control socket: trigger/status/reload-config from ops tooling.
+    var ctrl <-chan control.Request
+    if cfg.ControlSocket != "" {
+        if ctrl, err = control.Listen(ctx, cfg.ControlSocket); err != nil {
+            l.Warn("control", "err", err.Error(), "socket", cfg.ControlSocket)
+        } else {
+            l.Info("control", "socket", cfg.ControlSocket)
+        }
+    }
+
+    sched := cfg.Schedule(cfg.Now())
+    next := sched.Next(cfg.Now())
+    r.SetNextRun(next)
+    if _, err := runOnce("boot"); err != nil { l.Warn("initial run", err.Error()) }
+    r.SetForce(false)
+    next = backoff(next)
+    t := time.NewTimer(next.Sub(cfg.Now()))
     for {
         select {
         case <-ctx.Done():
             return
         case <-t.C:
-            _ = r.RunOnce(ctx, *dry, "interval")
-            t.Reset(cfg.IntervalWithJitter())
+            next = sched.Next(cfg.Now())
+            r.SetNextRun(next)
+            if _, err := runOnce("interval"); err != nil { l.Warn("run", err.Error()) }
+            next = backoff(next)
+            t.Reset(next.Sub(cfg.Now()))
+        case req := <-ctrl:
+            switch req.Cmd {
+            case "trigger":
+                res, err := runOnce("control")
+                if err != nil { l.Warn("run", err.Error()) }
+                req.Reply <- control.Reply(controlResult(res), err)
+            case "status":
+                req.Reply <- control.Reply(r.ReadStatus())
+            case "reload-config":
+                ncfg, err := loadConfig()
+                if err == nil { err = ncfg.EnsureDirs() }
+                if err != nil {
+                    l.Warn("control", "reload-config failed; keeping the current config", "err", err.Error())
+                    req.Reply <- control.Reply(nil, err)
+                    continue
+                }
+                if ncfg.ControlSocket != cfg.ControlSocket { l.Warn("control", "detail", "controlSocket change takes effect after a restart") }
+                cfg = ncfg
+                r.Reload(cfg)
+                l.SetDebug(cfg.LogLevel == "debug")
+                sched = cfg.Schedule(cfg.Now())
+                next = backoff(sched.Next(cfg.Now()))
+                r.SetNextRun(next)
+                if !t.Stop() { select { case <-t.C: default: } }
+                t.Reset(next.Sub(cfg.Now()))
+                l.Info("control", "detail", "config reloaded", "next", next.UTC().Format(time.RFC3339))
+                req.Reply <- control.Reply(map[string]string{"nextRun": next.UTC().Format(time.RFC3339)}, nil)
+            }
         }
     }
 }
+
+// controlResult is what a trigger reports back over the control socket.
+func controlResult(res *run.RunResult) map[string]any {
+    errs := []string{}
+    for _, e := range res.Errors { errs = append(errs, e.Error()) }
+    return map[string]any{"result": res.Result, "commit": res.Commit, "changed": res.Changed, "removed": res.Removed, "failed": res.Failed, "errors": errs}
+}
+
+func printShow(res *run.ShowResult) {
+    fmt.Printf("file:    %s\n", res.File)
+    fmt.Printf("kind:    %s\n", res.Kind)
+    fmt.Printf("matches: %v\n", res.Matches)
+    if res.Expires != "" {
+        note := ""
+        if res.Expired { note = " (expired: not applied)" }
+        fmt.Printf("expires: %s%s\n", res.Expires, note)
+    }
+    if len(res.DecidedBy) == 0 {
+        fmt.Println("  (empty selector: matches every host)")
+    }
+    for _, d := range res.DecidedBy { fmt.Println("  " + d) }
+    if res.RenderError != "" {
+        fmt.Println("render error:", res.RenderError)
+        return
+    }
+    for _, f := range res.Files {
+        fmt.Printf("\n--- %s\n%s", f.Path, f.Data)
+    }
+}
+
+func printExplain(res *run.ExplainResult) {
+    if len(res.Considered) == 0 { fmt.Println("(no polkit policies apply to this host)") }
+    if len(res.Considered) > 0 { fmt.Println("files:") }
+    for _, f := range res.Considered { fmt.Println("  " + f) }
+    d := res.Decision
+    if d == nil {
+        fmt.Println("result:  no lgpo rule returns; polkit falls through to other rules and the action defaults")
+        return
+    }
+    how := "match"
+    if d.Default { how = "default_result" }
+    fmt.Printf("rule:    %s/%s (%s, %s)\n", d.Policy, d.Rule, how, d.File)
+    fmt.Printf("result:  %s\n", d.Result)
+    if d.Message != "" { fmt.Printf("message: %s\n", d.Message) }
+}
+
+// printDoctor prints one line per check, hints indented below; exit code 1
+// if any check failed.
+func printDoctor(checks []run.Check) int {
+    code := 0
+    for _, c := range checks {
+        fmt.Printf("%-4s  %-32s %s\n", strings.ToUpper(c.Level), c.Name, c.Detail)
+        if c.Hint != "" && c.Level != "ok" { fmt.Printf("      hint: %s\n", c.Hint) }
+        if c.Level == "fail" { code = 1 }
+    }
+    return code
+}
+
+func printTagPlan(hash string, changes []inventory.TagChange) {
+    fmt.Printf("device: %s\n", hash)
+    if len(changes) == 0 { fmt.Println("  (no changes)"); return }
+    for _, c := range changes {
+        switch {
+        case c.Old == nil:
+            fmt.Printf("+ %s: %s\n", c.Key, strings.Join(c.New, ","))
+        case c.New == nil:
+            fmt.Printf("- %s: %s\n", c.Key, strings.Join(c.Old, ","))
+        default:
+            fmt.Printf("~ %s: %s -> %s\n", c.Key, strings.Join(c.Old, ","), strings.Join(c.New, ","))
+        }
+    }
+}
+
+// printPlan lists every policy with its match status and file actions.
+func printPlan(pl *run.Plan) {
+    for _, p := range pl.Policies {
+        state := "no match"
+        switch {
+        case p.File == "": state = "removed"
+        case p.Expired: state = "expired"
+        case p.Error != "": state = "error: " + p.Error
+        case p.Matches: state = "match"
+        }
+        kind := ""
+        if p.Kind != "" { kind = " (" + p.Kind + ")" }
+        fmt.Printf("%s%s %s\n", p.Name, kind, state)
+        for _, f := range p.Files { fmt.Printf("  %-6s %s\n", f.Action, f.Path) }
+    }
+}
+
+// checkDrift prints drifted files; exit code 0 = clean, 1 = drift, 2 = check failed.
+func checkDrift(check func() ([]run.DriftItem, error)) int {
+    items, err := check()
+    if err != nil { fmt.Fprintln(os.Stderr, "drift:", err); return 2 }
+    for _, it := range items { fmt.Printf("%-8s %s\n", it.State, it.Path) }
+    if len(items) > 0 { return 1 }
+    return 0
+}
+
+// watchDrift checks now and then after every interval until drift shows up
+// (exit 1) or ctx is cancelled (exit 0). Failed checks are logged and retried.
+func watchDrift(ctx context.Context, check func() ([]run.DriftItem, error), interval func() time.Duration, l *log.Logger) int {
+    for {
+        items, err := check()
+        if err != nil {
+            l.Warn("drift", "err", err.Error())
+        } else if len(items) > 0 {
+            for _, it := range items { l.Warn("drift", "state", it.State, "path", it.Path) }
+            return 1
+        }
+        t := time.NewTimer(interval())
+        select {
+        case <-ctx.Done():
+            t.Stop()
+            return 0
+        case <-t.C:
+        }
+    }
+}
+
+// printDeviceHash prints the hash of key (its certificate, private key or
+// .pub) and, with pub, the public key line; it returns the exit code.
+func printDeviceHash(key string, pub bool) int {
+    hash, _, err := inventory.ComputeDeviceHashPreferPub(key)
+    if err != nil { fmt.Fprintln(os.Stderr, "device hash:", err); return 1 }
+    fmt.Println(hash)
+    if pub {
+        b, err := os.ReadFile(key + ".pub")
+        if err != nil { fmt.Fprintln(os.Stderr, "public key:", err); return 1 }
+        fmt.Println(strings.TrimSpace(string(b)))
+    }
+    return 0
+}
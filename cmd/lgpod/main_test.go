@@ -0,0 +1,76 @@
+package main
+
+import (
+    "context"
+    "errors"
+    "io"
+    "testing"
+    "time"
+
+    "github.com/lgpo-org/lgpod/pkg/log"
+    "github.com/lgpo-org/lgpod/pkg/run"
+)
+
+func TestCheckDrift(t *testing.T) {
+    tests := []struct {
+        name  string
+        items []run.DriftItem
+        err   error
+        want  int
+    }{
+        {"in sync", nil, nil, 0},
+        {"drift", []run.DriftItem{{Path: "/etc/polkit-1/rules.d/60-lgpo-a.rules", State: "modified"}}, nil, 1},
+        {"check failed", nil, errors.New("sync failed"), 2},
+    }
+    for _, tc := range tests {
+        t.Run(tc.name, func(t *testing.T) {
+            got := checkDrift(func() ([]run.DriftItem, error) { return tc.items, tc.err })
+            if got != tc.want { t.Errorf("exit code = %d, want %d", got, tc.want) }
+        })
+    }
+}
+
+func TestWatchDrift(t *testing.T) {
+    l := log.NewTo(io.Discard)
+    interval := func() time.Duration { return time.Millisecond }
+
+    // failed checks are retried; the first drift ends the watch
+    calls := 0
+    check := func() ([]run.DriftItem, error) {
+        calls++
+        switch calls {
+        case 1: return nil, nil
+        case 2: return nil, errors.New("offline")
+        }
+        return []run.DriftItem{{Path: "/etc/x", State: "missing"}}, nil
+    }
+    if got := watchDrift(context.Background(), check, interval, l); got != 1 || calls != 3 {
+        t.Errorf("exit code %d after %d checks, want 1 after 3", got, calls)
+    }
+
+    // no drift until cancelled
+    ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+    defer cancel()
+    if got := watchDrift(ctx, func() ([]run.DriftItem, error) { return nil, nil }, interval, l); got != 0 {
+        t.Errorf("exit code = %d, want 0 on cancel", got)
+    }
+}
+
+func TestPrintDoctor(t *testing.T) {
+    tests := []struct {
+        name   string
+        levels []string
+        want   int
+    }{
+        {"all ok", []string{"ok", "ok"}, 0},
+        {"warnings only", []string{"ok", "warn"}, 0},
+        {"a failure", []string{"warn", "fail", "ok"}, 1},
+    }
+    for _, tc := range tests {
+        t.Run(tc.name, func(t *testing.T) {
+            var checks []run.Check
+            for _, l := range tc.levels { checks = append(checks, run.Check{Name: "check", Level: l, Hint: "fix it"}) }
+            if got := printDoctor(checks); got != tc.want { t.Errorf("exit code = %d, want %d", got, tc.want) }
+        })
+    }
+}
@@ -1,9 +1,15 @@
 package config
 
 import (
+    "fmt"
+    "io/fs"
     "io/ioutil"
+    "math/rand"
+    "net/url"
     "os"
     "path/filepath"
+    "regexp"
+    "strconv"
     "strings"
     "time"
 
@@ -11,33 +17,214 @@ import (
 )
 
 type Config struct {
-    Repo         string `yaml:"repo"`
-    Branch       string `yaml:"branch"`
-    PoliciesPath string `yaml:"policiesPath"`
-    TagsDir      string `yaml:"tagsDir"`
-    IntervalStr  string `yaml:"interval"`
-    JitterStr    string `yaml:"jitter"`
-    AuditLog     string `yaml:"auditLog"`
-    StatusFile   string `yaml:"statusFile"`
-    CacheDir     string `yaml:"cacheDir"`
+    Repo                  string              `yaml:"repo"`
+    Branch                string              `yaml:"branch"`
+    FetchDepth            int                 `yaml:"fetchDepth"`
+    HTTPProxy             string              `yaml:"httpProxy"`
+    HTTPSProxy            string              `yaml:"httpsProxy"`
+    NoProxy               string              `yaml:"noProxy"`
+    BranchFromTag         string              `yaml:"branchFromTag"`
+    BranchMap             map[string]string   `yaml:"branchMap"`
+    ChannelFromTag        string              `yaml:"channelFromTag"`
+    PoliciesSubdirFromTag string              `yaml:"policiesSubdirFromTag"`
+    PoliciesPath          string              `yaml:"policiesPath"`
+    TagsDir               string              `yaml:"tagsDir"`
+    TagsDirModeStr        string              `yaml:"tagsDirMode"`
+    TagsFileModeStr       string              `yaml:"tagsFileMode"`
+    TagsOwner             string              `yaml:"tagsOwner"`
+    TagsGroup             string              `yaml:"tagsGroup"`
+    DeviceKey             string              `yaml:"deviceKey"`
+    DeviceKeys            []string            `yaml:"deviceKeys"`
+    HaltFile              string              `yaml:"haltFile"`
+    FactsDir              string              `yaml:"factsDir"`
+    OverrideFacts         bool                `yaml:"overrideFacts"`
+    FactsCmdTimeoutStr    string              `yaml:"factsCommandTimeout"`
+    FactsMaxOutput        int                 `yaml:"factsMaxOutput"`
+    IntervalStr           string              `yaml:"interval"`
+    JitterStr             string              `yaml:"jitter"`
+    RunTimeoutStr         string              `yaml:"runTimeout"`
+    BackoffMaxStr         string              `yaml:"backoffMax"`
+    AuditLog              string              `yaml:"auditLog"`
+    StatusFile            string              `yaml:"statusFile"`
+    LogLevel              string              `yaml:"logLevel"`
+    StatusFormat          string              `yaml:"statusFormat"`
+    StatusChangedFiles    bool                `yaml:"statusChangedFiles"`
+    CacheDir              string              `yaml:"cacheDir"`
+    BackupDir             string              `yaml:"backupDir"`
+    BackupKeep            int                 `yaml:"backupKeep"`
+    Root                  string              `yaml:"root"`
+    LocalPoliciesDir      string              `yaml:"localPoliciesDir"`
+    ExcludeGlobs          []string            `yaml:"excludeGlobs"`
+    RedactKeys            []string            `yaml:"redactKeys"`
+    CheckPrincipals       bool                `yaml:"checkPrincipals"`
+    InventorySigningKey   string              `yaml:"inventorySigningKey"`
+    CheckDconfCollisions  bool                `yaml:"checkDconfCollisions"`
+    DconfProfile          string              `yaml:"dconfProfile"`
+    DconfDb               string              `yaml:"dconfDb"`
+    ResetCorruptCache     bool                `yaml:"resetCorruptCache"`
+    VerifyManifest        bool                `yaml:"verifyManifest"`
+    Hooks                 map[string][]string `yaml:"hooks"`
+    TaskCommandDirs       []string            `yaml:"taskCommandDirs"`
+    Strict                bool                `yaml:"strict"`
+    Transactional         bool                `yaml:"transactional"`
+    PostStepConcurrency   int                 `yaml:"postStepConcurrency"`
+    VerifyAfterApply      bool                `yaml:"verifyAfterApply"`
+    Incremental           bool                `yaml:"incremental"`
+    ControlSocket         string              `yaml:"controlSocket"`
+    PolkitMaxBytes        int                 `yaml:"polkitMaxBytes"`
+    PolkitMaxRules        int                 `yaml:"polkitMaxRules"`
+    PolkitGuard           string              `yaml:"polkitGuard"`
+    PolkitGuardPrefixes   []string            `yaml:"polkitGuardPrefixes"`
+    PolkitAdminGroups     []string            `yaml:"polkitAdminGroups"`
+    // Clock drives the schedule; the zero value is SystemClock.
+    Clock                 Clock               `yaml:"-"`
+    defaulted             []string            `yaml:"-"`
 }
 
+// DefaultDeviceKey is deviceKey when agent.yaml does not set it.
+const DefaultDeviceKey = "/etc/lgpo/device.key"
+
 func Load(path string) (*Config, error) {
     b, err := ioutil.ReadFile(path)
     if err != nil { return nil, err }
+    return Parse(b)
+}
+
+// Parse is Load for config already in memory: it decodes agent.yaml content,
+// expands ${VAR} references from the environment, fills in defaults and
+// validates. Programs embedding the agent use it to build a Config with the
+// same defaults as the daemon.
+func Parse(b []byte) (*Config, error) {
     var c Config
-    if err := yaml.Unmarshal(b, &c); err != nil { return nil, err }
-    if c.Branch == "" { c.Branch = "main" }
-    if c.PoliciesPath == "" { c.PoliciesPath = "policies" }
-    if c.TagsDir == "" { c.TagsDir = "/etc/lgpo/tags.d" }
-    if c.IntervalStr == "" { c.IntervalStr = "15m" }
-    if c.JitterStr == "" { c.JitterStr = "3m" }
-    if c.AuditLog == "" { c.AuditLog = "/var/log/lgpo/audit.jsonl" }
-    if c.StatusFile == "" { c.StatusFile = "/var/lib/lgpo/status.json" }
-    if c.CacheDir == "" { c.CacheDir = "/var/lib/lgpo/repo" }
+    var doc yaml.Node
+    if err := yaml.Unmarshal(b, &doc); err != nil { return nil, err }
+    if err := expandEnv(&doc, ""); err != nil { return nil, err }
+    if len(doc.Content) > 0 {
+        if err := doc.Decode(&c); err != nil { return nil, err }
+    }
+    str := func(p *string, key, v string) { if *p == "" { *p = v; c.defaulted = append(c.defaulted, key) } }
+    num := func(p *int, key string, v int) { if *p == 0 { *p = v; c.defaulted = append(c.defaulted, key) } }
+    str(&c.Branch, "branch", "main")
+    str(&c.PoliciesPath, "policiesPath", "policies")
+    str(&c.DeviceKey, "deviceKey", DefaultDeviceKey)
+    str(&c.HaltFile, "haltFile", "/etc/lgpo/HALT")
+    str(&c.TagsDir, "tagsDir", "/etc/lgpo/tags.d")
+    str(&c.TagsDirModeStr, "tagsDirMode", "0750")
+    str(&c.TagsFileModeStr, "tagsFileMode", "0640")
+    str(&c.FactsDir, "factsDir", "/etc/lgpo/facts.d")
+    str(&c.IntervalStr, "interval", "15m")
+    str(&c.JitterStr, "jitter", "3m")
+    str(&c.RunTimeoutStr, "runTimeout", "10m")
+    str(&c.BackoffMaxStr, "backoffMax", "4h")
+    str(&c.FactsCmdTimeoutStr, "factsCommandTimeout", "5s")
+    num(&c.FactsMaxOutput, "factsMaxOutput", 64<<10)
+    str(&c.AuditLog, "auditLog", "/var/log/lgpo/audit.jsonl")
+    str(&c.StatusFile, "statusFile", "/var/lib/lgpo/status.json")
+    str(&c.StatusFormat, "statusFormat", "pretty")
+    str(&c.LogLevel, "logLevel", "info")
+    str(&c.CacheDir, "cacheDir", "/var/lib/lgpo/repo")
+    str(&c.DconfProfile, "dconfProfile", "user")
+    str(&c.DconfDb, "dconfDb", "local")
+    num(&c.FetchDepth, "fetchDepth", 1)
+    num(&c.PostStepConcurrency, "postStepConcurrency", 4)
+    num(&c.BackupKeep, "backupKeep", 10)
+    num(&c.PolkitMaxBytes, "polkitMaxBytes", 64<<10)
+    num(&c.PolkitMaxRules, "polkitMaxRules", 200)
+    str(&c.PolkitGuard, "polkitGuard", "warn")
+    // nil only when unset: an explicit [] turns the list off
+    if c.PolkitGuardPrefixes == nil { c.PolkitGuardPrefixes = []string{"org.freedesktop.systemd1.", "org.freedesktop.login1."}; c.defaulted = append(c.defaulted, "polkitGuardPrefixes") }
+    if c.TaskCommandDirs == nil { c.TaskCommandDirs = []string{"/usr/local/libexec/lgpo/", "/usr/local/sbin/", "/usr/local/bin/"}; c.defaulted = append(c.defaulted, "taskCommandDirs") }
+    if c.PolkitAdminGroups == nil { c.PolkitAdminGroups = []string{"wheel", "sudo", "admin"}; c.defaulted = append(c.defaulted, "polkitAdminGroups") }
+    if err := c.Validate(); err != nil { return nil, err }
     return &c, nil
 }
 
+// reDconfName is a dconf profile or system db name: one path component.
+var reDconfName = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// Validate rejects values the agent would otherwise silently replace or
+// misread at run time.
+func (c *Config) Validate() error {
+    if c.Repo == "" && c.LocalPoliciesDir == "" { return fmt.Errorf("repo or localPoliciesDir is required") }
+    for key, v := range map[string]string{"interval": c.IntervalStr, "jitter": c.JitterStr, "runTimeout": c.RunTimeoutStr, "backoffMax": c.BackoffMaxStr, "factsCommandTimeout": c.FactsCmdTimeoutStr} {
+        if _, err := time.ParseDuration(v); err != nil { return fmt.Errorf("%s: %v", key, err) }
+    }
+    if c.StatusFormat != "pretty" && c.StatusFormat != "compact" { return fmt.Errorf("statusFormat must be pretty or compact, got %q", c.StatusFormat) }
+    if c.FactsCommandTimeout() <= 0 { return fmt.Errorf("factsCommandTimeout must be positive, got %q", c.FactsCmdTimeoutStr) }
+    if c.FactsMaxOutput < 0 { return fmt.Errorf("factsMaxOutput must be 1 or more, got %d", c.FactsMaxOutput) }
+    if c.PostStepConcurrency < 0 { return fmt.Errorf("postStepConcurrency must be 1 or more, got %d", c.PostStepConcurrency) }
+    if c.PolkitGuard != "warn" && c.PolkitGuard != "refuse" && c.PolkitGuard != "off" { return fmt.Errorf("polkitGuard must be warn, refuse or off, got %q", c.PolkitGuard) }
+    if c.LogLevel != "info" && c.LogLevel != "debug" { return fmt.Errorf("logLevel must be info or debug, got %q", c.LogLevel) }
+    for key, v := range map[string]string{"dconfProfile": c.DconfProfile, "dconfDb": c.DconfDb} {
+        if !reDconfName.MatchString(v) { return fmt.Errorf("%s must be a plain name like user or local, got %q", key, v) }
+    }
+    for key, v := range map[string]string{"httpProxy": c.HTTPProxy, "httpsProxy": c.HTTPSProxy} {
+        if u, err := url.Parse(v); v != "" && (err != nil || u.Scheme == "" || u.Host == "") { return fmt.Errorf("%s must be a URL like http://proxy:3128, got %q", key, v) }
+    }
+    for key, v := range map[string]string{"tagsDirMode": c.TagsDirModeStr, "tagsFileMode": c.TagsFileModeStr} {
+        if _, err := parseMode(v); err != nil { return fmt.Errorf("%s: %v", key, err) }
+    }
+    for name, argv := range c.Hooks {
+        if len(argv) == 0 || !filepath.IsAbs(argv[0]) { return fmt.Errorf("hooks.%s: want a command with an absolute path, e.g. [/usr/bin/systemctl, restart, gdm]", name) }
+    }
+    for _, d := range c.TaskCommandDirs {
+        if !filepath.IsAbs(d) || strings.TrimSuffix(filepath.Clean(d), "/")+"/" != d { return fmt.Errorf("taskCommandDirs: want absolute, clean directories ending in /, got %q", d) }
+    }
+    if c.BackupDir != "" && !filepath.IsAbs(c.BackupDir) { return fmt.Errorf("backupDir: want an absolute path, got %q", c.BackupDir) }
+    if c.BackupKeep < 0 { return fmt.Errorf("backupKeep must be 1 or more, got %d", c.BackupKeep) }
+    for _, k := range c.DeviceKeys {
+        if !filepath.IsAbs(k) { return fmt.Errorf("deviceKeys: want absolute paths, got %q", k) }
+    }
+    for _, g := range c.ExcludeGlobs {
+        if _, err := filepath.Match(g, ""); err != nil { return fmt.Errorf("excludeGlobs %q: %v", g, err) }
+    }
+    return nil
+}
+
+// Defaulted lists the config keys that were unset and got their default.
+func (c *Config) Defaulted() []string { return c.defaulted }
+
+// Dump is the resolved config keyed like agent.yaml, plus parsed durations
+// and the keys that fell back to defaults. Proxy credentials are redacted.
+func (c *Config) Dump() map[string]any {
+    out := map[string]any{}
+    b, _ := yaml.Marshal(c)
+    _ = yaml.Unmarshal(b, &out)
+    for _, key := range []string{"httpProxy", "httpsProxy"} {
+        if v, _ := out[key].(string); v != "" { out[key] = redactUserinfo(v) }
+    }
+    out["resolved"] = map[string]string{
+        "interval":            c.Interval().String(),
+        "jitter":              c.Jitter().String(),
+        "runTimeout":          c.RunTimeout().String(),
+        "backoffMax":          c.BackoffMax().String(),
+        "factsCommandTimeout": c.FactsCommandTimeout().String(),
+        "repoDir":             c.RepoDir(),
+    }
+    out["defaulted"] = c.Defaulted()
+    return out
+}
+
+// redactUserinfo replaces the user:password@ part of a URL with xxxxx@.
+func redactUserinfo(v string) string {
+    u, err := url.Parse(v)
+    if err != nil || u.User == nil { return v }
+    u.User = url.User("xxxxx")
+    return u.String()
+}
+
+// parseMode reads an octal permission string like "0640".
+func parseMode(s string) (fs.FileMode, error) {
+    m, err := strconv.ParseUint(s, 8, 32)
+    if err != nil || m > 0o777 { return 0, fmt.Errorf("want an octal mode like 0640, got %q", s) }
+    return fs.FileMode(m), nil
+}
+
+// TagsDirMode and TagsFileMode are the modes of the tags dirs and the
+// inventory tag files (tagsOwner/tagsGroup set their owner).
+func (c *Config) TagsDirMode() fs.FileMode { m, _ := parseMode(c.TagsDirModeStr); return m }
+func (c *Config) TagsFileMode() fs.FileMode { m, _ := parseMode(c.TagsFileModeStr); return m }
+
 func (c *Config) EnsureDirs() error {
     for _, p := range []string{filepath.Dir(c.AuditLog), filepath.Dir(c.StatusFile), c.CacheDir} {
         if err := os.MkdirAll(p, 0755); err != nil { return err }
@@ -55,15 +242,114 @@ func (c *Config) Jitter() time.Duration {
     if d < 0 { d = 0 }
     return d
 }
+// RunTimeout bounds a single run; 0 (runTimeout: "0") means no deadline.
+func (c *Config) RunTimeout() time.Duration {
+    d, _ := time.ParseDuration(c.RunTimeoutStr)
+    if d < 0 { d = 0 }
+    return d
+}
+// DeviceKeyPaths is deviceKey followed by deviceKeys, without duplicates:
+// the identity files offered to SSH remotes, in order.
+func (c *Config) DeviceKeyPaths() []string {
+    out := []string{c.DeviceKey}
+    for _, k := range c.DeviceKeys {
+        dup := false
+        for _, o := range out { dup = dup || o == k }
+        if !dup { out = append(out, k) }
+    }
+    return out
+}
+// FactsCommandTimeout bounds each command fact discovery runs.
+func (c *Config) FactsCommandTimeout() time.Duration {
+    d, _ := time.ParseDuration(c.FactsCmdTimeoutStr)
+    return d
+}
+
+// BackoffMax caps the failure backoff; 0 (backoffMax: "0") disables it.
+func (c *Config) BackoffMax() time.Duration {
+    d, _ := time.ParseDuration(c.BackoffMaxStr)
+    if d < 0 { d = 0 }
+    return d
+}
+
+// Backoff is the delay before the next run after streak consecutive failed
+// runs: the interval doubled per failure, capped at BackoffMax. It is 0 after
+// a success or with backoff disabled.
+func (c *Config) Backoff(streak int) time.Duration {
+    max := c.BackoffMax()
+    if streak <= 0 || max <= 0 { return 0 }
+    d := c.Interval()
+    for i := 0; i < streak && d < max; i++ { d *= 2 }
+    if d > max { d = max }
+    return d
+}
+
+// Clock is where scheduling gets the time and its jitter randomness. Tests
+// set Config.Clock to a fixed time and a seeded source to get exact run times.
+type Clock struct {
+    Now    func() time.Time
+    Int63n func(n int64) int64 // uniform in [0, n)
+}
+
+var SystemClock = Clock{Now: time.Now, Int63n: rand.Int63n}
+
+func (c *Config) clock() Clock {
+    clk := c.Clock
+    if clk.Now == nil { clk.Now = SystemClock.Now }
+    if clk.Int63n == nil { clk.Int63n = SystemClock.Int63n }
+    return clk
+}
+
+// Now is the current time on the config's clock.
+func (c *Config) Now() time.Time { return c.clock().Now() }
+
 func (c *Config) IntervalWithJitter() time.Duration {
-    base := c.Interval()
-    j := c.Jitter()
-    if j == 0 { return base }
-    // simple +/- 50% of jitter duration based on time
-    n := time.Now().UnixNano()
-    s := int64(1)
-    if n&1 == 0 { s = -1 }
-    return base + time.Duration(s)*j/2
+    return c.Interval() + jitterOffset(c.Jitter(), c.clock().Int63n)
+}
+
+// jitterOffset is a uniform random offset in [-j/2, +j/2].
+func jitterOffset(j time.Duration, rnd func(int64) int64) time.Duration {
+    if j <= 0 { return 0 }
+    return time.Duration(rnd(int64(j)+1)) - j/2
+}
+
+// Schedule yields absolute run times anchored at its start: run k is due at
+// start + k*interval plus a fresh random jitter offset, so the schedule never
+// drifts with run duration and agents started together still spread out.
+type Schedule struct {
+    start    time.Time
+    interval time.Duration
+    jitter   time.Duration
+    k        int64
+    rnd      func(int64) int64
+}
+
+func (c *Config) Schedule(start time.Time) *Schedule {
+    return &Schedule{start: start, interval: c.Interval(), jitter: c.Jitter(), rnd: c.clock().Int63n}
+}
+
+// Next returns the next due time after now. Slots that already passed (a run
+// overran its interval) are skipped rather than run back to back.
+func (s *Schedule) Next(now time.Time) time.Time {
+    s.k++
+    if due := s.start.Add(time.Duration(s.k) * s.interval); due.Before(now) {
+        s.k = int64(now.Sub(s.start)/s.interval) + 1
+    }
+    return s.start.Add(time.Duration(s.k)*s.interval + jitterOffset(s.jitter, s.rnd))
+}
+
+// LocalDir is the out-of-band synced repo copy to read instead of git
+// (localPoliciesDir, or a file:// repo URL); "" means use git.
+func (c *Config) LocalDir() string {
+    if c.LocalPoliciesDir != "" { return c.LocalPoliciesDir }
+    if strings.HasPrefix(c.Repo, "file://") { return strings.TrimPrefix(c.Repo, "file://") }
+    return ""
+}
+
+// RepoDir is where policies and inventory are read from.
+func (c *Config) RepoDir() string {
+    if d := c.LocalDir(); d != "" { return d }
+    return c.CacheDir
 }
 
 func (c *Config) PoliciesDir() string {
@@ -0,0 +1,73 @@
+package config
+
+import (
+    "fmt"
+    "os"
+    "strings"
+
+    "gopkg.in/yaml.v3"
+)
+
+// expandEnv replaces ${VAR} and ${VAR:-default} in every scalar value under
+// n (map keys are left alone) from the process environment. $${ is a
+// literal ${. A plain (unquoted) scalar is re-typed after expansion, so
+// fetchDepth: ${DEPTH:-1} still decodes as a number.
+func expandEnv(n *yaml.Node, path string) error {
+    switch n.Kind {
+    case yaml.DocumentNode, yaml.SequenceNode:
+        for i, c := range n.Content {
+            p := path
+            if n.Kind == yaml.SequenceNode { p = fmt.Sprintf("%s[%d]", path, i) }
+            if err := expandEnv(c, p); err != nil { return err }
+        }
+    case yaml.MappingNode:
+        for i := 0; i+1 < len(n.Content); i += 2 {
+            p := n.Content[i].Value
+            if path != "" { p = path + "." + p }
+            if err := expandEnv(n.Content[i+1], p); err != nil { return err }
+        }
+    case yaml.ScalarNode:
+        if !strings.Contains(n.Value, "${") { return nil }
+        v, err := expand(n.Value, os.LookupEnv)
+        if err != nil { return fmt.Errorf("%s: %v", path, err) }
+        n.Value = v
+        if n.Style == 0 { n.Tag = "" }
+    }
+    return nil
+}
+
+// expand substitutes the ${...} references in s using lookup.
+func expand(s string, lookup func(string) (string, bool)) (string, error) {
+    var b strings.Builder
+    for {
+        i := strings.Index(s, "${")
+        if i < 0 { b.WriteString(s); return b.String(), nil }
+        if i > 0 && s[i-1] == '$' {
+            b.WriteString(s[:i-1] + "${")
+            s = s[i+2:]
+            continue
+        }
+        end := strings.IndexByte(s[i:], '}')
+        if end < 0 { return "", fmt.Errorf("unterminated ${ in %q", s) }
+        ref := s[i+2 : i+end]
+        name, def, hasDef := strings.Cut(ref, ":-")
+        if !validEnvName(name) { return "", fmt.Errorf("bad variable name in ${%s}", ref) }
+        v, ok := lookup(name)
+        switch {
+        case hasDef && v == "":
+            v = def
+        case !ok:
+            return "", fmt.Errorf("${%s} is not set (use ${%s:-default} for a fallback)", name, name)
+        }
+        b.WriteString(s[:i] + v)
+        s = s[i+end+1:]
+    }
+}
+
+func validEnvName(s string) bool {
+    if s == "" { return false }
+    for i, r := range s {
+        if r != '_' && (r < 'A' || r > 'Z') && (r < 'a' || r > 'z') && (i == 0 || r < '0' || r > '9') { return false }
+    }
+    return true
+}
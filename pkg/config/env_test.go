@@ -0,0 +1,53 @@
+package config
+
+import (
+    "strings"
+    "testing"
+)
+
+func TestExpand(t *testing.T) {
+    env := map[string]string{"HOST": "git.example.org", "EMPTY": ""}
+    lookup := func(k string) (string, bool) { v, ok := env[k]; return v, ok }
+    tests := []struct {
+        in, want, wantErr string
+    }{
+        {"plain", "plain", ""},
+        {"https://${HOST}/lgpo.git", "https://git.example.org/lgpo.git", ""},
+        {"${HOST}${HOST}", "git.example.orggit.example.org", ""},
+        {"${MISSING:-main}", "main", ""},
+        {"${EMPTY:-main}", "main", ""},
+        {"${HOST:-other}", "git.example.org", ""},
+        {"${MISSING:-}", "", ""},
+        {"[${EMPTY}]", "[]", ""},
+        {"$${HOST}", "${HOST}", ""},
+        {"$${HOST} ${HOST}", "${HOST} git.example.org", ""},
+        {"${MISSING}", "", "${MISSING} is not set"},
+        {"${HOST", "", "unterminated"},
+        {"${1X}", "", "bad variable name"},
+        {"${}", "", "bad variable name"},
+    }
+    for _, tc := range tests {
+        got, err := expand(tc.in, lookup)
+        if tc.wantErr != "" {
+            if err == nil || !strings.Contains(err.Error(), tc.wantErr) { t.Errorf("expand(%q) = %q, %v, want error containing %q", tc.in, got, err, tc.wantErr) }
+            continue
+        }
+        if err != nil || got != tc.want { t.Errorf("expand(%q) = %q, %v, want %q", tc.in, got, err, tc.want) }
+    }
+}
+
+func TestParseEnv(t *testing.T) {
+    t.Setenv("LGPO_BRANCH", "stable")
+    t.Setenv("LGPO_DEPTH", "5")
+    c, err := Parse([]byte("localPoliciesDir: /srv/lgpo\nbranch: ${LGPO_BRANCH}\nfetchDepth: ${LGPO_DEPTH:-1}\n"))
+    if err != nil { t.Fatal(err) }
+    // an unquoted scalar is re-typed, so fetchDepth still decodes as a number
+    if c.Branch != "stable" || c.FetchDepth != 5 { t.Errorf("branch, fetchDepth = %q, %d, want stable, 5", c.Branch, c.FetchDepth) }
+
+    // a quoted one keeps its string type
+    if _, err := Parse([]byte("localPoliciesDir: /srv/lgpo\nfetchDepth: \"${LGPO_DEPTH}\"\n")); err == nil { t.Error("quoted fetchDepth decoded as a number") }
+
+    // errors name the key they came from
+    _, err = Parse([]byte("localPoliciesDir: /srv/lgpo\nhooks:\n  pre: [ok, \"${LGPO_UNSET_VAR}\"]\n"))
+    if err == nil || !strings.Contains(err.Error(), "hooks.pre[1]") { t.Errorf("err = %v, want one naming hooks.pre[1]", err) }
+}
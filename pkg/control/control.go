@@ -0,0 +1,170 @@
+// Package control is the service's unix-socket control interface. A client
+// writes one command per connection as a line ("trigger", "status" or
+// "reload-config") and reads back one JSON Response line. Access is guarded
+// by the socket's permissions (0600, owner only).
+package control
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Commands the service loop answers.
+var Commands = map[string]bool{"trigger": true, "status": true, "reload-config": true}
+
+// Request is one command read from the socket. The service loop must send
+// exactly one Response on Reply.
+type Request struct {
+	Cmd   string
+	Reply chan<- Response
+}
+
+type Response struct {
+	OK    bool            `json:"ok"`
+	Error string          `json:"error,omitempty"`
+	Data  json.RawMessage `json:"data,omitempty"`
+}
+
+// Reply builds a Response from a result and its error.
+func Reply(data any, err error) Response {
+	if err != nil {
+		return Response{Error: err.Error()}
+	}
+	b, merr := json.Marshal(data)
+	if merr != nil {
+		return Response{Error: merr.Error()}
+	}
+	return Response{OK: true, Data: b}
+}
+
+// Listen serves the socket at path until ctx is done and delivers commands
+// on the returned channel. A stale socket file from a previous run is
+// replaced.
+func Listen(ctx context.Context, path string) (<-chan Request, error) {
+	ln, err := listenPrivate(path)
+	if err != nil {
+		return nil, err
+	}
+	reqs := make(chan Request)
+	go func() {
+		<-ctx.Done()
+		_ = ln.Close()
+		_ = os.Remove(path)
+	}()
+	go func() {
+		var delay time.Duration // backoff after failed accepts, e.g. EMFILE
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				if errors.Is(err, net.ErrClosed) || ctx.Err() != nil {
+					return
+				}
+				if delay *= 2; delay == 0 {
+					delay = 5 * time.Millisecond
+				}
+				if delay > time.Second {
+					delay = time.Second
+				}
+				select {
+				case <-time.After(delay):
+				case <-ctx.Done():
+					return
+				}
+				continue
+			}
+			delay = 0
+			go serve(ctx, c, reqs)
+		}
+	}()
+	return reqs, nil
+}
+
+// listenPrivate binds the socket inside a fresh 0700 dir next to path,
+// restricts it to 0600 and only then renames it to path, so it is never
+// reachable with the permissions the process umask would give it.
+func listenPrivate(path string) (net.Listener, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	dir, err := os.MkdirTemp(filepath.Dir(path), ".lgpo-control-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	tmp := filepath.Join(dir, "sock")
+	ln, err := net.Listen("unix", tmp)
+	if err != nil {
+		return nil, err
+	}
+	// path is removed on shutdown; tmp is gone by then
+	ln.(*net.UnixListener).SetUnlinkOnClose(false)
+	if err := os.Chmod(tmp, 0o600); err != nil {
+		_ = ln.Close()
+		return nil, err
+	}
+	_ = os.Remove(path)
+	if err := os.Rename(tmp, path); err != nil {
+		_ = ln.Close()
+		return nil, err
+	}
+	return ln, nil
+}
+
+func serve(ctx context.Context, c net.Conn, reqs chan<- Request) {
+	defer c.Close()
+	_ = c.SetReadDeadline(time.Now().Add(10 * time.Second))
+	line, err := bufio.NewReader(io.LimitReader(c, 256)).ReadString('\n')
+	if err != nil && line == "" {
+		return
+	}
+	cmd := strings.TrimSpace(line)
+
+	var resp Response
+	if !Commands[cmd] {
+		resp = Response{Error: fmt.Sprintf("unknown command %q (want trigger, status or reload-config)", cmd)}
+	} else {
+		reply := make(chan Response, 1)
+		select {
+		case reqs <- Request{Cmd: cmd, Reply: reply}:
+		case <-ctx.Done():
+			return
+		}
+		select {
+		case resp = <-reply:
+		case <-ctx.Done():
+			return
+		}
+	}
+	_ = c.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	_ = json.NewEncoder(c).Encode(resp)
+}
+
+// Send is the client side: it sends cmd and waits for the response. A
+// trigger answers only after the run finished, so timeout should cover one.
+func Send(path, cmd string, timeout time.Duration) (Response, error) {
+	var resp Response
+	c, err := net.DialTimeout("unix", path, 5*time.Second)
+	if err != nil {
+		return resp, err
+	}
+	defer c.Close()
+	if timeout > 0 {
+		_ = c.SetDeadline(time.Now().Add(timeout))
+	}
+	if _, err := fmt.Fprintln(c, cmd); err != nil {
+		return resp, err
+	}
+	if err := json.NewDecoder(c).Decode(&resp); err != nil {
+		return resp, fmt.Errorf("read response: %w", err)
+	}
+	return resp, nil
+}
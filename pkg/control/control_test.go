@@ -0,0 +1,73 @@
+package control
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestListen(t *testing.T) {
+	old := syscall.Umask(0)
+	defer syscall.Umask(old)
+
+	path := filepath.Join(t.TempDir(), "run", "control.sock")
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("stale"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	reqs, err := Listen(ctx, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode()&os.ModeSocket == 0 || fi.Mode().Perm() != 0o600 {
+		t.Errorf("socket mode %v, want a 0600 socket", fi.Mode())
+	}
+	if ents, _ := os.ReadDir(filepath.Dir(path)); len(ents) != 1 {
+		t.Errorf("socket dir holds %d entries, want only the socket", len(ents))
+	}
+
+	go func() {
+		for req := range reqs {
+			req.Reply <- Reply(map[string]string{"cmd": req.Cmd}, nil)
+		}
+	}()
+	tests := []struct {
+		cmd    string
+		wantOK bool
+	}{
+		{"status", true},
+		{"trigger", true},
+		{"bogus", false},
+	}
+	for _, tc := range tests {
+		resp, err := Send(path, tc.cmd, 5*time.Second)
+		if err != nil {
+			t.Fatalf("Send %s: %v", tc.cmd, err)
+		}
+		if resp.OK != tc.wantOK {
+			t.Errorf("Send %s: ok = %v (%s), want %v", tc.cmd, resp.OK, resp.Error, tc.wantOK)
+		}
+	}
+
+	cancel()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("socket not removed after ctx was done")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,47 @@
+package dconf
+
+import (
+    "bufio"
+    "bytes"
+    "fmt"
+    "sort"
+    "strings"
+)
+
+// Keys returns the "group/key" names set in a dconf keyfile.
+func Keys(b []byte) []string {
+    var out []string
+    group := ""
+    sc := bufio.NewScanner(bytes.NewReader(b))
+    for sc.Scan() {
+        line := strings.TrimSpace(sc.Text())
+        switch {
+        case line == "" || strings.HasPrefix(line, "#"):
+        case strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]"):
+            group = strings.TrimSpace(line[1 : len(line)-1])
+        default:
+            if k, _, ok := strings.Cut(line, "="); ok && group != "" {
+                out = append(out, group+"/"+strings.TrimSpace(k))
+            }
+        }
+    }
+    return out
+}
+
+// Collisions reports each key of settings that another keyfile in the same db
+// dir (path -> contents) also sets. dconf compiles them in lexical file order,
+// so which value wins depends on file naming rather than intent.
+func Collisions(settings []byte, others map[string][]byte) []string {
+    paths := make([]string, 0, len(others))
+    for p := range others { paths = append(paths, p) }
+    sort.Strings(paths)
+    var out []string
+    for _, k := range Keys(settings) {
+        for _, p := range paths {
+            for _, ok := range Keys(others[p]) {
+                if ok == k { out = append(out, fmt.Sprintf("%s is also set by %s", k, p)); break }
+            }
+        }
+    }
+    return out
+}
@@ -0,0 +1,27 @@
+package dconf
+
+import (
+    "reflect"
+    "testing"
+)
+
+func TestKeys(t *testing.T) {
+    kf := "# site defaults\nstray=1\n[org/gnome/desktop/session]\nidle-delay=uint32 300\n\n[ org/gnome/desktop/screensaver ]\n lock-enabled = true\nnot a setting\n"
+    want := []string{"org/gnome/desktop/session/idle-delay", "org/gnome/desktop/screensaver/lock-enabled"}
+    if got := Keys([]byte(kf)); !reflect.DeepEqual(got, want) { t.Errorf("Keys = %q, want %q", got, want) }
+}
+
+func TestCollisions(t *testing.T) {
+    settings := []byte("[org/gnome/desktop/session]\nidle-delay=uint32 300\n[org/gnome/desktop/screensaver]\nlock-enabled=true\n")
+    others := map[string][]byte{
+        "/etc/dconf/db/local.d/90-site":   []byte("[org/gnome/desktop/session]\nidle-delay=uint32 900\n"),
+        "/etc/dconf/db/local.d/00-vendor": []byte("[org/gnome/desktop/session]\nidle-delay=uint32 0\n[org/gnome/desktop/background]\npicture-uri='x'\n"),
+        "/etc/dconf/db/local.d/50-other":  []byte("[org/gnome/desktop/screensaver]\nlock-delay=uint32 0\n"),
+    }
+    want := []string{
+        "org/gnome/desktop/session/idle-delay is also set by /etc/dconf/db/local.d/00-vendor",
+        "org/gnome/desktop/session/idle-delay is also set by /etc/dconf/db/local.d/90-site",
+    }
+    if got := Collisions(settings, others); !reflect.DeepEqual(got, want) { t.Errorf("Collisions = %q, want %q", got, want) }
+    if got := Collisions(settings, nil); got != nil { t.Errorf("Collisions without other files = %q", got) }
+}
@@ -0,0 +1,174 @@
+package dconf
+
+import (
+    "fmt"
+    "strings"
+)
+
+// gvType keywords that may prefix a value, e.g. "uint32 300".
+var gvTypeKeywords = map[string]bool{
+    "boolean": true, "byte": true, "int16": true, "uint16": true, "int32": true, "uint32": true,
+    "int64": true, "uint64": true, "handle": true, "double": true, "string": true,
+    "objectpath": true, "signature": true,
+}
+
+// CheckGVariant parses s as GVariant text format (what dconf keyfiles hold)
+// and reports the first syntax error: unbalanced quotes or brackets, bad
+// escapes, stray characters. It checks syntax only, not types.
+func CheckGVariant(s string) error {
+    p := &gvParser{s: s}
+    p.ws()
+    if err := p.value(); err != nil { return err }
+    p.ws()
+    if p.i < len(p.s) { return p.errf("unexpected %q", p.s[p.i:]) }
+    return nil
+}
+
+type gvParser struct {
+    s string
+    i int
+}
+
+func (p *gvParser) errf(format string, a ...any) error {
+    return fmt.Errorf("gvariant at offset %d: %s", p.i, fmt.Sprintf(format, a...))
+}
+
+func (p *gvParser) ws() {
+    for p.i < len(p.s) && strings.IndexByte(" \t", p.s[p.i]) >= 0 { p.i++ }
+}
+
+func (p *gvParser) peek() byte {
+    if p.i < len(p.s) { return p.s[p.i] }
+    return 0
+}
+
+func (p *gvParser) value() error {
+    switch c := p.peek(); {
+    case c == 0:
+        return p.errf("missing value")
+    case c == '\'' || c == '"':
+        return p.str()
+    case c == '[':
+        return p.list('[', ']', false)
+    case c == '(':
+        return p.list('(', ')', false)
+    case c == '{':
+        return p.list('{', '}', true)
+    case c == '<':
+        p.i++
+        p.ws()
+        if err := p.value(); err != nil { return err }
+        p.ws()
+        if p.peek() != '>' { return p.errf("unclosed variant, want '>'") }
+        p.i++
+        return nil
+    case c == '@':
+        p.i++
+        start := p.i
+        for p.i < len(p.s) && strings.IndexByte("bynqiuxthdsogvam(){}*?r", p.s[p.i]) >= 0 { p.i++ }
+        if p.i == start { return p.errf("missing type after '@'") }
+        p.ws()
+        return p.value()
+    case c == '-' || c == '+' || c == '.' || (c >= '0' && c <= '9'):
+        return p.number()
+    default:
+        w := p.word()
+        switch {
+        case w == "true" || w == "false" || w == "nothing":
+            return nil
+        case w == "just" || gvTypeKeywords[w]:
+            p.ws()
+            return p.value()
+        case w == "b" && (p.peek() == '\'' || p.peek() == '"'):
+            return p.str() // bytestring b'...'
+        case w == "":
+            return p.errf("unexpected %q", string(c))
+        }
+        return p.errf("unknown word %q (strings need quotes)", w)
+    }
+}
+
+func (p *gvParser) word() string {
+    start := p.i
+    for p.i < len(p.s) {
+        c := p.s[p.i]
+        if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_') { break }
+        p.i++
+    }
+    return p.s[start:p.i]
+}
+
+func (p *gvParser) number() error {
+    start := p.i
+    if c := p.peek(); c == '-' || c == '+' { p.i++ }
+    for p.i < len(p.s) {
+        c := p.s[p.i]
+        if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F' || c == 'x' || c == 'X' || c == '.' || c == '+' || c == '-') { break }
+        p.i++
+    }
+    if p.i == start || strings.Trim(p.s[start:p.i], "+-.") == "" { return p.errf("bad number") }
+    return nil
+}
+
+// str consumes a '...' or "..." literal and checks its escapes.
+func (p *gvParser) str() error {
+    q := p.s[p.i]
+    p.i++
+    for p.i < len(p.s) {
+        c := p.s[p.i]
+        switch {
+        case c == q:
+            p.i++
+            return nil
+        case c == '\\':
+            p.i++
+            if p.i >= len(p.s) { return p.errf("dangling backslash") }
+            switch e := p.s[p.i]; e {
+            case '\\', '\'', '"', 'a', 'b', 'f', 'n', 'r', 't', 'v':
+                p.i++
+            case 'u', 'U':
+                n := 4
+                if e == 'U' { n = 8 }
+                p.i++
+                if p.i+n > len(p.s) || !isHex(p.s[p.i:p.i+n]) { return p.errf("bad \\%c escape, want %d hex digits", e, n) }
+                p.i += n
+            default:
+                return p.errf("bad escape \\%c", e)
+            }
+        default:
+            p.i++
+        }
+    }
+    return p.errf("unterminated string")
+}
+
+// list consumes [a, b], (a, b) or {k: v, ...}/{k, v}; dict entries allow ':'.
+func (p *gvParser) list(open, close byte, dict bool) error {
+    p.i++
+    p.ws()
+    if p.peek() == close { p.i++; return nil }
+    for {
+        if err := p.value(); err != nil { return err }
+        p.ws()
+        switch c := p.peek(); {
+        case c == ',' || (dict && c == ':'):
+            p.i++
+            p.ws()
+            if p.peek() == close && open == '(' { p.i++; return nil } // 1-tuple "(a,)"
+        case c == close:
+            p.i++
+            return nil
+        case c == 0:
+            return p.errf("unclosed %q", string(open))
+        default:
+            return p.errf("unexpected %q in %q...%q", string(c), string(open), string(close))
+        }
+    }
+}
+
+func isHex(s string) bool {
+    for _, c := range s {
+        if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F') { return false }
+    }
+    return true
+}
@@ -0,0 +1,54 @@
+package dconf
+
+import (
+    "strings"
+    "testing"
+
+    "github.com/lgpo-org/lgpod/pkg/selector"
+)
+
+func TestCheckGVariant(t *testing.T) {
+    valid := []string{
+        "true", "false", "nothing",
+        "300", "-1", "+2.5", "1e10", "0x1F", ".5",
+        "uint32 300", "int64 -7", "string 'x'", "just 'x'",
+        "'plain'", `"double"`, `'it\'s'`, `'tab\tnew\nline'`, `'é'`, `'\U0001F600'`, "b'bytes'",
+        "[]", "['a', 'b']", "[1, 2, 3]", "@as []", "@a{sv} {}",
+        "(1, 'a')", "(1,)", "{'k': 'v', 'n': <1>}", "{'k', 'v'}",
+        "<'variant'>", "<<1>>", "  [ 'spaced' ]  ",
+        "[('xkb', 'us'), ('xkb', 'de')]",
+    }
+    for _, s := range valid {
+        if err := CheckGVariant(s); err != nil { t.Errorf("CheckGVariant(%q) = %v", s, err) }
+    }
+    invalid := []struct {
+        in, wantErr string
+    }{
+        {"", "missing value"},
+        {"plain", `unknown word "plain"`},
+        {"'open", "unterminated string"},
+        {`'bad \q'`, `bad escape \q`},
+        {`'\u12'`, `bad \u escape`},
+        {`'trailing\`, "dangling backslash"},
+        {"['a', 'b'", `unclosed "["`},
+        {"['a' 'b']", `unexpected "'"`},
+        {"<1", "unclosed variant"},
+        {"@ 'x'", "missing type after '@'"},
+        {"'a' 'b'", `unexpected "'b'"`},
+        {"-", "bad number"},
+        {"uint32", "missing value"},
+        {"#", `unexpected "#"`},
+    }
+    for _, tc := range invalid {
+        err := CheckGVariant(tc.in)
+        if err == nil || !strings.Contains(err.Error(), tc.wantErr) { t.Errorf("CheckGVariant(%q) = %v, want %q", tc.in, err, tc.wantErr) }
+    }
+}
+
+func TestRenderRejectsBadGVariant(t *testing.T) {
+    p := screensaverPolicy()
+    p.Spec.Settings["org/gnome/desktop/screensaver"]["picture-uri"] = "file:///usr/share/bg.png"
+    if _, _, _, _, err := Render(p, selector.NewContext(nil, nil)); err == nil || !strings.Contains(err.Error(), "org/gnome/desktop/screensaver/picture-uri: gvariant") {
+        t.Errorf("err = %v, want a gvariant error for picture-uri", err)
+    }
+}
@@ -0,0 +1,63 @@
+package dconf
+
+import (
+    "fmt"
+    "regexp"
+    "strings"
+
+    "github.com/lgpo-org/lgpod/pkg/selector"
+)
+
+var reInterp = regexp.MustCompile(`\$\{([^}]*)\}`)
+
+// interpolate resolves ${fact.<key>} and ${tag.<key>} in a setting value.
+// Substitutions are escaped for use inside a GVariant string literal;
+// multi-valued tags are joined with ",". Unknown keys are an error.
+func interpolate(v string, ctx selector.Context) (string, error) {
+    return expand(v, ctx, gvariantEscape)
+}
+
+// expand is interpolate with esc applied to each substitution.
+func expand(v string, ctx selector.Context, esc func(string) string) (string, error) {
+    var firstErr error
+    out := reInterp.ReplaceAllStringFunc(v, func(m string) string {
+        val, err := lookup(m[2:len(m)-1], ctx)
+        if err != nil {
+            if firstErr == nil { firstErr = err }
+            return m
+        }
+        return esc(val)
+    })
+    return out, firstErr
+}
+
+func lookup(ref string, ctx selector.Context) (string, error) {
+    switch {
+    case strings.HasPrefix(ref, "fact."):
+        if v, ok := ctx.Facts[strings.TrimPrefix(ref, "fact.")]; ok { return v, nil }
+    case strings.HasPrefix(ref, "tag."):
+        if v, ok := ctx.Tags[strings.TrimPrefix(ref, "tag.")]; ok { return strings.Join(v, ","), nil }
+    default:
+        return "", fmt.Errorf("bad interpolation ${%s}: want ${fact.<key>} or ${tag.<key>}", ref)
+    }
+    return "", fmt.Errorf("unknown interpolation key ${%s}", ref)
+}
+
+func gvariantEscape(s string) string {
+    var b strings.Builder
+    for _, r := range s {
+        switch r {
+        case '\\', '\'', '"':
+            b.WriteByte('\\')
+            b.WriteRune(r)
+        case '\n':
+            b.WriteString(`\n`)
+        case '\t':
+            b.WriteString(`\t`)
+        default:
+            if r < 32 { continue }
+            b.WriteRune(r)
+        }
+    }
+    return b.String()
+}
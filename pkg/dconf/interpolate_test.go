@@ -0,0 +1,63 @@
+package dconf
+
+import (
+    "strings"
+    "testing"
+
+    "github.com/lgpo-org/lgpod/pkg/selector"
+)
+
+func TestInterpolate(t *testing.T) {
+    ctx := selector.NewContext(
+        map[string]string{"hostname": "lab-01", "owner": `O'Brien "Bob"`, "motd": "line1\nline2\tend\x01"},
+        map[string][]string{"asset": {"A-17"}, "roles": {"web", "cache"}, "empty": {}},
+    )
+    tests := []struct {
+        name    string
+        in      string
+        want    string
+        wantErr string
+    }{
+        {"no references", "'plain'", "'plain'", ""},
+        {"fact", "'host ${fact.hostname}'", "'host lab-01'", ""},
+        {"tag", "'asset ${tag.asset} on ${fact.hostname}'", "'asset A-17 on lab-01'", ""},
+        {"multi-valued tag joined", "'${tag.roles}'", "'web,cache'", ""},
+        {"empty tag", "'[${tag.empty}]'", "'[]'", ""},
+        {"quotes escaped", "'${fact.owner}'", `'O\'Brien \"Bob\"'`, ""},
+        {"control characters", "'${fact.motd}'", `'line1\nline2\tend'`, ""},
+        {"unknown fact", "'${fact.nope}'", "", "unknown interpolation key ${fact.nope}"},
+        {"unknown tag", "'${tag.nope}'", "", "unknown interpolation key ${tag.nope}"},
+        {"bad namespace", "'${env.HOME}'", "", "bad interpolation ${env.HOME}"},
+        {"first error reported", "'${tag.a} ${fact.b}'", "", "${tag.a}"},
+    }
+    for _, tc := range tests {
+        t.Run(tc.name, func(t *testing.T) {
+            got, err := interpolate(tc.in, ctx)
+            if tc.wantErr != "" {
+                if err == nil || !strings.Contains(err.Error(), tc.wantErr) { t.Fatalf("err = %v, want %q", err, tc.wantErr) }
+                return
+            }
+            if err != nil { t.Fatal(err) }
+            if got != tc.want { t.Errorf("interpolate(%q) = %q, want %q", tc.in, got, tc.want) }
+        })
+    }
+}
+
+func TestRenderInterpolation(t *testing.T) {
+    p := &Policy{Kind: "DconfPolicy"}
+    p.Metadata.Name = "banner"
+    p.Spec.Settings = map[string]map[string]any{
+        "org/gnome/login-screen": {"banner-message-text": "'Asset ${tag.asset} (${fact.hostname})'"},
+    }
+    ctx := selector.NewContext(map[string]string{"hostname": "lab-01"}, map[string][]string{"asset": {"A'17"}})
+    settings, _, _, _, err := Render(p, ctx)
+    if err != nil { t.Fatal(err) }
+    if want := "[org/gnome/login-screen]\nbanner-message-text='Asset A\\'17 (lab-01)'\n\n"; string(settings) != want {
+        t.Errorf("settings =\n%s\nwant\n%s", settings, want)
+    }
+    // an unknown key fails the policy instead of writing the literal
+    p.Spec.Settings["org/gnome/login-screen"]["banner-message-text"] = "'${tag.missing}'"
+    if _, _, _, _, err := Render(p, ctx); err == nil || !strings.Contains(err.Error(), "org/gnome/login-screen/banner-message-text: unknown interpolation key") {
+        t.Errorf("err = %v, want the unknown key", err)
+    }
+}
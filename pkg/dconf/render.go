@@ -6,9 +6,14 @@ import (
     "encoding/hex"
     "fmt"
     "sort"
+    "strings"
+
+    "github.com/lgpo-org/lgpod/pkg/selector"
 )
 
-func Render(p *Policy) (settings []byte, locks []byte, sumSettings string, sumLocks string, err error) {
+// Render emits the keyfile and locks for p; ${fact.*}/${tag.*} references in
+// setting values are resolved against ctx.
+func Render(p *Policy, ctx selector.Context) (settings []byte, locks []byte, sumSettings string, sumLocks string, err error) {
     if err = p.Validate(); err != nil { return }
     var sb bytes.Buffer
     keys := make([]string,0,len(p.Spec.Settings))
@@ -21,7 +26,10 @@ func Render(p *Policy) (settings []byte, locks []byte, sumSettings string, sumLo
         for k := range inner { ikeys = append(ikeys,k) }
         sort.Strings(ikeys)
         for _, k := range ikeys {
-            fmt.Fprintf(&sb, "%s=%s\n", k, inner[k])
+            v, ierr := settingValue(inner[k], ctx)
+            if ierr != nil { err = fmt.Errorf("%s/%s: %w", group, k, ierr); return }
+            if ierr = CheckGVariant(v); ierr != nil { err = fmt.Errorf("%s/%s: %w", group, k, ierr); return }
+            fmt.Fprintf(&sb, "%s=%s\n", k, v)
         }
         sb.WriteString("\n")
     }
@@ -30,10 +38,8 @@ func Render(p *Policy) (settings []byte, locks []byte, sumSettings string, sumLo
     sumSettings = hex.EncodeToString(ssum[:])
 
     var lb bytes.Buffer
-    if len(p.Spec.Locks) > 0 {
-        for _, l := range p.Spec.Locks {
-            fmt.Fprintln(&lb, l)
-        }
+    for _, l := range append(append([]string{}, p.Spec.Locks...), p.Spec.UnsetLocks...) {
+        fmt.Fprintln(&lb, l)
     }
     locks = lb.Bytes()
     lsum := sha256.Sum256(locks)
@@ -41,6 +47,24 @@ func Render(p *Policy) (settings []byte, locks []byte, sumSettings string, sumLo
     return
 }
 
-func TargetPaths(name string) (settingsPath, locksPath string) {
-    return "/etc/dconf/db/local.d/60-lgpo-" + name, "/etc/dconf/db/local.d/locks/60-lgpo-" + name
+// Unlock drops the lines of a locks file that lock one of keys, and reports
+// which keys it dropped.
+func Unlock(locks []byte, keys map[string]bool) ([]byte, []string) {
+    var out bytes.Buffer
+    var dropped []string
+    for _, l := range strings.SplitAfter(string(locks), "\n") {
+        if k := strings.TrimSpace(l); keys[k] {
+            dropped = append(dropped, k)
+            continue
+        }
+        out.WriteString(l)
+    }
+    return out.Bytes(), dropped
+}
+
+// DbDir is the keyfile dir of system db db, e.g. /etc/dconf/db/local.d.
+func DbDir(db string) string { return "/etc/dconf/db/" + db + ".d" }
+
+func TargetPaths(db, name string) (settingsPath, locksPath string) {
+    return DbDir(db) + "/60-lgpo-" + name, DbDir(db) + "/locks/60-lgpo-" + name
 }
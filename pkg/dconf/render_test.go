@@ -0,0 +1,79 @@
+package dconf
+
+import (
+    "strings"
+    "testing"
+
+    "github.com/lgpo-org/lgpod/pkg/selector"
+)
+
+func screensaverPolicy() *Policy {
+    p := &Policy{Kind: "DconfPolicy"}
+    p.Metadata.Name = "screensaver"
+    p.Spec.Settings = map[string]map[string]any{
+        "org/gnome/desktop/screensaver": {"lock-enabled": true, "lock-delay": "uint32 0"},
+    }
+    return p
+}
+
+func TestRenderLocks(t *testing.T) {
+    p := screensaverPolicy()
+    p.Spec.Locks = []string{"/org/gnome/desktop/screensaver/lock-enabled", "/org/gnome/desktop/screensaver/lock-delay"}
+    p.Spec.UnsetLocks = []string{"/org/gnome/desktop/session/idle-delay"}
+    settings, locks, sumSettings, sumLocks, err := Render(p, selector.NewContext(nil, nil))
+    if err != nil { t.Fatal(err) }
+    if want := "[org/gnome/desktop/screensaver]\nlock-delay=uint32 0\nlock-enabled=true\n\n"; string(settings) != want {
+        t.Errorf("settings =\n%s\nwant\n%s", settings, want)
+    }
+    if want := "/org/gnome/desktop/screensaver/lock-enabled\n/org/gnome/desktop/screensaver/lock-delay\n/org/gnome/desktop/session/idle-delay\n"; string(locks) != want {
+        t.Errorf("locks =\n%s\nwant\n%s", locks, want)
+    }
+    if len(sumSettings) != 64 || len(sumLocks) != 64 || sumSettings == sumLocks { t.Errorf("sums %q %q", sumSettings, sumLocks) }
+}
+
+func TestValidateLocks(t *testing.T) {
+    tests := []struct {
+        name    string
+        edit    func(p *Policy)
+        wantErr string
+    }{
+        {"locked setting", func(p *Policy) { p.Spec.Locks = []string{"/org/gnome/desktop/screensaver/lock-enabled"} }, ""},
+        {"unset lock", func(p *Policy) { p.Spec.UnsetLocks = []string{"/org/gnome/desktop/session/idle-delay"} }, ""},
+        {"locks only", func(p *Policy) { p.Spec.Settings = nil; p.Spec.UnsetLocks = []string{"/org/gnome/desktop/session/idle-delay"} }, ""},
+        {"lock without setting", func(p *Policy) { p.Spec.Locks = []string{"/org/gnome/desktop/session/idle-delay"} }, "move it to unsetLocks"},
+        {"relative lock", func(p *Policy) { p.Spec.UnsetLocks = []string{"org/gnome/desktop/session/idle-delay"} }, "must be a key path"},
+        {"lock on a dir", func(p *Policy) { p.Spec.UnsetLocks = []string{"/org/gnome/desktop/session/"} }, "must be a key path"},
+        {"unlock of an own lock", func(p *Policy) {
+            p.Spec.UnsetLocks = []string{"/org/gnome/desktop/session/idle-delay"}
+            p.Spec.Unlock = []string{"/org/gnome/desktop/session/idle-delay"}
+        }, "also locked by this policy"},
+        {"unlock only", func(p *Policy) { p.Spec.Settings = nil; p.Spec.Unlock = []string{"/org/gnome/desktop/session/idle-delay"} }, ""},
+        {"relative unlock", func(p *Policy) { p.Spec.Unlock = []string{"org/gnome/desktop/session/idle-delay"} }, "must be a key path"},
+        {"nothing at all", func(p *Policy) { p.Spec.Settings = nil }, "need settings, locks and/or unlock"},
+    }
+    for _, tc := range tests {
+        t.Run(tc.name, func(t *testing.T) {
+            p := screensaverPolicy()
+            tc.edit(p)
+            err := p.Validate()
+            if tc.wantErr == "" {
+                if err != nil { t.Fatal(err) }
+                return
+            }
+            if err == nil || !strings.Contains(err.Error(), tc.wantErr) { t.Errorf("err = %v, want %q", err, tc.wantErr) }
+        })
+    }
+}
+
+func TestUnlock(t *testing.T) {
+    locks := "/org/gnome/desktop/screensaver/lock-enabled\n/org/gnome/desktop/session/idle-delay\n/org/gnome/desktop/screensaver/lock-delay"
+    keys := map[string]bool{"/org/gnome/desktop/session/idle-delay": true, "/org/gnome/desktop/screensaver/lock-delay": true, "/org/gnome/desktop/other": true}
+    out, dropped := Unlock([]byte(locks), keys)
+    if want := "/org/gnome/desktop/screensaver/lock-enabled\n"; string(out) != want { t.Errorf("locks =\n%s\nwant\n%s", out, want) }
+    if want := "/org/gnome/desktop/session/idle-delay,/org/gnome/desktop/screensaver/lock-delay"; strings.Join(dropped, ",") != want { t.Errorf("dropped = %v, want %s", dropped, want) }
+
+    // nothing to drop leaves the file as it was
+    if out, dropped := Unlock([]byte(locks), map[string]bool{"/org/gnome/desktop/other": true}); string(out) != locks || len(dropped) != 0 {
+        t.Errorf("Unlock = %q, %v, want the input unchanged", out, dropped)
+    }
+}
@@ -1,19 +1,24 @@
 package dconf
 
+import "github.com/lgpo-org/lgpod/pkg/selector"
+
 type Policy struct {
-    APIVersion string `yaml:"apiVersion"`
-    Kind       string `yaml:"kind"`
-    Metadata   Meta   `yaml:"metadata"`
-    Selector   Sel    `yaml:"selector"`
-    Spec       Spec   `yaml:"spec"`
+    APIVersion string       `yaml:"apiVersion"`
+    Kind       string       `yaml:"kind"`
+    Metadata   Meta         `yaml:"metadata"`
+    Selector   selector.Sel `yaml:"selector"`
+    Spec       Spec         `yaml:"spec"`
 }
 type Meta struct{ Name string `yaml:"name"` }
-type Sel struct {
-    Facts map[string]string `yaml:"facts"`
-    Tags  map[string]any    `yaml:"tags"`
-    HostnameRegex string    `yaml:"hostnameRegex"`
-}
 type Spec struct {
-    Settings map[string]map[string]string `yaml:"settings"`
+    // Settings values are GVariant text strings, numbers, booleans, or YAML
+    // lists and maps (see settingValue).
+    Settings map[string]map[string]any `yaml:"settings"`
     Locks    []string `yaml:"locks"`
+    // UnsetLocks are locked without a setting in this policy, pinning the
+    // schema default (or a value set by another policy) over user-db.
+    UnsetLocks []string `yaml:"unsetLocks"`
+    // Unlock keys are kept out of every lgpo locks file on the host, whatever
+    // other policies lock, so users can set them again.
+    Unlock []string `yaml:"unlock"`
 }
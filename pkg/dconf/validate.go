@@ -1,12 +1,55 @@
 package dconf
 
-import "fmt"
+import (
+    "fmt"
+    "regexp"
+    "strings"
+)
+
+// Keyfile-safe names: groups are dconf dirs without the leading slash
+// (org/gnome/desktop/session), keys a single path component.
+var (
+    reGroup = regexp.MustCompile(`^[A-Za-z0-9_.-]+(/[A-Za-z0-9_.-]+)*$`)
+    reKey   = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+)
 
 func (p *Policy) Validate() error {
     if p.Kind != "DconfPolicy" { return fmt.Errorf("kind must be DconfPolicy") }
     if p.Metadata.Name == "" { return fmt.Errorf("metadata.name required") }
-    if len(p.Spec.Settings) == 0 && len(p.Spec.Locks) == 0 {
-        return fmt.Errorf("need settings and/or locks")
+    if len(p.Spec.Settings) == 0 && len(p.Spec.Locks) == 0 && len(p.Spec.UnsetLocks) == 0 && len(p.Spec.Unlock) == 0 {
+        return fmt.Errorf("need settings, locks and/or unlock")
+    }
+    for group, kv := range p.Spec.Settings {
+        if !reGroup.MatchString(group) { return fmt.Errorf("settings group %q must be a dconf dir like org/gnome/desktop/session", group) }
+        for k, v := range kv {
+            if !reKey.MatchString(k) { return fmt.Errorf("settings %s: invalid key %q", group, k) }
+            if v == nil { return fmt.Errorf("settings %s/%s: empty value", group, k) }
+            s, ok := v.(string)
+            if !ok { continue }
+            if strings.TrimSpace(s) == "" { return fmt.Errorf("settings %s/%s: empty value", group, k) }
+            if strings.ContainsAny(s, "\r\n") { return fmt.Errorf("settings %s/%s: value must be a single line", group, k) }
+        }
+    }
+    locked := map[string]bool{}
+    for _, l := range append(append([]string{}, p.Spec.Locks...), p.Spec.UnsetLocks...) {
+        if !validKeyPath(l) { return fmt.Errorf("lock %q must be a key path like /org/gnome/desktop/screensaver/lock-enabled", l) }
+        locked[l] = true
+    }
+    for _, l := range p.Spec.Unlock {
+        if !validKeyPath(l) { return fmt.Errorf("unlock %q must be a key path like /org/gnome/desktop/screensaver/lock-enabled", l) }
+        if locked[l] { return fmt.Errorf("unlock %s is also locked by this policy", l) }
+    }
+    // A lock without a setting pins whatever the next-lower db or the schema
+    // says, which is rarely intended: require it to be listed as unsetLocks.
+    for _, l := range p.Spec.Locks {
+        i := strings.LastIndex(l, "/")
+        if _, ok := p.Spec.Settings[strings.TrimPrefix(l[:i], "/")][l[i+1:]]; !ok {
+            return fmt.Errorf("lock %s has no setting in this policy (move it to unsetLocks to lock the default)", l)
+        }
     }
     return nil
 }
+
+func validKeyPath(l string) bool {
+    return strings.HasPrefix(l, "/") && !strings.HasSuffix(l, "/") && !strings.Contains(l, "//")
+}
@@ -0,0 +1,41 @@
+package dconf
+
+import (
+    "strings"
+    "testing"
+)
+
+func TestValidateSettings(t *testing.T) {
+    tests := []struct {
+        name    string
+        group   string
+        key     string
+        value   any
+        wantErr string
+    }{
+        {"valid", "org/gnome/desktop/session", "idle-delay", "uint32 300", ""},
+        {"non-string values", "org/gnome/desktop/session", "idle-delay", 300, ""},
+        {"leading slash", "/org/gnome/desktop/session", "idle-delay", "uint32 300", "must be a dconf dir"},
+        {"section header", "[org/gnome/desktop/session]", "idle-delay", "uint32 300", "must be a dconf dir"},
+        {"trailing slash", "org/gnome/desktop/session/", "idle-delay", "uint32 300", "must be a dconf dir"},
+        {"empty group", "", "idle-delay", "uint32 300", "must be a dconf dir"},
+        {"key with a slash", "org/gnome/desktop", "session/idle-delay", "uint32 300", `invalid key "session/idle-delay"`},
+        {"key with =", "org/gnome/desktop/session", "idle-delay=1", "uint32 300", "invalid key"},
+        {"null value", "org/gnome/desktop/session", "idle-delay", nil, "empty value"},
+        {"blank value", "org/gnome/desktop/session", "idle-delay", "  ", "empty value"},
+        {"multi-line value", "org/gnome/desktop/session", "idle-delay", "uint32 300\n[evil]", "single line"},
+    }
+    for _, tc := range tests {
+        t.Run(tc.name, func(t *testing.T) {
+            p := &Policy{Kind: "DconfPolicy"}
+            p.Metadata.Name = "t"
+            p.Spec.Settings = map[string]map[string]any{tc.group: {tc.key: tc.value}}
+            err := p.Validate()
+            if tc.wantErr == "" {
+                if err != nil { t.Fatal(err) }
+                return
+            }
+            if err == nil || !strings.Contains(err.Error(), tc.wantErr) { t.Errorf("err = %v, want %q", err, tc.wantErr) }
+        })
+    }
+}
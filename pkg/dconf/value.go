@@ -0,0 +1,97 @@
+package dconf
+
+import (
+    "fmt"
+    "sort"
+    "strconv"
+    "strings"
+
+    "github.com/lgpo-org/lgpod/pkg/selector"
+)
+
+// settingValue turns a YAML setting value into GVariant text. A string is
+// GVariant text already ('quoted', uint32 300, ...) and only interpolated.
+// Lists and maps become arrays and string-keyed dicts whose strings are
+// quoted for the author: [a.desktop, b.desktop] -> ['a.desktop', 'b.desktop'].
+// Numbers and booleans are written as they are.
+func settingValue(v any, ctx selector.Context) (string, error) {
+    if s, ok := v.(string); ok { return interpolate(s, ctx) }
+    return gvLiteral(v, ctx)
+}
+
+// gvLiteral renders v where a string is data, not GVariant text.
+func gvLiteral(v any, ctx selector.Context) (string, error) {
+    switch x := v.(type) {
+    case string:
+        s, err := expand(x, ctx, func(s string) string { return s })
+        return "'" + gvariantEscape(s) + "'", err
+    case []any:
+        // An empty array needs a type; string arrays are by far the most common.
+        if len(x) == 0 { return "@as []", nil }
+        parts := make([]string, 0, len(x))
+        for i, e := range x {
+            if err := sameKind(x[0], e); err != nil { return "", fmt.Errorf("list item %d: %w", i, err) }
+            s, err := gvLiteral(e, ctx)
+            if err != nil { return "", err }
+            parts = append(parts, s)
+        }
+        return "[" + strings.Join(parts, ", ") + "]", nil
+    case map[string]any:
+        if len(x) == 0 { return "@a{ss} {}", nil }
+        keys := make([]string, 0, len(x))
+        for k := range x { keys = append(keys, k) }
+        sort.Strings(keys)
+        parts := make([]string, 0, len(x))
+        for _, k := range keys {
+            if err := sameKind(x[keys[0]], x[k]); err != nil { return "", fmt.Errorf("map key %q: %w", k, err) }
+            s, err := gvLiteral(x[k], ctx)
+            if err != nil { return "", err }
+            parts = append(parts, "'"+gvariantEscape(k)+"': "+s)
+        }
+        return "{" + strings.Join(parts, ", ") + "}", nil
+    case map[any]any:
+        return "", fmt.Errorf("map keys must be strings")
+    case bool:
+        return strconv.FormatBool(x), nil
+    case int:
+        return strconv.Itoa(x), nil
+    case int64:
+        return strconv.FormatInt(x, 10), nil
+    case uint64:
+        return strconv.FormatUint(x, 10), nil
+    case float64:
+        s := strconv.FormatFloat(x, 'g', -1, 64)
+        if strings.ContainsAny(s, "IN") { return "", fmt.Errorf("%v is not a GVariant number", x) }
+        // Without a '.' or exponent GVariant would read 2.0 as an int32.
+        if !strings.ContainsAny(s, ".e") { s += ".0" }
+        return s, nil
+    case nil:
+        return "", fmt.Errorf("empty value")
+    }
+    return "", fmt.Errorf("unsupported value %v (%T)", v, v)
+}
+
+// sameKind rejects mixing item types in one array or dict: GVariant arrays
+// and dicts hold a single element type.
+func sameKind(first, v any) error {
+    if kind(first) != kind(v) { return fmt.Errorf("%s among %s items; items must all be one type", kind(v), kind(first)) }
+    return nil
+}
+
+func kind(v any) string {
+    switch v.(type) {
+    case string:
+        return "string"
+    case bool:
+        return "boolean"
+    case int, int64, uint64:
+        return "integer"
+    case float64:
+        return "number"
+    case []any:
+        return "list"
+    case map[string]any, map[any]any:
+        return "map"
+    }
+    return fmt.Sprintf("%T", v)
+}
@@ -0,0 +1,60 @@
+package dconf
+
+import (
+    "strings"
+    "testing"
+
+    "github.com/lgpo-org/lgpod/pkg/selector"
+    "gopkg.in/yaml.v3"
+)
+
+func TestSettingValue(t *testing.T) {
+    ctx := selector.NewContext(map[string]string{"hostname": "lab-01"}, map[string][]string{"site": {"hq"}})
+    tests := []struct {
+        name    string
+        y       string // the YAML value of one setting
+        want    string
+        wantErr string
+    }{
+        {"gvariant text", "uint32 300", "uint32 300", ""},
+        {"string list", "[firefox.desktop, code.desktop]", "['firefox.desktop', 'code.desktop']", ""},
+        {"quoted item", `["it's", 'say "hi"']`, `['it\'s', 'say \"hi\"']`, ""},
+        {"interpolated item", "['${fact.hostname}', 'site-${tag.site}']", "['lab-01', 'site-hq']", ""},
+        {"numbers", "[1, 2, 3]", "[1, 2, 3]", ""},
+        {"float stays a double", "[2.0, 2.5]", "[2.0, 2.5]", ""},
+        {"booleans", "[true, false]", "[true, false]", ""},
+        {"nested", "[[a, b], [c]]", "[['a', 'b'], ['c']]", ""},
+        {"map sorted by key", "{b: 2, a: 1}", "{'a': 1, 'b': 2}", ""},
+        {"map of lists", "{web: [a], db: []}", "{'db': @as [], 'web': ['a']}", ""},
+        {"empty list", "[]", "@as []", ""},
+        {"empty map", "{}", "@a{ss} {}", ""},
+        {"mixed list", "[a, 1]", "", "list item 1: integer among string items"},
+        {"mixed map", "{a: x, b: true}", "", `map key "b": boolean among string items`},
+        {"non-string map keys", "{1: a}", "", "map keys must be strings"},
+        {"null item", "[~]", "", "empty value"},
+        {"unknown reference", "['${fact.nope}']", "", "${fact.nope}"},
+    }
+    for _, tc := range tests {
+        t.Run(tc.name, func(t *testing.T) {
+            var v any
+            if err := yaml.Unmarshal([]byte(tc.y), &v); err != nil { t.Fatal(err) }
+            got, err := settingValue(v, ctx)
+            if tc.wantErr != "" {
+                if err == nil || !strings.Contains(err.Error(), tc.wantErr) { t.Fatalf("settingValue = %q, %v; want error %q", got, err, tc.wantErr) }
+                return
+            }
+            if err != nil { t.Fatal(err) }
+            if got != tc.want { t.Errorf("settingValue = %s, want %s", got, tc.want) }
+        })
+    }
+}
+
+func TestRenderListSetting(t *testing.T) {
+    var p Policy
+    y := "kind: DconfPolicy\nmetadata: {name: apps}\nspec:\n  settings:\n    org/gnome/shell:\n      favorite-apps: [firefox.desktop, code.desktop]\n"
+    if err := yaml.Unmarshal([]byte(y), &p); err != nil { t.Fatal(err) }
+    if err := p.Validate(); err != nil { t.Fatal(err) }
+    settings, _, _, _, err := Render(&p, selector.NewContext(nil, nil))
+    if err != nil { t.Fatal(err) }
+    if want := "[org/gnome/shell]\nfavorite-apps=['firefox.desktop', 'code.desktop']\n\n"; string(settings) != want { t.Errorf("settings =\n%s\nwant\n%s", settings, want) }
+}
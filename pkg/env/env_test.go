@@ -0,0 +1,63 @@
+package env
+
+import (
+	"strings"
+	"testing"
+)
+
+func envPolicy(vars map[string]string) *Policy {
+	return &Policy{Kind: "EnvPolicy", Metadata: Meta{Name: "proxy"}, Spec: Spec{Vars: vars}}
+}
+
+func TestRender(t *testing.T) {
+	got, err := Render(envPolicy(map[string]string{
+		"https_proxy": "http://proxy:3128",
+		"PS1":         `\u@\h $PWD "x"`,
+		"EMPTY":       "",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "# generated by lgpo (env) for policy proxy\n" +
+		"EMPTY=\"\"\n" +
+		`PS1="\\u@\\h \$PWD \"x\""` + "\n" +
+		"https_proxy=\"http://proxy:3128\"\n"
+	if string(got) != want {
+		t.Errorf("Render =\n%s\nwant\n%s", got, want)
+	}
+	if TargetPath("proxy") != "/etc/environment.d/60-lgpo-proxy.conf" {
+		t.Errorf("TargetPath = %s", TargetPath("proxy"))
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		key, value string
+		wantErr    string
+	}{
+		{"EDITOR", "vim", ""},
+		{"_private", "1", ""},
+		{"LD_PRELOAD", "/tmp/x.so", "LD_PRELOAD is not allowed"},
+		{"LD_LIBRARY_PATH", "/opt/lib", "not allowed"},
+		{"1ST", "x", "invalid variable name"},
+		{"MY-VAR", "x", "invalid variable name"},
+		{"MOTD", "line1\nline2", "control characters"},
+		{"BELL", "\a", "control characters"},
+		{"DEL", "x\x7f", "control characters"},
+	}
+	for _, tc := range tests {
+		err := envPolicy(map[string]string{tc.key: tc.value}).Validate()
+		if tc.wantErr == "" {
+			if err != nil {
+				t.Errorf("%s: %v", tc.key, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+			t.Errorf("%s: err = %v, want %q", tc.key, err, tc.wantErr)
+		}
+	}
+	if err := envPolicy(nil).Validate(); err == nil {
+		t.Error("no vars validated")
+	}
+}
@@ -0,0 +1,36 @@
+// pkg/env/render.go
+package env
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Render returns the environment.d file for p with variables sorted by name.
+// Values are double-quoted with \, " and $ escaped, so they are taken
+// literally rather than expanded.
+func Render(p *Policy) ([]byte, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(p.Spec.Vars))
+	for k := range p.Spec.Vars {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	out := &bytes.Buffer{}
+	fmt.Fprintf(out, "# generated by lgpo (env) for policy %s\n", p.Metadata.Name)
+	for _, k := range keys {
+		fmt.Fprintf(out, "%s=%s\n", k, quote(p.Spec.Vars[k]))
+	}
+	return out.Bytes(), nil
+}
+
+var quoter = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `$`, `\$`)
+
+func quote(v string) string {
+	return `"` + quoter.Replace(v) + `"`
+}
@@ -0,0 +1,27 @@
+// pkg/env/types.go
+package env
+
+import (
+	"github.com/lgpo-org/lgpod/pkg/selector"
+)
+
+type Policy struct {
+	APIVersion string       `yaml:"apiVersion"`
+	Kind       string       `yaml:"kind"`
+	Metadata   Meta         `yaml:"metadata"`
+	Selector   selector.Sel `yaml:"selector"`
+	Spec       Spec         `yaml:"spec"`
+}
+
+type Meta struct {
+	Name string `yaml:"name"`
+}
+
+type Spec struct {
+	Vars map[string]string `yaml:"vars"`
+}
+
+// TargetPath returns the rendered file path for this policy.
+func TargetPath(name string) string {
+	return "/etc/environment.d/60-lgpo-" + name + ".conf"
+}
@@ -0,0 +1,41 @@
+package env
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	nameRe = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+	varRe  = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+// Validate checks variable names and rejects values environment.d cannot
+// hold on one line. LD_* variables are refused: set fleet-wide they would
+// inject libraries into every user process.
+func (p *Policy) Validate() error {
+	if p.Kind != "EnvPolicy" {
+		return fmt.Errorf("kind must be EnvPolicy")
+	}
+	if !nameRe.MatchString(p.Metadata.Name) {
+		return fmt.Errorf("invalid metadata.name %q", p.Metadata.Name)
+	}
+	if len(p.Spec.Vars) == 0 {
+		return fmt.Errorf("spec.vars must be non-empty")
+	}
+	for k, v := range p.Spec.Vars {
+		if !varRe.MatchString(k) {
+			return fmt.Errorf("invalid variable name %q", k)
+		}
+		if strings.HasPrefix(k, "LD_") {
+			return fmt.Errorf("variable %s is not allowed", k)
+		}
+		for _, r := range v {
+			if r < 0x20 || r == 0x7f {
+				return fmt.Errorf("%s: value must not contain control characters", k)
+			}
+		}
+	}
+	return nil
+}
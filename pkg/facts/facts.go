@@ -1,28 +1,132 @@
 package facts
 
 import (
+    "bytes"
+    "context"
     "os"
     "os/exec"
+    "path/filepath"
+    "sort"
     "strings"
+    "time"
 )
 
-func Discover() map[string]string {
-    f := map[string]string{}
+// Limits bound the commands run during discovery: a hung or chatty command
+// is killed/truncated instead of wedging Discover.
+type Limits struct {
+    CommandTimeout time.Duration
+    MaxOutput      int
+}
+
+// DefaultLimits are the limits Discover uses for zero fields.
+var DefaultLimits = Limits{CommandTimeout: 5 * time.Second, MaxOutput: 64 << 10}
+
+// Discover detects the built-in facts. truncated names the facts whose
+// command output was cut at l.MaxOutput, so their values may be incomplete.
+func Discover(l Limits) (f map[string]string, truncated []string) {
+    if l.CommandTimeout <= 0 { l.CommandTimeout = DefaultLimits.CommandTimeout }
+    if l.MaxOutput <= 0 { l.MaxOutput = DefaultLimits.MaxOutput }
+    f = map[string]string{}
     h, _ := os.Hostname()
     f["hostname"] = h
-    f["os.id"] = osRelease("ID")
-    f["os.version"] = osRelease("VERSION_ID")
+    for key, v := range map[string]string{"os.id": "ID", "os.version": "VERSION_ID"} {
+        val, cut := osRelease(l, v)
+        f[key] = val
+        if cut { truncated = append(truncated, key) }
+    }
+    sort.Strings(truncated)
     if _, err := os.Stat("/usr/bin/gnome-shell"); err == nil {
         f["has_gnome"] = "true"
     } else {
         f["has_gnome"] = "false"
     }
-    return f
+    f["desktop"] = detectDesktop(os.Getenv("XDG_CURRENT_DESKTOP"), fileExists)
+    f["firmware"], f["secureboot"] = detectFirmware("/sys")
+    return f, truncated
+}
+
+// secureBootVar is the EFI global variable holding the SecureBoot state.
+const secureBootVar = "firmware/efi/efivars/SecureBoot-8be4df61-93ca-11d2-aa0d-00e098032b8c"
+
+// detectFirmware reports "uefi" or "bios" from sysfs rooted at sys, and
+// whether Secure Boot is "enabled" or "disabled" (also on BIOS, or when the
+// variable is unreadable).
+func detectFirmware(sys string) (firmware, secureboot string) {
+    if !fileExists(filepath.Join(sys, "firmware/efi")) { return "bios", "disabled" }
+    // efivarfs content: 4 bytes of attributes, then the 1-byte value
+    b, err := os.ReadFile(filepath.Join(sys, secureBootVar))
+    if err == nil && len(b) >= 5 && b[4] == 1 { return "uefi", "enabled" }
+    return "uefi", "disabled"
+}
+
+// desktops lists the `desktop` fact values in detection order, each with the
+// session binary that marks it as installed.
+var desktops = []struct{ name, bin string }{
+    {"gnome", "/usr/bin/gnome-shell"},
+    {"kde", "/usr/bin/plasmashell"},
+    {"xfce", "/usr/bin/xfce4-session"},
+    {"cinnamon", "/usr/bin/cinnamon-session"},
+    {"mate", "/usr/bin/mate-session"},
+    {"lxqt", "/usr/bin/lxqt-session"},
+}
+
+// detectDesktop prefers $XDG_CURRENT_DESKTOP (colon-separated, e.g.
+// "ubuntu:GNOME" or "X-Cinnamon") and falls back to installed session
+// binaries; "none" if neither names a known desktop.
+func detectDesktop(xdg string, exists func(path string) bool) string {
+    for _, d := range strings.Split(xdg, ":") {
+        d = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(d)), "x-")
+        for _, k := range desktops {
+            if d == k.name { return d }
+        }
+    }
+    for _, k := range desktops {
+        if exists(k.bin) { return k.name }
+    }
+    return "none"
+}
+
+func fileExists(path string) bool {
+    _, err := os.Stat(path)
+    return err == nil
+}
+
+func osRelease(l Limits, key string) (string, bool) {
+    out, cut, err := runLimited(l, "bash", "-lc", "source /etc/os-release && echo -n ${"+key+"}")
+    if err != nil { return "", false }
+    return strings.TrimSpace(string(out)), cut
 }
 
-func osRelease(key string) string {
-    cmd := exec.Command("bash", "-lc", "source /etc/os-release && echo -n ${"+key+"}")
-    out, err := cmd.CombinedOutput()
-    if err != nil { return "" }
-    return strings.TrimSpace(string(out))
+// runLimited runs name with l.CommandTimeout and keeps at most l.MaxOutput
+// bytes of its combined output; cut reports whether any were dropped.
+func runLimited(l Limits, name string, args ...string) (out []byte, cut bool, err error) {
+    ctx, cancel := context.WithTimeout(context.Background(), l.CommandTimeout)
+    defer cancel()
+    var buf capWriter
+    buf.max = l.MaxOutput
+    cmd := exec.CommandContext(ctx, name, args...)
+    cmd.Stdout, cmd.Stderr = &buf, &buf
+    cmd.WaitDelay = time.Second
+    if err := cmd.Run(); err != nil { return nil, false, err }
+    return buf.Bytes(), buf.dropped, nil
 }
+
+// capWriter keeps the first max bytes and drops the rest, noting that it did.
+// The buffer is a field, not embedded, so io.Copy cannot bypass Write through
+// bytes.Buffer's ReadFrom.
+type capWriter struct {
+    buf     bytes.Buffer
+    max     int
+    dropped bool
+}
+
+func (w *capWriter) Write(p []byte) (int, error) {
+    n := len(p)
+    room := w.max - w.buf.Len()
+    if room < 0 { room = 0 }
+    if n > room { w.dropped = true; p = p[:room] }
+    w.buf.Write(p)
+    return n, nil
+}
+
+func (w *capWriter) Bytes() []byte { return w.buf.Bytes() }
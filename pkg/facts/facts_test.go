@@ -0,0 +1,90 @@
+package facts
+
+import (
+    "os"
+    "path/filepath"
+    "testing"
+    "time"
+)
+
+func TestRunLimited(t *testing.T) {
+    tests := []struct {
+        name    string
+        l       Limits
+        script  string
+        want    string
+        wantCut bool
+        wantErr bool
+    }{
+        {"fits", Limits{time.Second, 16}, "printf abc", "abc", false, false},
+        {"exactly max", Limits{time.Second, 3}, "printf abc", "abc", false, false},
+        {"truncated", Limits{time.Second, 4}, "printf abcdefgh", "abcd", true, false},
+        {"truncated across writes", Limits{time.Second, 4}, "printf ab; printf cd; printf ef", "abcd", true, false},
+        {"timeout", Limits{100 * time.Millisecond, 16}, "sleep 5", "", false, true},
+    }
+    for _, tc := range tests {
+        t.Run(tc.name, func(t *testing.T) {
+            out, cut, err := runLimited(tc.l, "sh", "-c", tc.script)
+            if (err != nil) != tc.wantErr { t.Fatalf("err = %v, want error %v", err, tc.wantErr) }
+            if string(out) != tc.want || cut != tc.wantCut {
+                t.Errorf("got %q (cut %v), want %q (cut %v)", out, cut, tc.want, tc.wantCut)
+            }
+        })
+    }
+}
+
+func TestDetectDesktop(t *testing.T) {
+    tests := []struct {
+        xdg       string
+        installed []string
+        want      string
+    }{
+        {"GNOME", nil, "gnome"},
+        {"ubuntu:GNOME", nil, "gnome"},
+        {"X-Cinnamon", nil, "cinnamon"},
+        {"KDE", []string{"/usr/bin/gnome-shell"}, "kde"},
+        {" xfce ", nil, "xfce"},
+        {"", []string{"/usr/bin/mate-session"}, "mate"},
+        {"sway", []string{"/usr/bin/lxqt-session", "/usr/bin/plasmashell"}, "kde"}, // detection order, not install order
+        {"sway", nil, "none"},
+        {"", nil, "none"},
+    }
+    for _, tc := range tests {
+        exists := func(path string) bool {
+            for _, p := range tc.installed {
+                if p == path { return true }
+            }
+            return false
+        }
+        if got := detectDesktop(tc.xdg, exists); got != tc.want { t.Errorf("detectDesktop(%q, %v) = %q, want %q", tc.xdg, tc.installed, got, tc.want) }
+    }
+}
+
+func TestDetectFirmware(t *testing.T) {
+    tests := []struct {
+        name     string
+        efi      bool
+        efivar   []byte // SecureBoot variable; nil writes none
+        firmware string
+        sb       string
+    }{
+        {"bios", false, nil, "bios", "disabled"},
+        {"uefi without the variable", true, nil, "uefi", "disabled"},
+        {"secure boot on", true, []byte{0x06, 0, 0, 0, 1}, "uefi", "enabled"},
+        {"secure boot off", true, []byte{0x06, 0, 0, 0, 0}, "uefi", "disabled"},
+        {"truncated variable", true, []byte{0x06, 0, 0, 0}, "uefi", "disabled"},
+    }
+    for _, tc := range tests {
+        t.Run(tc.name, func(t *testing.T) {
+            sys := t.TempDir()
+            if tc.efi {
+                if err := os.MkdirAll(filepath.Join(sys, "firmware/efi/efivars"), 0o755); err != nil { t.Fatal(err) }
+            }
+            if tc.efivar != nil {
+                if err := os.WriteFile(filepath.Join(sys, secureBootVar), tc.efivar, 0o644); err != nil { t.Fatal(err) }
+            }
+            fw, sb := detectFirmware(sys)
+            if fw != tc.firmware || sb != tc.sb { t.Errorf("detectFirmware = %s, %s; want %s, %s", fw, sb, tc.firmware, tc.sb) }
+        })
+    }
+}
@@ -0,0 +1,51 @@
+package facts
+
+import (
+    "encoding/json"
+    "fmt"
+    "os"
+    "path/filepath"
+    "sort"
+    "strings"
+)
+
+// LoadStatic reads <dir>/*.json (each a flat JSON object) in lexical order;
+// later files win. Values may be strings, numbers or booleans. A missing dir
+// means no static facts. Unreadable or malformed files are returned as
+// errors and skipped.
+func LoadStatic(dir string) (map[string]string, []error) {
+    m := map[string]string{}
+    var errs []error
+    paths, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+    sort.Strings(paths)
+    for _, p := range paths {
+        b, err := os.ReadFile(p)
+        if err != nil { errs = append(errs, err); continue }
+        var raw map[string]any
+        if err := json.Unmarshal(b, &raw); err != nil { errs = append(errs, fmt.Errorf("%s: %v", p, err)); continue }
+        for k, v := range raw {
+            switch v.(type) {
+            case string, float64, bool:
+                m[k] = strings.TrimSpace(fmt.Sprint(v))
+            default:
+                errs = append(errs, fmt.Errorf("%s: fact %q must be a string, number or boolean", p, k))
+            }
+        }
+    }
+    return m, errs
+}
+
+// Merge adds static facts to the discovered ones. Keys that discovery already
+// provides are reserved: they are only overridden when allowReserved is set,
+// otherwise they are returned as rejected.
+func Merge(discovered, static map[string]string, allowReserved bool) (rejected []string) {
+    for k, v := range static {
+        if _, reserved := discovered[k]; reserved && !allowReserved {
+            rejected = append(rejected, k)
+            continue
+        }
+        discovered[k] = v
+    }
+    sort.Strings(rejected)
+    return rejected
+}
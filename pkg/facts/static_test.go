@@ -0,0 +1,43 @@
+package facts
+
+import (
+    "os"
+    "path/filepath"
+    "reflect"
+    "strings"
+    "testing"
+)
+
+func TestLoadStatic(t *testing.T) {
+    dir := t.TempDir()
+    files := map[string]string{
+        "10-site.json":   `{"site": "hq", "rack": 12, "kiosk": true, "room": " 2.01 "}`,
+        "20-local.json":  `{"site": "lab"}`,
+        "30-bad.json":    `{"site": `,
+        "40-nested.json": `{"owner": {"name": "ops"}, "floor": "3"}`,
+        "notes.txt":      `{"ignored": "yes"}`,
+    }
+    for name, content := range files {
+        if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil { t.Fatal(err) }
+    }
+    m, errs := LoadStatic(dir)
+    want := map[string]string{"site": "lab", "rack": "12", "kiosk": "true", "room": "2.01", "floor": "3"}
+    if !reflect.DeepEqual(m, want) { t.Errorf("facts = %v, want %v", m, want) }
+    if len(errs) != 2 || !strings.Contains(errs[0].Error(), "30-bad.json") || !strings.Contains(errs[1].Error(), `fact "owner"`) {
+        t.Errorf("errs = %v, want 30-bad.json and owner", errs)
+    }
+
+    if m, errs := LoadStatic(filepath.Join(dir, "none")); len(m) != 0 || len(errs) != 0 { t.Errorf("missing dir = %v, %v", m, errs) }
+}
+
+func TestMerge(t *testing.T) {
+    static := map[string]string{"hostname": "fake", "site": "hq"}
+    discovered := map[string]string{"hostname": "lab-01", "os.id": "debian"}
+    if rejected := Merge(discovered, static, false); !reflect.DeepEqual(rejected, []string{"hostname"}) { t.Errorf("rejected = %v", rejected) }
+    if want := map[string]string{"hostname": "lab-01", "os.id": "debian", "site": "hq"}; !reflect.DeepEqual(discovered, want) {
+        t.Errorf("merged = %v, want %v", discovered, want)
+    }
+    if rejected := Merge(discovered, static, true); rejected != nil || discovered["hostname"] != "fake" {
+        t.Errorf("with allowReserved: rejected %v, hostname %q", rejected, discovered["hostname"])
+    }
+}
@@ -1,6 +1,7 @@
 package git
 
 import (
+	"context"
 	"crypto/rand"
 	"encoding/hex"
 	"errors"
@@ -12,32 +13,89 @@ import (
 	"strings"
 )
 
-const deviceKeyPath = "/etc/lgpo/device.key"
+// defaultDeviceKey is used when Options.DeviceKey is empty.
+const defaultDeviceKey = "/etc/lgpo/device.key"
+
+// Options tune how Ensure maintains the cache dir.
+type Options struct {
+	// ResetCorrupt moves a cache whose fetch/reset fails with a repository
+	// integrity error aside (to <dir>.corrupt) and clones afresh.
+	ResetCorrupt bool
+	// OnReset, if set, is told why the cache is being reset.
+	OnReset func(reason string)
+	// DeviceKey is the SSH private key for deploy-key access
+	// (default /etc/lgpo/device.key).
+	DeviceKey string
+	// DeviceKeys are more identity files, offered after DeviceKey in order,
+	// e.g. one key per algorithm.
+	DeviceKeys []string
+	// Depth is how many commits clone/fetch bring in: 0 means 1 (the
+	// default), a negative value full history (a shallow cache is unshallowed).
+	Depth int
+	// HTTPProxy, HTTPSProxy and NoProxy are passed to every git command as
+	// http_proxy, https_proxy and no_proxy (both cases), replacing what the
+	// agent inherited; empty ones are left alone. SSH remotes ignore them.
+	HTTPProxy, HTTPSProxy, NoProxy string
+}
+
+// proxyEnv is the environment for o's proxy settings.
+func (o Options) proxyEnv() []string {
+	var env []string
+	for _, kv := range [][2]string{{"http_proxy", o.HTTPProxy}, {"https_proxy", o.HTTPSProxy}, {"no_proxy", o.NoProxy}} {
+		if kv[1] != "" {
+			env = append(env, kv[0]+"="+kv[1], strings.ToUpper(kv[0])+"="+kv[1])
+		}
+	}
+	return env
+}
+
+// depthArgs are the clone/fetch history flags for o.Depth. unshallow is set
+// for a fetch into an existing shallow cache when full history is wanted.
+func (o Options) depthArgs(unshallow bool) []string {
+	switch {
+	case o.Depth < 0 && unshallow:
+		return []string{"--unshallow"}
+	case o.Depth < 0:
+		return nil
+	case o.Depth == 0:
+		return []string{"--depth", "1"}
+	}
+	return []string{"--depth", fmt.Sprint(o.Depth)}
+}
+
+// identities are the identity files ssh offers, DeviceKey first.
+func (o Options) identities() []string {
+	key := o.DeviceKey
+	if key == "" {
+		key = defaultDeviceKey
+	}
+	return append([]string{key}, o.DeviceKeys...)
+}
 
 // Ensure syncs the repo to dir at the given branch.
 // Flows:
-//  - If repo is SSH (git@...), always use /etc/lgpo/device.key and assert read-only.
+//  - If repo is SSH (git@...), always use the device key and assert read-only.
 //  - Else try HTTPS as-is; on auth error, fall back to SSH with device key and assert read-only.
-func Ensure(repo, branch, dir string) (string, error) {
+func Ensure(ctx context.Context, repo, branch, dir string, opts Options) (string, error) {
 	if isSSHURL(repo) {
-		commit, err := ensureWith(repo, branch, dir, sshEnv())
+		commit, err := ensureWith(ctx, repo, branch, dir, sshEnv(opts.identities()), opts)
 		if err != nil { return "", err }
-		readonly, checkErr := assertReadOnly(dir)
+		readonly, checkErr := assertReadOnly(ctx, dir, opts.identities())
 		if checkErr != nil { return "", fmt.Errorf("read-only check failed: %v", checkErr) }
 		if !readonly { return "", errors.New("credentials appear to be WRITE-capable; refusing to proceed") }
 		return commit, nil
 	}
 
 	// HTTPS first
-	commit, err := ensureWith(repo, branch, dir, nil)
+	commit, err := ensureWith(ctx, repo, branch, dir, nil, opts)
 	if err == nil { return commit, nil }
 
 	// If that failed and looks like a private GitHub repo with https, try SSH fallback
 	if strings.HasPrefix(repo, "https://github.com/") || strings.HasPrefix(repo, "http://github.com/") {
 		sshURL := httpsToSSH(repo)
-		commit, sshErr := ensureWith(sshURL, branch, dir, sshEnv())
+		commit, sshErr := ensureWith(ctx, sshURL, branch, dir, sshEnv(opts.identities()), opts)
 		if sshErr == nil {
-			if readonly, checkErr := assertReadOnly(dir); checkErr != nil {
+			if readonly, checkErr := assertReadOnly(ctx, dir, opts.identities()); checkErr != nil {
 				return "", fmt.Errorf("repo synced but read-only check failed: %v", checkErr)
 			} else if !readonly {
 				return "", errors.New("credentials appear to be WRITE-capable; refusing to proceed")
@@ -51,27 +109,106 @@ func Ensure(repo, branch, dir string) (string, error) {
 	return "", err
 }
 
-func ensureWith(repo, branch, dir string, extraEnv []string) (string, error) {
+func ensureWith(ctx context.Context, repo, branch, dir string, extraEnv []string, opts Options) (string, error) {
+	extraEnv = append(extraEnv, opts.proxyEnv()...)
 	if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
-		if out, err := cmdEnv(extraEnv, "git", "-C", dir, "fetch", "--depth", "1", "origin", branch); err != nil {
-			return "", fmt.Errorf("git fetch: %v: %s", err, out)
+		err := update(ctx, branch, dir, extraEnv, opts)
+		if err != nil && opts.ResetCorrupt && isCorruptError(err.Error()) {
+			if opts.OnReset != nil {
+				opts.OnReset(err.Error())
+			}
+			_ = os.RemoveAll(dir + ".corrupt")
+			if mvErr := os.Rename(dir, dir+".corrupt"); mvErr != nil {
+				return "", fmt.Errorf("reset corrupt cache: %v", mvErr)
+			}
+			err = clone(ctx, repo, branch, dir, extraEnv, opts)
 		}
-		if out, err := cmdEnv(extraEnv, "git", "-C", dir, "reset", "--hard", "origin/"+branch); err != nil {
-			return "", fmt.Errorf("git reset: %v: %s", err, out)
+		if err != nil {
+			return "", err
 		}
 	} else {
-		if err := os.MkdirAll(dir, 0755); err != nil { return "", err }
-		if out, err := cmdEnv(extraEnv, "git", "clone", "--depth", "1", "--branch", branch, repo, dir); err != nil {
-			return "", fmt.Errorf("git clone: %v: %s", err, out)
+		if err := clone(ctx, repo, branch, dir, extraEnv, opts); err != nil {
+			return "", err
 		}
 	}
-	out, err := cmdEnv(extraEnv, "git", "-C", dir, "rev-parse", "HEAD")
+	out, err := cmdEnv(ctx, extraEnv, "git", "-C", dir, "rev-parse", "HEAD")
 	if err != nil { return "", err }
 	return strings.TrimSpace(out), nil
 }
 
-func cmdEnv(extraEnv []string, name string, args ...string) (string, error) {
-	cmd := exec.Command(name, args...)
+// Pin checks out commit (a full sha) in the cache at dir and returns it. A
+// commit the cache does not have yet, e.g. in a shallow clone, is fetched
+// from origin first. The next Ensure moves the cache back to the branch head.
+func Pin(ctx context.Context, dir, commit string, opts Options) (string, error) {
+	env := opts.proxyEnv()
+	if u, err := cmdEnv(ctx, nil, "git", "-C", dir, "remote", "get-url", "origin"); err == nil && isSSHURL(strings.TrimSpace(u)) {
+		env = append(sshEnv(opts.identities()), env...)
+	}
+	if _, err := cmdEnv(ctx, env, "git", "-C", dir, "cat-file", "-e", commit+"^{commit}"); err != nil {
+		args := append([]string{"-C", dir, "fetch"}, opts.depthArgs(false)...)
+		if out, err := cmdEnv(ctx, env, "git", append(args, "origin", commit)...); err != nil {
+			return "", fmt.Errorf("git fetch %s: %v: %s", commit, err, out)
+		}
+	}
+	if out, err := cmdEnv(ctx, env, "git", "-C", dir, "reset", "--hard", commit); err != nil {
+		return "", fmt.Errorf("git reset: %v: %s", err, out)
+	}
+	out, err := cmdEnv(ctx, env, "git", "-C", dir, "rev-parse", "HEAD")
+	if err != nil { return "", err }
+	return strings.TrimSpace(out), nil
+}
+
+// ShowFile returns the content of path (relative to the repo top) at rev in
+// the cache at dir, whatever is checked out. A path rev does not have is
+// reported as os.ErrNotExist.
+func ShowFile(ctx context.Context, dir, rev, path string) ([]byte, error) {
+	out, err := cmdEnv(ctx, nil, "git", "-C", dir, "ls-tree", "--name-only", rev, "--", path)
+	if err != nil { return nil, fmt.Errorf("git ls-tree %s: %v: %s", rev, err, strings.TrimSpace(out)) }
+	if strings.TrimSpace(out) == "" { return nil, fmt.Errorf("%s:%s: %w", rev, path, os.ErrNotExist) }
+	out, err = cmdEnv(ctx, nil, "git", "-C", dir, "show", rev+":"+path)
+	if err != nil { return nil, fmt.Errorf("git show %s:%s: %v: %s", rev, path, err, strings.TrimSpace(out)) }
+	return []byte(out), nil
+}
+
+// ChangedFiles lists the files under path (relative to the repo top) that
+// differ between commits from and to in the cache at dir. Renames show as a
+// deletion and an addition. Both commits must be in the cache.
+func ChangedFiles(ctx context.Context, dir, from, to, path string) ([]string, error) {
+	out, err := cmdEnv(ctx, nil, "git", "-C", dir, "diff", "--name-only", "--no-renames", from, to, "--", path)
+	if err != nil { return nil, fmt.Errorf("git diff: %v: %s", err, strings.TrimSpace(out)) }
+	var files []string
+	for _, l := range strings.Split(out, "\n") {
+		if l = strings.TrimSpace(l); l != "" { files = append(files, l) }
+	}
+	return files, nil
+}
+
+func update(ctx context.Context, branch, dir string, extraEnv []string, opts Options) error {
+	// Explicit refspec: a single-branch clone would not update origin/<branch>
+	// for any other branch.
+	refspec := "+refs/heads/" + branch + ":refs/remotes/origin/" + branch
+	_, err := os.Stat(filepath.Join(dir, ".git", "shallow"))
+	args := append([]string{"-C", dir, "fetch"}, opts.depthArgs(err == nil)...)
+	if out, err := cmdEnv(ctx, extraEnv, "git", append(args, "origin", refspec)...); err != nil {
+		return fmt.Errorf("git fetch: %v: %s", err, out)
+	}
+	if out, err := cmdEnv(ctx, extraEnv, "git", "-C", dir, "reset", "--hard", "origin/"+branch); err != nil {
+		return fmt.Errorf("git reset: %v: %s", err, out)
+	}
+	return nil
+}
+
+func clone(ctx context.Context, repo, branch, dir string, extraEnv []string, opts Options) error {
+	if err := os.MkdirAll(dir, 0755); err != nil { return err }
+	args := append([]string{"clone"}, opts.depthArgs(false)...)
+	if out, err := cmdEnv(ctx, extraEnv, "git", append(args, "--branch", branch, repo, dir)...); err != nil {
+		return fmt.Errorf("git clone: %v: %s", err, out)
+	}
+	return nil
+}
+
+func cmdEnv(ctx context.Context, extraEnv []string, name string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, name, args...)
 	if len(extraEnv) > 0 {
 		cmd.Env = append(os.Environ(), extraEnv...)
 	}
@@ -91,15 +228,21 @@ func httpsToSSH(u string) string {
 	return "git@github.com:" + s + ".git"
 }
 
-func sshEnv() []string {
+// sshEnv points ssh at keys only; it offers them in order and uses the
+// first the server accepts.
+func sshEnv(keys []string) []string {
 	// No pinning for now (accept-new), BatchMode avoids prompts
-	return []string{`GIT_SSH_COMMAND=ssh -i ` + deviceKeyPath + ` -o IdentitiesOnly=yes -o BatchMode=yes -o StrictHostKeyChecking=accept-new`}
+	var ids strings.Builder
+	for _, k := range keys {
+		ids.WriteString("-i " + k + " ")
+	}
+	return []string{`GIT_SSH_COMMAND=ssh ` + ids.String() + `-o IdentitiesOnly=yes -o BatchMode=yes -o StrictHostKeyChecking=accept-new`}
 }
 
-func assertReadOnly(dir string) (bool, error) {
+func assertReadOnly(ctx context.Context, dir string, keys []string) (bool, error) {
 	// Push dry-run should fail with permission-related error when using read-only deploy key
 	ref := "refs/heads/lgpo-perm-check-" + randHex(6)
-	out, err := cmdEnv(sshEnv(), "git", "-C", dir, "push", "--dry-run", "origin", "HEAD:"+ref)
+	out, err := cmdEnv(ctx, sshEnv(keys), "git", "-C", dir, "push", "--dry-run", "origin", "HEAD:"+ref)
 	if err == nil {
 		// Exit code 0 → push appears permitted
 		return false, nil
@@ -122,6 +265,26 @@ func isAuthError(msg string) bool {
 		strings.Contains(msg, "authorization")
 }
 
+// reCorrupt are the messages git prints for a damaged local repository (e.g.
+// an interrupted clone or a full disk). Anything else, network and auth
+// problems above all, must not get the cache moved aside.
+var reCorrupt = []*regexp.Regexp{
+	regexp.MustCompile(`(fatal|error): bad object `),
+	regexp.MustCompile(`(fatal|error): loose object [0-9a-f]+ \(stored in [^)]*\) is corrupt`),
+	regexp.MustCompile(`(fatal|error): index file corrupt`),
+}
+
+// isCorruptError matches git failures caused by a damaged local repository,
+// as opposed to network or auth problems.
+func isCorruptError(msg string) bool {
+	for _, re := range reCorrupt {
+		if re.MatchString(msg) {
+			return true
+		}
+	}
+	return false
+}
+
 func randHex(n int) string {
 	b := make([]byte, n)
 	_, _ = rand.Read(b)
@@ -0,0 +1,264 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestIsCorruptError(t *testing.T) {
+	tests := []struct {
+		msg  string
+		want bool
+	}{
+		{"git fetch: exit status 128: fatal: bad object 1f2e3d4c5b6a79881f2e3d4c5b6a79881f2e3d4c", true},
+		{"git reset: exit status 128: error: object file .git/objects/ab/cdef is empty\nfatal: loose object abcdef0123 (stored in .git/objects/ab/cdef0123) is corrupt", true},
+		{"git reset: exit status 128: fatal: index file corrupt", true},
+		{"git fetch: exit status 128: fatal: could not read from remote repository", false},
+		{"git fetch: exit status 128: fatal: 'origin' does not appear to be a git repository", false},
+		{"git fetch: exit status 128: fatal: unable to access 'https://example.com/repo.git/': Could not resolve host", false},
+		{"git fetch: exit status 1: error: cannot lock ref 'refs/remotes/origin/main': is at 1234 but expected 5678", false},
+		{"git fetch: exit status 128: fatal: couldn't find remote ref corrupt-fix", false},
+		{"git reset: exit status 128: fatal: Unable to create '.git/index.lock': File exists", false},
+	}
+	for _, tc := range tests {
+		if got := isCorruptError(tc.msg); got != tc.want {
+			t.Errorf("isCorruptError(%q) = %v, want %v", tc.msg, got, tc.want)
+		}
+	}
+}
+
+// gitIn runs git in dir and returns its trimmed output.
+func gitIn(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	out, err := exec.Command("git", append([]string{"-C", dir, "-c", "user.name=t", "-c", "user.email=t@example.com"}, args...)...).CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %v: %v: %s", args, err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+func TestEnsureResetsCorruptCache(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	for _, reset := range []bool{true, false} {
+		t.Run(fmt.Sprintf("resetCorrupt=%v", reset), func(t *testing.T) {
+			dir := t.TempDir()
+			src, cache := filepath.Join(dir, "src"), filepath.Join(dir, "cache")
+			if out, err := exec.Command("git", "init", "-q", "-b", "main", src).CombinedOutput(); err != nil {
+				t.Fatalf("git init: %v: %s", err, out)
+			}
+			if err := os.WriteFile(filepath.Join(src, "a"), []byte("1\n"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			gitIn(t, src, "add", "-A")
+			gitIn(t, src, "commit", "-q", "-m", "one")
+			var reasons []string
+			opts := Options{ResetCorrupt: reset, OnReset: func(reason string) { reasons = append(reasons, reason) }}
+			if _, err := Ensure(context.Background(), src, "main", cache, opts); err != nil {
+				t.Fatal(err)
+			}
+
+			// a damaged index makes the next reset fail
+			if err := os.WriteFile(filepath.Join(cache, ".git", "index"), []byte(strings.Repeat("garbage ", 16)), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(filepath.Join(src, "a"), []byte("2\n"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			gitIn(t, src, "commit", "-q", "-am", "two")
+			want := gitIn(t, src, "rev-parse", "HEAD")
+
+			got, err := Ensure(context.Background(), src, "main", cache, opts)
+			_, statErr := os.Stat(cache + ".corrupt")
+			if !reset {
+				if err == nil || !isCorruptError(err.Error()) {
+					t.Fatalf("err = %v, want the corrupt-index error", err)
+				}
+				if statErr == nil || len(reasons) > 0 {
+					t.Error("cache moved aside with resetCorrupt off")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != want {
+				t.Errorf("commit = %s, want %s", got, want)
+			}
+			if statErr != nil {
+				t.Errorf("old cache not kept: %v", statErr)
+			}
+			if len(reasons) != 1 || !isCorruptError(reasons[0]) {
+				t.Errorf("OnReset reasons = %q, want one corrupt-cache error", reasons)
+			}
+		})
+	}
+}
+
+func TestDepthArgs(t *testing.T) {
+	tests := []struct {
+		depth     int
+		unshallow bool
+		want      string
+	}{
+		{0, false, "--depth 1"},
+		{1, true, "--depth 1"},
+		{5, false, "--depth 5"},
+		{-1, false, ""},
+		{-1, true, "--unshallow"},
+	}
+	for _, tc := range tests {
+		if got := strings.Join(Options{Depth: tc.depth}.depthArgs(tc.unshallow), " "); got != tc.want {
+			t.Errorf("depthArgs(depth %d, unshallow %v) = %q, want %q", tc.depth, tc.unshallow, got, tc.want)
+		}
+	}
+}
+
+func TestEnsureDepth(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	dir := t.TempDir()
+	src, cache := filepath.Join(dir, "src"), filepath.Join(dir, "cache")
+	if out, err := exec.Command("git", "init", "-q", "-b", "main", src).CombinedOutput(); err != nil {
+		t.Fatalf("git init: %v: %s", err, out)
+	}
+	for i := 1; i <= 3; i++ {
+		if err := os.WriteFile(filepath.Join(src, "a"), []byte(fmt.Sprintln(i)), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		gitIn(t, src, "add", "-A")
+		gitIn(t, src, "commit", "-q", "-m", fmt.Sprint(i))
+	}
+	// --depth is ignored for plain local paths
+	repo := "file://" + src
+	ctx := context.Background()
+	shallow := func() bool {
+		_, err := os.Stat(filepath.Join(cache, ".git", "shallow"))
+		return err == nil
+	}
+
+	steps := []struct {
+		depth   int
+		commits string
+		shallow bool
+	}{
+		{0, "1", true},
+		{2, "2", true},
+		{-1, "3", false}, // the shallow cache is unshallowed
+		{-1, "3", false},
+	}
+	for _, s := range steps {
+		if _, err := Ensure(ctx, repo, "main", cache, Options{Depth: s.depth}); err != nil {
+			t.Fatalf("depth %d: %v", s.depth, err)
+		}
+		if got := gitIn(t, cache, "rev-list", "--count", "HEAD"); got != s.commits {
+			t.Errorf("depth %d: %s commits in the cache, want %s", s.depth, got, s.commits)
+		}
+		if shallow() != s.shallow {
+			t.Errorf("depth %d: shallow = %v, want %v", s.depth, shallow(), s.shallow)
+		}
+	}
+}
+
+func TestProxyEnv(t *testing.T) {
+	o := Options{HTTPSProxy: "http://proxy:3128", NoProxy: "localhost,.corp"}
+	want := []string{"https_proxy=http://proxy:3128", "HTTPS_PROXY=http://proxy:3128", "no_proxy=localhost,.corp", "NO_PROXY=localhost,.corp"}
+	if got := o.proxyEnv(); strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("proxyEnv = %q, want %q", got, want)
+	}
+	if got := (Options{}).proxyEnv(); len(got) != 0 {
+		t.Errorf("proxyEnv without proxies = %q, want none", got)
+	}
+}
+
+func TestEnsureUsesProxy(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	// nothing listens on port 1, so the clone fails at the proxy without
+	// reaching the (unresolvable) remote host
+	t.Setenv("https_proxy", "")
+	t.Setenv("HTTPS_PROXY", "")
+	cache := filepath.Join(t.TempDir(), "cache")
+	_, err := Ensure(context.Background(), "https://git.example.invalid/policies.git", "main", cache, Options{HTTPSProxy: "http://127.0.0.1:1"})
+	if err == nil || !strings.Contains(err.Error(), "127.0.0.1") {
+		t.Errorf("err = %v, want a failure connecting to the proxy", err)
+	}
+}
+
+func TestPin(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	dir := t.TempDir()
+	src, cache := filepath.Join(dir, "src"), filepath.Join(dir, "cache")
+	if out, err := exec.Command("git", "init", "-q", "-b", "main", src).CombinedOutput(); err != nil {
+		t.Fatalf("git init: %v: %s", err, out)
+	}
+	var commits []string
+	for i := 1; i <= 3; i++ {
+		if err := os.WriteFile(filepath.Join(src, "a"), []byte(fmt.Sprintln(i)), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		gitIn(t, src, "add", "-A")
+		gitIn(t, src, "commit", "-q", "-m", fmt.Sprint(i))
+		commits = append(commits, gitIn(t, src, "rev-parse", "HEAD"))
+	}
+	ctx := context.Background()
+	if _, err := Ensure(ctx, "file://"+src, "main", cache, Options{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the shallow cache lacks the first commit until Pin fetches it
+	if _, err := cmdEnv(ctx, nil, "git", "-C", cache, "cat-file", "-e", commits[0]+"^{commit}"); err == nil {
+		t.Fatal("shallow cache already has the first commit")
+	}
+	got, err := Pin(ctx, cache, commits[0], Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != commits[0] {
+		t.Errorf("Pin = %s, want %s", got, commits[0])
+	}
+	if b, err := os.ReadFile(filepath.Join(cache, "a")); err != nil || string(b) != "1\n" {
+		t.Errorf("worktree a = %q, %v; want the first commit's", b, err)
+	}
+
+	// the next Ensure moves back to the branch head
+	if got, err := Ensure(ctx, "file://"+src, "main", cache, Options{}); err != nil || got != commits[2] {
+		t.Errorf("Ensure after Pin = %s, %v; want %s", got, err, commits[2])
+	}
+
+	if _, err := Pin(ctx, cache, strings.Repeat("0", 40), Options{}); err == nil {
+		t.Error("Pin to a commit origin does not have succeeded")
+	}
+}
+
+func TestIdentities(t *testing.T) {
+	tests := []struct {
+		opts Options
+		want string
+	}{
+		{Options{}, defaultDeviceKey},
+		{Options{DeviceKey: "/etc/lgpo/ed25519.key"}, "/etc/lgpo/ed25519.key"},
+		{Options{DeviceKey: "/etc/lgpo/ed25519.key", DeviceKeys: []string{"/etc/lgpo/rsa.key", "/etc/lgpo/ecdsa.key"}}, "/etc/lgpo/ed25519.key /etc/lgpo/rsa.key /etc/lgpo/ecdsa.key"},
+		{Options{DeviceKeys: []string{"/etc/lgpo/rsa.key"}}, defaultDeviceKey + " /etc/lgpo/rsa.key"},
+	}
+	for _, tc := range tests {
+		if got := strings.Join(tc.opts.identities(), " "); got != tc.want {
+			t.Errorf("identities(%+v) = %q, want %q", tc.opts, got, tc.want)
+		}
+	}
+	// ssh offers them in that order, and nothing else
+	env := sshEnv([]string{"/etc/lgpo/a.key", "/etc/lgpo/b.key"})
+	if len(env) != 1 || !strings.HasPrefix(env[0], "GIT_SSH_COMMAND=ssh -i /etc/lgpo/a.key -i /etc/lgpo/b.key -o IdentitiesOnly=yes ") {
+		t.Errorf("sshEnv = %q", env)
+	}
+}
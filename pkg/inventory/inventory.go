@@ -3,7 +3,10 @@ package inventory
 import (
 	"golang.org/x/crypto/ssh"
 
+	"crypto"
+	"crypto/ecdsa"
 	"crypto/ed25519"
+	"crypto/rsa"
 	"crypto/sha256"
 	"crypto/x509"
 	"encoding/hex"
@@ -13,9 +16,13 @@ import (
 	"io/fs"
 	"os"
 	"path/filepath"
+	"regexp"
+	"sort"
 	"strings"
 
 	"gopkg.in/yaml.v3"
+
+	"github.com/lgpo-org/lgpod/pkg/tags"
 )
 
 // ---------- inventory/devices.yml schema ----------
@@ -27,16 +34,59 @@ type DeviceInventory struct {
 }
 
 type DeviceEntry struct {
-	DevicePubSHA256 string            `yaml:"device_pub_sha256"`
-	Identity        string            `yaml:"identity"`
-	Tags            map[string]string `yaml:"tags"`
+	DevicePubSHA256 string `yaml:"device_pub_sha256"`
+	Identity        string `yaml:"identity"`
+	// Hostname (exact) or HostnameRegex (whole name) match a device by name
+	// when no entry has its hash, so new hosts get baseline tags before their
+	// key is enrolled. Only entries without device_pub_sha256 match this way.
+	Hostname      string              `yaml:"hostname"`
+	HostnameRegex string              `yaml:"hostnameRegex"`
+	Tags          map[string]TagValue `yaml:"tags"`
+}
+
+// Match is how LookupDevice found the device in the inventory.
+type Match int
+
+const (
+	NoMatch    Match = iota
+	ByKey            // an entry's device_pub_sha256 is the device hash
+	ByHostname       // no hash matched, a hostname entry did; less trusted
+)
+
+func (m Match) String() string {
+	switch m {
+	case ByKey:
+		return "key"
+	case ByHostname:
+		return "hostname"
+	}
+	return "none"
+}
+
+// TagValue is a tag's value(s): a plain string or a list of strings.
+type TagValue []string
+
+func (t *TagValue) UnmarshalYAML(n *yaml.Node) error {
+	switch n.Kind {
+	case yaml.ScalarNode:
+		*t = TagValue{n.Value}
+		return nil
+	case yaml.SequenceNode:
+		var vs []string
+		if err := n.Decode(&vs); err != nil {
+			return err
+		}
+		*t = vs
+		return nil
+	}
+	return fmt.Errorf("line %d: tag value must be a string or a list of strings", n.Line)
 }
 
 // ---------- Hashing helpers (canonical) ----------
 
 // hashOpenSSHBlob = SHA-256 over the OpenSSH wire format of the public key,
-// i.e. hash( ssh.NewPublicKey(pub).Marshal() ).
-func hashOpenSSHBlob(pub ed25519.PublicKey) (string, []byte, error) {
+// i.e. hash( ssh.NewPublicKey(pub).Marshal() ). pub is an Ed25519, RSA or ECDSA key.
+func hashOpenSSHBlob(pub crypto.PublicKey) (string, []byte, error) {
 	sshPub, err := ssh.NewPublicKey(pub)
 	if err != nil {
 		return "", nil, fmt.Errorf("ssh.NewPublicKey: %w", err)
@@ -53,7 +103,26 @@ func hashOpenSSHBlob(pub ed25519.PublicKey) (string, []byte, error) {
 	return strings.ToLower(hex.EncodeToString(sum[:])), pemBytes, nil
 }
 
-// ComputeDeviceHashFromPrivateKey derives pub from PRIVATE key (OpenSSH or PKCS#8)
+// publicOf returns the public half of a parsed Ed25519, RSA or ECDSA private key.
+func publicOf(privAny any) (crypto.PublicKey, error) {
+	switch k := privAny.(type) {
+	case ed25519.PrivateKey:
+		if len(k) == 0 {
+			return nil, errors.New("empty Ed25519 private key")
+		}
+		return k.Public(), nil
+	case *ed25519.PrivateKey:
+		return k.Public(), nil
+	case *rsa.PrivateKey:
+		return &k.PublicKey, nil
+	case *ecdsa.PrivateKey:
+		return &k.PublicKey, nil
+	default:
+		return nil, fmt.Errorf("unsupported private key type %T (need Ed25519, RSA or ECDSA)", privAny)
+	}
+}
+
+// ComputeDeviceHashFromPrivateKey derives pub from PRIVATE key (OpenSSH, PKCS#8, PKCS#1 or SEC1)
 // and returns (hex SHA-256 of OpenSSH blob, PEM SPKI bytes for diagnostics).
 func ComputeDeviceHashFromPrivateKey(privPath string) (string, []byte, error) {
 	keyPEM, err := os.ReadFile(privPath)
@@ -67,33 +136,39 @@ func ComputeDeviceHashFromPrivateKey(privPath string) (string, []byte, error) {
 		if err != nil {
 			return "", nil, fmt.Errorf("parse OpenSSH private key: %w", err)
 		}
-		switch k := privAny.(type) {
-		case ed25519.PrivateKey:
-			return hashOpenSSHBlob(k.Public().(ed25519.PublicKey))
-		case *ed25519.PrivateKey:
-			return hashOpenSSHBlob(k.Public().(ed25519.PublicKey))
-		default:
-			return "", nil, errors.New("unsupported OpenSSH private key type (need Ed25519)")
+		pub, err := publicOf(privAny)
+		if err != nil {
+			return "", nil, err
 		}
+		return hashOpenSSHBlob(pub)
 	}
 
-	// PKCS#8 fallback (compat)
+	// PEM fallback (compat)
 	block, _ := pem.Decode(keyPEM)
 	if block == nil || !strings.Contains(block.Type, "PRIVATE KEY") {
 		return "", nil, errors.New("invalid PEM: no PRIVATE KEY block found")
 	}
-	privAny, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	var privAny any
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		privAny, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		privAny, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		privAny, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
 	if err != nil {
-		return "", nil, fmt.Errorf("parse PKCS#8 private key: %w", err)
+		return "", nil, fmt.Errorf("parse %s: %w", strings.ToLower(block.Type), err)
 	}
-	priv, ok := privAny.(ed25519.PrivateKey)
-	if !ok || len(priv) == 0 {
-		return "", nil, errors.New("not an Ed25519 private key")
+	pub, err := publicOf(privAny)
+	if err != nil {
+		return "", nil, err
 	}
-	return hashOpenSSHBlob(priv.Public().(ed25519.PublicKey))
+	return hashOpenSSHBlob(pub)
 }
 
-// Reads an OpenSSH public key file and returns (hex SHA-256 of blob, PEM SPKI bytes).
+// Reads an OpenSSH public key (or certificate) file and returns (hex SHA-256 of blob, PEM SPKI bytes).
+// A certificate hashes its embedded key, so cert rotation keeps the device hash.
 func ComputeDeviceHashFromOpenSSHPub(pubPath string) (string, []byte, error) {
 	b, err := os.ReadFile(pubPath)
 	if err != nil {
@@ -103,31 +178,99 @@ func ComputeDeviceHashFromOpenSSHPub(pubPath string) (string, []byte, error) {
 	if err != nil {
 		return "", nil, fmt.Errorf("parse OpenSSH public key: %w", err)
 	}
+	if cert, ok := pk.(*ssh.Certificate); ok {
+		pk = cert.Key
+	}
 	cp, ok := pk.(ssh.CryptoPublicKey)
 	if !ok {
 		return "", nil, errors.New("public key does not expose crypto key")
 	}
-	goPub := cp.CryptoPublicKey()
-	ed, ok := goPub.(ed25519.PublicKey)
+	return hashOpenSSHBlob(cp.CryptoPublicKey())
+}
+
+// CertPath is where OpenSSH looks for the certificate of a private key.
+func CertPath(deviceKeyPath string) string {
+	return deviceKeyPath + "-cert.pub"
+}
+
+// CertPrincipals returns the valid principals of the OpenSSH certificate at certPath.
+func CertPrincipals(certPath string) ([]string, error) {
+	b, err := os.ReadFile(certPath)
+	if err != nil {
+		return nil, fmt.Errorf("read certificate: %w", err)
+	}
+	pk, _, _, _, err := ssh.ParseAuthorizedKey(b)
+	if err != nil {
+		return nil, fmt.Errorf("parse OpenSSH certificate: %w", err)
+	}
+	cert, ok := pk.(*ssh.Certificate)
 	if !ok {
-		return "", nil, errors.New("not an Ed25519 public key")
+		return nil, errors.New("not an OpenSSH certificate")
 	}
-	return hashOpenSSHBlob(ed)
+	return cert.ValidPrincipals, nil
+}
+
+// ShortIDLen is the length of a device short-id.
+const ShortIDLen = 12
+
+// ShortID is the compact device identifier for dashboards: the first
+// ShortIDLen hex chars of the device hash. Shorter input is returned as-is.
+func ShortID(hash string) string {
+	hash = strings.ToLower(hash)
+	if len(hash) < ShortIDLen {
+		return hash
+	}
+	return hash[:ShortIDLen]
 }
 
 // For run.go compatibility; we standardize on computing from the private key we own.
+// A private key the caller may not read (an enrollment script without root)
+// falls back to <key>.pub, which hashes the same. An SSH certificate next to
+// the key (<key>-cert.pub) must certify that same key, else it is an error:
+// its principals would otherwise vouch for another device.
 func ComputeDeviceHashPreferPub(deviceKeyPath string) (string, []byte, error) {
-	return ComputeDeviceHashFromPrivateKey(deviceKeyPath)
+	hash, spki, err := ComputeDeviceHashFromPrivateKey(deviceKeyPath)
+	if errors.Is(err, fs.ErrPermission) {
+		if _, statErr := os.Stat(deviceKeyPath + ".pub"); statErr == nil {
+			hash, spki, err = ComputeDeviceHashFromOpenSSHPub(deviceKeyPath + ".pub")
+		}
+	}
+	if err != nil {
+		return hash, spki, err
+	}
+	certPath := CertPath(deviceKeyPath)
+	if _, statErr := os.Stat(certPath); statErr == nil {
+		certHash, _, err := ComputeDeviceHashFromOpenSSHPub(certPath)
+		if err != nil {
+			return "", nil, err
+		}
+		if certHash != hash {
+			return "", nil, fmt.Errorf("%s certifies a different key than %s", certPath, deviceKeyPath)
+		}
+	}
+	return hash, spki, nil
 }
 
 // ---------- Inventory → tags ----------
 
-func loadInventory(cacheDir string) (*DeviceInventory, error) {
+// loadInventory reads inventory/devices.yml. With sigKey set (a public key
+// file) the file must carry a valid devices.yml.sig by that key, else it is
+// refused.
+func loadInventory(cacheDir, sigKey string) (*DeviceInventory, error) {
 	path := filepath.Join(cacheDir, "inventory", "devices.yml")
 	b, err := os.ReadFile(path)
 	if err != nil {
 		return nil, fmt.Errorf("read %s: %w", path, err)
 	}
+	if sigKey != "" {
+		sig, err := os.ReadFile(path + ".sig")
+		if err != nil {
+			return nil, fmt.Errorf("inventory signature required: %w", err)
+		}
+		if err := VerifySSHSig(sigKey, b, sig); err != nil {
+			return nil, fmt.Errorf("verify %s: %w", path, err)
+		}
+	}
 	var inv DeviceInventory
 	if err := yaml.Unmarshal(b, &inv); err != nil {
 		return nil, fmt.Errorf("parse %s: %w", path, err)
@@ -135,29 +278,85 @@ func loadInventory(cacheDir string) (*DeviceInventory, error) {
 	return &inv, nil
 }
 
-func writeManagedTag(tagsDir, key, value string) (string, error) {
-	target := filepath.Join(tagsDir, key+".tag")
-	content := "# managed-by: lgpod-inventory\n" + strings.TrimSpace(value) + "\n"
+// TagPerms is the mode and ownership given to the tags dirs and the managed
+// tag files. A UID or GID of -1 leaves it to whoever runs the agent.
+type TagPerms struct {
+	DirMode  fs.FileMode
+	FileMode fs.FileMode
+	UID, GID int
+}
+
+// DefaultTagPerms keeps tags readable by root and the owning group only.
+var DefaultTagPerms = TagPerms{DirMode: 0o750, FileMode: 0o640, UID: -1, GID: -1}
 
-	if err := os.MkdirAll(tagsDir, 0o750); err != nil {
-		return "", fmt.Errorf("create tags dir: %w", err)
+func (p TagPerms) set(path string, mode fs.FileMode) error {
+	if err := os.Chmod(path, mode); err != nil {
+		return err
+	}
+	if p.UID >= 0 || p.GID >= 0 {
+		return os.Lchown(path, p.UID, p.GID)
 	}
+	return nil
+}
+
+// stagedTag is a rendered tag file written next to its target but not yet
+// renamed into place.
+type stagedTag struct {
+	tmp, target string
+	prev        []byte // previous content, nil if the target did not exist
+}
 
-	// Backup if file exists and wasn't ours
-	if b, err := os.ReadFile(target); err == nil {
-		if !strings.HasPrefix(string(b), "# managed-by: lgpod-inventory") {
-			_ = os.WriteFile(target+".bak", b, 0o640) // best-effort
+// stageManagedTag writes one value per line to the temp file, with the final
+// mode and owner already set so the rename publishes it complete.
+func stageManagedTag(tagsDir, key string, values []string, perms TagPerms) (stagedTag, error) {
+	target := filepath.Join(tagsDir, key+".tag")
+	content := "# managed-by: lgpod-inventory\n"
+	for _, v := range values {
+		v = strings.TrimSpace(v)
+		if strings.ContainsAny(v, "\r\n") {
+			return stagedTag{}, fmt.Errorf("tag value %q spans multiple lines", v)
 		}
+		content += v + "\n"
 	}
 
 	tmp := target + ".tmp"
-	if err := os.WriteFile(tmp, []byte(content), 0o640); err != nil {
-		return "", fmt.Errorf("write temp tag file: %w", err)
+	if err := os.WriteFile(tmp, []byte(content), 0o600); err != nil {
+		_ = os.Remove(tmp)
+		return stagedTag{}, fmt.Errorf("write temp tag file: %w", err)
+	}
+	if err := perms.set(tmp, perms.FileMode); err != nil {
+		_ = os.Remove(tmp)
+		return stagedTag{}, fmt.Errorf("set tag file mode/owner: %w", err)
+	}
+	return stagedTag{tmp: tmp, target: target}, nil
+}
+
+// swapStagedTags renames every staged file into place. If a rename fails, the
+// tags already swapped are restored to their previous content so the tag set
+// is either fully old or fully new.
+func swapStagedTags(staged []stagedTag, perms TagPerms) error {
+	for i := range staged {
+		s := &staged[i]
+		if b, err := os.ReadFile(s.target); err == nil {
+			s.prev = b
+		}
 	}
-	if err := os.Rename(tmp, target); err != nil {
-		return "", fmt.Errorf("rename tag file: %w", err)
+	for i, s := range staged {
+		if err := os.Rename(s.tmp, s.target); err != nil {
+			for _, u := range staged[i:] {
+				_ = os.Remove(u.tmp)
+			}
+			for _, u := range staged[:i] {
+				if u.prev == nil {
+					_ = os.Remove(u.target)
+				} else {
+					_ = os.WriteFile(u.target, u.prev, perms.FileMode)
+				}
+			}
+			return fmt.Errorf("rename tag file: %w", err)
+		}
 	}
-	return target, nil
+	return nil
 }
 
 func cleanManagedTagsExcept(tagsDir string, keep map[string]struct{}) (int, error) {
@@ -187,56 +386,213 @@ func cleanManagedTagsExcept(tagsDir string, keep map[string]struct{}) (int, erro
 	return removed, nil
 }
 
-// SyncInventoryTags: compute hash (from PRIVATE key), look it up, write tags.
-// Returns (deviceHash, filesWritten).
-func SyncInventoryTags(cacheDir, tagsDir, deviceKeyPath string) (string, int, error) {
-	hash, _, err := ComputeDeviceHashFromPrivateKey(deviceKeyPath)
+// inventoryTags computes the device hash and the full tag set the inventory
+// assigns to it (including identity). An unenrolled device gets an empty set.
+func inventoryTags(cacheDir, deviceKeyPath, hostname, sigKey string) (string, map[string][]string, error) {
+	hash, want, _, err := LookupDevice(cacheDir, deviceKeyPath, hostname, sigKey)
+	return hash, want, err
+}
+
+// LookupDevice is inventoryTags plus how the device was found, so an
+// unenrolled device can be told from one without tags. The entry with the
+// device hash wins; only without one is hostname ("" skips this) matched
+// against the hostname entries, in file order. A hostname match gets no
+// identity tag: nothing proves the host is who the entry names.
+func LookupDevice(cacheDir, deviceKeyPath, hostname, sigKey string) (string, map[string][]string, Match, error) {
+	hash, _, err := ComputeDeviceHashPreferPub(deviceKeyPath)
 	if err != nil {
-		return "", 0, err
+		return "", nil, NoMatch, err
 	}
 
-	inv, err := loadInventory(cacheDir)
+	inv, err := loadInventory(cacheDir, sigKey)
 	if err != nil {
-		return hash, 0, err
+		return hash, nil, NoMatch, err
 	}
 
 	var match *DeviceEntry
+	how := ByKey
 	for i := range inv.Items {
 		if strings.EqualFold(inv.Items[i].DevicePubSHA256, hash) {
 			match = &inv.Items[i]
 			break
 		}
 	}
+	if match == nil && hostname != "" {
+		if match, err = matchHostname(inv.Items, hostname); err != nil {
+			return hash, nil, NoMatch, err
+		}
+		how = ByHostname
+	}
+	want := map[string][]string{}
 	if match == nil {
-		_, _ = cleanManagedTagsExcept(tagsDir, map[string]struct{}{}) // keep none
-		return hash, 0, nil
+		return hash, want, NoMatch, nil
 	}
 
-	keep := make(map[string]struct{}, len(match.Tags)+1)
-	for k := range match.Tags {
-		if strings.TrimSpace(k) != "" {
-			keep[k] = struct{}{}
+	identity := ""
+	if how == ByKey {
+		identity = match.Identity
+		if identity == "" {
+			if principals, err := CertPrincipals(CertPath(deviceKeyPath)); err == nil {
+				identity = strings.Join(principals, ",")
+			}
 		}
 	}
-	if match.Identity != "" {
-		keep["identity"] = struct{}{}
-	}
-	_, _ = cleanManagedTagsExcept(tagsDir, keep)
 
-	wrote := 0
 	for k, v := range match.Tags {
 		if strings.TrimSpace(k) == "" {
 			continue
 		}
-		if _, err := writeManagedTag(tagsDir, k, v); err != nil {
-		 return hash, wrote, fmt.Errorf("write tag %q: %w", k, err)
+		vals := []string{}
+		for _, s := range v {
+			if s = strings.TrimSpace(s); s != "" {
+				vals = append(vals, s)
+			}
+		}
+		want[k] = vals
+	}
+	if identity != "" {
+		want["identity"] = []string{identity}
+	}
+	return hash, want, how, nil
+}
+
+// matchHostname is the first entry without a device hash whose hostname or
+// hostnameRegex matches hostname, ignoring case, or nil.
+func matchHostname(items []DeviceEntry, hostname string) (*DeviceEntry, error) {
+	for i := range items {
+		e := &items[i]
+		if e.DevicePubSHA256 != "" {
+			continue
+		}
+		if e.Hostname != "" && strings.EqualFold(e.Hostname, hostname) {
+			return e, nil
+		}
+		if e.HostnameRegex != "" {
+			re, err := regexp.Compile("(?i)^(?:" + e.HostnameRegex + ")$")
+			if err != nil {
+				return nil, fmt.Errorf("inventory item %d: invalid hostnameRegex: %w", i, err)
+			}
+			if re.MatchString(hostname) {
+				return e, nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+// SyncInventoryTags: compute hash (from PRIVATE key or its certificate), look it up, write tags.
+// Without an inventory identity, the certificate principals (if any) become the identity tag.
+// Tags are written to <tagsDir>/inventory so they never touch admin-created tags.
+// Both tag dirs and the tag files get the mode and owner in perms.
+// Returns (deviceHash, filesWritten, match); with NoMatch the inventory has
+// no entry for the device, whose managed tags are then removed.
+func SyncInventoryTags(cacheDir, tagsRoot, deviceKeyPath, hostname, sigKey string, perms TagPerms) (string, int, Match, error) {
+	tagsDir := filepath.Join(tagsRoot, tags.InventoryDir)
+	hash, want, match, err := LookupDevice(cacheDir, deviceKeyPath, hostname, sigKey)
+	if err != nil {
+		return hash, 0, NoMatch, err
+	}
+
+	keep := make(map[string]struct{}, len(want))
+	for k := range want {
+		keep[k] = struct{}{}
+	}
+	if len(want) > 0 {
+		if err := os.MkdirAll(tagsDir, perms.DirMode); err != nil {
+			return hash, 0, NoMatch, fmt.Errorf("create tags dir: %w", err)
+		}
+		for _, dir := range []string{tagsRoot, tagsDir} {
+			if err := perms.set(dir, perms.DirMode); err != nil {
+				return hash, 0, NoMatch, fmt.Errorf("set tags dir mode/owner: %w", err)
+			}
+		}
+	}
+	// Stage every tag first; nothing visible changes until all of them are
+	// written, so a failure here leaves the previous tag set untouched.
+	var staged []stagedTag
+	abort := func() {
+		for _, s := range staged {
+			_ = os.Remove(s.tmp)
+		}
+	}
+	for k, v := range want {
+		st, err := stageManagedTag(tagsDir, k, v, perms)
+		if err != nil {
+			abort()
+			return hash, 0, NoMatch, fmt.Errorf("write tag %q: %w", k, err)
+		}
+		staged = append(staged, st)
+	}
+	if err := swapStagedTags(staged, perms); err != nil {
+		return hash, 0, NoMatch, err
+	}
+	wrote := len(staged)
+	_, _ = cleanManagedTagsExcept(tagsDir, keep)
+	// Managed tags from before namespacing lived in the tags root.
+	_, _ = cleanManagedTagsExcept(tagsRoot, nil)
+	return hash, wrote, match, nil
+}
+
+// loadManagedTags reads the values of the tag files in dir written by the
+// inventory sync; files without the managed-by header are left out.
+func loadManagedTags(dir string) map[string][]string {
+	m := map[string][]string{}
+	ents, err := os.ReadDir(dir)
+	if err != nil {
+		return m
+	}
+	for _, de := range ents {
+		if de.IsDir() || !strings.HasSuffix(de.Name(), ".tag") {
+			continue
+		}
+		b, err := os.ReadFile(filepath.Join(dir, de.Name()))
+		if err != nil || !strings.HasPrefix(string(b), "# managed-by: lgpod-inventory") {
+			continue
+		}
+		vals := []string{}
+		for _, line := range strings.Split(string(b), "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			vals = append(vals, line)
+		}
+		m[strings.TrimSuffix(de.Name(), ".tag")] = vals
+	}
+	return m
+}
+
+// TagChange is one difference between the on-disk inventory tags and what the
+// next sync would write. Old is nil for an added tag, New is nil for a removed one.
+type TagChange struct {
+	Key string
+	Old []string
+	New []string
+}
+
+// PlanInventoryTags computes what SyncInventoryTags would change without
+// writing anything. Changes are sorted by key.
+func PlanInventoryTags(cacheDir, tagsRoot, deviceKeyPath, hostname, sigKey string) (string, []TagChange, error) {
+	hash, want, err := inventoryTags(cacheDir, deviceKeyPath, hostname, sigKey)
+	if err != nil {
+		return hash, nil, err
+	}
+	have := loadManagedTags(filepath.Join(tagsRoot, tags.InventoryDir))
+
+	var out []TagChange
+	for k, nv := range want {
+		ov, ok := have[k]
+		if !ok {
+			out = append(out, TagChange{Key: k, New: nv})
+		} else if strings.Join(ov, "\n") != strings.Join(nv, "\n") {
+			out = append(out, TagChange{Key: k, Old: ov, New: nv})
 		}
-		wrote++
 	}
-	if match.Identity != "" {
-		if _, err := writeManagedTag(tagsDir, "identity", match.Identity); err == nil {
-			wrote++
+	for k, ov := range have {
+		if _, ok := want[k]; !ok {
+			out = append(out, TagChange{Key: k, Old: ov})
 		}
 	}
-	return hash, wrote, nil
+	sort.Slice(out, func(i, j int) bool { return out[i].Key < out[j].Key })
+	return hash, out, nil
 }
@@ -0,0 +1,103 @@
+package inventory
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// SigNamespace is the ssh-keygen -Y namespace inventory signatures must use:
+//
+//	ssh-keygen -Y sign -f signer_key -n lgpo-inventory inventory/devices.yml
+//
+// which writes inventory/devices.yml.sig next to the file.
+const SigNamespace = "lgpo-inventory"
+
+// sshsig is the wire format of an SSH signature (PROTOCOL.sshsig).
+type sshsig struct {
+	Magic     [6]byte
+	Version   uint32
+	PublicKey string
+	Namespace string
+	Reserved  string
+	HashAlg   string
+	Signature string
+}
+
+// sshsigSigned is the data the signature covers.
+type sshsigSigned struct {
+	Magic     [6]byte
+	Namespace string
+	Reserved  string
+	HashAlg   string
+	Hash      string
+}
+
+// VerifySSHSig checks that armored (an "SSH SIGNATURE" PEM block) is a valid
+// signature over data by the key in pubKeyPath (authorized_keys format) under
+// SigNamespace.
+func VerifySSHSig(pubKeyPath string, data, armored []byte) error {
+	b, err := os.ReadFile(pubKeyPath)
+	if err != nil {
+		return fmt.Errorf("read signing key: %w", err)
+	}
+	want, _, _, _, err := ssh.ParseAuthorizedKey(b)
+	if err != nil {
+		return fmt.Errorf("parse signing key %s: %w", pubKeyPath, err)
+	}
+
+	blk, _ := pem.Decode(armored)
+	if blk == nil || blk.Type != "SSH SIGNATURE" {
+		return errors.New("signature is not an armored SSH SIGNATURE")
+	}
+	var sig sshsig
+	if err := ssh.Unmarshal(blk.Bytes, &sig); err != nil {
+		return fmt.Errorf("parse signature: %w", err)
+	}
+	if string(sig.Magic[:]) != "SSHSIG" || sig.Version != 1 {
+		return errors.New("parse signature: bad magic or version")
+	}
+	if sig.Namespace != SigNamespace {
+		return fmt.Errorf("signature namespace %q, want %q", sig.Namespace, SigNamespace)
+	}
+	signer, err := ssh.ParsePublicKey([]byte(sig.PublicKey))
+	if err != nil {
+		return fmt.Errorf("parse signature key: %w", err)
+	}
+	if !bytes.Equal(signer.Marshal(), want.Marshal()) {
+		return fmt.Errorf("signed by %s, want %s", ssh.FingerprintSHA256(signer), ssh.FingerprintSHA256(want))
+	}
+
+	var h []byte
+	switch sig.HashAlg {
+	case "sha256":
+		s := sha256.Sum256(data)
+		h = s[:]
+	case "sha512":
+		s := sha512.Sum512(data)
+		h = s[:]
+	default:
+		return fmt.Errorf("unsupported signature hash %q", sig.HashAlg)
+	}
+	var s ssh.Signature
+	if err := ssh.Unmarshal([]byte(sig.Signature), &s); err != nil {
+		return fmt.Errorf("parse signature blob: %w", err)
+	}
+	signed := ssh.Marshal(sshsigSigned{
+		Magic:     sig.Magic,
+		Namespace: sig.Namespace,
+		Reserved:  sig.Reserved,
+		HashAlg:   sig.HashAlg,
+		Hash:      string(h),
+	})
+	if err := want.Verify(signed, &s); err != nil {
+		return fmt.Errorf("bad signature: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package inventory
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// sshSign writes file.sig, signed by key under namespace ns.
+func sshSign(t *testing.T, key, ns, file string) {
+	t.Helper()
+	if out, err := exec.Command("ssh-keygen", "-q", "-Y", "sign", "-f", key, "-n", ns, file).CombinedOutput(); err != nil {
+		t.Fatalf("ssh-keygen -Y sign: %v: %s", err, out)
+	}
+}
+
+func TestVerifySSHSig(t *testing.T) {
+	dir := t.TempDir()
+	signer := newKey(t, dir, "signer")
+	other := newKey(t, dir, "other")
+	data := filepath.Join(dir, "devices.yml")
+	if err := os.WriteFile(data, []byte("items: []\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		key     string // signs the file
+		ns      string
+		data    string // what is verified
+		wantErr string
+	}{
+		{"valid", signer, SigNamespace, "items: []\n", ""},
+		{"edited", signer, SigNamespace, "items: [{tags: {group: admins}}]\n", "bad signature"},
+		{"wrong key", other, SigNamespace, "items: []\n", "signed by"},
+		{"wrong namespace", signer, "file", "items: []\n", "namespace"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			os.Remove(data + ".sig")
+			sshSign(t, tc.key, tc.ns, data)
+			sig, err := os.ReadFile(data + ".sig")
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = VerifySSHSig(signer+".pub", []byte(tc.data), sig)
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("VerifySSHSig = %v, want error containing %q", err, tc.wantErr)
+			}
+		})
+	}
+
+	if err := VerifySSHSig(signer+".pub", []byte("items: []\n"), []byte("not a signature")); err == nil {
+		t.Error("VerifySSHSig accepted an unarmored signature")
+	}
+}
+
+func TestLookupDeviceSigned(t *testing.T) {
+	dir := t.TempDir()
+	key := newKey(t, dir, "device")
+	signer := newKey(t, dir, "signer")
+	hash, _, err := ComputeDeviceHashPreferPub(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache := filepath.Join(dir, "cache")
+	writeInventory(t, cache, "  - device_pub_sha256: \""+hash+"\"\n    tags: {group: laptops}\n")
+	devices := filepath.Join(cache, "inventory", "devices.yml")
+
+	// without a signing key the plain file is used
+	if _, tags, _, err := LookupDevice(cache, key, "host", ""); err != nil || strings.Join(tags["group"], ",") != "laptops" {
+		t.Fatalf("unsigned lookup = %v, %v", tags, err)
+	}
+
+	// with one, a missing signature is refused
+	if _, _, _, err := LookupDevice(cache, key, "host", signer+".pub"); err == nil || !strings.Contains(err.Error(), "signature required") {
+		t.Errorf("missing signature: err = %v", err)
+	}
+
+	sshSign(t, signer, SigNamespace, devices)
+	if _, tags, _, err := LookupDevice(cache, key, "host", signer+".pub"); err != nil || strings.Join(tags["group"], ",") != "laptops" {
+		t.Errorf("signed lookup = %v, %v", tags, err)
+	}
+
+	// editing the inventory after signing breaks it, and no tags are synced
+	writeInventory(t, cache, "  - device_pub_sha256: \""+hash+"\"\n    tags: {group: admins}\n")
+	tagsRoot := filepath.Join(dir, "tags")
+	if _, _, _, err := SyncInventoryTags(cache, tagsRoot, key, "host", signer+".pub", TagPerms{DirMode: 0o755, FileMode: 0o644, UID: -1, GID: -1}); err == nil || !strings.Contains(err.Error(), "bad signature") {
+		t.Errorf("edited inventory: err = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(tagsRoot, "inventory", "group")); err == nil {
+		t.Error("tags synced from a tampered inventory")
+	}
+}
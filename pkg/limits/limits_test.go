@@ -0,0 +1,75 @@
+package limits
+
+import (
+	"strings"
+	"testing"
+)
+
+func limitsPolicy(entries ...Entry) *Policy {
+	return &Policy{Kind: "LimitsPolicy", Metadata: Meta{Name: "build"}, Spec: Spec{Entries: entries}}
+}
+
+func TestRender(t *testing.T) {
+	p := limitsPolicy(
+		Entry{Domain: "@builders", Type: "soft", Item: "nofile", Value: "65536"},
+		Entry{Domain: "@builders", Type: "hard", Item: "nofile", Value: "unlimited"},
+		Entry{Domain: "*", Type: "-", Item: "core", Value: "0"},
+	)
+	got, err := Render(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "# generated by lgpo (limits) for policy build\n" +
+		"@builders\tsoft\tnofile\t65536\n" +
+		"@builders\thard\tnofile\tunlimited\n" +
+		"*\t-\tcore\t0\n"
+	if string(got) != want {
+		t.Errorf("Render =\n%s\nwant\n%s", got, want)
+	}
+	if TargetPath("build") != "/etc/security/limits.d/60-lgpo-build.conf" {
+		t.Errorf("TargetPath = %s", TargetPath("build"))
+	}
+}
+
+func TestValidate(t *testing.T) {
+	ok := Entry{Domain: "alice", Type: "soft", Item: "nproc", Value: "4096"}
+	tests := []struct {
+		name    string
+		edit    func(e *Entry)
+		wantErr string
+	}{
+		{"user", func(e *Entry) {}, ""},
+		{"group", func(e *Entry) { e.Domain = "%wheel" }, ""},
+		{"uid range", func(e *Entry) { e.Domain = "1000:" }, ""},
+		{"gid range", func(e *Entry) { e.Domain = "@1000:2000" }, ""},
+		{"negative nice", func(e *Entry) { e.Item, e.Value = "nice", "-5" }, ""},
+		{"bare colon", func(e *Entry) { e.Domain = ":" }, "invalid domain"},
+		{"domain with space", func(e *Entry) { e.Domain = "alice bob" }, "invalid domain"},
+		{"bad type", func(e *Entry) { e.Type = "both" }, "type must be soft, hard or -"},
+		{"unknown item", func(e *Entry) { e.Item = "files" }, `unknown item "files"`},
+		{"bad value", func(e *Entry) { e.Value = "lots" }, "must be an integer"},
+		{"value with a unit", func(e *Entry) { e.Value = "64k" }, "must be an integer"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			e := ok
+			tc.edit(&e)
+			err := limitsPolicy(e).Validate()
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("err = %v, want %q", err, tc.wantErr)
+			}
+		})
+	}
+	if err := limitsPolicy().Validate(); err == nil {
+		t.Error("no entries validated")
+	}
+	if err := (&Policy{Kind: "LimitsPolicy", Metadata: Meta{Name: "a/b"}, Spec: Spec{Entries: []Entry{ok}}}).Validate(); err == nil {
+		t.Error("a name with a slash validated")
+	}
+}
@@ -0,0 +1,21 @@
+// pkg/limits/render.go
+package limits
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// Render returns the limits.d file for p, one line per entry in spec order
+// (pam_limits applies later lines over earlier ones).
+func Render(p *Policy) ([]byte, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	out := &bytes.Buffer{}
+	fmt.Fprintf(out, "# generated by lgpo (limits) for policy %s\n", p.Metadata.Name)
+	for _, e := range p.Spec.Entries {
+		fmt.Fprintf(out, "%s\t%s\t%s\t%s\n", e.Domain, e.Type, e.Item, e.Value)
+	}
+	return out.Bytes(), nil
+}
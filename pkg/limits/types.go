@@ -0,0 +1,35 @@
+// pkg/limits/types.go
+package limits
+
+import (
+	"github.com/lgpo-org/lgpod/pkg/selector"
+)
+
+type Policy struct {
+	APIVersion string       `yaml:"apiVersion"`
+	Kind       string       `yaml:"kind"`
+	Metadata   Meta         `yaml:"metadata"`
+	Selector   selector.Sel `yaml:"selector"`
+	Spec       Spec         `yaml:"spec"`
+}
+
+type Meta struct {
+	Name string `yaml:"name"`
+}
+
+type Spec struct {
+	Entries []Entry `yaml:"entries"`
+}
+
+// Entry is one limits.conf line: <domain> <type> <item> <value>.
+type Entry struct {
+	Domain string `yaml:"domain"` // user, @group, %group, *, or uid range like 1000:
+	Type   string `yaml:"type"`   // soft, hard or -
+	Item   string `yaml:"item"`   // nofile, nproc, memlock, ...
+	Value  string `yaml:"value"`  // integer, unlimited or infinity
+}
+
+// TargetPath returns the rendered file path for this policy.
+func TargetPath(name string) string {
+	return "/etc/security/limits.d/60-lgpo-" + name + ".conf"
+}
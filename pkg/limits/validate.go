@@ -0,0 +1,52 @@
+package limits
+
+import (
+	"fmt"
+	"regexp"
+)
+
+var (
+	nameRe   = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+	domainRe = regexp.MustCompile(`^(\*|[@%]?[a-z_][a-z0-9_-]*\$?|@?[0-9]*:[0-9]*|[0-9]+)$`)
+	valueRe  = regexp.MustCompile(`^(-?[0-9]+|unlimited|infinity)$`)
+)
+
+// items are the limits.conf(5) items pam_limits understands.
+var items = map[string]bool{
+	"core": true, "data": true, "fsize": true, "memlock": true, "nofile": true,
+	"rss": true, "stack": true, "cpu": true, "nproc": true, "as": true,
+	"maxlogins": true, "maxsyslogins": true, "nonewprivs": true, "priority": true,
+	"locks": true, "sigpending": true, "msgqueue": true, "nice": true,
+	"rtprio": true, "chroot": true,
+}
+
+var types = map[string]bool{"soft": true, "hard": true, "-": true}
+
+// Validate rejects anything pam_limits would skip or misparse: a bad line
+// there is silently ignored at login, so catch it here.
+func (p *Policy) Validate() error {
+	if p.Kind != "LimitsPolicy" {
+		return fmt.Errorf("kind must be LimitsPolicy")
+	}
+	if !nameRe.MatchString(p.Metadata.Name) {
+		return fmt.Errorf("invalid metadata.name %q", p.Metadata.Name)
+	}
+	if len(p.Spec.Entries) == 0 {
+		return fmt.Errorf("spec.entries must be non-empty")
+	}
+	for i, e := range p.Spec.Entries {
+		if e.Domain == ":" || !domainRe.MatchString(e.Domain) {
+			return fmt.Errorf("entries[%d]: invalid domain %q", i, e.Domain)
+		}
+		if !types[e.Type] {
+			return fmt.Errorf("entries[%d]: type must be soft, hard or -, got %q", i, e.Type)
+		}
+		if !items[e.Item] {
+			return fmt.Errorf("entries[%d]: unknown item %q", i, e.Item)
+		}
+		if !valueRe.MatchString(e.Value) {
+			return fmt.Errorf("entries[%d]: value %q must be an integer, unlimited or infinity", i, e.Value)
+		}
+	}
+	return nil
+}
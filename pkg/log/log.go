@@ -3,23 +3,84 @@ package log
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
+	"sync"
 	"time"
 )
 
-type Logger struct{}
+// MinSecretLen is the shortest value Redact masks: a short one such as "1"
+// or "eu" would also hide every unrelated field that happens to equal it.
+const MinSecretLen = 4
 
-func New() *Logger { return &Logger{} }
+type Logger struct {
+	mu         sync.Mutex // lines from concurrent post-steps must not interleave
+	debug      bool
+	out        io.Writer
+	redactKeys map[string]bool // fields always shown as ***
+	secrets    map[string]bool // values shown as *** wherever a whole field equals one
+}
+
+func New() *Logger { return &Logger{out: os.Stdout} }
+
+// NewTo logs JSON lines to w instead of stdout, e.g. io.Discard when the
+// agent is embedded in another program.
+func NewTo(w io.Writer) *Logger { return &Logger{out: w} }
 
 func (l *Logger) log(level, msg string, kv ...string) {
-	m := map[string]any{"ts": time.Now().UTC().Format(time.RFC3339), "level": level, "msg": msg}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	clean := func(s string) string {
+		if l.secrets[s] {
+			return "***"
+		}
+		return s
+	}
+	m := map[string]any{"ts": time.Now().UTC().Format(time.RFC3339), "level": level, "msg": clean(msg)}
 	for i := 0; i+1 < len(kv); i += 2 {
-		m[kv[i]] = kv[i+1]
+		v := clean(kv[i+1])
+		if l.redactKeys[kv[i]] {
+			v = "***"
+		}
+		m[clean(kv[i])] = v
 	}
 	b, _ := json.Marshal(m)
-	fmt.Fprintln(os.Stdout, string(b))
+	fmt.Fprintln(l.out, string(b))
 }
 
+// Redact makes every following line show *** for the fields named in keys
+// and for any field whose whole value is one of secrets. Values are not
+// replaced inside longer text, and secrets shorter than MinSecretLen are
+// ignored.
+func (l *Logger) Redact(keys, secrets []string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.redactKeys, l.secrets = nil, nil
+	for _, k := range keys {
+		if l.redactKeys == nil {
+			l.redactKeys = map[string]bool{}
+		}
+		l.redactKeys[k] = true
+	}
+	for _, s := range secrets {
+		if len(s) < MinSecretLen {
+			continue
+		}
+		if l.secrets == nil {
+			l.secrets = map[string]bool{}
+		}
+		l.secrets[s] = true
+	}
+}
+
+// SetDebug enables Debug output.
+func (l *Logger) SetDebug(on bool) { l.debug = on }
+
+func (l *Logger) Debug(msg string, kv ...string) {
+	if l.debug {
+		l.log("debug", msg, kv...)
+	}
+}
 func (l *Logger) Info(msg string, kv ...string)  { l.log("info", msg, kv...) }
 func (l *Logger) Warn(msg string, kv ...string)  { l.log("warn", msg, kv...) }
 func (l *Logger) Error(msg string, kv ...string) { l.log("error", msg, kv...) }
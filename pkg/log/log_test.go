@@ -0,0 +1,42 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestRedact(t *testing.T) {
+	tests := []struct {
+		name    string
+		keys    []string
+		secrets []string
+		kv      []string
+		want    map[string]string
+	}{
+		{"whole value", nil, []string{"ACME-1234"}, []string{"tag", "ACME-1234"}, map[string]string{"tag": "***"}},
+		{"not inside text", nil, []string{"ACME-1234"}, []string{"detail", "asset ACME-1234 missing"}, map[string]string{"detail": "asset ACME-1234 missing"}},
+		{"configured key", []string{"asset.tag"}, nil, []string{"asset.tag", "anything"}, map[string]string{"asset.tag": "***"}},
+		{"short secret ignored", nil, []string{"eu"}, []string{"region", "eu", "path", "/etc/eu"}, map[string]string{"region": "eu", "path": "/etc/eu"}},
+		{"other fields untouched", []string{"license"}, []string{"s3cr3t-key"}, []string{"path", "/etc/x", "license", "ABC"}, map[string]string{"path": "/etc/x", "license": "***"}},
+		{"reset", nil, nil, []string{"tag", "ACME-1234"}, map[string]string{"tag": "ACME-1234"}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			l := NewTo(&buf)
+			l.Redact([]string{"x"}, []string{"ACME-1234"})
+			l.Redact(tc.keys, tc.secrets)
+			l.Info("msg", tc.kv...)
+			var got map[string]string
+			if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			for k, v := range tc.want {
+				if got[k] != v {
+					t.Errorf("%s = %q, want %q", k, got[k], v)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package modprobe
+
+import "fmt"
+
+// directive describes what a policy writes for each of its modules.
+func directive(p *Policy) string {
+	if cmd := p.Spec.installCmd(); cmd != "" {
+		return "blacklist + install " + cmd
+	}
+	return "blacklist"
+}
+
+// Conflicts reports modules managed by more than one policy with different
+// directives (e.g. only blacklisted in one, hard-blocked via install in
+// another), which makes the combined /etc/modprobe.d behavior ambiguous.
+// Each policy is checked against every earlier owner of the module, so each
+// conflicting pair is reported once.
+func Conflicts(ps []*Policy) []string {
+	type owner struct{ policy, directive string }
+	seen := map[string][]owner{}
+	var out []string
+	for _, p := range ps {
+		d := directive(p)
+		for _, raw := range p.modules() {
+			canon, _ := normalize(raw)
+			owned := false
+			for _, o := range seen[canon] {
+				if o.policy == p.Metadata.Name {
+					owned = true
+					continue
+				}
+				if o.directive != d {
+					out = append(out, fmt.Sprintf("module %s: policy %s sets %q but policy %s sets %q",
+						canon, o.policy, o.directive, p.Metadata.Name, d))
+				}
+			}
+			if !owned {
+				seen[canon] = append(seen[canon], owner{p.Metadata.Name, d})
+			}
+		}
+	}
+	return out
+}
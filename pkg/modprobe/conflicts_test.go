@@ -0,0 +1,43 @@
+package modprobe
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestConflicts(t *testing.T) {
+	pol := func(name string, installFalse bool, mods ...string) *Policy {
+		p := &Policy{}
+		p.Metadata.Name = name
+		p.Spec.Blacklist = mods
+		p.Spec.InstallFalse = installFalse
+		return p
+	}
+	tests := []struct {
+		name string
+		ps   []*Policy
+		want []string
+	}{
+		{"same directive", []*Policy{pol("a", false, "usb-storage"), pol("b", false, "usb_storage")}, nil},
+		{"two owners", []*Policy{pol("a", false, "usb-storage"), pol("b", true, "usb_storage")},
+			[]string{`module usb_storage: policy a sets "blacklist" but policy b sets "blacklist + install /bin/false"`}},
+		{"conflict with a later owner", []*Policy{pol("a", true, "uas"), pol("b", true, "uas"), pol("c", false, "uas")},
+			[]string{
+				`module uas: policy a sets "blacklist + install /bin/false" but policy c sets "blacklist"`,
+				`module uas: policy b sets "blacklist + install /bin/false" but policy c sets "blacklist"`,
+			}},
+		{"conflict with a non-first owner", []*Policy{pol("a", false, "uas"), pol("b", true, "uas"), pol("c", true, "uas")},
+			[]string{
+				`module uas: policy a sets "blacklist" but policy b sets "blacklist + install /bin/false"`,
+				`module uas: policy a sets "blacklist" but policy c sets "blacklist + install /bin/false"`,
+			}},
+		{"module listed twice in one policy", []*Policy{pol("a", false, "uas", "uas"), pol("b", false, "uas")}, nil},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := Conflicts(tc.ps); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("Conflicts = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
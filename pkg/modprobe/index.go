@@ -0,0 +1,103 @@
+package modprobe
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ModuleIndex lists the module names available on a host. Swap it out to
+// expand blacklistGlob against something other than the running kernel.
+type ModuleIndex func() ([]string, error)
+
+// HostIndex reads /lib/modules/<running kernel>/modules.dep.
+var HostIndex ModuleIndex = func() ([]string, error) {
+	rel, err := os.ReadFile("/proc/sys/kernel/osrelease")
+	if err != nil {
+		return nil, err
+	}
+	return ReadModulesDep(filepath.Join("/lib/modules", strings.TrimSpace(string(rel)), "modules.dep"))
+}
+
+// ReadModulesDep returns the module names listed in a modules.dep file,
+// e.g. "kernel/drivers/usb/storage/usb-storage.ko.zst: ..." -> usb_storage.
+func ReadModulesDep(file string) ([]string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var out []string
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		mod, _, ok := strings.Cut(sc.Text(), ":")
+		if !ok {
+			continue
+		}
+		name := path.Base(mod)
+		if i := strings.Index(name, ".ko"); i > 0 {
+			name = name[:i]
+		}
+		canon, _ := normalize(name)
+		out = append(out, canon)
+	}
+	return out, sc.Err()
+}
+
+// expandGlobs matches every glob (in underscore form) against the index and
+// returns the sorted, de-duplicated module names.
+func expandGlobs(globs []string, idx ModuleIndex) ([]string, error) {
+	if len(globs) == 0 {
+		return nil, nil
+	}
+	if idx == nil {
+		return nil, fmt.Errorf("spec.blacklistGlob needs a module index")
+	}
+	mods, err := idx()
+	if err != nil {
+		return nil, fmt.Errorf("module index: %w", err)
+	}
+	seen := map[string]struct{}{}
+	var out []string
+	for _, g := range globs {
+		pat := normalizeGlob(g)
+		for _, m := range mods {
+			if _, ok := seen[m]; ok {
+				continue
+			}
+			if ok, _ := path.Match(pat, m); ok {
+				seen[m] = struct{}{}
+				out = append(out, m)
+			}
+		}
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+// normalizeGlob is normalize for a blacklistGlob: literal hyphens become
+// underscores, but a hyphen between two characters of a [...] class is a
+// range ([0-9], [a-z]) and is kept.
+func normalizeGlob(g string) string {
+	g = strings.ToLower(g)
+	var b strings.Builder
+	class := -1 // index of the open '[', or -1 outside a class
+	for i := 0; i < len(g); i++ {
+		c := g[i]
+		switch {
+		case class < 0 && c == '[':
+			class = i
+		case class >= 0 && c == ']' && i > class+1:
+			class = -1
+		case c == '-' && (class < 0 || i == class+1 || i+1 < len(g) && g[i+1] == ']'):
+			c = '_'
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
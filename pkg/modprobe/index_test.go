@@ -0,0 +1,51 @@
+package modprobe
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNormalizeGlob(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"usb-storage", "usb_storage"},
+		{"USB-*", "usb_*"},
+		{"snd-hda-[0-9]*", "snd_hda_[0-9]*"},
+		{"cdc_[a-z]*", "cdc_[a-z]*"},
+		{"dvb-[a-c0-3]", "dvb_[a-c0-3]"},
+		{"x[-a]", "x[_a]"},
+		{"x[a-]", "x[a_]"},
+		{"x[]-]", "x[]_]"},
+		{"b?-*", "b?_*"},
+	}
+	for _, tc := range tests {
+		if got := normalizeGlob(tc.in); got != tc.want {
+			t.Errorf("normalizeGlob(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestExpandGlobs(t *testing.T) {
+	idx := func() ([]string, error) {
+		return []string{"snd_hda_intel", "snd_hda_codec", "snd_hda_0", "snd_hda_7x", "usb_storage", "uas", "cdc_acm", "cdc_ether", "cdc_9"}, nil
+	}
+	tests := []struct {
+		globs []string
+		want  []string
+	}{
+		{[]string{"usb-storage"}, []string{"usb_storage"}},
+		{[]string{"snd-hda-[0-9]*"}, []string{"snd_hda_0", "snd_hda_7x"}},
+		{[]string{"cdc_[a-z]*"}, []string{"cdc_acm", "cdc_ether"}},
+		{[]string{"snd_hda_[a-c]*", "cdc-*"}, []string{"cdc_9", "cdc_acm", "cdc_ether", "snd_hda_codec"}},
+		{[]string{"snd?hda?[0-9]*"}, []string{"snd_hda_0", "snd_hda_7x"}},
+		{[]string{"nope-*"}, nil},
+	}
+	for _, tc := range tests {
+		got, err := expandGlobs(tc.globs, idx)
+		if err != nil {
+			t.Fatalf("expandGlobs(%v): %v", tc.globs, err)
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("expandGlobs(%v) = %v, want %v", tc.globs, got, tc.want)
+		}
+	}
+}
@@ -9,20 +9,24 @@ import (
 
 // Render returns the modprobe configuration bytes and the list of
 // normalized module names (underscore form) that should be considered
-// for runtime unloading when InstantApply is set.
-func Render(p *Policy) (conf []byte, modules []string, err error) {
+// for runtime unloading when InstantApply is set. blacklistGlob entries are
+// expanded against idx into concrete module names.
+func Render(p *Policy, idx ModuleIndex) (conf []byte, modules []string, err error) {
 	if err := p.Validate(); err != nil {
 		return nil, nil, err
 	}
+	if p.globbed, err = expandGlobs(p.Spec.BlacklistGlob, idx); err != nil {
+		return nil, nil, err
+	}
 
 	seen := map[string]struct{}{}
 	out := &bytes.Buffer{}
-	mods := make([]string, 0, len(p.Spec.Blacklist))
+	mods := make([]string, 0, len(p.Spec.Blacklist)+len(p.globbed))
 
 	// Write a header banner
 	fmt.Fprintf(out, "# generated by lgpo (modprobe) for policy %s\n", p.Metadata.Name)
 
-	for _, raw := range p.Spec.Blacklist {
+	for _, raw := range p.modules() {
 		canon, alias := normalize(raw)
 		if _, ok := seen[canon]; ok {
 			continue
@@ -36,10 +40,10 @@ func Render(p *Policy) (conf []byte, modules []string, err error) {
 			fmt.Fprintf(out, "blacklist %s\n", alias)
 		}
 
-		if p.Spec.InstallFalse {
-			fmt.Fprintf(out, "install %s /bin/false\n", canon)
+		if cmd := p.Spec.installCmd(); cmd != "" {
+			fmt.Fprintf(out, "install %s %s\n", canon, cmd)
 			if alias != canon {
-				fmt.Fprintf(out, "install %s /bin/false\n", alias)
+				fmt.Fprintf(out, "install %s %s\n", alias, cmd)
 			}
 		}
 	}
@@ -0,0 +1,43 @@
+package modprobe
+
+import "testing"
+
+func TestRenderInstallCommand(t *testing.T) {
+	tests := []struct {
+		name         string
+		installFalse bool
+		command      string
+		want         string
+	}{
+		{"blacklist only", false, "", "blacklist usb_storage\nblacklist usb-storage\n"},
+		{"installFalse", true, "", "blacklist usb_storage\nblacklist usb-storage\ninstall usb_storage /bin/false\ninstall usb-storage /bin/false\n"},
+		{"installCommand wins", true, "/usr/local/libexec/lgpo/deny",
+			"blacklist usb_storage\nblacklist usb-storage\ninstall usb_storage /usr/local/libexec/lgpo/deny\ninstall usb-storage /usr/local/libexec/lgpo/deny\n"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			p := &Policy{Kind: "ModprobePolicy"}
+			p.Metadata.Name = "usb"
+			p.Spec.Blacklist = []string{"usb-storage"}
+			p.Spec.InstallFalse, p.Spec.InstallCommand = tc.installFalse, tc.command
+			conf, mods, err := Render(p, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := "# generated by lgpo (modprobe) for policy usb\n" + tc.want; string(conf) != want {
+				t.Errorf("conf =\n%s\nwant\n%s", conf, want)
+			}
+			if len(mods) != 1 || mods[0] != "usb_storage" {
+				t.Errorf("modules = %q", mods)
+			}
+		})
+	}
+
+	p := &Policy{Kind: "ModprobePolicy"}
+	p.Metadata.Name = "usb"
+	p.Spec.Blacklist = []string{"usb-storage"}
+	p.Spec.InstallCommand = "/bin/sh"
+	if conf, _, err := Render(p, nil); err == nil {
+		t.Errorf("rendered a disallowed installCommand:\n%s", conf)
+	}
+}
@@ -2,59 +2,32 @@
 package modprobe
 
 import (
-	"fmt"
-	"regexp"
 	"strings"
+
+	"github.com/lgpo-org/lgpod/pkg/selector"
 )
 
 type Policy struct {
-	APIVersion string  `yaml:"apiVersion"`
-	Kind       string  `yaml:"kind"`
-	Metadata   Meta    `yaml:"metadata"`
-	Selector   Sel     `yaml:"selector"`
-	Spec       Spec    `yaml:"spec"`
+	APIVersion string       `yaml:"apiVersion"`
+	Kind       string       `yaml:"kind"`
+	Metadata   Meta         `yaml:"metadata"`
+	Selector   selector.Sel `yaml:"selector"`
+	Spec       Spec         `yaml:"spec"`
+
+	globbed []string // blacklistGlob matches, filled by Render
 }
 
 type Meta struct {
 	Name string `yaml:"name"`
 }
 
-type Sel struct {
-	Facts         map[string]string      `yaml:"facts"`
-	Tags          map[string]any         `yaml:"tags"`
-	HostnameRegex string                 `yaml:"hostnameRegex"`
-}
-
 type Spec struct {
 	Blacklist       []string `yaml:"blacklist"`
+	BlacklistGlob   []string `yaml:"blacklistGlob"` // expanded against the module index at render time
 	InstallFalse    bool     `yaml:"installFalse"`
+	InstallCommand  string   `yaml:"installCommand"` // replaces /bin/false; see installAllowed
 	UpdateInitramfs bool     `yaml:"updateInitramfs"`
-	InstantApply    bool     `yaml:"instantApply"` 
-}
-
-var (
-	// linux module name: keep it simple & safe
-	modNameRe = regexp.MustCompile(`^[a-z0-9]([-_a-z0-9]*[a-z0-9])?$`)
-	nameRe    = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
-)
-
-// Validate performs strict checks mirrored from your MVP.
-func (p *Policy) Validate() error {
-	if p.Kind != "ModprobePolicy" {
-		return fmt.Errorf("kind must be ModprobePolicy")
-	}
-	if !nameRe.MatchString(p.Metadata.Name) {
-		return fmt.Errorf("invalid metadata.name %q", p.Metadata.Name)
-	}
-	if len(p.Spec.Blacklist) == 0 {
-		return fmt.Errorf("spec.blacklist must be non-empty")
-	}
-	for _, m := range p.Spec.Blacklist {
-		if !modNameRe.MatchString(m) {
-			return fmt.Errorf("invalid module name %q", m)
-		}
-	}
-	return nil
+	InstantApply    bool     `yaml:"instantApply"`
 }
 
 // TargetPath returns the rendered file path for this policy.
@@ -62,6 +35,23 @@ func TargetPath(name string) string {
 	return "/etc/modprobe.d/60-lgpo-" + name + ".conf"
 }
 
+// modules returns the listed and glob-expanded module names, as written.
+func (p *Policy) modules() []string {
+	return append(append([]string(nil), p.Spec.Blacklist...), p.globbed...)
+}
+
+// installCmd returns the command rendered into `install <mod> <cmd>` lines,
+// or "" when the policy only blacklists.
+func (s Spec) installCmd() string {
+	if s.InstallCommand != "" {
+		return s.InstallCommand
+	}
+	if s.InstallFalse {
+		return "/bin/false"
+	}
+	return ""
+}
+
 // normalize takes a module and returns a canonical form (underscores),
 // plus its hyphen-alias for redundancy in config rendering.
 func normalize(mod string) (canon string, alias string) {
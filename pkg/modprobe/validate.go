@@ -2,6 +2,7 @@ package modprobe
 
 import (
     "fmt"
+    "path"
     "regexp"
     "sort"
     "strings"
@@ -9,11 +10,34 @@ import (
 
 var reName = regexp.MustCompile(`^[a-zA-Z0-9._-]+$`)
 var reModule = regexp.MustCompile(`^[a-z0-9]([-_a-z0-9]*[a-z0-9])?$`)
+// modprobe runs install commands through /bin/sh: no spaces or metachars
+var reCommand = regexp.MustCompile(`^/[A-Za-z0-9._/-]+$`)
+// module name characters plus path.Match wildcards
+var reGlob = regexp.MustCompile(`^[-_a-z0-9*?\[\]]+$`)
+
+// installAllowed lists the accepted installCommand values; anything under
+// installDir (site-provided scripts) is accepted too.
+var installAllowed = map[string]bool{
+    "/bin/false": true, "/bin/true": true,
+    "/usr/bin/false": true, "/usr/bin/true": true,
+}
+
+const installDir = "/usr/local/libexec/lgpo/"
+
+func validInstallCommand(cmd string) error {
+    if !reCommand.MatchString(cmd) || path.Clean(cmd) != cmd {
+        return fmt.Errorf("installCommand %q must be a plain absolute path", cmd)
+    }
+    if !installAllowed[cmd] && !strings.HasPrefix(cmd, installDir) {
+        return fmt.Errorf("installCommand %q not allowed (use /bin/true, /bin/false or a script under %s)", cmd, installDir)
+    }
+    return nil
+}
 
 func (p *Policy) Validate() error {
     if p.Kind != "ModprobePolicy" { return fmt.Errorf("kind must be ModprobePolicy") }
     if !reName.MatchString(p.Metadata.Name) { return fmt.Errorf("metadata.name invalid") }
-    if len(p.Spec.Blacklist) == 0 { return fmt.Errorf("blacklist empty") }
+    if len(p.Spec.Blacklist) == 0 && len(p.Spec.BlacklistGlob) == 0 { return fmt.Errorf("blacklist and blacklistGlob empty") }
     norm := make([]string,0,len(p.Spec.Blacklist)*2)
     seen := map[string]bool{}
     for _, m := range p.Spec.Blacklist {
@@ -25,6 +49,13 @@ func (p *Policy) Validate() error {
     }
     sort.Strings(norm)
     p.Spec.Blacklist = norm
+    for _, g := range p.Spec.BlacklistGlob {
+        if !reGlob.MatchString(g) { return fmt.Errorf("bad blacklistGlob %q", g) }
+        if _, err := path.Match(g, ""); err != nil { return fmt.Errorf("bad blacklistGlob %q: %w", g, err) }
+    }
+    if p.Spec.InstallCommand != "" {
+        if err := validInstallCommand(p.Spec.InstallCommand); err != nil { return err }
+    }
     return nil
 }
 func alts(m string) []string {
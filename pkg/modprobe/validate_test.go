@@ -0,0 +1,53 @@
+package modprobe
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidateNormalizesBlacklist(t *testing.T) {
+	p := &Policy{Kind: "ModprobePolicy"}
+	p.Metadata.Name = "usb"
+	p.Spec.Blacklist = []string{" usb-storage ", "usb_storage", "cramfs", "uas\n"}
+	if err := p.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"cramfs", "uas", "usb-storage", "usb_storage"}
+	if !reflect.DeepEqual(p.Spec.Blacklist, want) {
+		t.Errorf("blacklist = %q, want %q", p.Spec.Blacklist, want)
+	}
+}
+
+func TestValidateInstallCommand(t *testing.T) {
+	tests := []struct {
+		cmd     string
+		wantErr string
+	}{
+		{"/bin/true", ""},
+		{"/usr/bin/false", ""},
+		{"/usr/local/libexec/lgpo/log-and-deny", ""},
+		{"/usr/local/libexec/lgpo/../../bin/sh", "plain absolute path"},
+		{"/bin/sh -c reboot", "plain absolute path"},
+		{"/bin/false;reboot", "plain absolute path"},
+		{"false", "plain absolute path"},
+		{"/usr/bin/logger", "not allowed"},
+		{"/usr/local/libexec/lgpo", "not allowed"},
+	}
+	for _, tc := range tests {
+		p := &Policy{Kind: "ModprobePolicy"}
+		p.Metadata.Name = "usb"
+		p.Spec.Blacklist = []string{"usb-storage"}
+		p.Spec.InstallCommand = tc.cmd
+		err := p.Validate()
+		if tc.wantErr == "" {
+			if err != nil {
+				t.Errorf("%q: %v", tc.cmd, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+			t.Errorf("%q: err = %v, want %q", tc.cmd, err, tc.wantErr)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package pam
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// moduleDirGlobs are where Linux-PAM looks for modules across distributions.
+var moduleDirGlobs = []string{
+	"/lib/security", "/lib64/security", "/usr/lib/security", "/usr/lib64/security",
+	"/lib/*-linux-gnu*/security", "/usr/lib/*-linux-gnu*/security",
+}
+
+// FindModule returns the path of module in the PAM module dirs under root
+// ("" for the running system), or "" when none has it.
+func FindModule(root, module string) string {
+	for _, g := range moduleDirGlobs {
+		dirs, _ := filepath.Glob(filepath.Join(root, g))
+		for _, d := range dirs {
+			p := filepath.Join(d, module)
+			if fi, err := os.Stat(p); err == nil && fi.Mode().IsRegular() {
+				return p
+			}
+		}
+	}
+	return ""
+}
+
+// Check reads a rendered pam.d file back: every line must split into type,
+// control and module again, and every module must be an ELF file in the
+// module dirs under root. PAM treats a missing module as a failing one, so a
+// snippet naming a module this host lacks would deny every login it is
+// included in.
+func Check(root string, data []byte) error {
+	n := 0
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		n++
+		typ, rest, _ := strings.Cut(line, " ")
+		control := ""
+		if strings.HasPrefix(rest, "[") {
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return fmt.Errorf("line %d: unterminated control", i+1)
+			}
+			control, rest = rest[:end+1], strings.TrimSpace(rest[end+1:])
+		} else {
+			control, rest, _ = strings.Cut(rest, " ")
+		}
+		module, _, _ := strings.Cut(rest, " ")
+		if !types[typ] || validControl(control) != nil || !moduleRe.MatchString(module) {
+			return fmt.Errorf("line %d: does not parse as <type> <control> <module>: %q", i+1, line)
+		}
+		if err := checkModule(root, module); err != nil {
+			return fmt.Errorf("line %d: %w", i+1, err)
+		}
+	}
+	if n == 0 {
+		return fmt.Errorf("no rules")
+	}
+	return nil
+}
+
+// checkModule finds module (a bare name, or an absolute path as foreign
+// stack files may use) under root and requires it to be an ELF file.
+func checkModule(root, module string) error {
+	p := filepath.Join(root, module)
+	if !filepath.IsAbs(module) {
+		if p = FindModule(root, module); p == "" {
+			return fmt.Errorf("module %s is not installed", module)
+		}
+	}
+	if b, err := readHead(p, 4); err != nil || !bytes.Equal(b, []byte("\x7fELF")) {
+		return fmt.Errorf("%s is not a loadable module", p)
+	}
+	return nil
+}
+
+func readHead(path string, n int) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	b := make([]byte, n)
+	if _, err := f.Read(b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
@@ -0,0 +1,21 @@
+package pam
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// Render returns the pam.d file for p, one line per rule in spec order.
+func Render(p *Policy) ([]byte, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	out := &bytes.Buffer{}
+	fmt.Fprintf(out, "# generated by lgpo (pam) for policy %s\n", p.Metadata.Name)
+	for _, r := range p.Spec.Rules {
+		line := []string{r.Type, strings.Join(strings.Fields(r.Control), " "), r.Module}
+		fmt.Fprintln(out, strings.Join(append(line, r.Args...), " "))
+	}
+	return out.Bytes(), nil
+}
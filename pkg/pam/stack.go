@@ -0,0 +1,162 @@
+package pam
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// maxIncludeDepth bounds how far CheckStack follows includes; Linux-PAM
+// itself gives up on deeper stacks.
+const maxIncludeDepth = 16
+
+// stackLine is one line of a pam.d file as Linux-PAM reads it: either an
+// include of another file or a module.
+type stackLine struct {
+	num      int
+	include  string // target of @include, include or substack
+	module   string // module name or absolute path
+	optional bool   // "-type": a missing module is skipped, not a failure
+}
+
+// parseStack splits any pam.d file, not only ones lgpo rendered, into its
+// lines. Backslash continuations are joined and comments dropped.
+func parseStack(data []byte) ([]stackLine, error) {
+	var out []stackLine
+	lines := strings.Split(string(data), "\n")
+	for i := 0; i < len(lines); i++ {
+		num, s := i+1, lines[i]
+		for strings.HasSuffix(s, "\\") && i+1 < len(lines) {
+			i++
+			s = strings.TrimSuffix(s, "\\") + " " + lines[i]
+		}
+		if c := strings.IndexByte(s, '#'); c >= 0 {
+			s = s[:c]
+		}
+		f := strings.Fields(s)
+		if len(f) == 0 {
+			continue
+		}
+		if f[0] == "@include" {
+			if len(f) != 2 {
+				return nil, fmt.Errorf("line %d: @include wants one file", num)
+			}
+			out = append(out, stackLine{num: num, include: f[1]})
+			continue
+		}
+		typ := strings.ToLower(f[0])
+		l := stackLine{num: num, optional: strings.HasPrefix(typ, "-")}
+		if !types[strings.TrimPrefix(typ, "-")] {
+			return nil, fmt.Errorf("line %d: unknown type %q", num, f[0])
+		}
+		rest := strings.TrimSpace(strings.TrimSpace(s)[len(f[0]):])
+		control := ""
+		if strings.HasPrefix(rest, "[") {
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("line %d: unterminated control", num)
+			}
+			control, rest = rest[:end+1], rest[end+1:]
+		} else {
+			control, rest, _ = strings.Cut(rest, " ")
+		}
+		target := strings.Fields(rest)
+		if len(target) == 0 {
+			return nil, fmt.Errorf("line %d: no module", num)
+		}
+		switch strings.ToLower(control) {
+		case "include", "substack":
+			l.include = target[0]
+		default:
+			l.module = target[0]
+		}
+		out = append(out, l)
+	}
+	return out, nil
+}
+
+// Includers lists the files in dir (a pam.d directory) that pull in the
+// file name, by "@include name" or an include or substack control. A file
+// that does not parse counts when it mentions name at all: removing a
+// snippet something may still include locks users out.
+func Includers(dir, name string) []string {
+	ents, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	var out []string
+	for _, e := range ents {
+		if e.IsDir() || e.Name() == name || strings.HasSuffix(e.Name(), ".lgpo-tmp") {
+			continue
+		}
+		b, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			continue
+		}
+		lines, err := parseStack(b)
+		if err != nil {
+			if strings.Contains(string(b), name) {
+				out = append(out, e.Name())
+			}
+			continue
+		}
+		for _, l := range lines {
+			if l.include == name || l.include == filepath.Join("/etc/pam.d", name) {
+				out = append(out, e.Name())
+				break
+			}
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// CheckStack verifies the installed stack around the file name in dir (the
+// pam.d directory under root): every service file including it must parse,
+// every file it includes in turn must exist, and every module they name must
+// be installed under root.
+func CheckStack(root, dir, name string) error {
+	seen := map[string]bool{}
+	for _, f := range append([]string{name}, Includers(dir, name)...) {
+		if err := checkStackFile(root, dir, f, seen, 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkStackFile(root, dir, name string, seen map[string]bool, depth int) error {
+	if seen[name] {
+		return nil
+	}
+	seen[name] = true
+	if depth > maxIncludeDepth {
+		return fmt.Errorf("%s: includes nested deeper than %d", name, maxIncludeDepth)
+	}
+	path := filepath.Join(dir, name)
+	if filepath.IsAbs(name) {
+		path = filepath.Join(root, name)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	lines, err := parseStack(b)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	for _, l := range lines {
+		if l.include != "" {
+			if err := checkStackFile(root, dir, l.include, seen, depth+1); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := checkModule(root, l.module); err != nil && !l.optional {
+			return fmt.Errorf("%s line %d: %w", name, l.num, err)
+		}
+	}
+	return nil
+}
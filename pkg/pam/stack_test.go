@@ -0,0 +1,118 @@
+package pam
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fakeRoot is a root with pam_unix.so and pam_faillock.so installed and the
+// given /etc/pam.d files.
+func fakeRoot(t *testing.T, files map[string]string) (root, dir string) {
+	t.Helper()
+	root = t.TempDir()
+	mods := filepath.Join(root, "usr/lib/x86_64-linux-gnu/security")
+	if err := os.MkdirAll(mods, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range []string{"pam_unix.so", "pam_faillock.so"} {
+		if err := os.WriteFile(filepath.Join(mods, m), []byte("\x7fELF..."), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(mods, "pam_text.so"), []byte("not a module"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	dir = filepath.Join(root, "etc/pam.d")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root, dir
+}
+
+func TestIncluders(t *testing.T) {
+	_, dir := fakeRoot(t, map[string]string{
+		"60-lgpo-base":  "auth required pam_faillock.so preauth\n",
+		"common-auth":   "auth required pam_unix.so\n@include 60-lgpo-base\n",
+		"sshd":          "auth include 60-lgpo-base\n",
+		"su":            "auth substack /etc/pam.d/60-lgpo-base\n",
+		"login":         "# @include 60-lgpo-base\nauth required pam_unix.so\n",
+		"broken":        "bogus 60-lgpo-base\n",
+		"other":         "@include common-auth\n",
+		"60-lgpo-other": "auth include 60-lgpo-basement\n",
+	})
+	want := []string{"broken", "common-auth", "sshd", "su"}
+	if got := Includers(dir, "60-lgpo-base"); !reflect.DeepEqual(got, want) {
+		t.Errorf("Includers = %v, want %v", got, want)
+	}
+	if got := Includers(dir, "60-lgpo-none"); got != nil {
+		t.Errorf("Includers of an unused snippet = %v, want none", got)
+	}
+}
+
+func TestCheckStack(t *testing.T) {
+	const snippet = "auth required pam_faillock.so preauth\n"
+	tests := []struct {
+		name    string
+		files   map[string]string
+		wantErr string
+	}{
+		{"snippet alone", map[string]string{}, ""},
+		{"included by a good service", map[string]string{"common-auth": "auth required pam_unix.so\n@include 60-lgpo-t\n"}, ""},
+		{"nested includes", map[string]string{"common-auth": "@include 60-lgpo-t\n", "sshd": "@include common-auth\nauth include 60-lgpo-t\n"}, ""},
+		{"optional missing module", map[string]string{"common-auth": "-auth optional pam_gone.so\n@include 60-lgpo-t\n"}, ""},
+		{"continuation line", map[string]string{"common-auth": "auth required \\\n  pam_unix.so\n@include 60-lgpo-t\n"}, ""},
+		{"include loop", map[string]string{"a": "@include b\n@include 60-lgpo-t\n", "b": "@include a\n"}, ""},
+		{"missing module in includer", map[string]string{"common-auth": "auth required pam_gone.so\n@include 60-lgpo-t\n"}, "common-auth line 1: module pam_gone.so is not installed"},
+		{"not a module in includer", map[string]string{"common-auth": "@include 60-lgpo-t\nauth required pam_text.so\n"}, "is not a loadable module"},
+		{"absolute module path", map[string]string{"common-auth": "@include 60-lgpo-t\nauth required /lib/security/pam_gone.so\n"}, "is not a loadable module"},
+		{"includer includes a missing file", map[string]string{"common-auth": "@include 60-lgpo-t\n@include common-gone\n"}, "common-gone"},
+		{"includer does not parse", map[string]string{"common-auth": "@include 60-lgpo-t\nauth [default=die pam_unix.so\n"}, "unterminated control"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			files := map[string]string{"60-lgpo-t": snippet}
+			for k, v := range tc.files {
+				files[k] = v
+			}
+			root, dir := fakeRoot(t, files)
+			err := CheckStack(root, dir, "60-lgpo-t")
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Fatalf("CheckStack: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("CheckStack = %v, want error containing %q", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheck(t *testing.T) {
+	root, _ := fakeRoot(t, nil)
+	tests := []struct {
+		data    string
+		wantErr string
+	}{
+		{"auth required pam_faillock.so preauth\n", ""},
+		{"auth [default=die] pam_faillock.so authfail\n", ""},
+		{"auth required pam_gone.so\n", "not installed"},
+		{"auth required pam_text.so\n", "not a loadable module"},
+		{"# nothing\n", "no rules"},
+	}
+	for _, tc := range tests {
+		err := Check(root, []byte(tc.data))
+		if (err == nil) != (tc.wantErr == "") || err != nil && !strings.Contains(err.Error(), tc.wantErr) {
+			t.Errorf("Check(%q) = %v, want %q", tc.data, err, tc.wantErr)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package pam
+
+import (
+	"github.com/lgpo-org/lgpod/pkg/selector"
+)
+
+type Policy struct {
+	APIVersion string       `yaml:"apiVersion"`
+	Kind       string       `yaml:"kind"`
+	Metadata   Meta         `yaml:"metadata"`
+	Selector   selector.Sel `yaml:"selector"`
+	Spec       Spec         `yaml:"spec"`
+}
+
+type Meta struct {
+	Name string `yaml:"name"`
+}
+
+type Spec struct {
+	Rules []Rule `yaml:"rules"`
+}
+
+// Rule is one PAM stack line: <type> <control> <module> [args...].
+type Rule struct {
+	Type    string   `yaml:"type"`    // auth, account, password or session
+	Control string   `yaml:"control"` // required, requisite, sufficient, optional or [value=action ...]
+	Module  string   `yaml:"module"`  // bare module file name, e.g. pam_faillock.so
+	Args    []string `yaml:"args"`    // e.g. [preauth, silent, deny=5]
+}
+
+// TargetPath returns the rendered file path for this policy. It is a file
+// of its own that services pull in with "@include 60-lgpo-<name>" (or
+// "auth include ..."); lgpo never edits the distribution's stack files.
+func TargetPath(name string) string {
+	return "/etc/pam.d/60-lgpo-" + name
+}
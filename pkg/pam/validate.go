@@ -0,0 +1,101 @@
+package pam
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// maxRules bounds a snippet; a baseline needs a handful of lines.
+const maxRules = 32
+
+var (
+	nameRe   = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+	moduleRe = regexp.MustCompile(`^pam_[a-z0-9_]+\.so$`)
+	// Arguments are single plain words. Spaces, brackets, quotes and # would
+	// change how the line is split or end it early.
+	argRe    = regexp.MustCompile(`^[A-Za-z0-9_.,/=:@+%-]+$`)
+	actionRe = regexp.MustCompile(`^[a-z_]+=(ignore|bad|die|ok|done|reset)$`)
+)
+
+var types = map[string]bool{"auth": true, "account": true, "password": true, "session": true}
+
+var controls = map[string]bool{"required": true, "requisite": true, "sufficient": true, "optional": true}
+
+// values are the return values a [value=action] control may name (pam.conf(5)).
+var values = map[string]bool{
+	"success": true, "open_err": true, "symbol_err": true, "service_err": true, "system_err": true,
+	"buf_err": true, "perm_denied": true, "auth_err": true, "cred_insufficient": true,
+	"authinfo_unavail": true, "user_unknown": true, "maxtries": true, "new_authtok_reqd": true,
+	"acct_expired": true, "session_err": true, "cred_unavail": true, "cred_expired": true,
+	"cred_err": true, "no_module_data": true, "conv_err": true, "authtok_err": true,
+	"authtok_recover_err": true, "authtok_lock_busy": true, "authtok_disable_aging": true,
+	"try_again": true, "ignore": true, "abort": true, "authtok_expired": true,
+	"module_unknown": true, "bad_item": true, "conv_again": true, "incomplete": true,
+	"default": true,
+}
+
+// refused are modules that, wherever they sit in a stack, let everyone in
+// (pam_permit), lock everyone out (pam_deny) or run arbitrary programs at
+// login (pam_exec).
+var refused = map[string]bool{"pam_permit.so": true, "pam_deny.so": true, "pam_exec.so": true}
+
+// Validate only accepts lines with one unambiguous reading. A bad PAM file
+// can lock every user out, so anything unusual is refused rather than passed
+// through: module paths, include/substack, jumps and the "-type" prefix.
+func (p *Policy) Validate() error {
+	if p.Kind != "PamPolicy" {
+		return fmt.Errorf("kind must be PamPolicy")
+	}
+	if !nameRe.MatchString(p.Metadata.Name) {
+		return fmt.Errorf("invalid metadata.name %q (letters, digits, _ and - only)", p.Metadata.Name)
+	}
+	if len(p.Spec.Rules) == 0 {
+		return fmt.Errorf("spec.rules must be non-empty")
+	}
+	if len(p.Spec.Rules) > maxRules {
+		return fmt.Errorf("spec.rules: at most %d rules, got %d", maxRules, len(p.Spec.Rules))
+	}
+	for i, r := range p.Spec.Rules {
+		if !types[r.Type] {
+			return fmt.Errorf("rules[%d]: type must be auth, account, password or session, got %q", i, r.Type)
+		}
+		if err := validControl(r.Control); err != nil {
+			return fmt.Errorf("rules[%d]: %w", i, err)
+		}
+		if !moduleRe.MatchString(r.Module) {
+			return fmt.Errorf("rules[%d]: invalid module %q (a file name like pam_faillock.so, no path)", i, r.Module)
+		}
+		if refused[r.Module] {
+			return fmt.Errorf("rules[%d]: module %s is not allowed", i, r.Module)
+		}
+		for _, a := range r.Args {
+			if !argRe.MatchString(a) {
+				return fmt.Errorf("rules[%d]: invalid argument %q (one word; no spaces, brackets, quotes or #)", i, a)
+			}
+		}
+	}
+	return nil
+}
+
+// validControl accepts the four keywords or a bracketed list of
+// value=action pairs. Jumps (value=N) are refused: in a snippet included
+// from another stack they would skip lines lgpo cannot see.
+func validControl(c string) error {
+	if controls[c] {
+		return nil
+	}
+	if !strings.HasPrefix(c, "[") || !strings.HasSuffix(c, "]") {
+		return fmt.Errorf("control must be required, requisite, sufficient, optional or [value=action ...], got %q", c)
+	}
+	pairs := strings.Fields(c[1 : len(c)-1])
+	if len(pairs) == 0 {
+		return fmt.Errorf("control %q is empty", c)
+	}
+	for _, kv := range pairs {
+		if !actionRe.MatchString(kv) || !values[kv[:strings.IndexByte(kv, '=')]] {
+			return fmt.Errorf("invalid control %q in %q (value=ignore|bad|die|ok|done|reset; jumps are not allowed)", kv, c)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,24 @@
+package polkit
+
+import "fmt"
+
+// Budget caps the size of a single rendered rules file. A zero or negative
+// field disables that check.
+type Budget struct {
+	MaxBytes int
+	MaxRules int
+}
+
+// OverBudget returns one warning per limit the rendered js of p exceeds.
+// Large rules files slow polkit's JS evaluation on every authorization check;
+// split such policies into several smaller ones.
+func OverBudget(p *Policy, js []byte, b Budget) []string {
+	var out []string
+	if b.MaxBytes > 0 && len(js) > b.MaxBytes {
+		out = append(out, fmt.Sprintf("%s: rendered rules are %d bytes (budget %d)", p.Metadata.Name, len(js), b.MaxBytes))
+	}
+	if b.MaxRules > 0 && len(p.Spec.Rules) > b.MaxRules {
+		out = append(out, fmt.Sprintf("%s: %d rules (budget %d)", p.Metadata.Name, len(p.Spec.Rules), b.MaxRules))
+	}
+	return out
+}
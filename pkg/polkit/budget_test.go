@@ -0,0 +1,30 @@
+package polkit
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestOverBudget(t *testing.T) {
+	p := &Policy{Metadata: Meta{Name: "big"}, Spec: Spec{Rules: make([]Rule, 3)}}
+	js := []byte(strings.Repeat("x", 100))
+	tests := []struct {
+		name   string
+		budget Budget
+		want   []string
+	}{
+		{"within", Budget{MaxBytes: 100, MaxRules: 3}, nil},
+		{"disabled", Budget{}, nil},
+		{"bytes", Budget{MaxBytes: 99, MaxRules: 3}, []string{"big: rendered rules are 100 bytes (budget 99)"}},
+		{"rules", Budget{MaxBytes: -1, MaxRules: 2}, []string{"big: 3 rules (budget 2)"}},
+		{"both", Budget{MaxBytes: 10, MaxRules: 1}, []string{"big: rendered rules are 100 bytes (budget 10)", "big: 3 rules (budget 1)"}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got := OverBudget(p, js, tc.budget)
+			if strings.Join(got, "|") != strings.Join(tc.want, "|") {
+				t.Errorf("OverBudget = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
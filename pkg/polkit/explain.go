@@ -0,0 +1,109 @@
+package polkit
+
+import (
+	"sort"
+	"strings"
+)
+
+// Request is a simulated polkit authorization check.
+type Request struct {
+	ActionID string
+	User     string
+	Groups   []string
+	Active   bool
+	Local    bool   // session on a local seat rather than remote
+	Seat     string // logind seat, e.g. seat0; "" for none
+	Unit     string // for unit_prefix rules (systemd1 manage-units), optional
+}
+
+// Decision is the first lgpo rule that returns for a Request.
+type Decision struct {
+	File    string
+	Policy  string
+	Rule    string
+	Result  Result
+	Default bool   // returned by default_result rather than a subject match
+	Message string // logged by polkit for a NO result
+}
+
+// Explain evaluates the parsed rules the way the rendered JS does: files in
+// rules.d order, rules by name, and within a rule each match in turn followed
+// by its default_result prefixes. It returns nil if no lgpo rule returns, in
+// which case polkit falls back to other rules files and the action defaults.
+// Report-only policies never return and are skipped.
+func Explain(ps []*Policy, req Request) *Decision {
+	sorted := append([]*Policy(nil), ps...)
+	sort.SliceStable(sorted, func(i, j int) bool { return TargetPath(sorted[i]) < TargetPath(sorted[j]) })
+
+	for _, p := range sorted {
+		if p.Spec.ReportOnly {
+			continue
+		}
+		rules := append([]Rule(nil), p.Spec.Rules...)
+		sort.Slice(rules, func(i, j int) bool { return rules[i].Name < rules[j].Name })
+		for _, r := range rules {
+			d := &Decision{File: TargetPath(p), Policy: p.Metadata.Name, Rule: r.Name}
+			for _, m := range r.Matches {
+				if actionMatches(m, req.ActionID) && subjectMatches(r.Subject, req) && unitMatches(r.UnitPrefix, req.Unit) {
+					d.Result = r.Result
+					return d.withMessage(r)
+				}
+			}
+			if r.DefaultResult != nil {
+				for _, m := range r.Matches {
+					if m.ActionPrefix != "" && strings.HasPrefix(req.ActionID, m.ActionPrefix) {
+						d.Result, d.Default = *r.DefaultResult, true
+						return d.withMessage(r)
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (d *Decision) withMessage(r Rule) *Decision {
+	if d.Result == NO {
+		d.Message = r.Message
+	}
+	return d
+}
+
+func actionMatches(m Match, id string) bool {
+	if m.ActionID != "" {
+		return id == m.ActionID
+	}
+	return strings.HasPrefix(id, m.ActionPrefix)
+}
+
+func subjectMatches(s Subject, req Request) bool {
+	if s.Active != nil && *s.Active != req.Active {
+		return false
+	}
+	if s.Local != nil && *s.Local != req.Local {
+		return false
+	}
+	if s.Seat != "" && s.Seat != req.Seat {
+		return false
+	}
+	if s.Group != "" {
+		in := false
+		for _, g := range req.Groups {
+			if g == s.Group {
+				in = true
+				break
+			}
+		}
+		if !in {
+			return false
+		}
+	}
+	if s.User != "" && s.User != req.User {
+		return false
+	}
+	return true
+}
+
+func unitMatches(prefix, unit string) bool {
+	return prefix == "" || strings.HasPrefix(unit, prefix)
+}
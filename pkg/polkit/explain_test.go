@@ -0,0 +1,48 @@
+package polkit
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExplain(t *testing.T) {
+	no := NO
+	prio := func(n int) *int { return &n }
+	deny := &Policy{Metadata: Meta{Name: "deny"}, Spec: Spec{Priority: prio(10), Rules: []Rule{{
+		Name: "no-usb", Matches: []Match{{ActionPrefix: "org.freedesktop.udisks2."}},
+		Subject: Subject{Group: "staff"}, Result: YES, DefaultResult: &no, Message: "ask IT",
+	}}}}
+	allow := &Policy{Metadata: Meta{Name: "allow"}, Spec: Spec{Rules: []Rule{
+		{Name: "b-units", Matches: []Match{{ActionID: "org.freedesktop.systemd1.manage-units"}}, UnitPrefix: "kiosk-", Result: YES},
+		{Name: "a-mount", Matches: []Match{{ActionID: "org.freedesktop.udisks2.filesystem-mount"}}, Subject: Subject{Active: ptr(true)}, Result: AUTH_ADMIN},
+		{Name: "c-nm", Matches: []Match{{ActionPrefix: "org.freedesktop.NetworkManager."}}, Subject: Subject{Local: ptr(true), Seat: "seat0"}, Result: YES},
+	}}}
+	shadow := &Policy{Metadata: Meta{Name: "shadow"}, Spec: Spec{Priority: prio(5), ReportOnly: true, Rules: []Rule{{
+		Name: "all", Matches: []Match{{ActionPrefix: "org."}}, Result: NO,
+	}}}}
+	ps := []*Policy{allow, deny, shadow}
+	tests := []struct {
+		name string
+		req  Request
+		want *Decision
+	}{
+		{"subject match in the earlier file", Request{ActionID: "org.freedesktop.udisks2.filesystem-mount", Groups: []string{"staff"}, Active: true},
+			&Decision{File: "/etc/polkit-1/rules.d/10-lgpo-deny.rules", Policy: "deny", Rule: "no-usb", Result: YES}},
+		{"default_result for everyone else", Request{ActionID: "org.freedesktop.udisks2.filesystem-mount", Active: true},
+			&Decision{File: "/etc/polkit-1/rules.d/10-lgpo-deny.rules", Policy: "deny", Rule: "no-usb", Result: NO, Default: true, Message: "ask IT"}},
+		{"unit prefix", Request{ActionID: "org.freedesktop.systemd1.manage-units", Unit: "kiosk-browser.service"},
+			&Decision{File: "/etc/polkit-1/rules.d/60-lgpo-allow.rules", Policy: "allow", Rule: "b-units", Result: YES}},
+		{"other unit", Request{ActionID: "org.freedesktop.systemd1.manage-units", Unit: "sshd.service"}, nil},
+		{"seat and local", Request{ActionID: "org.freedesktop.NetworkManager.settings.modify.system", Local: true, Seat: "seat0"},
+			&Decision{File: "/etc/polkit-1/rules.d/60-lgpo-allow.rules", Policy: "allow", Rule: "c-nm", Result: YES}},
+		{"remote session", Request{ActionID: "org.freedesktop.NetworkManager.settings.modify.system", Seat: "seat0"}, nil},
+		{"report-only never returns", Request{ActionID: "org.example.other"}, nil},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := Explain(ps, tc.req); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("Explain = %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
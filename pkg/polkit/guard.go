@@ -0,0 +1,108 @@
+package polkit
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Guardrail names action prefixes no rule may deny outright: a NO on
+// systemd or logind actions for everybody can leave a fleet without a way
+// to administer it.
+type Guardrail struct {
+	Prefixes    []string // e.g. org.freedesktop.systemd1.
+	AdminGroups []string // groups whose YES/AUTH_ADMIN rule counts as an escape hatch
+}
+
+// Lockouts returns one finding per rule of p that returns NO for a guarded
+// action without an escape hatch. A deny is fine when it only applies to
+// one user (other than root) or to a non-admin group, or when an admin
+// group rule in the same policy grants the action first (rules are
+// evaluated in name order). A report-only policy never denies.
+func Lockouts(p *Policy, g Guardrail) []string {
+	if p.Spec.ReportOnly {
+		return nil
+	}
+	var out []string
+	for _, r := range p.Spec.Rules {
+		for _, m := range r.Matches {
+			guarded := g.guarded(m)
+			if guarded == "" {
+				continue
+			}
+			if r.Result == NO && !g.scoped(r.Subject) && !g.escaped(p, r.Name, m) {
+				out = append(out, fmt.Sprintf("%s: rule %s denies %s for everyone; add an earlier rule granting an admin group (%s) or narrow the subject",
+					p.Metadata.Name, r.Name, guarded, strings.Join(g.AdminGroups, ", ")))
+			}
+			// the rule's own matches run before its default_result
+			selfEscape := g.admin(r.Subject.Group) && r.Result != NO && r.UnitPrefix == ""
+			if r.DefaultResult != nil && *r.DefaultResult == NO && m.ActionPrefix != "" && !selfEscape && !g.escaped(p, r.Name, m) {
+				out = append(out, fmt.Sprintf("%s: rule %s default_result denies %s for everyone; add an earlier rule granting an admin group (%s)",
+					p.Metadata.Name, r.Name, guarded, strings.Join(g.AdminGroups, ", ")))
+			}
+		}
+	}
+	return out
+}
+
+// guarded returns the guarded prefix m can hit, or "".
+func (g Guardrail) guarded(m Match) string {
+	for _, pre := range g.Prefixes {
+		if m.ActionID != "" && strings.HasPrefix(m.ActionID, pre) {
+			return m.ActionID
+		}
+		// a prefix inside the guarded namespace, or a broader one covering it
+		if m.ActionPrefix != "" && strings.HasPrefix(m.ActionPrefix, pre) {
+			return m.ActionPrefix + "*"
+		}
+		if m.ActionPrefix != "" && strings.HasPrefix(pre, m.ActionPrefix) {
+			return pre + "*"
+		}
+	}
+	return ""
+}
+
+// scoped reports whether the subject leaves administrators out.
+func (g Guardrail) scoped(s Subject) bool {
+	if s.User != "" && s.User != "root" {
+		return true
+	}
+	return s.Group != "" && !g.admin(s.Group)
+}
+
+func (g Guardrail) admin(group string) bool {
+	for _, a := range g.AdminGroups {
+		if a == group {
+			return true
+		}
+	}
+	return false
+}
+
+// escaped reports whether a rule named before deny grants an admin group
+// every action m can match.
+func (g Guardrail) escaped(p *Policy, deny string, m Match) bool {
+	for _, r := range p.Spec.Rules {
+		if r.Name >= deny || !g.admin(r.Subject.Group) || r.UnitPrefix != "" || r.Result == NO {
+			continue
+		}
+		for _, e := range r.Matches {
+			if covers(e, m) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// covers reports whether match e matches every action m does.
+func covers(e, m Match) bool {
+	switch {
+	case e.ActionPrefix != "" && m.ActionID != "":
+		return strings.HasPrefix(m.ActionID, e.ActionPrefix)
+	case e.ActionPrefix != "" && m.ActionPrefix != "":
+		return strings.HasPrefix(m.ActionPrefix, e.ActionPrefix)
+	case e.ActionID != "":
+		return e.ActionID == m.ActionID
+	}
+	return false
+}
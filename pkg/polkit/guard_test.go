@@ -0,0 +1,65 @@
+package polkit
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLockouts(t *testing.T) {
+	guard := Guardrail{Prefixes: []string{"org.freedesktop.systemd1.", "org.freedesktop.login1."}, AdminGroups: []string{"wheel", "sudo"}}
+	no, yes := NO, YES
+	manage := Match{ActionID: "org.freedesktop.systemd1.manage-units"}
+	systemd := Match{ActionPrefix: "org.freedesktop.systemd1."}
+	deny := func(name string, m Match, s Subject) Rule {
+		return Rule{Name: name, Matches: []Match{m}, Subject: s, Result: NO}
+	}
+	grant := func(name string, m Match, group string) Rule {
+		return Rule{Name: name, Matches: []Match{m}, Subject: Subject{Group: group}, Result: YES}
+	}
+	tests := []struct {
+		name       string
+		rules      []Rule
+		reportOnly bool
+		want       string // substring of the only finding; "" for none
+	}{
+		{"deny for everyone", []Rule{deny("r", manage, Subject{})}, false, "rule r denies org.freedesktop.systemd1.manage-units for everyone"},
+		{"deny one user", []Rule{deny("r", manage, Subject{User: "alice"})}, false, ""},
+		{"deny root", []Rule{deny("r", manage, Subject{User: "root"})}, false, "denies"},
+		{"deny a non-admin group", []Rule{deny("r", manage, Subject{Group: "staff"})}, false, ""},
+		{"deny an admin group", []Rule{deny("r", manage, Subject{Group: "wheel"})}, false, "denies"},
+		{"unguarded action", []Rule{deny("r", Match{ActionID: "org.example.test"}, Subject{})}, false, ""},
+		{"broader prefix", []Rule{deny("r", Match{ActionPrefix: "org.freedesktop."}, Subject{})}, false, "denies org.freedesktop.systemd1.*"},
+		{"earlier admin grant", []Rule{grant("a-admins", systemd, "wheel"), deny("b-deny", manage, Subject{})}, false, ""},
+		{"later admin grant", []Rule{deny("a-deny", manage, Subject{}), grant("z-admins", systemd, "wheel")}, false, "rule a-deny denies"},
+		{"grant of another action", []Rule{grant("a-admins", Match{ActionID: "org.freedesktop.systemd1.reload-daemon"}, "wheel"), deny("b-deny", manage, Subject{})}, false, "rule b-deny denies"},
+		{"unit-scoped grant", []Rule{
+			{Name: "a-admins", Matches: []Match{systemd}, Subject: Subject{Group: "wheel"}, Result: YES, UnitPrefix: "getty@"},
+			deny("b-deny", manage, Subject{}),
+		}, false, "rule b-deny denies"},
+		{"default deny with an admin grant", []Rule{{Name: "r", Matches: []Match{systemd}, Subject: Subject{Group: "sudo"}, Result: YES, DefaultResult: &no}}, false, ""},
+		{"default deny for the rest", []Rule{{Name: "r", Matches: []Match{systemd}, Subject: Subject{Group: "staff"}, Result: YES, DefaultResult: &no}}, false, "default_result denies"},
+		{"default allow", []Rule{{Name: "r", Matches: []Match{systemd}, Subject: Subject{Group: "staff"}, Result: NO, DefaultResult: &yes}}, false, ""},
+		{"report only", []Rule{deny("r", manage, Subject{})}, true, ""},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			p := &Policy{Kind: "PolkitPolicy", Metadata: Meta{Name: "t"}, Spec: Spec{ReportOnly: tc.reportOnly, Rules: tc.rules}}
+			got := Lockouts(p, guard)
+			if tc.want == "" {
+				if len(got) != 0 {
+					t.Errorf("Lockouts = %q, want none", got)
+				}
+				return
+			}
+			if len(got) != 1 || !strings.Contains(got[0], tc.want) {
+				t.Errorf("Lockouts = %q, want one containing %q", got, tc.want)
+			}
+		})
+	}
+
+	// an empty prefix list guards nothing
+	p := &Policy{Kind: "PolkitPolicy", Metadata: Meta{Name: "t"}, Spec: Spec{Rules: []Rule{deny("r", manage, Subject{})}}}
+	if got := Lockouts(p, Guardrail{AdminGroups: guard.AdminGroups}); len(got) != 0 {
+		t.Errorf("Lockouts without prefixes = %q", got)
+	}
+}
@@ -0,0 +1,34 @@
+package polkit
+
+import (
+	"fmt"
+	"os/user"
+)
+
+// Lookup resolves local accounts. Swap it out to check against something
+// other than this host.
+type Lookup struct {
+	User  func(name string) error
+	Group func(name string) error
+}
+
+// HostLookup consults /etc/passwd and /etc/group (via os/user).
+var HostLookup = Lookup{
+	User:  func(name string) error { _, err := user.Lookup(name); return err },
+	Group: func(name string) error { _, err := user.LookupGroup(name); return err },
+}
+
+// MissingPrincipals returns one warning per subject.user/subject.group that
+// l cannot resolve. Such rules are valid but never match on this host.
+func MissingPrincipals(p *Policy, l Lookup) []string {
+	var out []string
+	for _, r := range p.Spec.Rules {
+		if r.Subject.Group != "" && l.Group(r.Subject.Group) != nil {
+			out = append(out, fmt.Sprintf("rule %s: group %q does not exist on this host", r.Name, r.Subject.Group))
+		}
+		if r.Subject.User != "" && l.User(r.Subject.User) != nil {
+			out = append(out, fmt.Sprintf("rule %s: user %q does not exist on this host", r.Name, r.Subject.User))
+		}
+	}
+	return out
+}
@@ -0,0 +1,38 @@
+package polkit
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestMissingPrincipals(t *testing.T) {
+	known := func(names ...string) func(string) error {
+		return func(name string) error {
+			for _, n := range names {
+				if n == name {
+					return nil
+				}
+			}
+			return errors.New("unknown " + name)
+		}
+	}
+	l := Lookup{User: known("alice"), Group: known("staff", "wheel")}
+	p := &Policy{}
+	p.Spec.Rules = []Rule{
+		{Name: "existing", Subject: Subject{User: "alice", Group: "staff"}},
+		{Name: "no-group", Subject: Subject{Group: "plugdev"}},
+		{Name: "no-user", Subject: Subject{User: "bob", Group: "wheel"}},
+		{Name: "both", Subject: Subject{User: "carol", Group: "kiosk"}},
+		{Name: "anyone", Subject: Subject{}},
+	}
+	want := []string{
+		`rule no-group: group "plugdev" does not exist on this host`,
+		`rule no-user: user "bob" does not exist on this host`,
+		`rule both: group "kiosk" does not exist on this host`,
+		`rule both: user "carol" does not exist on this host`,
+	}
+	if got := MissingPrincipals(p, l); !reflect.DeepEqual(got, want) {
+		t.Errorf("MissingPrincipals =\n%q\nwant\n%q", got, want)
+	}
+}
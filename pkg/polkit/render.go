@@ -31,12 +31,17 @@ func Render(p *Policy) ([]byte, string, error) {
 	}
 	var buf bytes.Buffer
 	buf.WriteString(header)
+	ret := returnStmt
+	if p.Spec.ReportOnly {
+		buf.WriteString("  // report-only: log the first decision, return none\n  var reported = false;\n")
+		ret = func(r Rule, res Result) string { return reportStmt(p.Metadata.Name, r, res) }
+	}
 
 	rules := append([]Rule(nil), p.Spec.Rules...)
 	sort.Slice(rules, func(i, j int) bool { return rules[i].Name < rules[j].Name })
 
 	for _, r := range rules {
-		writeRule(&buf, r)
+		writeRule(&buf, r, ret)
 	}
 	buf.WriteString(footer)
 	js := buf.String()
@@ -49,24 +54,39 @@ func Render(p *Policy) ([]byte, string, error) {
 	return []byte(js), hex.EncodeToString(sum[:]), nil
 }
 
-func writeRule(buf *bytes.Buffer, r Rule) {
+func writeRule(buf *bytes.Buffer, r Rule, ret func(Rule, Result) string) {
 	fmt.Fprintf(buf, "\n  // ---- %s ----\n", jsComment(r.Name))
 	for _, m := range r.Matches {
 		cond := matchCond(m)
 		subj := subjectCond(r.Subject)
 		unit := unitCond(r.UnitPrefix)
-		fmt.Fprintf(buf, "  if (%s%s%s) return %s;\n", cond, subj, unit, r.Result.JS())
+		fmt.Fprintf(buf, "  if (%s%s%s) %s\n", cond, subj, unit, ret(r, r.Result))
 	}
 	if r.DefaultResult != nil {
 		for _, m := range r.Matches {
 			if m.ActionPrefix != "" {
-				fmt.Fprintf(buf, "  if (action.id.indexOf(%s) === 0) return %s;\n",
-					jsString(m.ActionPrefix), (*r.DefaultResult).JS())
+				fmt.Fprintf(buf, "  if (action.id.indexOf(%s) === 0) %s\n",
+					jsString(m.ActionPrefix), ret(r, *r.DefaultResult))
 			}
 		}
 	}
 }
 
+// returnStmt returns res, logging the rule's message first when it denies.
+func returnStmt(r Rule, res Result) string {
+	if res == NO && r.Message != "" {
+		return "{ polkit.log(" + jsString(r.Message) + "); return " + res.JS() + "; }"
+	}
+	return "return " + res.JS() + ";"
+}
+
+// reportStmt logs the result the rule would return, once per check, and
+// returns nothing, so polkit goes on to the next rules file.
+func reportStmt(policy string, r Rule, res Result) string {
+	msg := jsString("lgpo report-only: " + policy + "/" + r.Name + " would return " + string(res) + " for ")
+	return "{ if (!reported) { reported = true; polkit.log(" + msg + " + action.id + \" by \" + subject.user); } }"
+}
+
 func matchCond(m Match) string {
 	if m.ActionID != "" {
 		return "action.id === " + jsString(m.ActionID)
@@ -83,6 +103,16 @@ func subjectCond(s Subject) string {
 			parts = append(parts, "!isActive()")
 		}
 	}
+	if s.Local != nil {
+		if *s.Local {
+			parts = append(parts, "subject.local")
+		} else {
+			parts = append(parts, "!subject.local")
+		}
+	}
+	if s.Seat != "" {
+		parts = append(parts, "subject.seat === "+jsString(s.Seat))
+	}
 	if s.Group != "" {
 		parts = append(parts, "inGroup("+jsString(s.Group)+")")
 	}
@@ -0,0 +1,226 @@
+package polkit
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// subjectCases is every combination of subject.active, local and seat.
+func subjectCases() []Subject {
+	bools := []*bool{nil, ptr(true), ptr(false)}
+	var out []Subject
+	for _, a := range bools {
+		for _, l := range bools {
+			for _, seat := range []string{"", "seat0"} {
+				out = append(out, Subject{Active: a, Local: l, Seat: seat})
+			}
+		}
+	}
+	return out
+}
+
+func ptr(b bool) *bool { return &b }
+
+func subjectName(s Subject) string {
+	f := func(b *bool) string {
+		if b == nil {
+			return "any"
+		}
+		return fmt.Sprint(*b)
+	}
+	seat := s.Seat
+	if seat == "" {
+		seat = "any"
+	}
+	return "active=" + f(s.Active) + ",local=" + f(s.Local) + ",seat=" + seat
+}
+
+func renderSubject(t *testing.T, s Subject) string {
+	t.Helper()
+	p := &Policy{APIVersion: "lgpo.io/v1", Kind: "PolkitPolicy", Metadata: Meta{Name: "t"}, Spec: Spec{Rules: []Rule{{
+		Name: "r", Matches: []Match{{ActionID: "org.example.test"}}, Subject: s, Result: YES,
+	}}}}
+	js, _, err := Render(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(js)
+}
+
+func TestRenderSubjectCondition(t *testing.T) {
+	for _, s := range subjectCases() {
+		t.Run(subjectName(s), func(t *testing.T) {
+			var parts []string
+			if s.Active != nil {
+				parts = append(parts, map[bool]string{true: "isActive()", false: "!isActive()"}[*s.Active])
+			}
+			if s.Local != nil {
+				parts = append(parts, map[bool]string{true: "subject.local", false: "!subject.local"}[*s.Local])
+			}
+			if s.Seat != "" {
+				parts = append(parts, `subject.seat === "`+s.Seat+`"`)
+			}
+			want := `  if (action.id === "org.example.test") return polkit.Result.YES;`
+			if len(parts) > 0 {
+				want = `  if (action.id === "org.example.test" && (` + strings.Join(parts, " && ") + `)) return polkit.Result.YES;`
+			}
+			if js := renderSubject(t, s); !strings.Contains(js, want+"\n") {
+				t.Errorf("rendered rules lack\n%s\ngot\n%s", want, js)
+			}
+		})
+	}
+}
+
+// evalJS is the polkit rules harness: it loads the rendered file with a
+// stub polkit object and prints the result for each session in sessions.
+const evalJS = `
+var polkit = {
+  Result: {YES: "YES", NO: "NO", AUTH_ADMIN: "AUTH_ADMIN", AUTH_ADMIN_KEEP: "AUTH_ADMIN_KEEP"},
+  rules: [], addRule: function(f) { this.rules.push(f); }, log: function() {}
+};
+eval(require("fs").readFileSync(process.argv[2], "utf8"));
+var out = [];
+for (var active of [true, false]) for (var local of [true, false]) for (var seat of ["seat0", "seat1"]) {
+  var subject = {user: "alice", active: active, local: local, seat: seat, isInGroup: function() { return false; }};
+  out.push(polkit.rules[0]({id: "org.example.test"}, subject) || "none");
+}
+console.log(out.join(" "));
+`
+
+func TestRenderSubjectSemantics(t *testing.T) {
+	node, err := exec.LookPath("node")
+	if err != nil {
+		t.Skip("node not installed")
+	}
+	dir := t.TempDir()
+	harness := filepath.Join(dir, "eval.js")
+	if err := os.WriteFile(harness, []byte(evalJS), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range subjectCases() {
+		t.Run(subjectName(s), func(t *testing.T) {
+			rules := filepath.Join(dir, "rules.js")
+			if err := os.WriteFile(rules, []byte(renderSubject(t, s)), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			out, err := exec.Command(node, harness, rules).CombinedOutput()
+			if err != nil {
+				t.Fatalf("node: %v: %s", err, out)
+			}
+			var want []string
+			for _, active := range []bool{true, false} {
+				for _, local := range []bool{true, false} {
+					for _, seat := range []string{"seat0", "seat1"} {
+						ok := (s.Active == nil || *s.Active == active) && (s.Local == nil || *s.Local == local) && (s.Seat == "" || s.Seat == seat)
+						want = append(want, map[bool]string{true: "YES", false: "none"}[ok])
+					}
+				}
+			}
+			if got := strings.TrimSpace(string(out)); got != strings.Join(want, " ") {
+				t.Errorf("results %s, want %s", got, strings.Join(want, " "))
+			}
+		})
+	}
+}
+
+func TestRenderDenyMessage(t *testing.T) {
+	no := NO
+	tests := []struct {
+		name string
+		rule Rule
+		want []string // rendered lines
+	}{
+		{"deny logs", Rule{Name: "r", Matches: []Match{{ActionID: "org.example.test"}}, Result: NO, Message: `USB storage is "disabled"`},
+			[]string{`  if (action.id === "org.example.test") { polkit.log("USB storage is \"disabled\""); return polkit.Result.NO; }`}},
+		{"deny without message", Rule{Name: "r", Matches: []Match{{ActionID: "org.example.test"}}, Result: NO},
+			[]string{`  if (action.id === "org.example.test") return polkit.Result.NO;`}},
+		{"only the denying default logs", Rule{Name: "r", Matches: []Match{{ActionPrefix: "org.example."}}, Subject: Subject{Group: "staff"},
+			Result: YES, DefaultResult: &no, Message: "ask IT"},
+			[]string{
+				`  if (action.id.indexOf("org.example.") === 0 && (inGroup("staff"))) return polkit.Result.YES;`,
+				`  if (action.id.indexOf("org.example.") === 0) { polkit.log("ask IT"); return polkit.Result.NO; }`,
+			}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			p := &Policy{APIVersion: "lgpo.io/v1", Kind: "PolkitPolicy", Metadata: Meta{Name: "t"}, Spec: Spec{Rules: []Rule{tc.rule}}}
+			js, _, err := Render(p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, line := range tc.want {
+				if !strings.Contains(string(js), line+"\n") {
+					t.Errorf("rendered rules lack\n%s\ngot\n%s", line, js)
+				}
+			}
+		})
+	}
+
+	for name, r := range map[string]Rule{
+		"message on an allow": {Name: "r", Matches: []Match{{ActionID: "org.example.test"}}, Result: YES, Message: "hi"},
+		"message too long":    {Name: "r", Matches: []Match{{ActionID: "org.example.test"}}, Result: NO, Message: strings.Repeat("x", maxMessage+1)},
+	} {
+		p := &Policy{APIVersion: "lgpo.io/v1", Kind: "PolkitPolicy", Metadata: Meta{Name: "t"}, Spec: Spec{Rules: []Rule{r}}}
+		if _, _, err := Render(p); err == nil {
+			t.Errorf("%s: rendered", name)
+		}
+	}
+}
+
+// reportJS loads the rendered file with a polkit stub that records logs and
+// prints, per group membership, the result and what was logged.
+const reportJS = `
+var logs = [];
+var polkit = {
+  Result: {YES: "YES", NO: "NO", AUTH_ADMIN: "AUTH_ADMIN", AUTH_ADMIN_KEEP: "AUTH_ADMIN_KEEP"},
+  rules: [], addRule: function(f) { this.rules.push(f); }, log: function(m) { logs.push(m); }
+};
+eval(require("fs").readFileSync(process.argv[2], "utf8"));
+for (var staff of [true, false]) {
+  logs = [];
+  var subject = {user: "alice", active: true, local: true, seat: "seat0", isInGroup: function(g) { return staff && g === "staff"; }};
+  var res = polkit.rules[0]({id: "org.example.test", lookup: function() { return ""; }}, subject) || "none";
+  console.log(res + " | " + logs.join(" | "));
+}
+`
+
+func TestRenderReportOnly(t *testing.T) {
+	p := &Policy{APIVersion: "lgpo.io/v1", Kind: "PolkitPolicy", Metadata: Meta{Name: "t"}, Spec: Spec{ReportOnly: true, Rules: []Rule{
+		{Name: "a-staff", Matches: []Match{{ActionID: "org.example.test"}}, Subject: Subject{Group: "staff"}, Result: NO, Message: "not for staff"},
+		{Name: "b-all", Matches: []Match{{ActionID: "org.example.test"}}, Result: YES},
+	}}}
+	js, _, err := Render(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(js), "return polkit.Result") {
+		t.Errorf("report-only rules return a result:\n%s", js)
+	}
+
+	node, err := exec.LookPath("node")
+	if err != nil {
+		t.Skip("node not installed")
+	}
+	dir := t.TempDir()
+	harness, rules := filepath.Join(dir, "report.js"), filepath.Join(dir, "rules.js")
+	if err := os.WriteFile(harness, []byte(reportJS), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(rules, js, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	out, err := exec.Command(node, harness, rules).CombinedOutput()
+	if err != nil {
+		t.Fatalf("node: %v: %s", err, out)
+	}
+	// only the first decision is logged, and polkit goes on to other files
+	want := "none | lgpo report-only: t/a-staff would return NO for org.example.test by alice\n" +
+		"none | lgpo report-only: t/b-all would return YES for org.example.test by alice\n"
+	if string(out) != want {
+		t.Errorf("node output\n%s\nwant\n%s", out, want)
+	}
+}
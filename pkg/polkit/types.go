@@ -1,20 +1,27 @@
 package polkit
 
+import (
+    "fmt"
+
+    "github.com/lgpo-org/lgpod/pkg/selector"
+)
+
 type Policy struct {
-    APIVersion string     `yaml:"apiVersion"`
-    Kind       string     `yaml:"kind"`
-    Metadata   Meta       `yaml:"metadata"`
-    Selector   Sel        `yaml:"selector"`
-    Spec       Spec       `yaml:"spec"`
+    APIVersion string       `yaml:"apiVersion"`
+    Kind       string       `yaml:"kind"`
+    Metadata   Meta         `yaml:"metadata"`
+    Selector   selector.Sel `yaml:"selector"`
+    Spec       Spec         `yaml:"spec"`
 }
 type Meta struct{ Name string `yaml:"name"` }
-type Sel struct {
-    Facts map[string]string `yaml:"facts"`
-    Tags  map[string]any    `yaml:"tags"`
-    HostnameRegex string    `yaml:"hostnameRegex"`
-}
 type Spec struct {
-    Rules []Rule `yaml:"rules"`
+    // Priority is the rules.d filename prefix (0-99, default 60). polkit reads
+    // files in lexical order, so a lower number is evaluated first.
+    Priority   *int   `yaml:"priority,omitempty"`
+    // ReportOnly renders rules that log the decision they would make via
+    // polkit.log() and return none, for observing a rollout before enforcing.
+    ReportOnly bool   `yaml:"reportOnly,omitempty"`
+    Rules      []Rule `yaml:"rules"`
 }
 type Rule struct {
     Name string `yaml:"name"`
@@ -24,6 +31,8 @@ type Rule struct {
     Result  Result  `yaml:"result"`
     DefaultResult *Result `yaml:"default_result,omitempty"`
     UnitPrefix string `yaml:"unit_prefix,omitempty"`
+    // Message is logged via polkit.log() before a NO result is returned.
+    Message string `yaml:"message,omitempty"`
 }
 type Match struct {
     ActionID string `yaml:"action_id,omitempty"`
@@ -31,9 +40,23 @@ type Match struct {
 }
 type Subject struct {
     Active *bool `yaml:"active,omitempty"`
+    // Local is whether the session is on a local seat, not remote (ssh).
+    Local *bool `yaml:"local,omitempty"`
+    // Seat is the logind seat of the session, e.g. seat0.
+    Seat  string `yaml:"seat,omitempty"`
     Group string `yaml:"group,omitempty"`
     User  string `yaml:"user,omitempty"`
 }
+// DefaultPriority is used when spec.priority is unset.
+const DefaultPriority = 60
+
+// TargetPath returns the rendered rules file path for this policy.
+func TargetPath(p *Policy) string {
+    prio := DefaultPriority
+    if p.Spec.Priority != nil { prio = *p.Spec.Priority }
+    return fmt.Sprintf("/etc/polkit-1/rules.d/%02d-lgpo-%s.rules", prio, p.Metadata.Name)
+}
+
 type Result string
 const (
     YES Result = "YES"
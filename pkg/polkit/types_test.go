@@ -0,0 +1,40 @@
+package polkit
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTargetPath(t *testing.T) {
+	prio := func(n int) *int { return &n }
+	tests := []struct {
+		priority *int
+		want     string
+		wantErr  bool
+	}{
+		{nil, "/etc/polkit-1/rules.d/60-lgpo-t.rules", false},
+		{prio(0), "/etc/polkit-1/rules.d/00-lgpo-t.rules", false},
+		{prio(5), "/etc/polkit-1/rules.d/05-lgpo-t.rules", false},
+		{prio(99), "/etc/polkit-1/rules.d/99-lgpo-t.rules", false},
+		{prio(-1), "", true},
+		{prio(100), "", true},
+	}
+	for _, tc := range tests {
+		p := &Policy{APIVersion: "lgpo.io/v1", Kind: "PolkitPolicy", Metadata: Meta{Name: "t"}, Spec: Spec{Priority: tc.priority, Rules: []Rule{{
+			Name: "r", Matches: []Match{{ActionID: "org.example.test"}}, Result: YES,
+		}}}}
+		err := p.Validate()
+		if tc.wantErr {
+			if err == nil || !strings.Contains(err.Error(), "spec.priority") {
+				t.Errorf("priority %d: err = %v, want a spec.priority error", *tc.priority, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := TargetPath(p); got != tc.want {
+			t.Errorf("TargetPath = %q, want %q", got, tc.want)
+		}
+	}
+}
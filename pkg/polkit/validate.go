@@ -2,14 +2,25 @@ package polkit
 
 import "regexp"
 import "fmt"
+import "strings"
 
 var reAction = regexp.MustCompile(`^[a-z0-9._-]+$`)
 var reName   = regexp.MustCompile(`^[a-zA-Z0-9._-]+$`)
 var reUser   = regexp.MustCompile(`^[a-z_][a-z0-9_-]*[$]?$`)
+// reSeat is a logind seat name; they all start with "seat".
+var reSeat   = regexp.MustCompile(`^seat[A-Za-z0-9_-]{0,64}$`)
+// reUnit is the systemd unit name charset; a prefix may stop anywhere, e.g. "getty@".
+var reUnit   = regexp.MustCompile(`^[A-Za-z0-9:_.@\\-]{1,255}$`)
+
+// unitActions is the action namespace whose checks carry a "unit" lookup.
+const unitActions = "org.freedesktop.systemd1."
+
+const maxMessage = 256
 
 func (p *Policy) Validate() error {
     if p.Kind != "PolkitPolicy" { return fmt.Errorf("kind must be PolkitPolicy") }
     if !reName.MatchString(p.Metadata.Name) { return fmt.Errorf("metadata.name invalid") }
+    if p.Spec.Priority != nil && (*p.Spec.Priority < 0 || *p.Spec.Priority > 99) { return fmt.Errorf("spec.priority must be 0-99") }
     if len(p.Spec.Rules) == 0 { return fmt.Errorf("spec.rules empty") }
     for _, r := range p.Spec.Rules {
         if !reName.MatchString(r.Name) { return fmt.Errorf("rule name invalid") }
@@ -21,6 +32,25 @@ func (p *Policy) Validate() error {
         }
         if r.Subject.Group != "" && !reUser.MatchString(r.Subject.Group) { return fmt.Errorf("bad subject.group") }
         if r.Subject.User != "" && !reUser.MatchString(r.Subject.User) { return fmt.Errorf("bad subject.user") }
+        if r.Subject.Seat != "" && !reSeat.MatchString(r.Subject.Seat) { return fmt.Errorf("rule %s: bad subject.seat %q (a logind seat like seat0)", r.Name, r.Subject.Seat) }
+        if r.Message != "" && r.Result != NO && (r.DefaultResult == nil || *r.DefaultResult != NO) {
+            return fmt.Errorf("rule %s: message needs a NO result or default_result", r.Name)
+        }
+        if len(r.Message) > maxMessage { return fmt.Errorf("rule %s: message longer than %d bytes", r.Name, maxMessage) }
+        if r.UnitPrefix != "" {
+            if !reUnit.MatchString(r.UnitPrefix) { return fmt.Errorf("rule %s: bad unit_prefix %q (systemd unit names use letters, digits and :_.@\\-)", r.Name, r.UnitPrefix) }
+            if !hasUnitAction(r.Matches) { return fmt.Errorf("rule %s: unit_prefix needs an %s* action; other actions have no unit to match", r.Name, unitActions) }
+        }
     }
     return nil
 }
+
+// hasUnitAction reports whether any match can hit a systemd1 action.
+func hasUnitAction(ms []Match) bool {
+    for _, m := range ms {
+        if strings.HasPrefix(m.ActionID+m.ActionPrefix, unitActions) { return true }
+        // a short prefix like "org.freedesktop." also covers systemd1 actions
+        if m.ActionPrefix != "" && strings.HasPrefix(unitActions, m.ActionPrefix) { return true }
+    }
+    return false
+}
@@ -0,0 +1,49 @@
+package polkit
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateUnitPrefix(t *testing.T) {
+	tests := []struct {
+		name    string
+		prefix  string
+		match   Match
+		wantErr string
+	}{
+		{"template prefix", "getty@", Match{ActionID: "org.freedesktop.systemd1.manage-units"}, ""},
+		{"systemd1 prefix", "ssh.service", Match{ActionPrefix: "org.freedesktop.systemd1."}, ""},
+		{"broader prefix", "ssh.service", Match{ActionPrefix: "org.freedesktop."}, ""},
+		{"escaped dash", `dev-disk-by\x2dlabel-data.mount`, Match{ActionID: "org.freedesktop.systemd1.manage-units"}, ""},
+		{"space", "foo bar", Match{ActionID: "org.freedesktop.systemd1.manage-units"}, "bad unit_prefix"},
+		{"quote", `x");polkit.log("y`, Match{ActionID: "org.freedesktop.systemd1.manage-units"}, "bad unit_prefix"},
+		{"too long", strings.Repeat("a", 256), Match{ActionID: "org.freedesktop.systemd1.manage-units"}, "bad unit_prefix"},
+		{"non-systemd action", "getty@", Match{ActionID: "org.freedesktop.login1.reboot"}, "needs an org.freedesktop.systemd1.* action"},
+		{"other prefix", "getty@", Match{ActionPrefix: "org.freedesktop.login1."}, "needs an org.freedesktop.systemd1.* action"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			p := &Policy{APIVersion: "lgpo.io/v1", Kind: "PolkitPolicy", Metadata: Meta{Name: "t"}, Spec: Spec{Rules: []Rule{{
+				Name: "r", Matches: []Match{tc.match}, UnitPrefix: tc.prefix, Result: YES,
+			}}}}
+			err := p.Validate()
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				js, _, err := Render(p)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !strings.Contains(string(js), "unitStartsWith("+jsString(tc.prefix)+")") {
+					t.Errorf("rendered rule lacks the unit check:\n%s", js)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("Validate = %v, want error containing %q", err, tc.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package run
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParseSince reads a cutoff for ReadAudit: a duration back from now (90m,
+// 24h, or whole days like 7d) or an RFC3339 time.
+func ParseSince(s string, now time.Time) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	if n, ok := strings.CutSuffix(s, "d"); ok {
+		if days, err := strconv.Atoi(n); err == nil && days >= 0 {
+			return now.Add(-time.Duration(days) * 24 * time.Hour), nil
+		}
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return time.Time{}, fmt.Errorf("want a duration like 24h or 7d, or an RFC3339 time, got %q", s)
+	}
+	return now.Add(-d), nil
+}
+
+// ReadAudit returns the audit records whose ts is at or after since, in the
+// order they were written. A zero since returns all of them; a record
+// without a readable ts is only returned then.
+func (r *Runner) ReadAudit(since time.Time) ([]json.RawMessage, error) {
+	if r.cfg.AuditLog == "" {
+		return nil, errors.New("auditLog not configured")
+	}
+	f, err := os.Open(r.auditPath())
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var out []json.RawMessage
+	br := bufio.NewReader(f)
+	for {
+		line, err := br.ReadBytes('\n')
+		if line = bytes.TrimSpace(line); len(line) > 0 && keepAudit(line, since) {
+			out = append(out, json.RawMessage(line))
+		}
+		if errors.Is(err, io.EOF) {
+			return out, nil
+		}
+		if err != nil {
+			return out, err
+		}
+	}
+}
+
+func keepAudit(line []byte, since time.Time) bool {
+	if since.IsZero() {
+		return true
+	}
+	var rec struct {
+		TS string `json:"ts"`
+	}
+	if json.Unmarshal(line, &rec) != nil {
+		return false
+	}
+	ts, err := time.Parse(time.RFC3339, rec.TS)
+	return err == nil && !ts.Before(since)
+}
@@ -0,0 +1,279 @@
+package run
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lgpo-org/lgpod/pkg/status"
+	"github.com/lgpo-org/lgpod/pkg/version"
+)
+
+func TestParseSince(t *testing.T) {
+	now := time.Date(2026, 10, 14, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		in      string
+		want    time.Time
+		wantErr bool
+	}{
+		{"24h", now.Add(-24 * time.Hour), false},
+		{"90m", now.Add(-90 * time.Minute), false},
+		{"7d", now.Add(-7 * 24 * time.Hour), false},
+		{"0d", now, false},
+		{"2026-10-01T08:30:00Z", time.Date(2026, 10, 1, 8, 30, 0, 0, time.UTC), false},
+		{"2026-10-01T08:30:00+02:00", time.Date(2026, 10, 1, 6, 30, 0, 0, time.UTC), false},
+		{"-1h", time.Time{}, true},
+		{"-1d", time.Time{}, true},
+		{"1.5d", time.Time{}, true},
+		{"yesterday", time.Time{}, true},
+		{"2026-10-01", time.Time{}, true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.in, func(t *testing.T) {
+			got, err := ParseSince(tc.in, now)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tc.wantErr)
+			}
+			if !got.Equal(tc.want) {
+				t.Errorf("ParseSince(%q) = %v, want %v", tc.in, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestReadAudit(t *testing.T) {
+	r, _ := newTestRunner(t, "")
+	writeFile(t, r.auditPath(), `{"ts":"2026-10-12T12:00:00Z","n":1}
+{"ts":"2026-10-13T12:00:00Z","n":2}
+not json
+
+{"n":3}
+{"ts":"2026-10-14T11:00:00Z","n":4}
+`)
+	now := time.Date(2026, 10, 14, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		since string // "" for all records
+		want  []string
+	}{
+		{"", []string{"1", "2", "not json", `"n":3`, "4"}},
+		{"2h", []string{"4"}},
+		{"1d", []string{"2", "4"}},
+		{"2026-10-12T12:00:00Z", []string{"1", "2", "4"}},
+		{"2026-10-15T00:00:00Z", nil},
+	}
+	for _, tc := range tests {
+		t.Run(tc.since, func(t *testing.T) {
+			var cutoff time.Time
+			if tc.since != "" {
+				var err error
+				if cutoff, err = ParseSince(tc.since, now); err != nil {
+					t.Fatal(err)
+				}
+			}
+			recs, err := r.ReadAudit(cutoff)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(recs) != len(tc.want) {
+				t.Fatalf("got %d records %s, want %d", len(recs), recs, len(tc.want))
+			}
+			for i, w := range tc.want {
+				if !strings.Contains(string(recs[i]), w) {
+					t.Errorf("record %d = %s, want it to contain %s", i, recs[i], w)
+				}
+			}
+		})
+	}
+}
+
+func TestReadAuditNotConfigured(t *testing.T) {
+	r, _ := newTestRunner(t, "")
+	r.cfg.AuditLog = ""
+	if _, err := r.ReadAudit(time.Time{}); err == nil || err.Error() != "auditLog not configured" {
+		t.Errorf("err = %v, want auditLog not configured", err)
+	}
+}
+
+func TestVersionRecorded(t *testing.T) {
+	defer func(v string) { version.Version = v }(version.Version)
+	version.Version = "v9.9.9-test"
+	tests := []struct {
+		name   string
+		halt   bool
+		result string
+	}{
+		{"applied", false, "ok"},
+		{"halted", true, "halted"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r, dir := newTestRunner(t, "")
+			writeFile(t, filepath.Join(dir, "repo", "policies", "a.yml"), polkitYAML("a"))
+			if tc.halt {
+				writeFile(t, filepath.Join(dir, "HALT"), "")
+			}
+			if _, err := r.RunOnce(context.Background(), false, "test"); err != nil {
+				t.Fatal(err)
+			}
+			st, err := r.ReadStatus()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if st.Result != tc.result || st.Version != "v9.9.9-test" {
+				t.Errorf("status %s version %q, want %s v9.9.9-test", st.Result, st.Version, tc.result)
+			}
+			b, err := os.ReadFile(r.auditPath())
+			if err != nil {
+				t.Fatal(err)
+			}
+			lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+			var rec map[string]any
+			if err := json.Unmarshal([]byte(lines[len(lines)-1]), &rec); err != nil {
+				t.Fatal(err)
+			}
+			if rec["version"] != "v9.9.9-test" {
+				t.Errorf("audit version = %v, want v9.9.9-test", rec["version"])
+			}
+		})
+	}
+}
+
+func TestMaxSeverity(t *testing.T) {
+	tests := []struct {
+		in   []string
+		want string
+	}{
+		{nil, "info"},
+		{[]string{"info"}, "info"},
+		{[]string{"info", "warning"}, "warning"},
+		{[]string{"critical", "warning", "info"}, "critical"},
+	}
+	for _, tc := range tests {
+		var fs []failure
+		for _, s := range tc.in {
+			fs = append(fs, failure{Severity: s})
+		}
+		if got := maxSeverity(fs); got != tc.want {
+			t.Errorf("maxSeverity(%v) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestFailureSeverity(t *testing.T) {
+	r, dir := newTestRunner(t, "")
+	policies := filepath.Join(dir, "repo", "policies")
+	broken := func(name, severity string) string {
+		y := strings.Replace(polkitYAML(name), "result: YES", "result: YES\n      message: denied", 1)
+		if severity != "" {
+			y = strings.Replace(y, "metadata:\n", "metadata:\n  severity: "+severity+"\n", 1)
+		}
+		return y
+	}
+	writeFile(t, filepath.Join(policies, "ok.yml"), polkitYAML("ok"))
+	writeFile(t, filepath.Join(policies, "plain.yml"), broken("plain", ""))
+	writeFile(t, filepath.Join(policies, "page.yml"), broken("page", "critical"))
+	writeFile(t, filepath.Join(policies, "typo.yml"), broken("typo", "urgent"))
+	if _, err := r.RunOnce(context.Background(), false, "test"); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(r.auditPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rec struct {
+		Severity string `json:"severity"`
+		Failures []struct {
+			Policy   string `json:"policy"`
+			Severity string `json:"severity"`
+		} `json:"failures"`
+	}
+	if err := json.Unmarshal(b, &rec); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Severity != "critical" {
+		t.Errorf("audit severity = %q, want critical", rec.Severity)
+	}
+	got := map[string]string{}
+	for _, f := range rec.Failures {
+		got[f.Policy] = f.Severity
+	}
+	// an unknown severity is a parse error, so that policy never gets that far
+	if want := map[string]string{"plain": "info", "page": "critical"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("failures = %v, want %v", got, want)
+	}
+}
+
+func TestChangedFiles(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		config string
+	}{
+		{"default", ""},
+		{"in status", "statusChangedFiles: true\n"},
+		{"transactional", "statusChangedFiles: true\ntransactional: true\n"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r, dir := newTestRunner(t, tc.config)
+			policies := filepath.Join(dir, "repo", "policies")
+			ctx := context.Background()
+			writeFile(t, filepath.Join(policies, "a.yml"), polkitYAML("a"))
+			writeFile(t, filepath.Join(policies, "b.yml"), polkitYAML("b"))
+			if _, err := r.RunOnce(ctx, false, "test"); err != nil {
+				t.Fatal(err)
+			}
+
+			writeFile(t, filepath.Join(policies, "a.yml"), strings.Replace(polkitYAML("a"), "group: staff", "group: wheel", 1))
+			os.Remove(filepath.Join(policies, "b.yml"))
+			writeFile(t, filepath.Join(policies, "c.yml"), polkitYAML("c"))
+			want := []status.FileChange{
+				{Path: "/etc/polkit-1/rules.d/60-lgpo-a.rules", Op: "modified"},
+				{Path: "/etc/polkit-1/rules.d/60-lgpo-b.rules", Op: "removed"},
+				{Path: "/etc/polkit-1/rules.d/60-lgpo-c.rules", Op: "created"},
+			}
+			// a dry run lists what it would touch, then the real run what it did
+			for _, dry := range []bool{true, false} {
+				if _, err := r.RunOnce(ctx, dry, "test"); err != nil {
+					t.Fatal(err)
+				}
+				b, err := os.ReadFile(r.auditPath())
+				if err != nil {
+					t.Fatal(err)
+				}
+				lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+				var rec struct {
+					ChangedFiles []status.FileChange `json:"changedFiles"`
+				}
+				if err := json.Unmarshal([]byte(lines[len(lines)-1]), &rec); err != nil {
+					t.Fatal(err)
+				}
+				sort.Slice(rec.ChangedFiles, func(i, j int) bool { return rec.ChangedFiles[i].Path < rec.ChangedFiles[j].Path })
+				if !reflect.DeepEqual(rec.ChangedFiles, want) {
+					t.Errorf("dry %v: audit changedFiles = %v, want %v", dry, rec.ChangedFiles, want)
+				}
+			}
+			st, err := r.ReadStatus()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := len(st.ChangedFiles) > 0; got != r.cfg.StatusChangedFiles {
+				t.Errorf("status changedFiles = %v, want them only with statusChangedFiles", st.ChangedFiles)
+			}
+		})
+	}
+}
+
+func TestCapFiles(t *testing.T) {
+	files := make([]status.FileChange, maxChangedFiles+5)
+	if got, omitted := capFiles(files[:maxChangedFiles]); len(got) != maxChangedFiles || omitted != 0 {
+		t.Errorf("at the cap: %d files, %d omitted", len(got), omitted)
+	}
+	if got, omitted := capFiles(files); len(got) != maxChangedFiles || omitted != 5 {
+		t.Errorf("over the cap: %d files, %d omitted, want %d and 5", len(got), omitted, maxChangedFiles)
+	}
+}
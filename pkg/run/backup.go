@@ -0,0 +1,147 @@
+package run
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// backupSetFormat names a backup set, the files one run replaced or removed;
+// names sort by time. Runs within the same nanosecond get a -N suffix.
+const backupSetFormat = "20060102T150405.000000000Z"
+
+// reBackupSet also matches the older one-second names so they are pruned.
+var reBackupSet = regexp.MustCompile(`^\d{8}T\d{6}(\.\d{9})?Z(-\d+)?$`)
+
+// backupIndex is the file in each set listing the saved files' metadata.
+const backupIndex = "index.jsonl"
+
+// backupEntry is one line of backupIndex: what the file was before the run
+// replaced or removed it.
+type backupEntry struct {
+	Path string `json:"path"`
+	Mode string `json:"mode"` // octal permission bits, e.g. "0440"
+	UID  int    `json:"uid"`
+	GID  int    `json:"gid"`
+}
+
+// backupFile copies the current content of the managed file path to
+// <backupDir>/<set>/<path> before it is overwritten or removed, and appends
+// its mode and owner to <set>/index.jsonl. The set is created when the run
+// saves its first file. Without backupDir, or when the file does not exist,
+// it does nothing.
+func (r *Runner) backupFile(path string) error {
+	if r.cfg.BackupDir == "" {
+		return nil
+	}
+	host := r.hostPath(path)
+	fi, err := os.Lstat(host)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("backup %s: %w", path, err)
+	}
+	b, err := os.ReadFile(host)
+	if err != nil {
+		return fmt.Errorf("backup %s: %w", path, err)
+	}
+	if r.backupSet == "" {
+		set, err := newBackupSet(r.cfg.BackupDir, time.Now())
+		if err != nil {
+			return fmt.Errorf("backup %s: %w", path, err)
+		}
+		r.backupSet = set
+	}
+	dst := filepath.Join(r.cfg.BackupDir, r.backupSet, path)
+	if err := os.MkdirAll(filepath.Dir(dst), 0o700); err != nil {
+		return fmt.Errorf("backup %s: %w", path, err)
+	}
+	if err := os.WriteFile(dst, b, 0o600); err != nil {
+		return fmt.Errorf("backup %s: %w", path, err)
+	}
+	e := backupEntry{Path: path, Mode: fmt.Sprintf("%#o", fi.Mode().Perm()), UID: -1, GID: -1}
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+		e.UID, e.GID = int(st.Uid), int(st.Gid)
+	}
+	line, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("backup %s: %w", path, err)
+	}
+	f, err := os.OpenFile(filepath.Join(r.cfg.BackupDir, r.backupSet, backupIndex), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("backup %s: %w", path, err)
+	}
+	_, err = f.Write(append(line, '\n'))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("backup %s: %w", path, err)
+	}
+	return nil
+}
+
+// newBackupSet creates the set directory for now under dir and returns its
+// name, adding a -N suffix when a set of the same name already exists.
+func newBackupSet(dir string, now time.Time) (string, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", err
+	}
+	base := now.UTC().Format(backupSetFormat)
+	for i := 0; ; i++ {
+		name := base
+		if i > 0 {
+			name += "-" + strconv.Itoa(i)
+		}
+		err := os.Mkdir(filepath.Join(dir, name), 0o700)
+		if err == nil {
+			return name, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return "", err
+		}
+	}
+}
+
+// backupSetKey orders set names by time: one-second names sort as if their
+// fraction were zero, and -N suffixes sort numerically.
+func backupSetKey(name string) string {
+	base, n, _ := strings.Cut(name, "-")
+	if !strings.Contains(base, ".") {
+		base = strings.TrimSuffix(base, "Z") + ".000000000Z"
+	}
+	return fmt.Sprintf("%s-%06s", base, n)
+}
+
+// pruneBackups removes the oldest backup sets beyond backupKeep.
+func (r *Runner) pruneBackups() {
+	if r.cfg.BackupDir == "" {
+		return
+	}
+	ents, err := os.ReadDir(r.cfg.BackupDir)
+	if err != nil {
+		return
+	}
+	var sets []string
+	for _, e := range ents {
+		if e.IsDir() && reBackupSet.MatchString(e.Name()) {
+			sets = append(sets, e.Name())
+		}
+	}
+	sort.Slice(sets, func(i, j int) bool { return backupSetKey(sets[i]) < backupSetKey(sets[j]) })
+	for len(sets) > r.cfg.BackupKeep {
+		if err := os.RemoveAll(filepath.Join(r.cfg.BackupDir, sets[0])); err != nil {
+			r.log.Warn("backup", "err", err.Error(), "set", sets[0])
+		}
+		sets = sets[1:]
+	}
+}
@@ -0,0 +1,164 @@
+package run
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const backupRules = "/etc/polkit-1/rules.d/60-lgpo-a.rules"
+
+// backupSets lists the set names in dir, oldest first.
+func backupSets(t *testing.T, dir string) []string {
+	t.Helper()
+	ents, err := os.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	var sets []string
+	for _, e := range ents {
+		if reBackupSet.MatchString(e.Name()) {
+			sets = append(sets, e.Name())
+		}
+	}
+	return sets
+}
+
+func readBackupIndex(t *testing.T, set string) []backupEntry {
+	t.Helper()
+	f, err := os.Open(filepath.Join(set, backupIndex))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var es []backupEntry
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var e backupEntry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			t.Fatal(err)
+		}
+		es = append(es, e)
+	}
+	return es
+}
+
+func TestBackupOnOverwriteAndRemove(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(t *testing.T, policy string) // applied between the two runs
+	}{
+		{"overwrite", func(t *testing.T, policy string) {
+			writeFile(t, policy, strings.Replace(polkitYAML("a"), "staff", "wheel", 1))
+		}},
+		{"remove", func(t *testing.T, policy string) {
+			if err := os.Remove(policy); err != nil {
+				t.Fatal(err)
+			}
+		}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r, dir := newTestRunner(t, "backupDir: "+filepath.Join(t.TempDir(), "b")+"\n")
+			policy := filepath.Join(dir, "repo", "policies", "a.yml")
+			writeFile(t, policy, polkitYAML("a"))
+			ctx := context.Background()
+			if _, err := r.RunOnce(ctx, false, "test"); err != nil {
+				t.Fatal(err)
+			}
+			dst := r.hostPath(backupRules)
+			old, err := os.ReadFile(dst)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Chmod(dst, 0o640); err != nil {
+				t.Fatal(err)
+			}
+			if sets := backupSets(t, r.cfg.BackupDir); len(sets) != 0 {
+				t.Fatalf("first run made backup sets %v", sets)
+			}
+
+			tc.change(t, policy)
+			if _, err := r.RunOnce(ctx, false, "test"); err != nil {
+				t.Fatal(err)
+			}
+			sets := backupSets(t, r.cfg.BackupDir)
+			if len(sets) != 1 {
+				t.Fatalf("backup sets = %v, want one", sets)
+			}
+			set := filepath.Join(r.cfg.BackupDir, sets[0])
+			got, err := os.ReadFile(filepath.Join(set, backupRules))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != string(old) {
+				t.Errorf("backup = %q, want %q", got, old)
+			}
+			es := readBackupIndex(t, set)
+			if len(es) != 1 || es[0].Path != backupRules || es[0].Mode != "0640" || es[0].UID != os.Geteuid() {
+				t.Errorf("index = %+v, want %s mode 0640 uid %d", es, backupRules, os.Geteuid())
+			}
+		})
+	}
+}
+
+func TestBackupSetNames(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Date(2026, 10, 14, 12, 0, 0, 5, time.UTC)
+	var names []string
+	for i := 0; i < 3; i++ {
+		n, err := newBackupSet(dir, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, n)
+	}
+	want := []string{"20261014T120000.000000005Z", "20261014T120000.000000005Z-1", "20261014T120000.000000005Z-2"}
+	for i := range want {
+		if names[i] != want[i] {
+			t.Errorf("set %d = %s, want %s", i, names[i], want[i])
+		}
+	}
+}
+
+func TestPruneBackups(t *testing.T) {
+	tests := []struct {
+		name string
+		keep int
+		sets []string
+		want []string
+	}{
+		{"under the limit", 3, []string{"20261014T120000.000000001Z", "20261014T120001.000000000Z"},
+			[]string{"20261014T120000.000000001Z", "20261014T120001.000000000Z"}},
+		{"oldest pruned first", 2, []string{"20261014T120000Z", "20261014T120000.500000000Z", "20261014T120000.500000000Z-1", "20261014T120001.000000000Z"},
+			[]string{"20261014T120000.500000000Z-1", "20261014T120001.000000000Z"}},
+		{"other dirs left alone", 1, []string{"20261014T120000.000000001Z", "20261014T120001.000000000Z", "notes"},
+			[]string{"20261014T120001.000000000Z"}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r, _ := newTestRunner(t, "backupDir: "+filepath.Join(t.TempDir(), "b")+"\n")
+			r.cfg.BackupKeep = tc.keep
+			for _, s := range tc.sets {
+				if err := os.MkdirAll(filepath.Join(r.cfg.BackupDir, s), 0o700); err != nil {
+					t.Fatal(err)
+				}
+			}
+			r.pruneBackups()
+			got := backupSets(t, r.cfg.BackupDir)
+			if strings.Join(got, " ") != strings.Join(tc.want, " ") {
+				t.Errorf("sets = %v, want %v", got, tc.want)
+			}
+			if tc.name == "other dirs left alone" {
+				if _, err := os.Stat(filepath.Join(r.cfg.BackupDir, "notes")); err != nil {
+					t.Errorf("notes: %v", err)
+				}
+			}
+		})
+	}
+}
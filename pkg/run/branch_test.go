@@ -0,0 +1,91 @@
+package run
+
+import (
+	"bytes"
+	"context"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	lglog "github.com/lgpo-org/lgpod/pkg/log"
+)
+
+func TestBranchFromTag(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   string
+		ring     []string // ring tag values; nil for no tag
+		want     string
+		wantWarn bool
+	}{
+		{"unset", "", []string{"canary"}, "main", false},
+		{"no tag", "branchFromTag: ring\n", nil, "main", false},
+		{"tag value", "branchFromTag: ring\n", []string{"canary"}, "canary", false},
+		{"first value wins", "branchFromTag: ring\n", []string{"beta", "canary"}, "beta", false},
+		{"mapped", "branchFromTag: ring\nbranchMap: {canary: release/next}\n", []string{"canary"}, "release/next", false},
+		{"invalid value", "branchFromTag: ring\n", []string{"../main"}, "main", true},
+		{"invalid mapping", "branchFromTag: ring\nbranchMap: {canary: 'a b'}\n", []string{"canary"}, "main", true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r, _ := newTestRunner(t, "branch: main\n"+tc.config)
+			var buf bytes.Buffer
+			r.log = lglog.NewTo(&buf)
+			r.lastTags = map[string][]string{}
+			if tc.ring != nil {
+				r.lastTags["ring"] = tc.ring
+			}
+			if got := r.branch(); got != tc.want {
+				t.Errorf("branch = %q, want %q", got, tc.want)
+			}
+			if got := strings.Contains(buf.String(), `"err":"invalid branch from tag"`); got != tc.wantWarn {
+				t.Errorf("warning logged = %v, want %v:\n%s", got, tc.wantWarn, buf.String())
+			}
+		})
+	}
+}
+
+func TestFollowBranch(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	dir := t.TempDir()
+	src := newGitRepo(t, dir)
+	head := gitCommit(t, src, map[string]string{"a.yml": polkitYAML("a")})
+	if out, err := exec.Command("git", "-C", src, "checkout", "-q", "-b", "canary").CombinedOutput(); err != nil {
+		t.Fatalf("git checkout: %v: %s", err, out)
+	}
+	canary := gitCommit(t, src, map[string]string{"b.yml": polkitYAML("b")})
+	if out, err := exec.Command("git", "-C", src, "checkout", "-q", "main").CombinedOutput(); err != nil {
+		t.Fatalf("git checkout: %v: %s", err, out)
+	}
+	r := newRunnerIn(t, dir, "repo: "+src+"\nbranch: main\nbranchFromTag: ring\n")
+
+	tests := []struct {
+		ring     string
+		want     string
+		wantWarn bool // the branch could not be synced
+	}{
+		{"canary", canary, false},
+		{"gone", head, true},
+		{"main", head, false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.ring, func(t *testing.T) {
+			writeFile(t, filepath.Join(dir, "tags", "ring.tag"), tc.ring+"\n")
+			var buf bytes.Buffer
+			r.log = lglog.NewTo(&buf)
+			res, err := r.RunOnce(context.Background(), true, "test")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.Commit != tc.want {
+				t.Errorf("commit = %s, want %s", res.Commit, tc.want)
+			}
+			if got := strings.Contains(buf.String(), `"fallback":"main","level":"warn","msg":"branch"`); got != tc.wantWarn {
+				t.Errorf("fallback logged = %v, want %v:\n%s", got, tc.wantWarn, buf.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package run
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Bundle records exactly what the last run enforced: every managed file with
+// its content hash and owning policy, at one commit.
+type Bundle struct {
+	Version   int          `json:"version"`
+	Commit    string       `json:"commit"`
+	Generated string       `json:"generated"`
+	Context   string       `json:"context,omitempty"` // hash of facts, tags and config the run saw
+	Unlocks   []string     `json:"unlocks,omitempty"` // dconf unlock keys in effect
+	Files     []BundleFile `json:"files"`
+}
+
+type BundleFile struct {
+	Path      string `json:"path"`
+	SHA256    string `json:"sha256"`
+	Policy    string `json:"policy"`
+	Kind      string `json:"kind,omitempty"`    // the policy's short kind, e.g. modprobe
+	Source    string `json:"source,omitempty"`  // policy file, relative to the policies dir
+	Expires   string `json:"expires,omitempty"` // the policy's metadata.expires (RFC3339)
+	Initramfs bool   `json:"initramfs,omitempty"`
+}
+
+// bundlePath sits next to managed.json, under the root prefix for the same reason.
+func (r *Runner) bundlePath() string {
+	return r.hostPath(filepath.Join(filepath.Dir(r.cfg.StatusFile), "bundle.json"))
+}
+
+// saveBundle records the applied items plus the files an incremental run
+// carried over unchanged.
+func (r *Runner) saveBundle(commit string, items []applyItem, want *desired) {
+	carried := want.Carried
+	b := Bundle{Version: 1, Commit: commit, Generated: time.Now().UTC().Format(time.RFC3339), Context: r.contextHash(), Unlocks: want.Unlocks, Files: make([]BundleFile, 0, len(items)+len(carried))}
+	for _, it := range items {
+		sum := it.SHA256
+		if sum == "" {
+			sum = sha256Hex(it.Data)
+		}
+		f := BundleFile{Path: it.Path, SHA256: sum, Policy: it.Policy, Kind: want.Kinds[it.Policy], Source: it.Source, Initramfs: it.Initramfs}
+		if !it.Expires.IsZero() {
+			f.Expires = it.Expires.UTC().Format(time.RFC3339)
+		}
+		b.Files = append(b.Files, f)
+	}
+	b.Files = append(b.Files, carried...)
+	out, _ := json.MarshalIndent(b, "", "  ")
+	_ = os.MkdirAll(filepath.Dir(r.bundlePath()), 0o755)
+	_ = os.WriteFile(r.bundlePath(), out, 0o644)
+}
+
+// ReadBundle returns the bundle written by the last non-dry run.
+func (r *Runner) ReadBundle() (*Bundle, error) {
+	b, err := os.ReadFile(r.bundlePath())
+	if err != nil {
+		return nil, err
+	}
+	var out Bundle
+	if err := json.Unmarshal(b, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func sha256Hex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,60 @@
+package run
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestBundle(t *testing.T) {
+	r, dir := newTestRunner(t, "")
+	policies := filepath.Join(dir, "repo", "policies")
+	writeFile(t, filepath.Join(policies, "a.yml"), polkitYAML("a"))
+	writeFile(t, filepath.Join(policies, "team", "mp.yml"), modprobeYAML("mp", "usb-storage", true)+"  updateInitramfs: true\n")
+	ctx := context.Background()
+	if _, err := r.ReadBundle(); err == nil {
+		t.Fatal("bundle before any run")
+	}
+	if _, err := r.RunOnce(ctx, false, "test"); err != nil {
+		t.Fatal(err)
+	}
+	b, err := r.ReadBundle()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Version != 1 || b.Generated == "" || b.Context == "" {
+		t.Errorf("bundle header %+v", b)
+	}
+	got := map[string]BundleFile{}
+	for _, f := range b.Files {
+		data, err := os.ReadFile(r.hostPath(f.Path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f.SHA256 != sha256Hex(data) {
+			t.Errorf("%s: sha256 %s does not match the file on disk", f.Path, f.SHA256)
+		}
+		f.SHA256 = ""
+		got[f.Path] = f
+	}
+	want := map[string]BundleFile{
+		"/etc/polkit-1/rules.d/60-lgpo-a.rules": {Path: "/etc/polkit-1/rules.d/60-lgpo-a.rules", Policy: "a", Kind: "polkit", Source: "a.yml"},
+		"/etc/modprobe.d/60-lgpo-mp.conf":       {Path: "/etc/modprobe.d/60-lgpo-mp.conf", Policy: "mp", Kind: "modprobe", Source: "team/mp.yml", Initramfs: true},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("files = %+v, want %+v", got, want)
+	}
+
+	// a dry run leaves the last enforced bundle alone
+	if err := os.Remove(filepath.Join(policies, "a.yml")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.RunOnce(ctx, true, "test"); err != nil {
+		t.Fatal(err)
+	}
+	if after, err := r.ReadBundle(); err != nil || len(after.Files) != 2 {
+		t.Errorf("bundle after a dry run = %+v, %v", after, err)
+	}
+}
@@ -0,0 +1,89 @@
+package run
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	lglog "github.com/lgpo-org/lgpod/pkg/log"
+)
+
+func TestChannelCommit(t *testing.T) {
+	dir := t.TempDir()
+	src := newGitRepo(t, dir)
+	c1 := gitCommit(t, src, map[string]string{"a.yml": polkitYAML("a")})
+	c2 := gitCommit(t, src, map[string]string{"b.yml": polkitYAML("b")})
+	r := newRunnerIn(t, dir, "repo: "+src+"\nchannelFromTag: ring\n")
+	ctx := context.Background()
+
+	cases := []struct {
+		name    string
+		ring    string
+		channel map[string]string // committed to main before the run
+		want    string            // "" for the branch head
+		wantErr string
+	}{
+		{name: "pinned to channel", ring: "canary", channel: map[string]string{"channels/canary.txt": "# canary\n" + c1 + "\n"}, want: c1},
+		{name: "channel moves forward", ring: "canary", channel: map[string]string{"channels/canary.txt": c2 + "\n"}, want: c2},
+		{name: "missing file follows branch", ring: "beta"},
+		{name: "invalid sha", ring: "broken", channel: map[string]string{"channels/broken.txt": "main\n"}, wantErr: "want a full commit sha"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			head := ""
+			if tc.channel != nil {
+				head = gitCommitTop(t, src, tc.channel)
+			} else {
+				head = gitCommitTop(t, src, map[string]string{"note.txt": tc.name})
+			}
+			writeFile(t, filepath.Join(dir, "tags", "ring.tag"), tc.ring+"\n")
+			res, err := r.RunOnce(ctx, true, "test")
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := tc.want
+			if want == "" {
+				want = head
+			}
+			if res.Commit != want {
+				t.Errorf("commit = %s, want %s", res.Commit, want)
+			}
+		})
+	}
+}
+
+func TestChannelCommitWarnsWhenSyncFailed(t *testing.T) {
+	dir := t.TempDir()
+	src := newGitRepo(t, dir)
+	c1 := gitCommit(t, src, map[string]string{"a.yml": polkitYAML("a")})
+	gitCommitTop(t, src, map[string]string{"channels/canary.txt": c1 + "\n"})
+	r := newRunnerIn(t, dir, "repo: "+src+"\nchannelFromTag: ring\n")
+	writeFile(t, filepath.Join(dir, "tags", "ring.tag"), "canary\n")
+	ctx := context.Background()
+	if _, err := r.RunOnce(ctx, true, "test"); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	r.log = lglog.NewTo(&buf)
+	r.syncErr = errors.New("fetch: connection refused")
+	got, _, err := r.channelCommit(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != c1 {
+		t.Errorf("commit = %s, want %s", got, c1)
+	}
+	if !strings.Contains(buf.String(), "may be stale") {
+		t.Errorf("no stale warning in log:\n%s", buf.String())
+	}
+}
@@ -0,0 +1,106 @@
+package run
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	lglog "github.com/lgpo-org/lgpod/pkg/log"
+)
+
+func TestDconfDb(t *testing.T) {
+	r, dir := newTestRunner(t, "dconfProfile: gdm\ndconfDb: site\n")
+	writeFile(t, filepath.Join(dir, "repo", "policies", "idle.yml"),
+		"apiVersion: lgpo.io/v1\nkind: DconfPolicy\nmetadata:\n  name: idle\nspec:\n  settings:\n    org/gnome/desktop/session:\n      idle-delay: uint32 300\n  locks:\n  - /org/gnome/desktop/session/idle-delay\n")
+	if _, err := r.RunOnce(context.Background(), false, "test"); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{
+		"/etc/dconf/db/site.d/60-lgpo-idle",
+		"/etc/dconf/db/site.d/locks/60-lgpo-idle",
+	} {
+		if _, err := os.Stat(r.hostPath(path)); err != nil {
+			t.Errorf("%s: %v", path, err)
+		}
+	}
+	if _, err := os.Stat(r.hostPath("/etc/dconf/db/local.d")); err == nil {
+		t.Error("the default db was written despite dconfDb: site")
+	}
+}
+
+func TestEnsureDconfProfile(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing string // "" means no profile yet
+		want     string
+	}{
+		{"new", "", "user-db:user\nsystem-db:site\n"},
+		{"append", "user-db:user\nsystem-db:local", "user-db:user\nsystem-db:local\nsystem-db:site\n"},
+		{"present", "user-db:user\nsystem-db:site\nsystem-db:local\n", "user-db:user\nsystem-db:site\nsystem-db:local\n"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "profile", "gdm")
+			if tc.existing != "" {
+				writeFile(t, path, tc.existing)
+			}
+			if err := ensureDconfProfile(path, "site"); err != nil {
+				t.Fatal(err)
+			}
+			b, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != tc.want {
+				t.Errorf("profile = %q, want %q", b, tc.want)
+			}
+		})
+	}
+}
+
+func TestDconfUnlock(t *testing.T) {
+	r, dir := newTestRunner(t, "")
+	var buf bytes.Buffer
+	r.log = lglog.NewTo(&buf)
+	policies := filepath.Join(dir, "repo", "policies")
+	writeFile(t, filepath.Join(policies, "idle.yml"),
+		"apiVersion: lgpo.io/v1\nkind: DconfPolicy\nmetadata:\n  name: idle\nspec:\n  settings:\n    org/gnome/desktop/session:\n      idle-delay: uint32 300\n"+
+			"  locks:\n  - /org/gnome/desktop/session/idle-delay\n  unsetLocks:\n  - /org/gnome/desktop/screensaver/lock-enabled\n")
+	writeFile(t, filepath.Join(policies, "open.yml"),
+		"apiVersion: lgpo.io/v1\nkind: DconfPolicy\nmetadata:\n  name: open\nspec:\n  unlock:\n  - /org/gnome/desktop/session/idle-delay\n")
+	// a locks file of another tool is only warned about
+	site := "/etc/dconf/db/local.d/locks/00-site"
+	writeFile(t, r.hostPath(site), "/org/gnome/desktop/session/idle-delay\n")
+
+	if _, err := r.RunOnce(context.Background(), false, "test"); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(r.hostPath("/etc/dconf/db/local.d/locks/60-lgpo-idle"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "/org/gnome/desktop/screensaver/lock-enabled\n"; string(b) != want {
+		t.Errorf("idle locks = %q, want %q", b, want)
+	}
+	if b, _ := os.ReadFile(r.hostPath(site)); string(b) != "/org/gnome/desktop/session/idle-delay\n" {
+		t.Errorf("%s rewritten to %q", site, b)
+	}
+	if !strings.Contains(buf.String(), "still locked by a file lgpo does not manage") || !strings.Contains(buf.String(), site) {
+		t.Errorf("no warning about %s in log:\n%s", site, buf.String())
+	}
+	bundle, err := r.ReadBundle()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"/org/gnome/desktop/session/idle-delay"}; !reflect.DeepEqual(bundle.Unlocks, want) {
+		t.Errorf("bundle unlocks = %v, want %v", bundle.Unlocks, want)
+	}
+	// the bundle records the locks file as written, so drift stays quiet
+	if items, err := r.Drift(); err != nil || len(items) != 0 {
+		t.Errorf("drift after an unlock = %v, %v", items, err)
+	}
+}
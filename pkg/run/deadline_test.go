@@ -0,0 +1,90 @@
+package run
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func managedPaths(t *testing.T, r *Runner) []string {
+	t.Helper()
+	var s managedState
+	b, err := os.ReadFile(r.managedPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(b, &s); err != nil {
+		t.Fatal(err)
+	}
+	var out []string
+	for _, it := range s.Items {
+		out = append(out, it.Path)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func TestDeadlineKeepsUnappliedOutOfManaged(t *testing.T) {
+	r, dir := newTestRunner(t, "")
+	policies := filepath.Join(dir, "repo", "policies")
+	writeFile(t, filepath.Join(policies, "a.yml"), polkitYAML("a"))
+	ctx := context.Background()
+	if _, err := r.RunOnce(ctx, false, "test"); err != nil {
+		t.Fatal(err)
+	}
+	a := "/etc/polkit-1/rules.d/60-lgpo-a.rules"
+	b := "/etc/polkit-1/rules.d/60-lgpo-b.rules"
+	if got := managedPaths(t, r); !reflect.DeepEqual(got, []string{a}) {
+		t.Fatalf("managed = %v, want [%s]", got, a)
+	}
+
+	// the deadline passes before the first item is applied
+	writeFile(t, filepath.Join(policies, "b.yml"), polkitYAML("b"))
+	expired, cancel := context.WithDeadline(ctx, time.Now().Add(-time.Second))
+	defer cancel()
+	res, err := r.RunOnce(expired, false, "test")
+	if err == nil || res.Result != "failed-timeout" {
+		t.Fatalf("result %q, err %v; want failed-timeout", res.Result, err)
+	}
+	if _, err := os.Stat(r.hostPath(b)); err == nil {
+		t.Fatalf("%s written after the deadline", b)
+	}
+	if got := managedPaths(t, r); !reflect.DeepEqual(got, []string{a}) {
+		t.Errorf("managed = %v, want [%s]", got, a)
+	}
+
+	// the next run applies b and records it
+	if _, err := r.RunOnce(ctx, false, "test"); err != nil {
+		t.Fatal(err)
+	}
+	if got := managedPaths(t, r); !reflect.DeepEqual(got, []string{a, b}) {
+		t.Errorf("managed = %v, want [%s %s]", got, a, b)
+	}
+}
+
+func TestReachedManaged(t *testing.T) {
+	a, b, c := managedItem{Path: "/a"}, managedItem{Path: "/b"}, managedItem{Path: "/c", Initramfs: true}
+	tests := []struct {
+		name      string
+		managed   []managedItem
+		prev      []managedItem
+		unreached map[string]bool
+		want      []managedItem
+	}{
+		{"all reached", []managedItem{a, b}, nil, nil, []managedItem{a, b}},
+		{"new path cut off", []managedItem{a, b}, []managedItem{a}, map[string]bool{"/b": true}, []managedItem{a}},
+		{"managed path keeps its old entry", []managedItem{a, {Path: "/c"}}, []managedItem{c}, map[string]bool{"/c": true}, []managedItem{a, c}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := reachedManaged(tc.managed, tc.prev, tc.unreached); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("reachedManaged = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
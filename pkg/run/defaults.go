@@ -0,0 +1,70 @@
+package run
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+// defaultsFile lives at the top of the policies dir and is never applied itself.
+const defaultsFile = "_defaults.yml"
+
+// policyDefaults holds selector/metadata keys merged into every policy.
+// Keys set in the policy itself always win over the defaults.
+type policyDefaults struct {
+	Selector map[string]any `yaml:"selector"`
+	Metadata map[string]any `yaml:"metadata"`
+}
+
+// loadDefaults reads <polDir>/_defaults.yml; a missing file means no defaults.
+func loadDefaults(polDir string) (*policyDefaults, error) {
+	b, err := os.ReadFile(filepath.Join(polDir, defaultsFile))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var d policyDefaults
+	if err := yaml.Unmarshal(b, &d); err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// apply merges the defaults into the raw policy document b (shallow, per key
+// inside selector and metadata) and returns the merged YAML.
+func (d *policyDefaults) apply(b []byte) ([]byte, error) {
+	if d == nil || (len(d.Selector) == 0 && len(d.Metadata) == 0) {
+		return b, nil
+	}
+	var doc map[string]any
+	if err := yaml.Unmarshal(b, &doc); err != nil {
+		return nil, err
+	}
+	if doc == nil {
+		return b, nil
+	}
+	mergeSection(doc, "selector", d.Selector)
+	mergeSection(doc, "metadata", d.Metadata)
+	return yaml.Marshal(doc)
+}
+
+func mergeSection(doc map[string]any, key string, defs map[string]any) {
+	if len(defs) == 0 {
+		return
+	}
+	cur, _ := doc[key].(map[string]any)
+	if cur == nil {
+		cur = map[string]any{}
+	}
+	for k, v := range defs {
+		if _, ok := cur[k]; !ok {
+			cur[k] = v
+		}
+	}
+	doc[key] = cur
+}
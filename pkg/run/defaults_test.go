@@ -0,0 +1,83 @@
+package run
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPolicyDefaults(t *testing.T) {
+	r, dir := newTestRunner(t, "")
+	policies := filepath.Join(dir, "repo", "policies")
+	writeFile(t, filepath.Join(policies, defaultsFile),
+		"selector:\n  facts:\n    os.id: debian\n  hostnameRegex: '^kiosk-'\n")
+	writeFile(t, filepath.Join(policies, "plain.yml"), polkitYAML("plain"))
+	writeFile(t, filepath.Join(policies, "own.yml"),
+		strings.Replace(polkitYAML("own"), "spec:\n", "selector:\n  facts:\n    os.id: ubuntu\nspec:\n", 1))
+
+	got := map[string]map[string]string{}
+	regex := map[string]string{}
+	if _, err := r.walkPolicies(func(p *policy) {
+		got[p.Name], regex[p.Name] = p.Selector.Facts, p.Selector.HostnameRegex
+	}); err != nil {
+		t.Fatal(err)
+	}
+	// the default only applies where the policy is silent
+	if want := map[string]string{"os.id": "debian"}; !reflect.DeepEqual(got["plain"], want) {
+		t.Errorf("plain facts = %v, want %v", got["plain"], want)
+	}
+	if want := map[string]string{"os.id": "ubuntu"}; !reflect.DeepEqual(got["own"], want) {
+		t.Errorf("own facts = %v, want %v", got["own"], want)
+	}
+	for _, name := range []string{"plain", "own"} {
+		if regex[name] != "^kiosk-" {
+			t.Errorf("%s hostnameRegex = %q, want the default", name, regex[name])
+		}
+	}
+}
+
+func TestMalformedDefaultsAbortsRun(t *testing.T) {
+	r, dir := newTestRunner(t, "")
+	policies := filepath.Join(dir, "repo", "policies")
+	writeFile(t, filepath.Join(policies, "a.yml"), polkitYAML("a"))
+	ctx := context.Background()
+	if _, err := r.RunOnce(ctx, false, "test"); err != nil {
+		t.Fatal(err)
+	}
+	a := "/etc/polkit-1/rules.d/60-lgpo-a.rules"
+
+	// a broken defaults file must not let policies apply without it, nor
+	// make the files of the last run look orphaned
+	writeFile(t, filepath.Join(policies, defaultsFile), "selector: [\n")
+	writeFile(t, filepath.Join(policies, "b.yml"), polkitYAML("b"))
+	res, err := r.RunOnce(ctx, false, "test")
+	if err == nil || !strings.Contains(err.Error(), defaultsFile) {
+		t.Fatalf("err = %v, want a %s error", err, defaultsFile)
+	}
+	if res.Result != "invalid-defaults" {
+		t.Errorf("result = %q, want invalid-defaults", res.Result)
+	}
+	st, err := r.ReadStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Result != "invalid-defaults" || st.Reason != "defaults" {
+		t.Errorf("status = %q/%q, want invalid-defaults/defaults", st.Result, st.Reason)
+	}
+	if _, err := os.Stat(r.hostPath("/etc/polkit-1/rules.d/60-lgpo-b.rules")); err == nil {
+		t.Error("b applied despite the broken defaults")
+	}
+	if _, err := os.Stat(r.hostPath(a)); err != nil {
+		t.Errorf("%s removed: %v", a, err)
+	}
+
+	if _, err := r.Reconcile(ctx, true); err == nil {
+		t.Error("Reconcile succeeded with a broken defaults file")
+	}
+	if _, err := os.Stat(r.hostPath(a)); err != nil {
+		t.Errorf("%s removed by reconcile: %v", a, err)
+	}
+}
@@ -0,0 +1,16 @@
+// Package run is the lgpod engine: it syncs the policy repo, merges facts and
+// tags, renders the matching policies and applies them. cmd/lgpod is a thin
+// wrapper around it, and other programs can drive it the same way:
+//
+//	cfg, err := config.Parse([]byte("localPoliciesDir: /srv/lgpo\nroot: /tmp/lgpo-root\n"))
+//	if err != nil { ... }
+//	r := run.New(cfg, log.NewTo(io.Discard))
+//	res, err := r.RunOnce(ctx, false, "embedded")
+//	// res.Result, res.Changed, res.Errors; r.ReadStatus(), r.Facts(), r.Tags()
+//
+// A Runner keeps no package-level state. Every path it reads or writes comes
+// from the Config: cacheDir, tagsDir, factsDir, statusFile, auditLog,
+// deviceKey, haltFile, and root, which prefixes all managed files (and skips
+// the post-steps that would touch the real system, like dconf update).
+// Facts are discovered from the running host.
+package run
@@ -0,0 +1,137 @@
+package run
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/lgpo-org/lgpod/pkg/inventory"
+)
+
+// Check is one doctor finding. Level is ok, warn or fail; Hint says what to
+// do about anything but ok.
+type Check struct {
+	Name   string
+	Level  string
+	Detail string
+	Hint   string
+}
+
+// doctorBinaries are the external commands the agent runs, with what needs them.
+var doctorBinaries = []struct{ name, usedBy string }{
+	{"dconf", "DconfPolicy"},
+	{"udevadm", "UdevPolicy"},
+	{"modprobe", "ModprobePolicy instantApply"},
+	{"update-initramfs", "ModprobePolicy initramfs"},
+	{"visudo", "SudoersPolicy"},
+	{"systemctl", "ScheduledTaskPolicy timers"},
+}
+
+// Doctor checks the things a working agent needs, in the order they usually
+// break: device key, repo access, inventory entry, binaries, target dirs and
+// the last run. It syncs the repo cache but writes nothing else.
+func (r *Runner) Doctor(ctx context.Context) []Check {
+	var out []Check
+	add := func(name, level, detail, hint string) {
+		out = append(out, Check{Name: name, Level: level, Detail: detail, Hint: hint})
+	}
+
+	// Device key
+	key := r.DeviceKey()
+	hash, _, keyErr := inventory.ComputeDeviceHashFromPrivateKey(key)
+	if keyErr != nil {
+		add("device key", "fail", keyErr.Error(), "create one with scripts/install-lgpo.sh or: ssh-keygen -t ed25519 -N '' -f "+key)
+	} else {
+		add("device key", "ok", fmt.Sprintf("%s: %s (short id %s)", key, hash, inventory.ShortID(hash)), "")
+	}
+
+	// Repo reachable (and read-only for SSH/deploy-key access; git.Ensure refuses write access)
+	commit, err := r.syncRepo(ctx)
+	switch {
+	case err != nil:
+		add("repo", "fail", err.Error(), enrollHint)
+	case r.cfg.LocalDir() != "":
+		add("repo", "ok", "local policies dir "+r.cfg.LocalDir(), "")
+	default:
+		add("repo", "ok", fmt.Sprintf("%s@%s at %s", r.cfg.Repo, r.cfg.Branch, commit), "")
+	}
+
+	// Inventory entry
+	if keyErr == nil {
+		_, tags, match, err := inventory.LookupDevice(r.cfg.RepoDir(), key, r.Facts()["hostname"], r.cfg.InventorySigningKey)
+		switch {
+		case err != nil:
+			add("inventory", "fail", err.Error(), "check inventory/devices.yml in the policy repo")
+		case match == inventory.ByHostname:
+			add("inventory", "warn", "matched by hostname only; tags: "+formatTags(tags),
+				"enroll the key: add "+hash+" to inventory/devices.yml")
+		case match == inventory.NoMatch:
+			add("inventory", "warn", "device not in inventory; policies matching on inventory tags will not apply",
+				"add "+hash+" to inventory/devices.yml")
+		default:
+			add("inventory", "ok", "tags: "+formatTags(tags), "")
+		}
+	}
+
+	// Binaries
+	if r.cfg.LocalDir() == "" {
+		if _, err := exec.LookPath("git"); err != nil {
+			add("binary git", "fail", "not found in PATH", "install git; the repo cannot be synced without it")
+		}
+	}
+	for _, b := range doctorBinaries {
+		if p, err := exec.LookPath(b.name); err != nil {
+			add("binary "+b.name, "warn", "not found in PATH", "install it if this host gets "+b.usedBy)
+		} else {
+			add("binary "+b.name, "ok", p, "")
+		}
+	}
+
+	// Target dirs
+	for _, dir := range r.managedDirs() {
+		p := existingParent(r.hostPath(dir))
+		if err := syscall.Access(p, 2 /* W_OK */); err != nil {
+			add("writable "+dir, "fail", fmt.Sprintf("%s: %v", p, err), "run the agent as root")
+		}
+	}
+
+	// Last run
+	st, err := r.ReadStatus()
+	switch {
+	case os.IsNotExist(err):
+		add("last run", "warn", "no status yet", "start the service or run: lgpod -once")
+	case err != nil:
+		add("last run", "fail", err.Error(), "status file "+r.statusPath()+" is unreadable; the next run rewrites it")
+	case st.Result != "ok":
+		add("last run", "fail", fmt.Sprintf("%s at %s: %s %s", st.Result, st.LastApply, st.Reason, st.Detail), "see the agent log and lgpod -sub status")
+	default:
+		add("last run", "ok", fmt.Sprintf("%s at %s (%s)", st.Result, st.LastApply, st.Reason), "")
+	}
+	return out
+}
+
+// existingParent is dir, or its nearest ancestor that exists.
+func existingParent(dir string) string {
+	for {
+		if _, err := os.Stat(dir); err == nil || dir == filepath.Dir(dir) {
+			return dir
+		}
+		dir = filepath.Dir(dir)
+	}
+}
+
+// formatTags renders tags as "k=v1,v2 k2=v3", sorted by key.
+func formatTags(tags map[string][]string) string {
+	if len(tags) == 0 {
+		return "(none)"
+	}
+	var parts []string
+	for _, k := range sortedKeys(tags) {
+		parts = append(parts, k+"="+strings.Join(tags[k], ","))
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,77 @@
+package run
+
+import (
+	"context"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lgpo-org/lgpod/pkg/inventory"
+)
+
+// doctorLevels maps each check name to its level.
+func doctorLevels(checks []Check) map[string]string {
+	m := map[string]string{}
+	for _, c := range checks {
+		m[c.Name] = c.Level
+	}
+	return m
+}
+
+func TestDoctor(t *testing.T) {
+	if _, err := exec.LookPath("ssh-keygen"); err != nil {
+		t.Skip("ssh-keygen not installed")
+	}
+	r, dir := newTestRunner(t, "")
+	ctx := context.Background()
+	writeFile(t, filepath.Join(dir, "repo", "policies", "a.yml"), polkitYAML("a"))
+
+	// no key yet: the inventory cannot be checked, and nothing has run
+	got := doctorLevels(r.Doctor(ctx))
+	if got["device key"] != "fail" {
+		t.Errorf("device key = %q, want fail", got["device key"])
+	}
+	if _, ok := got["inventory"]; ok {
+		t.Errorf("inventory checked without a device key")
+	}
+	if got["repo"] != "ok" || got["last run"] != "warn" {
+		t.Errorf("repo/last run = %q/%q, want ok/warn", got["repo"], got["last run"])
+	}
+
+	key := filepath.Join(dir, "device.key")
+	if out, err := exec.Command("ssh-keygen", "-q", "-t", "ed25519", "-N", "", "-f", key).CombinedOutput(); err != nil {
+		t.Fatalf("ssh-keygen: %v: %s", err, out)
+	}
+	hash, _, err := inventory.ComputeDeviceHashPreferPub(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	devices := filepath.Join(dir, "repo", "inventory", "devices.yml")
+	tests := []struct {
+		name  string
+		items string
+		want  string
+	}{
+		{"not listed", "  - device_pub_sha256: \"" + strings.Repeat("0", 64) + "\"\n    tags: {group: other}\n", "warn"},
+		{"hostname only", "  - hostnameRegex: \".*\"\n    tags: {group: bootstrap}\n", "warn"},
+		{"enrolled", "  - device_pub_sha256: \"" + hash + "\"\n    tags: {group: laptops}\n", "ok"},
+	}
+	for _, tc := range tests {
+		writeFile(t, devices, "apiVersion: lgpo.io/v1\nkind: DeviceInventory\nitems:\n"+tc.items)
+		got := doctorLevels(r.Doctor(ctx))
+		if got["device key"] != "ok" {
+			t.Errorf("%s: device key = %q, want ok", tc.name, got["device key"])
+		}
+		if got["inventory"] != tc.want {
+			t.Errorf("%s: inventory = %q, want %q", tc.name, got["inventory"], tc.want)
+		}
+	}
+
+	if _, err := r.RunOnce(ctx, false, "test"); err != nil {
+		t.Fatal(err)
+	}
+	if got := doctorLevels(r.Doctor(ctx)); got["last run"] != "ok" {
+		t.Errorf("last run = %q after a good run, want ok", got["last run"])
+	}
+}
@@ -0,0 +1,34 @@
+package run
+
+// DriftItem is one managed file that differs from the desired state.
+type DriftItem struct {
+	Path  string `json:"path"`
+	State string `json:"state"` // missing, modified or stale (would be removed)
+}
+
+// driftStates maps plan actions to drift states; noop is no drift.
+var driftStates = map[string]string{"create": "missing", "update": "modified", "delete": "stale"}
+
+// Drift syncs the repo cache and compares what the policies render to on this
+// host with what is on disk. Unlike RunOnce it never writes tags, managed
+// files, status or audit, and runs no post-steps. It is Plan without the
+// unchanged files, stale ones last.
+func (r *Runner) Drift() ([]DriftItem, error) {
+	pl, err := r.Plan()
+	if err != nil {
+		return nil, err
+	}
+	var out, stale []DriftItem
+	for _, p := range pl.Policies {
+		for _, f := range p.Files {
+			switch state := driftStates[f.Action]; state {
+			case "":
+			case "stale":
+				stale = append(stale, DriftItem{Path: f.Path, State: state})
+			default:
+				out = append(out, DriftItem{Path: f.Path, State: state})
+			}
+		}
+	}
+	return append(out, stale...), nil
+}
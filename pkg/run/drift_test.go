@@ -0,0 +1,44 @@
+package run
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestDrift(t *testing.T) {
+	r, dir := newTestRunner(t, "")
+	policies := filepath.Join(dir, "repo", "policies")
+	for _, n := range []string{"a", "b", "c"} {
+		writeFile(t, filepath.Join(policies, n+".yml"), polkitYAML(n))
+	}
+	if _, err := r.RunOnce(context.Background(), false, "test"); err != nil {
+		t.Fatal(err)
+	}
+	path := func(n string) string { return "/etc/polkit-1/rules.d/60-lgpo-" + n + ".rules" }
+	if items, err := r.Drift(); err != nil || len(items) != 0 {
+		t.Fatalf("drift right after a run = %v, %v", items, err)
+	}
+
+	writeFile(t, r.hostPath(path("a")), "// edited by hand\n")
+	if err := os.Remove(r.hostPath(path("b"))); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(policies, "c.yml")); err != nil {
+		t.Fatal(err)
+	}
+	items, err := r.Drift()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []DriftItem{{path("a"), "modified"}, {path("b"), "missing"}, {path("c"), "stale"}}
+	if !reflect.DeepEqual(items, want) {
+		t.Errorf("drift = %v, want %v", items, want)
+	}
+	// drift writes nothing
+	if b, _ := os.ReadFile(r.hostPath(path("a"))); string(b) != "// edited by hand\n" {
+		t.Errorf("drift rewrote %s", path("a"))
+	}
+}
@@ -0,0 +1,65 @@
+package run_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/lgpo-org/lgpod/pkg/config"
+	"github.com/lgpo-org/lgpod/pkg/log"
+	"github.com/lgpo-org/lgpod/pkg/run"
+)
+
+// A program embedding the agent applies a policies dir under a temp root:
+// every managed file, the status file and the audit log land below it.
+func ExampleRunner_RunOnce() {
+	dir, err := os.MkdirTemp("", "lgpo-example")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir)
+	policy := `apiVersion: lgpo.io/v1
+kind: PolkitPolicy
+metadata: { name: staff-test }
+spec:
+  rules:
+    - name: allow
+      matches: [{action_id: org.example.test}]
+      subject: {group: staff}
+      result: YES
+`
+	_ = os.MkdirAll(filepath.Join(dir, "repo", "policies"), 0o755)
+	_ = os.WriteFile(filepath.Join(dir, "repo", "policies", "staff.yml"), []byte(policy), 0o644)
+
+	cfg, err := config.Parse([]byte(fmt.Sprintf(`localPoliciesDir: %[1]s/repo
+root: %[1]s/root
+cacheDir: %[1]s/cache
+tagsDir: %[1]s/tags
+factsDir: %[1]s/facts
+deviceKey: %[1]s/device.key
+haltFile: %[1]s/HALT
+`, dir)))
+	if err != nil {
+		panic(err)
+	}
+	r := run.New(cfg, log.NewTo(io.Discard))
+	res, err := r.RunOnce(context.Background(), false, "embedded")
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(res.Result, res.Changed)
+
+	_, err = os.Stat(filepath.Join(dir, "root", "etc/polkit-1/rules.d/60-lgpo-staff-test.rules"))
+	fmt.Println("rules written under root:", err == nil)
+	st, err := r.ReadStatus()
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println("status:", st.Result)
+	// Output:
+	// ok 1
+	// rules written under root: true
+	// status: ok
+}
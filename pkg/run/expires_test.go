@@ -0,0 +1,59 @@
+package run
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	lglog "github.com/lgpo-org/lgpod/pkg/log"
+)
+
+func TestPolicyExpires(t *testing.T) {
+	r, dir := newTestRunner(t, "")
+	var buf bytes.Buffer
+	r.log = lglog.NewTo(&buf)
+	policies := filepath.Join(dir, "repo", "policies")
+	expiring := func(name, when string) string {
+		return strings.Replace(polkitYAML(name), "  name: "+name+"\n", "  name: "+name+"\n  expires: "+when+"\n", 1)
+	}
+	ctx := context.Background()
+	temp := "/etc/polkit-1/rules.d/60-lgpo-temp.rules"
+
+	// not yet expired: applied like any other policy
+	writeFile(t, filepath.Join(policies, "temp.yml"), expiring("temp", "2999-01-01T00:00:00Z"))
+	if _, err := r.RunOnce(ctx, false, "test"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(r.hostPath(temp)); err != nil {
+		t.Fatalf("unexpired policy not applied: %v", err)
+	}
+
+	// once expired, its file goes like a deleted policy's
+	writeFile(t, filepath.Join(policies, "temp.yml"), expiring("temp", "2020-01-01T00:00:00Z"))
+	res, err := r.RunOnce(ctx, false, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(r.hostPath(temp)); !os.IsNotExist(err) {
+		t.Errorf("expired policy's file still present: %v", err)
+	}
+	if res.Failed != 0 {
+		t.Errorf("failed = %d, want 0: expiry is not a failure", res.Failed)
+	}
+	if !strings.Contains(buf.String(), `"msg":"expired"`) || !strings.Contains(buf.String(), `"expires":"2020-01-01T00:00:00Z"`) {
+		t.Errorf("expiry not logged:\n%s", buf.String())
+	}
+
+	// a malformed date makes the file invalid rather than never expiring
+	buf.Reset()
+	writeFile(t, filepath.Join(policies, "bad.yml"), expiring("bad", "next tuesday"))
+	if got := walkedNames(r); got != "temp" {
+		t.Errorf("walked %q, want the malformed policy skipped", got)
+	}
+	if !strings.Contains(buf.String(), "metadata.expires must be RFC3339") {
+		t.Errorf("malformed expiry not reported:\n%s", buf.String())
+	}
+}
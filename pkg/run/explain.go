@@ -0,0 +1,39 @@
+package run
+
+import (
+	"sort"
+	"time"
+
+	pk "github.com/lgpo-org/lgpod/pkg/polkit"
+)
+
+// ExplainResult is a simulated polkit check against this host's policies.
+type ExplainResult struct {
+	Considered []string     // rules files that would be installed, in polkit order
+	Decision   *pk.Decision // nil: no lgpo rule returns for the request
+}
+
+// Explain evaluates req against the polkit policies that match this host and
+// render cleanly. Nothing is written.
+func (r *Runner) Explain(req pk.Request) *ExplainResult {
+	ctx := r.Context()
+
+	var ps []*pk.Policy
+	now := time.Now()
+	r.walkPolicies(func(p *policy) {
+		if p.polkit == nil || p.expired(now) || !p.Selector.Match(ctx) {
+			return
+		}
+		if err := p.render(ctx); err != nil {
+			r.log.Warn("render", "err", err.Error(), "file", p.Path)
+			return
+		}
+		ps = append(ps, p.polkit)
+	})
+	res := &ExplainResult{Decision: pk.Explain(ps, req)}
+	for _, p := range ps {
+		res.Considered = append(res.Considered, pk.TargetPath(p))
+	}
+	sort.Strings(res.Considered)
+	return res
+}
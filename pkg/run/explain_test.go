@@ -0,0 +1,31 @@
+package run
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	pk "github.com/lgpo-org/lgpod/pkg/polkit"
+)
+
+func TestExplain(t *testing.T) {
+	r, dir := newTestRunner(t, "")
+	policies := filepath.Join(dir, "repo", "policies")
+	writeFile(t, filepath.Join(policies, "a.yml"), polkitYAML("a"))
+	writeFile(t, filepath.Join(policies, "other.yml"),
+		strings.Replace(polkitYAML("other"), "spec:\n", "selector:\n  hostnameRegex: '^nomatch$'\nspec:\n", 1))
+	writeFile(t, filepath.Join(policies, "bad.yml"), strings.Replace(polkitYAML("bad"), "result: YES", "result: YES\n      message: denied", 1))
+	writeFile(t, filepath.Join(policies, "mp.yml"), modprobeYAML("mp", "usb-storage", true))
+
+	res := r.Explain(pk.Request{ActionID: "org.example.test", User: "alice", Groups: []string{"staff"}})
+	if want := []string{"/etc/polkit-1/rules.d/60-lgpo-a.rules"}; !reflect.DeepEqual(res.Considered, want) {
+		t.Errorf("considered = %q, want %q", res.Considered, want)
+	}
+	if d := res.Decision; d == nil || d.Policy != "a" || d.Result != pk.YES {
+		t.Errorf("decision = %+v, want YES from a", d)
+	}
+	if res := r.Explain(pk.Request{ActionID: "org.example.test", User: "bob"}); res.Decision != nil {
+		t.Errorf("decision for a user outside staff = %+v, want none", res.Decision)
+	}
+}
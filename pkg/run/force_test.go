@@ -0,0 +1,75 @@
+package run
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestForceResetsOwnershipAndMode(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("needs root to chown")
+	}
+	const path = "/etc/sudoers.d/60-lgpo-t"
+	data := []byte("# managed\n")
+	tests := []struct {
+		name      string
+		force     bool
+		tx        bool
+		wantGid   uint32
+		wantMode  fs.FileMode
+		wantWrite bool
+	}{
+		{"unchanged without force", false, false, 1, 0o600, false},
+		{"force", true, false, 0, 0o440, true},
+		{"force in a transaction", true, true, 0, 0o440, true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r, _ := newTestRunner(t, "")
+			dst := r.hostPath(path)
+			writeFile(t, dst, string(data))
+			// a setgid dir hands its group to every new file, the temp file too
+			dir := filepath.Dir(dst)
+			if err := os.Chown(dir, 0, 1); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Chmod(dir, 0o755|fs.ModeSetgid); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Chown(dst, 0, 1); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Chmod(dst, 0o600); err != nil {
+				t.Fatal(err)
+			}
+			r.SetForce(tc.force)
+			it := applyItem{Path: path, Data: data, Mode: 0o440}
+			var err error
+			wrote := false
+			if tc.tx {
+				var st []staged
+				st, err = r.applyTransaction(context.Background(), []applyItem{it}, nil)
+				wrote = len(st) == 1
+			} else {
+				wrote, err = r.applyAtomic(it, false)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if wrote != tc.wantWrite {
+				t.Errorf("wrote = %v, want %v", wrote, tc.wantWrite)
+			}
+			fi, err := os.Stat(dst)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if gid := fi.Sys().(*syscall.Stat_t).Gid; gid != tc.wantGid || fi.Mode().Perm() != tc.wantMode {
+				t.Errorf("gid %d mode %v, want gid %d mode %v", gid, fi.Mode().Perm(), tc.wantGid, tc.wantMode)
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package run
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// hookRefs are a policy's spec.preApply/spec.postApply entries. They name
+// commands from the agent config's hooks allowlist; the repo never supplies
+// the command itself.
+type hookRefs struct {
+	Pre  []string
+	Post []string
+}
+
+// checkHooks rejects hook names the agent config does not define.
+func (r *Runner) checkHooks(h hookRefs) error {
+	for _, n := range append(append([]string(nil), h.Pre...), h.Post...) {
+		if _, ok := r.cfg.Hooks[n]; !ok {
+			return fmt.Errorf("hook %q is not in the agent's hooks allowlist", n)
+		}
+	}
+	return nil
+}
+
+// runHooks runs the named hooks in order with LGPO_POLICY set, stopping at
+// the first failure.
+func (r *Runner) runHooks(ctx context.Context, policy string, names []string) error {
+	for _, n := range names {
+		argv := r.cfg.Hooks[n]
+		cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+		cmd.Env = append(os.Environ(), "LGPO_POLICY="+policy)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("hook %s: %w: %s", n, err, strings.TrimSpace(string(out)))
+		}
+		r.log.Info("hook", "name", n, "policy", policy)
+	}
+	return nil
+}
+
+// pending reports whether applying policy's items would change any file.
+func (r *Runner) pending(items []applyItem, policy string) bool {
+	for _, it := range items {
+		if it.Policy != policy {
+			continue
+		}
+		if c, err := r.applyAtomic(it, true); err == nil && c {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,70 @@
+package run
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunHooks(t *testing.T) {
+	dir := t.TempDir()
+	out := filepath.Join(dir, "out")
+	r, _ := newTestRunner(t, fmt.Sprintf("hooks:\n  mark: [/bin/sh, -c, 'echo \"$LGPO_POLICY\" >> %s']\n  fail: [/bin/sh, -c, 'echo boom; exit 3']\n", out))
+	ctx := context.Background()
+
+	if err := r.runHooks(ctx, "kiosk", []string{"mark", "mark"}); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := os.ReadFile(out); string(b) != "kiosk\nkiosk\n" {
+		t.Errorf("hooks wrote %q, want the policy name twice", b)
+	}
+
+	// the first failure stops the rest
+	err := r.runHooks(ctx, "lab", []string{"fail", "mark"})
+	if err == nil || !strings.Contains(err.Error(), "hook fail") || !strings.Contains(err.Error(), "boom") {
+		t.Errorf("err = %v, want hook fail with its output", err)
+	}
+	if b, _ := os.ReadFile(out); strings.Contains(string(b), "lab") {
+		t.Errorf("hook after a failure ran: %q", b)
+	}
+}
+
+func TestCheckHooks(t *testing.T) {
+	r, dir := newTestRunner(t, "hooks:\n  reload: [/bin/true]\n")
+	tests := []struct {
+		name    string
+		spec    string
+		wantErr string
+	}{
+		{"allowlisted", "  preApply: [reload]\n  postApply: [reload]\n", ""},
+		{"unknown pre", "  preApply: [reboot]\n", `hook "reboot" is not in the agent's hooks allowlist`},
+		{"unknown post", "  postApply: [reload, wipe]\n", `hook "wipe" is not in the agent's hooks allowlist`},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			policies := filepath.Join(dir, "repo", "policies")
+			os.RemoveAll(policies)
+			writeFile(t, filepath.Join(policies, "a.yml"), strings.Replace(polkitYAML("a"), "spec:\n", "spec:\n"+tc.spec, 1))
+			res, err := r.RunOnce(context.Background(), false, "test")
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, statErr := os.Stat(r.hostPath("/etc/polkit-1/rules.d/60-lgpo-a.rules"))
+			if tc.wantErr == "" {
+				if res.Failed != 0 || statErr != nil {
+					t.Errorf("failed %d, rules file: %v; want the policy applied", res.Failed, statErr)
+				}
+				return
+			}
+			if res.Failed != 1 || len(res.Errors) == 0 || !strings.Contains(res.Errors[len(res.Errors)-1].Error(), tc.wantErr) {
+				t.Errorf("failed %d, errors %v; want %q", res.Failed, res.Errors, tc.wantErr)
+			}
+			if statErr == nil {
+				t.Error("policy applied despite an unknown hook")
+			}
+		})
+	}
+}
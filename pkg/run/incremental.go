@@ -0,0 +1,101 @@
+package run
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/lgpo-org/lgpod/pkg/git"
+	"github.com/lgpo-org/lgpod/pkg/version"
+)
+
+// incremental is what an incremental run re-evaluates and what it keeps.
+type incremental struct {
+	changed map[string]bool // policy files changed since the last bundle, relative to the policies dir
+	carry   []BundleFile    // last bundle entries of the other files
+}
+
+// incrementalSince decides whether this run can re-evaluate only the policy
+// files changed between the last bundle's commit and commit. It returns nil,
+// meaning a full evaluation, whenever the shortcut could miss a change.
+func (r *Runner) incrementalSince(ctx context.Context, commit string) *incremental {
+	if !r.cfg.Incremental || r.force || commit == "" || r.cfg.LocalDir() != "" {
+		return nil
+	}
+	full := func(why string) *incremental {
+		r.log.Debug("incremental", "detail", "full evaluation: "+why)
+		return nil
+	}
+	b, err := r.ReadBundle()
+	if err != nil || b.Commit == "" {
+		return full("no previous bundle")
+	}
+	if b.Commit == commit {
+		return nil
+	}
+	if st, err := r.ReadStatus(); err != nil || st.Result != "ok" || st.Failed > 0 || st.Commit != b.Commit {
+		return full("the last run was not a clean apply of " + b.Commit)
+	}
+	if len(b.Unlocks) > 0 {
+		return full("dconf unlock keys apply across policies")
+	}
+	if b.Context != r.contextHash() {
+		return full("facts, tags or config changed")
+	}
+	polDir := r.policiesDir()
+	relPol, err := filepath.Rel(r.cfg.RepoDir(), polDir)
+	if err != nil {
+		return full(err.Error())
+	}
+	files, err := git.ChangedFiles(ctx, r.cfg.CacheDir, b.Commit, commit, filepath.ToSlash(relPol))
+	if err != nil {
+		return full(err.Error())
+	}
+	inc := &incremental{changed: map[string]bool{}}
+	for _, f := range files {
+		rel, err := filepath.Rel(relPol, filepath.FromSlash(f))
+		if err != nil || rel == defaultsFile || rel == manifestFile {
+			return full(f + " changed")
+		}
+		inc.changed[rel] = true
+	}
+	now := time.Now()
+	for _, f := range b.Files {
+		if f.Source == "" || f.Kind == "" {
+			return full("the last bundle has no policy sources or kinds")
+		}
+		if f.Kind == "modprobe" {
+			return full("modprobe conflicts are checked across policies")
+		}
+		if inc.changed[f.Source] {
+			continue
+		}
+		// An expired policy is dropped, so its files are removed as stale
+		// just like on a full run.
+		if t, err := time.Parse(time.RFC3339, f.Expires); err == nil && !now.Before(t) {
+			continue
+		}
+		inc.carry = append(inc.carry, f)
+	}
+	r.log.Info("incremental", "from", b.Commit, "to", commit, "changed", strconv.Itoa(len(inc.changed)), "kept", strconv.Itoa(len(inc.carry)))
+	return inc
+}
+
+// sourceOf is a policy file's path relative to the policies dir.
+func (r *Runner) sourceOf(path string) string {
+	rel, err := filepath.Rel(r.policiesDir(), path)
+	if err != nil {
+		return path
+	}
+	return rel
+}
+
+// contextHash identifies what a full evaluation depends on besides the policy
+// files: facts, tags, config and agent version.
+func (r *Runner) contextHash() string {
+	ctx := r.Context()
+	b, _ := json.Marshal(map[string]any{"facts": ctx.Facts, "tags": ctx.Tags, "config": r.cfg.Dump(), "version": version.Version})
+	return sha256Hex(b)
+}
@@ -0,0 +1,148 @@
+package run
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	lglog "github.com/lgpo-org/lgpod/pkg/log"
+)
+
+func modprobeYAML(name, module string, installFalse bool) string {
+	y := "apiVersion: lgpo.io/v1\nkind: ModprobePolicy\nmetadata:\n  name: " + name + "\nspec:\n  blacklist: [" + module + "]\n"
+	if installFalse {
+		y += "  installFalse: true\n"
+	}
+	return y
+}
+
+// gitCommit writes policy files into the repo at src and commits them.
+func gitCommit(t *testing.T, src string, files map[string]string) string {
+	t.Helper()
+	top := map[string]string{}
+	for name, content := range files {
+		top[filepath.Join("policies", name)] = content
+	}
+	return gitCommitTop(t, src, top)
+}
+
+// gitCommitTop is gitCommit for paths relative to the repo top; it returns
+// the new commit.
+func gitCommitTop(t *testing.T, src string, files map[string]string) string {
+	t.Helper()
+	for name, content := range files {
+		writeFile(t, filepath.Join(src, name), content)
+	}
+	for _, args := range [][]string{{"add", "-A"}, {"-c", "user.name=t", "-c", "user.email=t@example.com", "commit", "-q", "-m", "update"}} {
+		if out, err := exec.Command("git", append([]string{"-C", src}, args...)...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v: %s", args, err, out)
+		}
+	}
+	out, err := exec.Command("git", "-C", src, "rev-parse", "HEAD").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// newGitRepo creates an empty repo with a main branch at <dir>/src.
+func newGitRepo(t *testing.T, dir string) string {
+	t.Helper()
+	src := filepath.Join(dir, "src")
+	if out, err := exec.Command("git", "init", "-q", "-b", "main", src).CombinedOutput(); err != nil {
+		t.Fatalf("git init: %v: %s", err, out)
+	}
+	return src
+}
+
+func TestIncrementalConflicts(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	tests := []struct {
+		name         string
+		before       map[string]string
+		after        map[string]string
+		wantFull     string // full evaluation reason; empty for an incremental run
+		wantConflict bool
+		wantMatched  int // policies in policiesByKind after the second run
+	}{
+		{
+			name:        "polkit change stays incremental",
+			before:      map[string]string{"a.yml": polkitYAML("a"), "b.yml": polkitYAML("b")},
+			after:       map[string]string{"b.yml": polkitYAML("b") + "  # touched\n"},
+			wantMatched: 2,
+		},
+		{
+			name:         "changed modprobe with a kept one",
+			before:       map[string]string{"a.yml": modprobeYAML("a", "usb_storage", false), "b.yml": modprobeYAML("b", "uas", false)},
+			after:        map[string]string{"b.yml": modprobeYAML("b", "usb_storage", true)},
+			wantFull:     "modprobe conflicts are checked across policies",
+			wantConflict: true,
+			wantMatched:  2,
+		},
+		{
+			name:        "kept modprobe with a changed polkit",
+			before:      map[string]string{"a.yml": modprobeYAML("a", "usb_storage", false), "b.yml": polkitYAML("b")},
+			after:       map[string]string{"b.yml": polkitYAML("b") + "  # touched\n"},
+			wantFull:    "modprobe conflicts are checked across policies",
+			wantMatched: 2,
+		},
+		{
+			name:        "new modprobe next to kept polkit",
+			before:      map[string]string{"a.yml": polkitYAML("a"), "b.yml": polkitYAML("b")},
+			after:       map[string]string{"c.yml": modprobeYAML("c", "usb_storage", false)},
+			wantFull:    "a modprobe policy changed",
+			wantMatched: 3,
+		},
+	}
+	for _, tc := range tests {
+		for _, depth := range []int{1, 10} {
+			t.Run(fmt.Sprintf("%s/fetchDepth %d", tc.name, depth), func(t *testing.T) {
+				dir := t.TempDir()
+				src := newGitRepo(t, dir)
+				gitCommit(t, src, tc.before)
+				r := newRunnerIn(t, dir, "repo: "+src+fmt.Sprintf("\nincremental: true\nfetchDepth: %d\n", depth))
+				if _, err := r.RunOnce(context.Background(), false, "test"); err != nil {
+					t.Fatalf("first run: %v", err)
+				}
+				gitCommit(t, src, tc.after)
+				var buf bytes.Buffer
+				r.log = lglog.NewTo(&buf)
+				r.log.SetDebug(true)
+				if _, err := r.RunOnce(context.Background(), false, "test"); err != nil {
+					t.Fatalf("second run: %v", err)
+				}
+				out := buf.String()
+				if tc.wantFull == "" {
+					if !strings.Contains(out, `"kept":"1"`) {
+						t.Errorf("want an incremental run keeping one file, log:\n%s", out)
+					}
+				} else if !strings.Contains(out, "full evaluation: "+tc.wantFull) {
+					t.Errorf("want a full evaluation (%s), log:\n%s", tc.wantFull, out)
+				}
+				if got := strings.Contains(out, `"msg":"conflict"`); got != tc.wantConflict {
+					t.Errorf("conflict reported = %v, want %v, log:\n%s", got, tc.wantConflict, out)
+				}
+				st, err := r.ReadStatus()
+				if err != nil {
+					t.Fatal(err)
+				}
+				matched := 0
+				for _, c := range st.PoliciesByKind {
+					matched += c.Matched
+					if c.Applied != c.Matched {
+						t.Errorf("policiesByKind %+v: not every matched policy counted as applied", st.PoliciesByKind)
+					}
+				}
+				if matched != tc.wantMatched {
+					t.Errorf("policiesByKind %+v: %d matched, want %d", st.PoliciesByKind, matched, tc.wantMatched)
+				}
+			})
+		}
+	}
+}
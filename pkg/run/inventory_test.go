@@ -0,0 +1,254 @@
+package run
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lgpo-org/lgpod/pkg/inventory"
+	lglog "github.com/lgpo-org/lgpod/pkg/log"
+)
+
+func TestRunTagsFromInventory(t *testing.T) {
+	if _, err := exec.LookPath("ssh-keygen"); err != nil {
+		t.Skip("ssh-keygen not installed")
+	}
+	tests := []struct {
+		name      string
+		byKey     bool // the inventory lists the device hash too
+		wantGroup string
+		wantWarn  bool // the run logs the hostname match as less trusted
+	}{
+		{"hostname fallback", false, "bootstrap", true},
+		{"key wins", true, "laptops", false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r, dir := newTestRunner(t, "")
+			key := filepath.Join(dir, "device.key")
+			if out, err := exec.Command("ssh-keygen", "-q", "-t", "ed25519", "-N", "", "-f", key).CombinedOutput(); err != nil {
+				t.Fatalf("ssh-keygen: %v: %s", err, out)
+			}
+			hash, _, err := inventory.ComputeDeviceHashPreferPub(key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			items := "  - hostnameRegex: \".*\"\n    tags: {group: bootstrap}\n"
+			if tc.byKey {
+				items += "  - device_pub_sha256: \"" + hash + "\"\n    tags: {group: laptops}\n"
+			}
+			writeFile(t, filepath.Join(dir, "repo", "inventory", "devices.yml"), "apiVersion: lgpo.io/v1\nkind: DeviceInventory\nitems:\n"+items)
+			var buf bytes.Buffer
+			r.log = lglog.NewTo(&buf)
+			if _, err := r.RunOnce(context.Background(), true, "test"); err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.Join(r.Tags()["group"], ","); got != tc.wantGroup {
+				t.Errorf("group = %q, want %q", got, tc.wantGroup)
+			}
+			if got := strings.Contains(buf.String(), "inventory matched by hostname"); got != tc.wantWarn {
+				t.Errorf("hostname warning logged = %v, want %v:\n%s", got, tc.wantWarn, buf.String())
+			}
+		})
+	}
+}
+
+func TestRunHalted(t *testing.T) {
+	tests := []struct {
+		name   string
+		file   bool   // create the HALT file
+		tag    string // lgpo.halt.tag content; empty writes no tag file
+		wantBy string // "" for a run that applies
+	}{
+		{"no trigger", false, "", ""},
+		{"halt file", true, "", "HALT"},
+		{"halt tag", false, "true", "tag lgpo.halt"},
+		{"tag not true", false, "false", ""},
+		{"file wins over tag", true, "true", "HALT"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r, dir := newTestRunner(t, "")
+			writeFile(t, filepath.Join(dir, "repo", "policies", "a.yml"), polkitYAML("a"))
+			if tc.file {
+				writeFile(t, filepath.Join(dir, "HALT"), "")
+			}
+			if tc.tag != "" {
+				writeFile(t, filepath.Join(dir, "tags", haltTag+".tag"), tc.tag+"\n")
+			}
+			if tc.wantBy == "HALT" {
+				tc.wantBy = filepath.Join(dir, "HALT")
+			}
+			var buf bytes.Buffer
+			r.log = lglog.NewTo(&buf)
+			res, err := r.RunOnce(context.Background(), false, "test")
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, statErr := os.Stat(r.hostPath("/etc/polkit-1/rules.d/60-lgpo-a.rules"))
+			if tc.wantBy == "" {
+				if res.Result != "ok" || statErr != nil {
+					t.Errorf("result %q, rules file: %v; want an applied run", res.Result, statErr)
+				}
+				return
+			}
+			if res.Result != "halted" || statErr == nil {
+				t.Errorf("result %q, rules file written: %v; want halted with nothing applied", res.Result, statErr == nil)
+			}
+			st, err := r.ReadStatus()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if st.Reason != "kill-switch" || st.Detail != tc.wantBy {
+				t.Errorf("status reason %q detail %q, want kill-switch %q", st.Reason, st.Detail, tc.wantBy)
+			}
+			if !strings.Contains(buf.String(), `"by":"`+tc.wantBy+`","detail":"kill-switch active`) {
+				t.Errorf("halted log does not name %q:\n%s", tc.wantBy, buf.String())
+			}
+		})
+	}
+}
+
+func TestTagPerms(t *testing.T) {
+	tests := []struct {
+		owner, group string
+		uid, gid     int
+		wantErr      string
+	}{
+		{"", "", -1, -1, ""},
+		{"nobody", "", 65534, -1, ""},
+		{"", "0", -1, 0, ""},
+		{"1234", "root", 1234, 0, ""},
+		{"no-such-user-lgpo", "", 0, 0, "tagsOwner"},
+		{"", "no-such-group-lgpo", 0, 0, "tagsGroup"},
+	}
+	for _, tc := range tests {
+		r, _ := newTestRunner(t, "tagsDirMode: \"0700\"\ntagsFileMode: \"0600\"\n")
+		r.cfg.TagsOwner, r.cfg.TagsGroup = tc.owner, tc.group
+		p, err := r.tagPerms()
+		if tc.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("%q/%q: err = %v, want a %s error", tc.owner, tc.group, err, tc.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := (inventory.TagPerms{DirMode: 0o700, FileMode: 0o600, UID: tc.uid, GID: tc.gid}); p != want {
+			t.Errorf("%q/%q: perms = %+v, want %+v", tc.owner, tc.group, p, want)
+		}
+	}
+}
+
+func TestDeviceKey(t *testing.T) {
+	if _, err := exec.LookPath("ssh-keygen"); err != nil {
+		t.Skip("ssh-keygen not installed")
+	}
+	dir := t.TempDir()
+	keys := map[string]string{}
+	for _, name := range []string{"ed25519", "rsa"} {
+		keys[name] = filepath.Join(dir, name+".key")
+		if out, err := exec.Command("ssh-keygen", "-q", "-t", name, "-N", "", "-f", keys[name]).CombinedOutput(); err != nil {
+			t.Fatalf("ssh-keygen: %v: %s", err, out)
+		}
+	}
+	rsaHash, _, err := inventory.ComputeDeviceHashPreferPub(keys["rsa"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	missing := filepath.Join(dir, "ecdsa.key")
+	tests := []struct {
+		name     string
+		keys     []string // deviceKey, then deviceKeys
+		enrolled bool     // the inventory lists the rsa key
+		want     string
+	}{
+		{"single key", []string{missing}, true, missing},
+		{"the enrolled one", []string{keys["ed25519"], keys["rsa"]}, true, keys["rsa"]},
+		{"none enrolled: first that exists", []string{missing, keys["rsa"], keys["ed25519"]}, false, keys["rsa"]},
+		{"none exist", []string{missing, missing + ".2"}, false, missing},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r, rdir := newTestRunner(t, "")
+			r.cfg.DeviceKey, r.cfg.DeviceKeys = tc.keys[0], tc.keys[1:]
+			items := "  - hostnameRegex: \".*\"\n    tags: {group: bootstrap}\n"
+			if tc.enrolled {
+				items += "  - device_pub_sha256: \"" + rsaHash + "\"\n    tags: {group: laptops}\n"
+			}
+			writeFile(t, filepath.Join(rdir, "repo", "inventory", "devices.yml"), "apiVersion: lgpo.io/v1\nkind: DeviceInventory\nitems:\n"+items)
+			if got := r.DeviceKey(); got != tc.want {
+				t.Errorf("DeviceKey = %s, want %s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestRunEnrolled(t *testing.T) {
+	if _, err := exec.LookPath("ssh-keygen"); err != nil {
+		t.Skip("ssh-keygen not installed")
+	}
+	dir := t.TempDir()
+	key := filepath.Join(dir, "device.key")
+	if out, err := exec.Command("ssh-keygen", "-q", "-t", "ed25519", "-N", "", "-f", key).CombinedOutput(); err != nil {
+		t.Fatalf("ssh-keygen: %v: %s", err, out)
+	}
+	hash, _, err := inventory.ComputeDeviceHashPreferPub(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name  string
+		items string
+		want  string // status and audit enrolled; "" when left out
+	}{
+		{"not listed", "  - device_pub_sha256: \"" + strings.Repeat("0", 64) + "\"\n    tags: {group: other}\n", "false"},
+		{"hostname only", "  - hostnameRegex: \".*\"\n    tags: {group: bootstrap}\n", "false"},
+		{"enrolled", "  - device_pub_sha256: \"" + hash + "\"\n    tags: {group: laptops}\n", "true"},
+		{"unreadable inventory", "  - [\n", ""},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r, rdir := newTestRunner(t, "")
+			r.cfg.DeviceKey = key
+			writeFile(t, filepath.Join(rdir, "repo", "inventory", "devices.yml"), "apiVersion: lgpo.io/v1\nkind: DeviceInventory\nitems:\n"+tc.items)
+			// an unreadable inventory is a run error, checked below by enrolled being left out
+			_, _ = r.RunOnce(context.Background(), false, "test")
+
+			st, err := r.ReadStatus()
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := ""
+			if st.Enrolled != nil {
+				got = fmt.Sprint(*st.Enrolled)
+			}
+			if got != tc.want {
+				t.Errorf("status enrolled = %q, want %q", got, tc.want)
+			}
+			b, err := os.ReadFile(r.auditPath())
+			if err != nil {
+				t.Fatal(err)
+			}
+			lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+			var rec map[string]any
+			if err := json.Unmarshal([]byte(lines[len(lines)-1]), &rec); err != nil {
+				t.Fatal(err)
+			}
+			got = ""
+			if v, ok := rec["enrolled"]; ok {
+				got = fmt.Sprint(v)
+			}
+			if got != tc.want {
+				t.Errorf("audit enrolled = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package run
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLocalPoliciesDir(t *testing.T) {
+	tests := []struct {
+		name   string
+		config func(src string) string
+	}{
+		{"localPoliciesDir", func(src string) string { return "localPoliciesDir: " + src + "\n" }},
+		{"file repo URL", func(src string) string { return "repo: file://" + src + "\nbranch: main\n" }},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			src := filepath.Join(dir, "usb", "lgpo")
+			writeFile(t, filepath.Join(src, "policies", "a.yml"), polkitYAML("a"))
+			r := newRunnerIn(t, dir, tc.config(src))
+			res, err := r.RunOnce(context.Background(), false, "test")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.Commit != "" {
+				t.Errorf("commit = %q, want none for a local dir", res.Commit)
+			}
+			if _, err := os.Stat(r.hostPath("/etc/polkit-1/rules.d/60-lgpo-a.rules")); err != nil {
+				t.Errorf("policy not applied from the local dir: %v", err)
+			}
+			// git is never touched
+			if _, err := os.Stat(filepath.Join(dir, "cache", ".git")); err == nil {
+				t.Error("the repo cache was cloned")
+			}
+			b, err := os.ReadFile(r.auditPath())
+			if err != nil {
+				t.Fatal(err)
+			}
+			var rec map[string]any
+			if err := json.Unmarshal(b, &rec); err != nil {
+				t.Fatal(err)
+			}
+			if rec["source"] != "local:"+src {
+				t.Errorf("audit source = %v, want local:%s", rec["source"], src)
+			}
+		})
+	}
+}
+
+func TestLocalPoliciesDirMissing(t *testing.T) {
+	dir := t.TempDir()
+	r := newRunnerIn(t, dir, "localPoliciesDir: "+filepath.Join(dir, "unmounted")+"\n")
+	_, err := r.RunOnce(context.Background(), false, "test")
+	if err == nil || !strings.Contains(err.Error(), "local policies dir") {
+		t.Fatalf("err = %v, want a local policies dir error", err)
+	}
+}
@@ -0,0 +1,60 @@
+package run
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// manifestFile sits at the top of the policies dir in `sha256sum` format.
+const manifestFile = "MANIFEST.sha256"
+
+// manifest maps slash-separated paths (relative to the policies dir) to
+// their expected lowercase hex SHA-256.
+type manifest map[string]string
+
+func loadManifest(polDir string) (manifest, error) {
+	path := filepath.Join(polDir, manifestFile)
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", path, err)
+	}
+	m := manifest{}
+	sc := bufio.NewScanner(bytes.NewReader(b))
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		sum, name, ok := strings.Cut(line, " ")
+		if !ok || len(sum) != 64 {
+			return nil, fmt.Errorf("%s:%d: want \"<sha256>  <path>\"", path, n)
+		}
+		name = strings.TrimPrefix(strings.TrimSpace(name), "*")
+		m[filepath.ToSlash(filepath.Clean(name))] = strings.ToLower(sum)
+	}
+	return m, sc.Err()
+}
+
+// verify checks the raw bytes b of the file at path against the manifest.
+func (m manifest) verify(polDir, path string, b []byte) error {
+	rel, err := filepath.Rel(polDir, path)
+	if err != nil {
+		return err
+	}
+	rel = filepath.ToSlash(rel)
+	want, ok := m[rel]
+	if !ok {
+		return fmt.Errorf("%s: not listed in %s", rel, manifestFile)
+	}
+	sum := sha256.Sum256(b)
+	if got := hex.EncodeToString(sum[:]); got != want {
+		return fmt.Errorf("%s: sha256 %s does not match manifest %s", rel, got, want)
+	}
+	return nil
+}
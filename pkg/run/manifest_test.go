@@ -0,0 +1,73 @@
+package run
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadManifest(t *testing.T) {
+	dir := t.TempDir()
+	a, b := sha256Hex([]byte("a")), sha256Hex([]byte("b"))
+	writeFile(t, filepath.Join(dir, manifestFile),
+		"# generated by sha256sum\n\n"+a+"  a.yml\n"+strings.ToUpper(b)+" *team/./b.yml\n")
+	m, err := loadManifest(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m) != 2 || m["a.yml"] != a || m["team/b.yml"] != b {
+		t.Errorf("manifest = %v", m)
+	}
+
+	writeFile(t, filepath.Join(dir, manifestFile), a+"  a.yml\nbad  b.yml\n")
+	if _, err := loadManifest(dir); err == nil || !strings.Contains(err.Error(), manifestFile+":2:") {
+		t.Errorf("err = %v, want a line 2 error", err)
+	}
+}
+
+func TestVerifyManifest(t *testing.T) {
+	a, b := polkitYAML("a"), polkitYAML("b")
+	tests := []struct {
+		name     string
+		manifest string // "" writes no manifest
+		want     string // run result
+		detail   string // in the status detail
+	}{
+		{"all match", sha256Hex([]byte(a)) + "  a.yml\n" + sha256Hex([]byte(b)) + "  team/b.yml\n", "ok", ""},
+		{"mismatch", sha256Hex([]byte(a)) + "  a.yml\n" + sha256Hex([]byte("tampered")) + "  team/b.yml\n", "manifest-mismatch", "does not match"},
+		{"missing entry", sha256Hex([]byte(a)) + "  a.yml\n", "manifest-mismatch", "team/b.yml: not listed"},
+		{"no manifest", "", "manifest-mismatch", manifestFile},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r, dir := newTestRunner(t, "verifyManifest: true\n")
+			policies := filepath.Join(dir, "repo", "policies")
+			writeFile(t, filepath.Join(policies, "a.yml"), a)
+			writeFile(t, filepath.Join(policies, "team", "b.yml"), b)
+			if tc.manifest != "" {
+				writeFile(t, filepath.Join(policies, manifestFile), tc.manifest)
+			}
+			res, err := r.RunOnce(context.Background(), false, "test")
+			if (err != nil) != (tc.want != "ok") {
+				t.Fatalf("err = %v", err)
+			}
+			if res.Result != tc.want {
+				t.Errorf("result = %q, want %q", res.Result, tc.want)
+			}
+			st, err := r.ReadStatus()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(st.Detail, tc.detail) {
+				t.Errorf("status detail = %q, want %q", st.Detail, tc.detail)
+			}
+			// a rejected file stops the whole run, not just that file
+			_, err = os.Stat(r.hostPath("/etc/polkit-1/rules.d/60-lgpo-a.rules"))
+			if applied := err == nil; applied != (tc.want == "ok") {
+				t.Errorf("a applied = %v with result %s", applied, tc.want)
+			}
+		})
+	}
+}
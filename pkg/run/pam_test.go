@@ -0,0 +1,136 @@
+package run
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const pamSnippet = "/etc/pam.d/60-lgpo-t"
+
+// installPamModules puts fake pam_unix.so and pam_faillock.so under root.
+func installPamModules(t *testing.T, root string) {
+	t.Helper()
+	for _, m := range []string{"pam_unix.so", "pam_faillock.so"} {
+		writeFile(t, filepath.Join(root, "lib/security", m), "\x7fELF")
+	}
+}
+
+func TestApplyPamRollback(t *testing.T) {
+	const newData = "auth required pam_faillock.so preauth\n"
+	tests := []struct {
+		name     string
+		old      string // previous snippet; empty when there was none
+		includer string // /etc/pam.d/common-auth
+		wantErr  bool
+	}{
+		{"fresh install", "", "", false},
+		{"good includer", "", "auth required pam_unix.so\n@include 60-lgpo-t\n", false},
+		{"update with good includer", "auth required pam_unix.so\n", "@include 60-lgpo-t\n", false},
+		{"broken includer removes new file", "", "auth required pam_gone.so\n@include 60-lgpo-t\n", true},
+		{"broken includer restores old file", "auth required pam_unix.so\n", "@include 60-lgpo-t\n@include common-gone\n", true},
+	}
+	for _, tc := range tests {
+		for _, tx := range []bool{false, true} {
+			name := tc.name
+			if tx {
+				name += " (transactional)"
+			}
+			t.Run(name, func(t *testing.T) {
+				r, _ := newTestRunner(t, "")
+				root := r.cfg.Root
+				installPamModules(t, root)
+				dst := r.hostPath(pamSnippet)
+				if tc.old != "" {
+					writeFile(t, dst, tc.old)
+				}
+				if tc.includer != "" {
+					writeFile(t, r.hostPath("/etc/pam.d/common-auth"), tc.includer)
+				}
+				it := applyItem{Path: pamSnippet, Data: []byte(newData), Mode: 0o644, Pam: true}
+				var err error
+				if tx {
+					_, err = r.applyTransaction(context.Background(), []applyItem{it}, nil)
+				} else {
+					_, err = r.applyAtomic(it, false)
+				}
+				if (err != nil) != tc.wantErr {
+					t.Fatalf("apply error = %v, want error %v", err, tc.wantErr)
+				}
+				b, readErr := os.ReadFile(dst)
+				switch {
+				case !tc.wantErr:
+					if string(b) != newData {
+						t.Errorf("installed %q, want %q", b, newData)
+					}
+				case tc.old == "":
+					if readErr == nil {
+						t.Errorf("new snippet left in place: %q", b)
+					}
+				default:
+					if string(b) != tc.old {
+						t.Errorf("after rollback %q, want %q", b, tc.old)
+					}
+				}
+				if _, err := os.Stat(dst + ".lgpo-tmp"); err == nil {
+					t.Error("temp file left behind")
+				}
+			})
+		}
+	}
+}
+
+func TestStalePamSnippetKeptWhileIncluded(t *testing.T) {
+	tests := []struct {
+		name        string
+		includer    string
+		wantRemoved bool
+	}{
+		{"not included", "auth required pam_unix.so\n", true},
+		{"included", "auth required pam_unix.so\n@include 60-lgpo-t\n", false},
+		{"included as substack", "auth substack 60-lgpo-t\n", false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r, dir := newTestRunner(t, "")
+			if err := os.MkdirAll(filepath.Join(dir, "repo", "policies"), 0o755); err != nil {
+				t.Fatal(err)
+			}
+			installPamModules(t, r.cfg.Root)
+			dst := r.hostPath(pamSnippet)
+			writeFile(t, dst, "auth required pam_faillock.so preauth\n")
+			writeFile(t, r.hostPath("/etc/pam.d/common-auth"), tc.includer)
+			r.saveManaged([]managedItem{{Path: pamSnippet}})
+
+			if _, err := r.RunOnce(context.Background(), false, "test"); err != nil {
+				t.Fatalf("RunOnce: %v", err)
+			}
+			_, err := os.Stat(dst)
+			if removed := err != nil; removed != tc.wantRemoved {
+				t.Fatalf("removed = %v, want %v", removed, tc.wantRemoved)
+			}
+			kept := false
+			for _, it := range r.loadManaged().Items {
+				kept = kept || it.Path == pamSnippet
+			}
+			if kept == tc.wantRemoved {
+				t.Errorf("managed.json keeps the snippet = %v, want %v", kept, !tc.wantRemoved)
+			}
+
+			// reconcile -remove treats an unrecorded snippet the same way
+			r.saveManaged(nil)
+			found, err := r.Reconcile(context.Background(), true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !tc.wantRemoved && (len(found) != 1 || !strings.HasSuffix(found[0], "60-lgpo-t")) {
+				t.Fatalf("reconcile found %v", found)
+			}
+			if _, err := os.Stat(dst); !tc.wantRemoved && err != nil {
+				t.Error("reconcile removed an included snippet")
+			}
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package run
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	lglog "github.com/lgpo-org/lgpod/pkg/log"
+)
+
+func TestPinCommit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	dir := t.TempDir()
+	src := newGitRepo(t, dir)
+	c1 := gitCommit(t, src, map[string]string{"a.yml": polkitYAML("a")})
+	head := gitCommit(t, src, map[string]string{"b.yml": polkitYAML("b")})
+	r := newRunnerIn(t, dir, "repo: "+src+"\n")
+	ctx := context.Background()
+	pin := filepath.Join(dir, "tags", pinTag+".tag")
+	b := "/etc/polkit-1/rules.d/60-lgpo-b.rules"
+
+	cases := []struct {
+		name    string
+		tag     string // "" removes the tag
+		want    string
+		wantErr string
+	}{
+		{"pinned", c1, c1, ""},
+		{"upper case sha", strings.ToUpper(c1), c1, ""},
+		{"unpinned follows the branch", "", head, ""},
+		{"short sha", c1[:12], "", "want a full commit sha"},
+		{"unknown commit", strings.Repeat("0", 40), "", "git fetch"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			os.Remove(pin)
+			if tc.tag != "" {
+				writeFile(t, pin, tc.tag+"\n")
+			}
+			res, err := r.RunOnce(ctx, false, "test")
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tc.wantErr)
+				}
+				if res.Result != "failed" {
+					t.Errorf("result = %q, want failed", res.Result)
+				}
+				// nothing is applied: the files of the last good run stay
+				if _, err := os.Stat(r.hostPath(b)); err != nil {
+					t.Errorf("%s removed by a failed pin: %v", b, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.Commit != tc.want {
+				t.Errorf("commit = %s, want %s", res.Commit, tc.want)
+			}
+			if _, err := os.Stat(r.hostPath(b)); (err == nil) != (tc.want == head) {
+				t.Errorf("%s present = %v at %s", b, err == nil, tc.want)
+			}
+			audit, err := os.ReadFile(r.auditPath())
+			if err != nil {
+				t.Fatal(err)
+			}
+			lines := strings.Split(strings.TrimSpace(string(audit)), "\n")
+			var rec struct {
+				Pinned bool `json:"pinned"`
+			}
+			if err := json.Unmarshal([]byte(lines[len(lines)-1]), &rec); err != nil {
+				t.Fatal(err)
+			}
+			if rec.Pinned != (tc.tag != "") {
+				t.Errorf("audit pinned = %v, want %v", rec.Pinned, tc.tag != "")
+			}
+		})
+	}
+}
+
+func TestPinCommitLocalDir(t *testing.T) {
+	r, dir := newTestRunner(t, "")
+	var buf bytes.Buffer
+	r.log = lglog.NewTo(&buf)
+	writeFile(t, filepath.Join(dir, "repo", "policies", "a.yml"), polkitYAML("a"))
+	writeFile(t, filepath.Join(dir, "tags", pinTag+".tag"), strings.Repeat("a", 40)+"\n")
+	if _, err := r.RunOnce(context.Background(), false, "test"); err != nil {
+		t.Fatalf("a pin tag must not fail a local run: %v", err)
+	}
+	if !strings.Contains(buf.String(), "ignored with a local policies dir") {
+		t.Errorf("ignored pin not logged:\n%s", buf.String())
+	}
+}
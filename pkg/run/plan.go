@@ -0,0 +1,104 @@
+package run
+
+import (
+	"context"
+	"os"
+)
+
+// Plan is what a run would do on this host, per policy. It is the
+// structured form of Drift and computed the same way.
+type Plan struct {
+	Commit   string       `json:"commit,omitempty"`
+	Policies []PlanPolicy `json:"policies"`
+}
+
+// PlanPolicy is one policy in the repo, or (File empty) one that is gone
+// from it but still has files on disk.
+type PlanPolicy struct {
+	Name    string     `json:"name"`
+	Kind    string     `json:"kind,omitempty"`
+	File    string     `json:"file,omitempty"`
+	Matches bool       `json:"matches"`
+	Expired bool       `json:"expired,omitempty"`
+	Error   string     `json:"error,omitempty"` // why a matching policy would not apply
+	Files   []PlanFile `json:"files"`
+}
+
+// PlanFile is one target path. Before and After are sha256 hashes of the
+// file on disk and as rendered; either is empty when there is no such file.
+type PlanFile struct {
+	Path   string `json:"path"`
+	Action string `json:"action"` // create, update, noop or delete
+	Before string `json:"before,omitempty"`
+	After  string `json:"after,omitempty"`
+}
+
+// Plan syncs the repo cache and compares what the policies render to on
+// this host with what is on disk. Like Drift it writes nothing.
+func (r *Runner) Plan() (*Plan, error) {
+	commit, err := r.syncRepo(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	r.refreshContext()
+	commit, _ = r.followBranch(context.Background(), commit)
+
+	want := r.evaluate(false)
+	if want.Defaults != nil {
+		return nil, want.Defaults
+	}
+	pl := &Plan{Commit: commit}
+	index := map[string]int{} // policy name -> position in pl.Policies
+	for _, s := range want.Seen {
+		index[s.Name] = len(pl.Policies)
+		pl.Policies = append(pl.Policies, PlanPolicy{Name: s.Name, Kind: s.Kind, File: s.File, Matches: s.Matches, Expired: s.Expired, Files: []PlanFile{}})
+	}
+	for _, f := range want.Failures {
+		if i, ok := index[f.Policy]; ok && pl.Policies[i].Error == "" {
+			pl.Policies[i].Error = f.Error
+		}
+	}
+	for _, it := range want.Items {
+		f := PlanFile{Path: it.Path, After: it.SHA256}
+		if f.After == "" {
+			f.After = sha256Hex(it.Data)
+		}
+		b, err := os.ReadFile(r.hostPath(it.Path))
+		switch {
+		case err != nil:
+			f.Action = "create"
+		case sha256Hex(b) != f.After:
+			f.Action, f.Before = "update", sha256Hex(b)
+		default:
+			f.Action, f.Before = "noop", f.After
+		}
+		i := index[it.Policy]
+		pl.Policies[i].Files = append(pl.Policies[i].Files, f)
+	}
+
+	// Stale files, attributed to their policy by the last bundle
+	owner := map[string]string{}
+	if b, err := r.ReadBundle(); err == nil {
+		for _, f := range b.Files {
+			owner[f.Path] = f.Policy
+		}
+	}
+	for _, it := range r.loadManaged().Items {
+		if _, ok := want.Paths[it.Path]; ok || !allowedPath(it.Path) {
+			continue
+		}
+		b, err := os.ReadFile(r.hostPath(it.Path))
+		if err != nil {
+			continue
+		}
+		name := owner[it.Path]
+		i, ok := index[name]
+		if !ok {
+			i = len(pl.Policies)
+			index[name] = i
+			pl.Policies = append(pl.Policies, PlanPolicy{Name: name, Files: []PlanFile{}})
+		}
+		pl.Policies[i].Files = append(pl.Policies[i].Files, PlanFile{Path: it.Path, Action: "delete", Before: sha256Hex(b)})
+	}
+	return pl, nil
+}
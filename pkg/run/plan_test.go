@@ -0,0 +1,97 @@
+package run
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPlan(t *testing.T) {
+	r, dir := newTestRunner(t, "")
+	policies := filepath.Join(dir, "repo", "policies")
+	for _, n := range []string{"a", "b", "c"} {
+		writeFile(t, filepath.Join(policies, n+".yml"), polkitYAML(n))
+	}
+	if _, err := r.RunOnce(context.Background(), false, "test"); err != nil {
+		t.Fatal(err)
+	}
+	path := func(n string) string { return "/etc/polkit-1/rules.d/60-lgpo-" + n + ".rules" }
+
+	writeFile(t, r.hostPath(path("a")), "// edited by hand\n")
+	if err := os.Remove(filepath.Join(policies, "c.yml")); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(policies, "d.yml"), polkitYAML("d"))
+	writeFile(t, filepath.Join(policies, "e.yml"),
+		strings.Replace(polkitYAML("e"), "spec:\n", "selector:\n  hostnameRegex: '^no-such-host$'\nspec:\n", 1))
+
+	pl, err := r.Plan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]*PlanPolicy{}
+	for i := range pl.Policies {
+		got[pl.Policies[i].Name] = &pl.Policies[i]
+	}
+	for _, tc := range []struct {
+		name, action string
+		matches      bool
+	}{
+		{"a", "update", true},
+		{"b", "noop", true},
+		{"c", "delete", false},
+		{"d", "create", true},
+		{"e", "", false},
+	} {
+		p := got[tc.name]
+		if p == nil {
+			t.Errorf("%s missing from the plan", tc.name)
+			continue
+		}
+		if p.Matches != tc.matches {
+			t.Errorf("%s matches = %v, want %v", tc.name, p.Matches, tc.matches)
+		}
+		var actions []string
+		for _, f := range p.Files {
+			actions = append(actions, f.Action)
+		}
+		if got := strings.Join(actions, " "); got != tc.action {
+			t.Errorf("%s actions = %q, want %q", tc.name, got, tc.action)
+		}
+	}
+	if p := got["c"]; p != nil && p.File != "" {
+		t.Errorf("c file = %q, want empty for a policy gone from the repo", p.File)
+	}
+	if p := got["a"]; p != nil && len(p.Files) == 1 && (p.Files[0].Before == "" || p.Files[0].Before == p.Files[0].After) {
+		t.Errorf("a update hashes = %q -> %q", p.Files[0].Before, p.Files[0].After)
+	}
+	// plan writes nothing
+	if b, _ := os.ReadFile(r.hostPath(path("a"))); string(b) != "// edited by hand\n" {
+		t.Errorf("plan rewrote %s", path("a"))
+	}
+	if _, err := os.Stat(r.hostPath(path("d"))); err == nil {
+		t.Errorf("plan created %s", path("d"))
+	}
+}
+
+func TestPlanJSON(t *testing.T) {
+	pl := &Plan{Policies: []PlanPolicy{
+		{Name: "a", Kind: "PolkitPolicy", File: "a.yml", Matches: true, Files: []PlanFile{{Path: "/etc/x", Action: "create", After: "ff"}}},
+		{Name: "e", Kind: "PolkitPolicy", File: "e.yml", Files: []PlanFile{}},
+	}}
+	b, err := json.Marshal(pl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// consumers rely on files always being a list, and on empty hashes,
+	// errors and the commit being left out
+	want := `{"policies":[` +
+		`{"name":"a","kind":"PolkitPolicy","file":"a.yml","matches":true,"files":[{"path":"/etc/x","action":"create","after":"ff"}]},` +
+		`{"name":"e","kind":"PolkitPolicy","file":"e.yml","matches":false,"files":[]}]}`
+	if string(b) != want {
+		t.Errorf("json =\n%s\nwant\n%s", b, want)
+	}
+}
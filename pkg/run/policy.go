@@ -0,0 +1,620 @@
+package run
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	dc "github.com/lgpo-org/lgpod/pkg/dconf"
+	ev "github.com/lgpo-org/lgpod/pkg/env"
+	lm "github.com/lgpo-org/lgpod/pkg/limits"
+	mp "github.com/lgpo-org/lgpod/pkg/modprobe"
+	pm "github.com/lgpo-org/lgpod/pkg/pam"
+	pk "github.com/lgpo-org/lgpod/pkg/polkit"
+	sc "github.com/lgpo-org/lgpod/pkg/scheduledtask"
+	"github.com/lgpo-org/lgpod/pkg/selector"
+	"github.com/lgpo-org/lgpod/pkg/status"
+	su "github.com/lgpo-org/lgpod/pkg/sudoers"
+	ud "github.com/lgpo-org/lgpod/pkg/udev"
+)
+
+// policy is one parsed policy file of a known kind.
+type policy struct {
+	Path     string
+	Kind     string
+	Name     string
+	Severity string // metadata.severity: info (default), warning or critical
+	Labels   map[string]string
+	Expires  time.Time // metadata.expires; zero means never
+	Selector selector.Sel
+	Hooks    hookRefs
+
+	// Filled by render.
+	Items   []applyItem
+	Modules []string // instantApply candidates (modprobe only)
+
+	polkit   *pk.Policy
+	dconf    *dc.Policy
+	modprobe *mp.Policy
+	limits   *lm.Policy
+	udev     *ud.Policy
+	env      *ev.Policy
+	sudoers  *su.Policy
+	task     *sc.Policy
+	pam      *pm.Policy
+	dconfDb  string   // system db the dconf files go to (cfg.DconfDb)
+	taskDirs []string // where task commands may live (cfg.TaskCommandDirs)
+	src      []byte   // the file as read, for error positions
+}
+
+// parsePolicy decodes b by its kind. It returns (nil, nil) for unknown kinds.
+func parsePolicy(path string, b []byte) (*policy, error) {
+	// Peek kind
+	var hdr struct {
+		Kind     string `yaml:"kind"`
+		Metadata struct {
+			Severity string            `yaml:"severity"`
+			Labels   map[string]string `yaml:"labels"`
+			Expires  string            `yaml:"expires"`
+		} `yaml:"metadata"`
+		Spec struct {
+			PreApply  []string `yaml:"preApply"`
+			PostApply []string `yaml:"postApply"`
+		} `yaml:"spec"`
+	}
+	if err := yaml.Unmarshal(b, &hdr); err != nil {
+		return nil, err
+	}
+
+	p := &policy{Path: path, Kind: hdr.Kind, Severity: hdr.Metadata.Severity, Labels: hdr.Metadata.Labels,
+		Hooks: hookRefs{Pre: hdr.Spec.PreApply, Post: hdr.Spec.PostApply}}
+	switch p.Severity {
+	case "":
+		p.Severity = "info"
+	case "info", "warning", "critical":
+	default:
+		return nil, fmt.Errorf("metadata.severity must be info, warning or critical, got %q", p.Severity)
+	}
+	if hdr.Metadata.Expires != "" {
+		t, err := time.Parse(time.RFC3339, hdr.Metadata.Expires)
+		if err != nil {
+			return nil, fmt.Errorf("metadata.expires must be RFC3339 (e.g. 2026-01-31T00:00:00Z): %w", err)
+		}
+		p.Expires = t
+	}
+	switch hdr.Kind {
+	case "PolkitPolicy":
+		var d pk.Policy
+		if err := yaml.Unmarshal(b, &d); err != nil {
+			return nil, err
+		}
+		p.polkit, p.Name = &d, d.Metadata.Name
+		p.Selector = d.Selector
+
+	case "DconfPolicy":
+		var d dc.Policy
+		if err := yaml.Unmarshal(b, &d); err != nil {
+			return nil, err
+		}
+		p.dconf, p.Name = &d, d.Metadata.Name
+		p.Selector = d.Selector
+
+	case "ModprobePolicy":
+		var d mp.Policy
+		if err := yaml.Unmarshal(b, &d); err != nil {
+			return nil, err
+		}
+		p.modprobe, p.Name = &d, d.Metadata.Name
+		p.Selector = d.Selector
+
+	case "LimitsPolicy":
+		var d lm.Policy
+		if err := yaml.Unmarshal(b, &d); err != nil {
+			return nil, err
+		}
+		p.limits, p.Name = &d, d.Metadata.Name
+		p.Selector = d.Selector
+
+	case "UdevPolicy":
+		var d ud.Policy
+		if err := yaml.Unmarshal(b, &d); err != nil {
+			return nil, err
+		}
+		p.udev, p.Name = &d, d.Metadata.Name
+		p.Selector = d.Selector
+
+	case "EnvPolicy":
+		var d ev.Policy
+		if err := yaml.Unmarshal(b, &d); err != nil {
+			return nil, err
+		}
+		p.env, p.Name = &d, d.Metadata.Name
+		p.Selector = d.Selector
+
+	case "SudoersPolicy":
+		var d su.Policy
+		if err := yaml.Unmarshal(b, &d); err != nil {
+			return nil, err
+		}
+		p.sudoers, p.Name = &d, d.Metadata.Name
+		p.Selector = d.Selector
+
+	case "ScheduledTaskPolicy":
+		var d sc.Policy
+		if err := yaml.Unmarshal(b, &d); err != nil {
+			return nil, err
+		}
+		p.task, p.Name = &d, d.Metadata.Name
+		p.Selector = d.Selector
+
+	case "PamPolicy":
+		var d pm.Policy
+		if err := yaml.Unmarshal(b, &d); err != nil {
+			return nil, err
+		}
+		p.pam, p.Name = &d, d.Metadata.Name
+		p.Selector = d.Selector
+
+	default:
+		// ignore unknown kinds
+		return nil, nil
+	}
+	return p, nil
+}
+
+// expired reports whether the policy's metadata.expires is at or before now.
+func (p *policy) expired(now time.Time) bool {
+	return !p.Expires.IsZero() && !now.Before(p.Expires)
+}
+
+// render validates the policy and fills in its target files for the host
+// described by ctx.
+func (p *policy) render(ctx selector.Context) error {
+	switch {
+	case p.polkit != nil:
+		js, sum, err := pk.Render(p.polkit)
+		if err != nil {
+			return err
+		}
+		p.Items = []applyItem{{Path: pk.TargetPath(p.polkit), Data: js, Mode: 0o644, SHA256: sum}}
+
+	case p.dconf != nil:
+		settings, locks, ssum, lsum, err := dc.Render(p.dconf, ctx)
+		if err != nil {
+			return err
+		}
+		sp, lp := dc.TargetPaths(p.dconfDb, p.Name)
+		p.Items = []applyItem{
+			{Path: sp, Data: settings, Mode: 0o644, SHA256: ssum},
+			{Path: lp, Data: locks, Mode: 0o644, SHA256: lsum},
+		}
+
+	case p.modprobe != nil:
+		conf, mods, err := mp.Render(p.modprobe, mp.HostIndex)
+		if err != nil {
+			return err
+		}
+		p.Items = []applyItem{{Path: mp.TargetPath(p.Name), Data: conf, Mode: 0o644, Initramfs: p.modprobe.Spec.UpdateInitramfs}}
+		if p.modprobe.Spec.InstantApply {
+			p.Modules = mods
+		}
+
+	case p.limits != nil:
+		conf, err := lm.Render(p.limits)
+		if err != nil {
+			return err
+		}
+		p.Items = []applyItem{{Path: lm.TargetPath(p.Name), Data: conf, Mode: 0o644}}
+
+	case p.udev != nil:
+		rules, err := ud.Render(p.udev)
+		if err != nil {
+			return err
+		}
+		p.Items = []applyItem{{Path: ud.TargetPath(p.Name), Data: rules, Mode: 0o644}}
+
+	case p.env != nil:
+		conf, err := ev.Render(p.env)
+		if err != nil {
+			return err
+		}
+		p.Items = []applyItem{{Path: ev.TargetPath(p.Name), Data: conf, Mode: 0o644}}
+
+	case p.sudoers != nil:
+		conf, err := su.Render(p.sudoers)
+		if err != nil {
+			return err
+		}
+		p.Items = []applyItem{{Path: su.TargetPath(p.Name), Data: conf, Mode: 0o440, Visudo: true}}
+
+	case p.task != nil:
+		files, err := sc.Render(p.task, p.taskDirs)
+		if err != nil {
+			return err
+		}
+		p.Items = nil
+		for _, f := range files {
+			p.Items = append(p.Items, applyItem{Path: f.Path, Data: f.Data, Mode: 0o644})
+		}
+
+	case p.pam != nil:
+		conf, err := pm.Render(p.pam)
+		if err != nil {
+			return err
+		}
+		p.Items = []applyItem{{Path: pm.TargetPath(p.Name), Data: conf, Mode: 0o644, Pam: true}}
+	}
+	return nil
+}
+
+// desired is what the current policies render to on this host.
+type desired struct {
+	Items     []applyItem
+	Paths     map[string]struct{}
+	Managed   []managedItem
+	Modules   []string // instantApply candidates
+	Conflicts []string // cross-policy conflicts (modprobe)
+	Budget    []string // polkit files over the size/rule budget
+	Rejected  []string // files that failed manifest verification
+	Defaults  error    // _defaults.yml could not be loaded; nothing was walked
+	Failures  []failure
+	Labels    map[string]map[string]string // policy name -> metadata.labels
+	Hooks     map[string]hookRefs          // policy name -> preApply/postApply
+	Kinds     map[string]string            // policy name -> short kind, for matched policies
+	Carried   []BundleFile                 // unchanged files kept from the last bundle (incremental runs)
+	Seen      []seenPolicy                 // every policy walked, matching or not
+	Unlocks   []string                     // dconf keys no lgpo locks file may lock
+}
+
+// seenPolicy is a walked policy and whether it applies to this host.
+type seenPolicy struct {
+	Name, Kind, File string
+	Matches, Expired bool
+}
+
+// shortKind is the metrics name of a kind: PolkitPolicy -> polkit.
+func shortKind(kind string) string {
+	return strings.ToLower(strings.TrimSuffix(kind, "Policy"))
+}
+
+// hasKind reports whether a matched policy is of the short kind.
+func (d *desired) hasKind(kind string) bool {
+	for _, k := range d.Kinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// byKind tallies matched policies per kind, and how many of them had every
+// file applied (in applied and without a failure).
+func (d *desired) byKind(applied []applyItem) map[string]status.KindCount {
+	ok := map[string]bool{}
+	for _, it := range applied {
+		ok[it.Policy] = true
+	}
+	for _, f := range d.Carried {
+		ok[f.Policy] = true
+	}
+	for _, f := range d.Failures {
+		delete(ok, f.Policy)
+	}
+	out := map[string]status.KindCount{}
+	for name, kind := range d.Kinds {
+		c := out[kind]
+		c.Matched++
+		if ok[name] {
+			c.Applied++
+		}
+		out[kind] = c
+	}
+	return out
+}
+
+// failure is a matching policy that could not be rendered or applied.
+type failure struct {
+	Policy   string `json:"policy"`
+	Severity string `json:"severity"`
+	File     string `json:"file,omitempty"`
+	Line     int    `json:"line,omitempty"`
+	Error    string `json:"error"`
+}
+
+// evaluate matches and renders every policy against the current facts/tags.
+// checkPrincipals adds warnings for polkit users/groups missing on the host.
+func (r *Runner) evaluate(checkPrincipals bool) *desired {
+	return r.evaluateOnly(checkPrincipals, nil)
+}
+
+// evaluateOnly is evaluate limited to the files an incremental run changed;
+// the files of the other policies are carried over from the last bundle. A
+// nil inc evaluates everything.
+func (r *Runner) evaluateOnly(checkPrincipals bool, inc *incremental) *desired {
+	want := &desired{Paths: map[string]struct{}{}, Managed: make([]managedItem, 0, 64), Labels: map[string]map[string]string{}, Hooks: map[string]hookRefs{}, Kinds: map[string]string{}}
+	var only map[string]bool
+	// owners maps a matched policy name to its file: labels, hooks, kinds and
+	// failures are keyed by name, so a second matching policy of that name
+	// is refused rather than silently merged
+	owners := map[string]string{}
+	if inc != nil {
+		only = inc.changed
+		for _, f := range inc.carry {
+			owners[f.Policy] = f.Source
+			want.Carried = append(want.Carried, f)
+			want.Kinds[f.Policy] = f.Kind
+			want.Paths[f.Path] = struct{}{}
+			want.Managed = append(want.Managed, managedItem{Path: f.Path, Initramfs: f.Initramfs})
+		}
+	}
+	var modprobes []*mp.Policy
+	var foreign map[string][]byte // other tools' dconf keyfiles, read on first use
+	now := time.Now()
+	want.Rejected, want.Defaults = r.walkOnly(only, func(p *policy) {
+		seen := seenPolicy{Name: p.Name, Kind: p.Kind, File: p.Path, Expired: p.expired(now)}
+		if seen.Expired {
+			want.Seen = append(want.Seen, seen)
+			r.log.Info("expired", "policy", p.Name, "file", p.Path, "expires", p.Expires.Format(time.RFC3339))
+			return
+		}
+		ctx := r.Context()
+		ok, why := p.Selector.MatchExplain(ctx)
+		seen.Matches = ok
+		want.Seen = append(want.Seen, seen)
+		if !ok {
+			r.log.Debug("skip", "policy", p.Name, "file", p.Path, "reason", why)
+			return
+		}
+		if other, dup := owners[p.Name]; dup && other != r.sourceOf(p.Path) {
+			err := fmt.Errorf("%s: metadata.name %q is already used by %s; names must be unique among matching policies", r.sourceOf(p.Path), p.Name, other)
+			r.log.Warn("render", "err", err.Error(), "file", p.Path)
+			want.Failures = append(want.Failures, failure{Policy: p.Name, Severity: p.Severity, File: p.Path, Error: err.Error()})
+			return
+		}
+		owners[p.Name] = r.sourceOf(p.Path)
+		want.Kinds[p.Name] = shortKind(p.Kind)
+		var line int
+		err := p.render(ctx)
+		if err != nil {
+			perr := validationError(p.Path, p.src, err)
+			err, line = perr, perr.Line
+		} else {
+			err = r.checkHooks(p.Hooks)
+		}
+		if err != nil {
+			r.log.Warn("render", "err", err.Error(), "file", p.Path)
+			want.Failures = append(want.Failures, failure{Policy: p.Name, Severity: p.Severity, File: p.Path, Line: line, Error: err.Error()})
+			return
+		}
+		if p.polkit != nil && r.cfg.PolkitGuard != "off" {
+			guard := pk.Guardrail{Prefixes: r.cfg.PolkitGuardPrefixes, AdminGroups: r.cfg.PolkitAdminGroups}
+			lockouts := pk.Lockouts(p.polkit, guard)
+			if len(lockouts) > 0 && r.cfg.PolkitGuard == "refuse" {
+				r.log.Warn("polkit", "err", lockouts[0], "file", p.Path)
+				want.Failures = append(want.Failures, failure{Policy: p.Name, Severity: p.Severity, File: p.Path, Error: "lockout guard: " + lockouts[0]})
+				return
+			}
+			for _, w := range lockouts {
+				r.log.Warn("polkit", "warning", w, "file", p.Path)
+			}
+		}
+		if p.polkit != nil {
+			budget := pk.Budget{MaxBytes: r.cfg.PolkitMaxBytes, MaxRules: r.cfg.PolkitMaxRules}
+			want.Budget = append(want.Budget, pk.OverBudget(p.polkit, p.Items[0].Data, budget)...)
+		}
+		if p.polkit != nil && checkPrincipals {
+			for _, w := range pk.MissingPrincipals(p.polkit, pk.HostLookup) {
+				r.log.Warn("polkit", "warning", w, "file", p.Path)
+			}
+		}
+		if p.dconf != nil && r.cfg.CheckDconfCollisions {
+			if foreign == nil {
+				foreign = r.foreignDconfFiles()
+			}
+			for _, w := range dc.Collisions(p.Items[0].Data, foreign) {
+				r.log.Warn("dconf", "warning", w, "file", p.Path)
+			}
+		}
+		if len(p.Labels) > 0 {
+			want.Labels[p.Name] = p.Labels
+		}
+		if len(p.Hooks.Pre)+len(p.Hooks.Post) > 0 {
+			want.Hooks[p.Name] = p.Hooks
+		}
+		for _, it := range p.Items {
+			it.Policy, it.Severity = p.Name, p.Severity
+			it.Source, it.Expires = r.sourceOf(p.Path), p.Expires
+			want.Items = append(want.Items, it)
+			want.Paths[it.Path] = struct{}{}
+			want.Managed = append(want.Managed, managedItem{Path: it.Path, Initramfs: it.Initramfs})
+		}
+		if p.dconf != nil {
+			want.Unlocks = append(want.Unlocks, p.dconf.Spec.Unlock...)
+		}
+		want.Modules = append(want.Modules, p.Modules...)
+		if p.modprobe != nil {
+			modprobes = append(modprobes, p.modprobe)
+		}
+	})
+	want.Conflicts = mp.Conflicts(modprobes)
+	r.applyUnlocks(want)
+	return want
+}
+
+// foreignDconfFiles reads the keyfiles in the system db dir that lgpo does
+// not manage.
+func (r *Runner) foreignDconfFiles() map[string][]byte {
+	out := map[string][]byte{}
+	dir := dc.DbDir(r.cfg.DconfDb)
+	ents, err := os.ReadDir(r.hostPath(dir))
+	if err != nil {
+		return out
+	}
+	for _, e := range ents {
+		if e.IsDir() || strings.HasPrefix(e.Name(), "60-lgpo-") {
+			continue
+		}
+		if b, err := os.ReadFile(r.hostPath(filepath.Join(dir, e.Name()))); err == nil {
+			out[filepath.Join(dir, e.Name())] = b
+		}
+	}
+	return out
+}
+
+// reSubdir accepts a single path component taken from a tag.
+var reSubdir = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// policiesDir is policiesPath in the repo, plus the first value of the
+// policiesSubdirFromTag tag (per-tenant trees) when that subdir exists.
+func (r *Runner) policiesDir() string {
+	dir, _, _ := r.tenantDir()
+	return dir
+}
+
+// tenantDir is policiesDir, and whether only its top-level files apply. With
+// policiesSubdirFromTag set, a host without the tag, or with an invalid or
+// unknown value, falls back to the base path but must not pick up every
+// tenant's subdir, so flat is set and why says what went wrong (empty when
+// the tag is simply absent).
+func (r *Runner) tenantDir() (dir string, flat bool, why string) {
+	base := filepath.Join(r.cfg.RepoDir(), r.cfg.PoliciesDir())
+	tag := r.cfg.PoliciesSubdirFromTag
+	if tag == "" {
+		return base, false, ""
+	}
+	vals := r.Tags()[tag]
+	if len(vals) == 0 {
+		return base, true, ""
+	}
+	sub := vals[0]
+	if !reSubdir.MatchString(sub) || strings.Contains(sub, "..") {
+		return base, true, "invalid subdir from tag"
+	}
+	dir = filepath.Join(base, sub)
+	if fi, err := os.Stat(dir); err != nil || !fi.IsDir() {
+		return base, true, "no such policies subdir"
+	}
+	return dir, false, ""
+}
+
+// walkPolicies parses every .yml under the policies dir (with defaults merged)
+// and calls fn for each policy of a known kind. Unreadable or unparsable files
+// are logged and skipped. With verifyManifest set, files failing the
+// MANIFEST.sha256 check are not parsed and are returned as rejected. A
+// _defaults.yml that cannot be read or parsed returns an error and nothing is
+// walked: merging without it could widen every policy's selector.
+func (r *Runner) walkPolicies(fn func(p *policy)) (rejected []string, err error) {
+	return r.walkOnly(nil, fn)
+}
+
+// walkOnly is walkPolicies restricted to the files in only (relative to the
+// policies dir); a nil only walks every file.
+func (r *Runner) walkOnly(only map[string]bool, fn func(p *policy)) (rejected []string, err error) {
+	polDir, flat, why := r.tenantDir()
+	if why != "" {
+		tag := r.cfg.PoliciesSubdirFromTag
+		r.log.Warn("policies", "err", why, "tag", tag, "value", r.Tags()[tag][0], "fallback", polDir, "detail", "tenant subdirs skipped")
+	}
+	var m manifest
+	if r.cfg.VerifyManifest {
+		if m, err = loadManifest(polDir); err != nil {
+			return []string{err.Error()}, nil
+		}
+		if b, err := os.ReadFile(filepath.Join(polDir, defaultsFile)); err == nil {
+			if err := m.verify(polDir, filepath.Join(polDir, defaultsFile), b); err != nil {
+				return []string{err.Error()}, nil
+			}
+		}
+	}
+	defaults, err := loadDefaults(polDir)
+	if err != nil {
+		file := filepath.Join(polDir, defaultsFile)
+		r.log.Error("defaults", "err", err.Error(), "file", file)
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+
+	_ = filepath.WalkDir(polDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if path != polDir && r.excluded(polDir, path, d) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			if flat && path != polDir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasSuffix(d.Name(), ".yml") {
+			return nil
+		}
+		if path == filepath.Join(polDir, defaultsFile) {
+			return nil
+		}
+		if only != nil && !only[r.sourceOf(path)] {
+			return nil
+		}
+		b, err := os.ReadFile(path)
+		if err != nil {
+			r.log.Warn("read", err.Error(), "file", path)
+			return nil
+		}
+		if m != nil {
+			if err := m.verify(polDir, path, b); err != nil {
+				rejected = append(rejected, err.Error())
+				return nil
+			}
+		}
+		src := b
+		if b, err = defaults.apply(b); err != nil {
+			r.log.Warn("yaml", "err", parseError(path, src, err).Error(), "file", path)
+			return nil
+		}
+		p, err := parsePolicy(path, b)
+		if err != nil {
+			// Lines in the merged document can differ from the file's; report
+			// the file's own error when it has one.
+			if _, serr := parsePolicy(path, src); serr != nil {
+				err = serr
+			}
+			r.log.Warn("yaml", "err", parseError(path, src, err).Error(), "file", path)
+			return nil
+		}
+		if p != nil {
+			p.dconfDb, p.taskDirs, p.src = r.cfg.DconfDb, r.cfg.TaskCommandDirs, src
+			fn(p)
+		}
+		return nil
+	})
+	return rejected, nil
+}
+
+// excluded reports dotfiles/dotdirs and entries matching cfg.ExcludeGlobs
+// (slash-separated, relative to the policies dir). An excluded dir skips its
+// whole subtree.
+func (r *Runner) excluded(polDir, path string, d fs.DirEntry) bool {
+	if strings.HasPrefix(d.Name(), ".") {
+		return true
+	}
+	rel, err := filepath.Rel(polDir, path)
+	if err != nil {
+		return false
+	}
+	rel = filepath.ToSlash(rel)
+	for _, g := range r.cfg.ExcludeGlobs {
+		if ok, _ := filepath.Match(g, rel); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,420 @@
+package run
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/lgpo-org/lgpod/pkg/config"
+	lglog "github.com/lgpo-org/lgpod/pkg/log"
+	"github.com/lgpo-org/lgpod/pkg/selector"
+	"github.com/lgpo-org/lgpod/pkg/status"
+)
+
+// newTestRunner builds a Runner on a temp root whose policies live in
+// <tmp>/repo/policies. extra is appended to agent.yaml.
+func newTestRunner(t *testing.T, extra string) (*Runner, string) {
+	t.Helper()
+	dir := t.TempDir()
+	return newRunnerIn(t, dir, "localPoliciesDir: "+filepath.Join(dir, "repo")+"\n"+extra), dir
+}
+
+// newRunnerIn is newTestRunner for a config naming its own policy source.
+func newRunnerIn(t *testing.T, dir, extra string) *Runner {
+	t.Helper()
+	// facts source os-release through a login shell; keep it off the
+	// user's profile
+	t.Setenv("HOME", dir)
+	y := "cacheDir: " + filepath.Join(dir, "cache") + "\n" +
+		"tagsDir: " + filepath.Join(dir, "tags") + "\n" +
+		"factsDir: " + filepath.Join(dir, "facts") + "\n" +
+		"auditLog: " + filepath.Join(dir, "audit.jsonl") + "\n" +
+		"statusFile: " + filepath.Join(dir, "status.json") + "\n" +
+		"deviceKey: " + filepath.Join(dir, "device.key") + "\n" +
+		"haltFile: " + filepath.Join(dir, "HALT") + "\n" +
+		"root: " + filepath.Join(dir, "root") + "\n" + extra
+	cfg, err := config.Parse([]byte(y))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return New(cfg, lglog.NewTo(io.Discard))
+}
+
+// writeFile creates path (and its parents) with content.
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func polkitYAML(name string) string {
+	return "apiVersion: lgpo.io/v1\nkind: PolkitPolicy\nmetadata:\n  name: " + name + "\nspec:\n  rules:\n" +
+		"    - name: r\n      matches: [{action_id: org.example.test}]\n      subject: {group: staff}\n      result: YES\n"
+}
+
+func walkedNames(r *Runner) string {
+	var names []string
+	r.walkPolicies(func(p *policy) { names = append(names, p.Name) })
+	sort.Strings(names)
+	return strings.Join(names, ",")
+}
+
+func TestPoliciesSubdirFromTag(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		tag    string // tenant.tag content; empty writes no tag file
+		want   string
+	}{
+		{"unset walks everything", "", "", "acme,base,globex"},
+		{"tenant subdir", "policiesSubdirFromTag: tenant\n", "acme", "acme"},
+		{"no tag skips tenant subdirs", "policiesSubdirFromTag: tenant\n", "", "base"},
+		{"unknown tenant skips tenant subdirs", "policiesSubdirFromTag: tenant\n", "initech", "base"},
+		{"invalid tenant skips tenant subdirs", "policiesSubdirFromTag: tenant\n", "../acme", "base"},
+		{"file is not a tenant", "policiesSubdirFromTag: tenant\n", "base.yml", "base"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r, dir := newTestRunner(t, tc.config)
+			pol := filepath.Join(dir, "repo", "policies")
+			writeFile(t, filepath.Join(pol, "base.yml"), polkitYAML("base"))
+			writeFile(t, filepath.Join(pol, "acme", "a.yml"), polkitYAML("acme"))
+			writeFile(t, filepath.Join(pol, "globex", "g.yml"), polkitYAML("globex"))
+			if tc.tag != "" {
+				writeFile(t, filepath.Join(dir, "tags", "tenant.tag"), tc.tag+"\n")
+			}
+			if got := walkedNames(r); got != tc.want {
+				t.Errorf("walked %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestDuplicatePolicyNames(t *testing.T) {
+	other := strings.Replace(polkitYAML("x"), "spec:", "selector:\n  tags:\n    group: [kiosk]\nspec:", 1)
+	tests := []struct {
+		name     string
+		files    map[string]string // relative to the policies dir
+		wantFail string            // file of the refused policy, "" for none
+		wantKind int               // matched polkit policies
+	}{
+		{"distinct names", map[string]string{"a/x.yml": polkitYAML("x"), "b/y.yml": polkitYAML("y")}, "", 2},
+		{"same name in two dirs", map[string]string{"a/x.yml": polkitYAML("x"), "b/x.yml": polkitYAML("x")}, "b/x.yml", 1},
+		{"same name, only one matches", map[string]string{"a/x.yml": other, "b/x.yml": polkitYAML("x")}, "", 1},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r, dir := newTestRunner(t, "")
+			for name, content := range tc.files {
+				writeFile(t, filepath.Join(dir, "repo", "policies", name), content)
+			}
+			want := r.evaluate(false)
+			var failed []string
+			for _, f := range want.Failures {
+				failed = append(failed, r.sourceOf(f.File))
+			}
+			if got := strings.Join(failed, ","); got != tc.wantFail {
+				t.Errorf("failed = %q, want %q (%v)", got, tc.wantFail, want.Failures)
+			}
+			if got := want.byKind(want.Items)["polkit"].Matched; got != tc.wantKind {
+				t.Errorf("matched = %d, want %d", got, tc.wantKind)
+			}
+			if n := len(want.Items); n != tc.wantKind {
+				t.Errorf("%d items, want %d", n, tc.wantKind)
+			}
+		})
+	}
+}
+
+func TestTaskCommandDirsFromConfig(t *testing.T) {
+	task := "apiVersion: lgpo.io/v1\nkind: ScheduledTaskPolicy\nmetadata:\n  name: backup\nspec:\n  backend: cron\n  schedule: \"@daily\"\n  command: /opt/site/bin/backup\n"
+	tests := []struct {
+		extra    string
+		wantFail bool
+	}{
+		{"", true},
+		{"taskCommandDirs: [/opt/site/bin/]\n", false},
+	}
+	for _, tc := range tests {
+		r, dir := newTestRunner(t, tc.extra)
+		writeFile(t, filepath.Join(dir, "repo", "policies", "backup.yml"), task)
+		want := r.evaluate(false)
+		if failed := len(want.Failures) > 0; failed != tc.wantFail {
+			t.Errorf("%q: failures %v, want failed %v", tc.extra, want.Failures, tc.wantFail)
+		}
+	}
+}
+
+func TestParsePolicySelector(t *testing.T) {
+	sel := "selector:\n" +
+		"  facts: {os.id: debian}\n" +
+		"  tags: {role: [kiosk, lab], site: hq}\n" +
+		"  hostnameRegex: '^lab-'\n" +
+		"  factsPresent: [firmware]\n" +
+		"  tagsAbsent: [legacy]\n" +
+		"  caseInsensitive: true\n"
+	want := selector.Sel{
+		Facts:           map[string]string{"os.id": "debian"},
+		Tags:            map[string]any{"role": []any{"kiosk", "lab"}, "site": "hq"},
+		HostnameRegex:   "^lab-",
+		FactsPresent:    []string{"firmware"},
+		TagsAbsent:      []string{"legacy"},
+		CaseInsensitive: true,
+	}
+	for _, kind := range []string{"PolkitPolicy", "DconfPolicy", "ModprobePolicy", "LimitsPolicy", "UdevPolicy",
+		"EnvPolicy", "SudoersPolicy", "ScheduledTaskPolicy", "PamPolicy"} {
+		t.Run(kind, func(t *testing.T) {
+			b := "apiVersion: lgpo.io/v1\nkind: " + kind + "\nmetadata:\n  name: s\n" + sel
+			p, err := parsePolicy("s.yml", []byte(b))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if p == nil {
+				t.Fatal("kind not recognised")
+			}
+			if !reflect.DeepEqual(p.Selector, want) {
+				t.Errorf("selector = %+v, want %+v", p.Selector, want)
+			}
+		})
+	}
+}
+
+func TestPoliciesByKind(t *testing.T) {
+	r, dir := newTestRunner(t, "")
+	policies := filepath.Join(dir, "repo", "policies")
+	writeFile(t, filepath.Join(policies, "a.yml"), polkitYAML("a"))
+	writeFile(t, filepath.Join(policies, "bad.yml"), strings.Replace(polkitYAML("bad"), "result: YES", "result: YES\n      message: denied", 1))
+	writeFile(t, filepath.Join(policies, "other.yml"),
+		strings.Replace(polkitYAML("other"), "spec:\n", "selector:\n  facts: {os.id: no-such-os}\nspec:\n", 1))
+	writeFile(t, filepath.Join(policies, "usb.yml"), modprobeYAML("usb", "usb-storage", true))
+	writeFile(t, filepath.Join(policies, "cramfs.yml"), modprobeYAML("cramfs", "cramfs", false))
+	if _, err := r.RunOnce(context.Background(), false, "test"); err != nil {
+		t.Fatal(err)
+	}
+	st, err := r.ReadStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]status.KindCount{
+		"polkit":   {Matched: 2, Applied: 1}, // other does not match, bad fails to render
+		"modprobe": {Matched: 2, Applied: 2},
+	}
+	if !reflect.DeepEqual(st.PoliciesByKind, want) {
+		t.Errorf("policiesByKind = %+v, want %+v", st.PoliciesByKind, want)
+	}
+
+	// carried files count as applied unless the policy failed this run
+	d := &desired{
+		Kinds:    map[string]string{"a": "polkit", "b": "polkit", "c": "dconf"},
+		Carried:  []BundleFile{{Policy: "b"}, {Policy: "c"}},
+		Failures: []failure{{Policy: "c"}},
+	}
+	got := d.byKind([]applyItem{{Policy: "a"}})
+	if want := (map[string]status.KindCount{"polkit": {Matched: 2, Applied: 2}, "dconf": {Matched: 1}}); !reflect.DeepEqual(got, want) {
+		t.Errorf("byKind = %+v, want %+v", got, want)
+	}
+}
+
+func TestCheckPrincipalsWarnings(t *testing.T) {
+	rules := "apiVersion: lgpo.io/v1\nkind: PolkitPolicy\nmetadata:\n  name: p\nspec:\n  rules:\n" +
+		"    - name: root-group\n      matches: [{action_id: org.example.test}]\n      subject: {group: root}\n      result: YES\n" +
+		"    - name: ghost\n      matches: [{action_id: org.example.test}]\n      subject: {user: lgpo-no-such-user}\n      result: YES\n"
+	tests := []struct {
+		name     string
+		config   string
+		dry      bool
+		wantWarn bool
+	}{
+		{"dry run checks", "", true, true},
+		{"apply skips the check", "", false, false},
+		{"apply with checkPrincipals", "checkPrincipals: true\n", false, true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r, dir := newTestRunner(t, tc.config)
+			writeFile(t, filepath.Join(dir, "repo", "policies", "p.yml"), rules)
+			var buf bytes.Buffer
+			r.log = lglog.NewTo(&buf)
+			if _, err := r.RunOnce(context.Background(), tc.dry, "test"); err != nil {
+				t.Fatal(err)
+			}
+			log := buf.String()
+			if got := strings.Contains(log, `rule ghost: user \"lgpo-no-such-user\" does not exist on this host`); got != tc.wantWarn {
+				t.Errorf("missing user warned = %v, want %v:\n%s", got, tc.wantWarn, log)
+			}
+			if strings.Contains(log, "root-group") {
+				t.Errorf("existing group root reported missing:\n%s", log)
+			}
+		})
+	}
+}
+
+func TestExcludeGlobs(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		want   string
+	}{
+		{"dotfiles only", "", "base,draft,old,wip"},
+		{"file glob", "excludeGlobs: ['*/wip.yml']\n", "base,draft,old"},
+		{"dir skips subtree", "excludeGlobs: [drafts]\n", "base,old,wip"},
+		{"several globs", "excludeGlobs: [drafts, 'archive/*']\n", "base,wip"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r, dir := newTestRunner(t, tc.config)
+			policies := filepath.Join(dir, "repo", "policies")
+			for file, name := range map[string]string{
+				"base.yml":              "base",
+				"team/wip.yml":          "wip",
+				"drafts/deep/draft.yml": "draft",
+				"archive/old.yml":       "old",
+				".hidden.yml":           "hidden",
+				".staging/staged.yml":   "staged",
+			} {
+				writeFile(t, filepath.Join(policies, file), polkitYAML(name))
+			}
+			if got := walkedNames(r); got != tc.want {
+				t.Errorf("walked %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestPolkitPriority(t *testing.T) {
+	for path, want := range map[string]bool{
+		"/etc/polkit-1/rules.d/60-lgpo-a.rules": true,
+		"/etc/polkit-1/rules.d/05-lgpo-a.rules": true,
+		"/etc/polkit-1/rules.d/5-lgpo-a.rules":  false,
+		"/etc/polkit-1/rules.d/49-site.rules":   false,
+		"/etc/polkit-1/lgpo-a.rules":            false,
+	} {
+		if got := allowedPath(path); got != want {
+			t.Errorf("allowedPath(%s) = %v, want %v", path, got, want)
+		}
+	}
+
+	// moving a policy to another priority replaces its file
+	r, dir := newTestRunner(t, "")
+	file := filepath.Join(dir, "repo", "policies", "a.yml")
+	writeFile(t, file, polkitYAML("a"))
+	ctx := context.Background()
+	if _, err := r.RunOnce(ctx, false, "test"); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, file, strings.Replace(polkitYAML("a"), "spec:\n", "spec:\n  priority: 10\n", 1))
+	if _, err := r.RunOnce(ctx, false, "test"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(r.hostPath("/etc/polkit-1/rules.d/10-lgpo-a.rules")); err != nil {
+		t.Errorf("10-lgpo-a.rules: %v", err)
+	}
+	if _, err := os.Stat(r.hostPath("/etc/polkit-1/rules.d/60-lgpo-a.rules")); err == nil {
+		t.Error("60-lgpo-a.rules left behind")
+	}
+}
+
+func TestPolkitBudget(t *testing.T) {
+	two := polkitYAML("big") + "    - name: r2\n      matches: [{action_id: org.example.other}]\n      subject: {group: staff}\n      result: YES\n"
+	tests := []struct {
+		name    string
+		config  string
+		result  string
+		applied bool
+	}{
+		{"within budget", "", "ok", true},
+		{"over budget warns", "polkitMaxRules: 1\n", "ok", true},
+		{"strict refuses", "polkitMaxRules: 1\nstrict: true\n", "over-budget", false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r, dir := newTestRunner(t, tc.config)
+			var buf bytes.Buffer
+			r.log = lglog.NewTo(&buf)
+			writeFile(t, filepath.Join(dir, "repo", "policies", "big.yml"), two)
+			res, err := r.RunOnce(context.Background(), false, "test")
+			if (err != nil) != (tc.result != "ok") || res.Result != tc.result {
+				t.Fatalf("result %q, err %v; want %s", res.Result, err, tc.result)
+			}
+			warned := strings.Contains(buf.String(), `"detail":"big: 2 rules (budget 1)"`)
+			if want := tc.config != ""; warned != want {
+				t.Errorf("budget warning = %v, want %v; log:\n%s", warned, want, buf.String())
+			}
+			_, err = os.Stat(r.hostPath("/etc/polkit-1/rules.d/60-lgpo-big.rules"))
+			if applied := err == nil; applied != tc.applied {
+				t.Errorf("applied = %v, want %v", applied, tc.applied)
+			}
+		})
+	}
+}
+
+func TestPolkitGuard(t *testing.T) {
+	lockout := "apiVersion: lgpo.io/v1\nkind: PolkitPolicy\nmetadata:\n  name: lock\nspec:\n  rules:\n" +
+		"    - name: r\n      matches: [{action_prefix: org.freedesktop.systemd1.}]\n      result: NO\n"
+	tests := []struct {
+		config  string
+		warned  bool
+		failed  int
+		applied bool
+	}{
+		{"", true, 0, true}, // warn is the default
+		{"polkitGuard: refuse\n", false, 1, false},
+		{"polkitGuard: off\n", false, 0, true},
+		{"polkitGuardPrefixes: [org.freedesktop.login1.]\n", false, 0, true},
+		{"polkitGuard: refuse\npolkitAdminGroups: []\n", false, 1, false},
+	}
+	for _, tc := range tests {
+		r, dir := newTestRunner(t, tc.config)
+		var buf bytes.Buffer
+		r.log = lglog.NewTo(&buf)
+		writeFile(t, filepath.Join(dir, "repo", "policies", "lock.yml"), lockout)
+		res, err := r.RunOnce(context.Background(), false, "test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		warned := strings.Contains(buf.String(), `"warning":"lock: rule r denies org.freedesktop.systemd1.* for everyone`)
+		if warned != tc.warned || res.Failed != tc.failed {
+			t.Errorf("%q: warned %v failed %d, want %v %d; log:\n%s", tc.config, warned, res.Failed, tc.warned, tc.failed, buf.String())
+		}
+		_, err = os.Stat(r.hostPath("/etc/polkit-1/rules.d/60-lgpo-lock.rules"))
+		if applied := err == nil; applied != tc.applied {
+			t.Errorf("%q: applied = %v, want %v", tc.config, applied, tc.applied)
+		}
+	}
+}
+
+func TestCheckDconfCollisions(t *testing.T) {
+	dconf := "apiVersion: lgpo.io/v1\nkind: DconfPolicy\nmetadata:\n  name: idle\nspec:\n  settings:\n    org/gnome/desktop/session:\n      idle-delay: uint32 300\n"
+	for _, check := range []bool{false, true} {
+		extra := ""
+		if check {
+			extra = "checkDconfCollisions: true\n"
+		}
+		r, dir := newTestRunner(t, extra)
+		var buf bytes.Buffer
+		r.log = lglog.NewTo(&buf)
+		writeFile(t, filepath.Join(dir, "repo", "policies", "idle.yml"), dconf)
+		writeFile(t, r.hostPath("/etc/dconf/db/local.d/90-site"), "[org/gnome/desktop/session]\nidle-delay=uint32 900\n")
+		if _, err := r.RunOnce(context.Background(), false, "test"); err != nil {
+			t.Fatal(err)
+		}
+		warned := strings.Contains(buf.String(), `"warning":"org/gnome/desktop/session/idle-delay is also set by /etc/dconf/db/local.d/90-site"`)
+		if warned != check {
+			t.Errorf("checkDconfCollisions %v: warned %v; log:\n%s", check, warned, buf.String())
+		}
+		// a warning, not a failure
+		if _, err := os.Stat(r.hostPath("/etc/dconf/db/local.d/60-lgpo-idle")); err != nil {
+			t.Errorf("checkDconfCollisions %v: %v", check, err)
+		}
+	}
+}
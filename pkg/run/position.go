@@ -0,0 +1,136 @@
+package run
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// PolicyError is a policy file that failed to parse or validate. Line is the
+// 1-based line in File the error points at, or 0 when it is not known.
+type PolicyError struct {
+	File string
+	Line int
+	Err  error
+}
+
+func (e *PolicyError) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("%s:%d: %v", e.File, e.Line, e.Err)
+	}
+	return fmt.Sprintf("%s: %v", e.File, e.Err)
+}
+
+func (e *PolicyError) Unwrap() error { return e.Err }
+
+// reYAMLLine is the position prefix yaml.v3 puts on syntax and type errors.
+var reYAMLLine = regexp.MustCompile(`^yaml: (?:unmarshal errors:\n\s*)?line (\d+): `)
+
+// parseError wraps an error from decoding src. A yaml.v3 error has its line
+// number moved into the PolicyError; any other is located like a validation
+// error.
+func parseError(file string, src []byte, err error) *PolicyError {
+	msg := err.Error()
+	m := reYAMLLine.FindStringSubmatch(msg)
+	if m == nil {
+		return validationError(file, src, err)
+	}
+	line, _ := strconv.Atoi(m[1])
+	return &PolicyError{File: file, Line: line, Err: fmt.Errorf("%s", strings.TrimPrefix(msg, m[0]))}
+}
+
+// validationError wraps an error from a kind's Validate and points it at the
+// line in src it names, where that can be found: a field path such as
+// metadata.name or rules[2] (looked up at the top and under spec), else the
+// first quoted value the message mentions.
+func validationError(file string, src []byte, err error) *PolicyError {
+	return &PolicyError{File: file, Line: locate(src, err.Error()), Err: err}
+}
+
+var (
+	reFieldPath = regexp.MustCompile(`^[A-Za-z_]+(\[\d+\])?(\.[A-Za-z_]+(\[\d+\])?)*$`)
+	reQuoted    = regexp.MustCompile(`"((?:[^"\\]|\\.)*)"`)
+)
+
+// locate is the line of the YAML node msg refers to in src, or 0.
+func locate(src []byte, msg string) int {
+	var doc yaml.Node
+	if yaml.Unmarshal(src, &doc) != nil || len(doc.Content) == 0 {
+		return 0
+	}
+	root := doc.Content[0]
+	for _, tok := range strings.Fields(msg) {
+		tok = strings.TrimRight(tok, ":,")
+		if !reFieldPath.MatchString(tok) {
+			continue
+		}
+		if n := lookup(root, tok); n != nil {
+			return n.Line
+		}
+		if spec := lookup(root, "spec"); spec != nil {
+			if n := lookup(spec, tok); n != nil {
+				return n.Line
+			}
+		}
+	}
+	for _, m := range reQuoted.FindAllStringSubmatch(msg, -1) {
+		v, err := strconv.Unquote(`"` + m[1] + `"`)
+		if err != nil || v == "" {
+			continue
+		}
+		if n := findScalar(root, v); n != nil {
+			return n.Line
+		}
+	}
+	return 0
+}
+
+// lookup follows a dotted path with optional [i] indexes from n.
+func lookup(n *yaml.Node, path string) *yaml.Node {
+	for _, seg := range strings.Split(path, ".") {
+		idx := -1
+		if i := strings.IndexByte(seg, '['); i >= 0 {
+			idx, _ = strconv.Atoi(strings.TrimSuffix(seg[i+1:], "]"))
+			seg = seg[:i]
+		}
+		n = mapValue(n, seg)
+		if n == nil {
+			return nil
+		}
+		if idx >= 0 {
+			if n.Kind != yaml.SequenceNode || idx >= len(n.Content) {
+				return nil
+			}
+			n = n.Content[idx]
+		}
+	}
+	return n
+}
+
+func mapValue(n *yaml.Node, key string) *yaml.Node {
+	if n == nil || n.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			return n.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// findScalar is the first scalar under n (keys included) with value v.
+func findScalar(n *yaml.Node, v string) *yaml.Node {
+	if n.Kind == yaml.ScalarNode && n.Value == v {
+		return n
+	}
+	for _, c := range n.Content {
+		if f := findScalar(c, v); f != nil {
+			return f
+		}
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package run
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	lglog "github.com/lgpo-org/lgpod/pkg/log"
+	"gopkg.in/yaml.v3"
+)
+
+func TestParseError(t *testing.T) {
+	src := []byte("apiVersion: lgpo.io/v1\n" + // 1
+		"kind: PolkitPolicy\n" + // 2
+		"metadata:\n" + // 3
+		"  name: bad name\n" + // 4
+		"spec:\n" + // 5
+		"  priority: 120\n" + // 6
+		"  rules:\n" + // 7
+		"    - name: a\n" + // 8
+		"      matches: [{action_id: org.example.test}]\n" + // 9
+		"    - name: b\n" + // 10
+		"      subject: {seat: \"seat 0\"}\n") // 11
+	var v struct{ Spec struct{ Priority string } }
+	typeErr := yaml.Unmarshal([]byte("spec:\n  priority: [1]\n"), &v)
+	syntaxErr := yaml.Unmarshal([]byte("kind: x\n  bad: [\n"), &v)
+	tests := []struct {
+		name string
+		err  error
+		line int
+		want string
+	}{
+		{"yaml syntax", syntaxErr, 2, "p.yml:2: "},
+		{"yaml type", typeErr, 2, "p.yml:2: cannot unmarshal !!seq into string"},
+		{"top-level field", errors.New("kind must be PolkitPolicy"), 2, "p.yml:2: kind must be PolkitPolicy"},
+		{"field path", errors.New("metadata.name invalid"), 4, "p.yml:4: metadata.name invalid"},
+		{"field under spec", errors.New("spec.priority must be 0-99"), 6, "p.yml:6: spec.priority must be 0-99"},
+		{"index under spec", errors.New("rules[1]: matches empty"), 10, "p.yml:10: rules[1]: matches empty"},
+		{"quoted value", fmt.Errorf("rule b: bad subject.seat %q (a logind seat like seat0)", "seat 0"), 11, `p.yml:11: rule b: bad subject.seat "seat 0" (a logind seat like seat0)`},
+		{"not found", errors.New("unknown field lifetime"), 0, "p.yml: unknown field lifetime"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.err == nil {
+				t.Fatal("no error to wrap")
+			}
+			pe := parseError("p.yml", src, tc.err)
+			if got := pe.Error(); pe.Line != tc.line || !strings.HasPrefix(got, tc.want) {
+				t.Errorf("parseError = %q (line %d), want prefix %q (line %d)", got, pe.Line, tc.want, tc.line)
+			}
+		})
+	}
+
+	// the original error stays reachable
+	base := errors.New("metadata.name invalid")
+	if !errors.Is(parseError("p.yml", src, base), base) {
+		t.Error("PolicyError does not unwrap to the validation error")
+	}
+	if got := parseError("p.yml", []byte("{{{"), base).Line; got != 0 {
+		t.Errorf("line in unparsable source = %d, want 0", got)
+	}
+}
+
+func TestInvalidPolicyLogsLine(t *testing.T) {
+	r, dir := newTestRunner(t, "")
+	var buf bytes.Buffer
+	r.log = lglog.NewTo(&buf)
+	policies := filepath.Join(dir, "repo", "policies")
+	bad := filepath.Join(policies, "bad.yml")
+	broken := filepath.Join(policies, "broken.yml")
+	writeFile(t, bad, strings.Replace(polkitYAML("bad"), "spec:\n", "spec:\n  priority: 120\n", 1))
+	writeFile(t, broken, "kind: PolkitPolicy\nmetadata: {name: [\n")
+	if _, err := r.RunOnce(context.Background(), false, "test"); err != nil {
+		t.Fatal(err)
+	}
+	// both are logged with file and line; only bad parses, so only it is a
+	// policy failure (with its line in the audit record)
+	for _, want := range []string{bad + ":6: spec.priority must be 0-99", broken + ":2: did not find expected node content"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("log lacks %q:\n%s", want, buf.String())
+		}
+	}
+	b, err := os.ReadFile(r.auditPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rec struct {
+		Failures []struct {
+			Policy string `json:"policy"`
+			Line   int    `json:"line"`
+		} `json:"failures"`
+	}
+	if err := json.Unmarshal(b, &rec); err != nil {
+		t.Fatal(err)
+	}
+	if len(rec.Failures) != 1 || rec.Failures[0].Policy != "bad" || rec.Failures[0].Line != 6 {
+		t.Errorf("audit failures = %+v, want bad at line 6", rec.Failures)
+	}
+}
@@ -0,0 +1,36 @@
+package run
+
+import "sync"
+
+// postStep is one built-in post-apply step. Commands that depend on each
+// other (dconf compile, then update) belong to the same step; different
+// steps touch different subsystems and may run at the same time.
+type postStep struct {
+	name string
+	run  func() []error
+}
+
+// runPostSteps runs steps, at most limit at once, and returns every error
+// they reported, in step order.
+func runPostSteps(steps []postStep, limit int) []error {
+	if limit < 1 {
+		limit = 1
+	}
+	errs := make([][]error, len(steps))
+	sem := make(chan struct{}, limit)
+	var wg sync.WaitGroup
+	for i, s := range steps {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, s postStep) {
+			defer func() { <-sem; wg.Done() }()
+			errs[i] = s.run()
+		}(i, s)
+	}
+	wg.Wait()
+	var out []error
+	for _, e := range errs {
+		out = append(out, e...)
+	}
+	return out
+}
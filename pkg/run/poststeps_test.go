@@ -0,0 +1,108 @@
+package run
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	lglog "github.com/lgpo-org/lgpod/pkg/log"
+)
+
+// postSteps returns the post-steps a run under root skipped, from its debug log.
+func postSteps(t *testing.T, log string) string {
+	t.Helper()
+	for _, line := range strings.Split(log, "\n") {
+		var m map[string]string
+		if json.Unmarshal([]byte(line), &m) == nil && m["msg"] == "post-steps" {
+			return m["steps"]
+		}
+	}
+	return ""
+}
+
+func TestInitramfsOnlyOnChange(t *testing.T) {
+	r, dir := newTestRunner(t, "")
+	policies := filepath.Join(dir, "repo", "policies")
+	usb := modprobeYAML("usb", "usb-storage", true) + "  updateInitramfs: true\n"
+	steps := []struct {
+		name  string
+		setup func()
+		want  string
+	}{
+		{"new modprobe file", func() { writeFile(t, filepath.Join(policies, "usb.yml"), usb) }, "initramfs"},
+		{"unchanged", nil, ""},
+		{"unrelated change", func() { writeFile(t, filepath.Join(policies, "a.yml"), polkitYAML("a")) }, ""},
+		{"modprobe without initramfs", func() { writeFile(t, filepath.Join(policies, "fw.yml"), modprobeYAML("fw", "firewire-core", true)) }, ""},
+		{"removed file that asked for it", func() { os.Remove(filepath.Join(policies, "usb.yml")) }, "initramfs"},
+	}
+	for _, s := range steps {
+		if s.setup != nil {
+			s.setup()
+		}
+		var buf bytes.Buffer
+		r.log = lglog.NewTo(&buf)
+		r.log.SetDebug(true)
+		if _, err := r.RunOnce(context.Background(), false, "test"); err != nil {
+			t.Fatalf("%s: %v", s.name, err)
+		}
+		if got := postSteps(t, buf.String()); got != s.want {
+			t.Errorf("%s: post-steps %q, want %q", s.name, got, s.want)
+		}
+	}
+}
+
+func TestRunPostSteps(t *testing.T) {
+	for _, limit := range []int{0, 1, 2, 4} {
+		var mu sync.Mutex
+		running, peak := 0, 0
+		step := func(name string, d time.Duration, fail bool) postStep {
+			return postStep{name, func() []error {
+				mu.Lock()
+				running++
+				if running > peak {
+					peak = running
+				}
+				mu.Unlock()
+				time.Sleep(d)
+				mu.Lock()
+				running--
+				mu.Unlock()
+				if fail {
+					return []error{errors.New(name + " a"), errors.New(name + " b")}
+				}
+				return nil
+			}}
+		}
+		// the slowest step comes first, so errors arrive out of order
+		steps := []postStep{
+			step("dconf", 30*time.Millisecond, true),
+			step("initramfs", 10*time.Millisecond, false),
+			step("modprobe", 5*time.Millisecond, true),
+			step("udev", 5*time.Millisecond, false),
+		}
+		var got []string
+		for _, err := range runPostSteps(steps, limit) {
+			got = append(got, err.Error())
+		}
+		if want := "dconf a,dconf b,modprobe a,modprobe b"; strings.Join(got, ",") != want {
+			t.Errorf("limit %d: errors %q, want %q", limit, got, want)
+		}
+		want := limit
+		if want < 1 {
+			want = 1
+		}
+		if peak > want {
+			t.Errorf("limit %d: %d steps ran at once", limit, peak)
+		}
+		if limit >= 2 && peak < 2 {
+			t.Errorf("limit %d: steps never overlapped", limit)
+		}
+	}
+}
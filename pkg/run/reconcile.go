@@ -0,0 +1,114 @@
+package run
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	dc "github.com/lgpo-org/lgpod/pkg/dconf"
+)
+
+// managedDirs are the directories holding files lgpo may write (see allowedPath).
+func (r *Runner) managedDirs() []string {
+	db := dc.DbDir(r.cfg.DconfDb)
+	return []string{
+		"/etc/polkit-1/rules.d",
+		db,
+		db + "/locks",
+		"/etc/modprobe.d",
+		"/etc/security/limits.d",
+		"/etc/udev/rules.d",
+		"/etc/environment.d",
+		"/etc/sudoers.d",
+		"/etc/cron.d",
+		"/etc/systemd/system",
+		"/etc/pam.d",
+	}
+}
+
+// orphans lists files with lgpo naming that are neither desired now nor
+// recorded in managed.json, e.g. after managed.json was lost. Normal cleanup
+// never sees them.
+func (r *Runner) orphans(want *desired) []string {
+	known := map[string]struct{}{}
+	for _, it := range r.loadManaged().Items {
+		known[it.Path] = struct{}{}
+	}
+	var out []string
+	for _, dir := range r.managedDirs() {
+		ents, err := os.ReadDir(r.hostPath(dir))
+		if err != nil {
+			continue
+		}
+		for _, e := range ents {
+			path := filepath.Join(dir, e.Name())
+			if e.IsDir() || !allowedPath(path) || strings.HasSuffix(path, ".tmp") {
+				continue
+			}
+			if _, ok := want.Paths[path]; ok {
+				continue
+			}
+			if _, ok := known[path]; ok {
+				continue
+			}
+			out = append(out, path)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Reconcile syncs the repo cache, evaluates policies and reports orphaned lgpo
+// files. With remove set they are deleted (and the dconf db rebuilt if any
+// dconf file went away); otherwise nothing is written.
+func (r *Runner) Reconcile(ctx context.Context, remove bool) ([]string, error) {
+	if _, err := r.syncRepo(ctx); err != nil {
+		return nil, err
+	}
+	r.refreshContext()
+	r.followBranch(ctx, "")
+
+	want := r.evaluate(false)
+	// nothing was walked, so every lgpo file would look orphaned
+	if want.Defaults != nil {
+		return nil, want.Defaults
+	}
+	if len(want.Rejected) > 0 {
+		return nil, fmt.Errorf("manifest verification failed for %d file(s)", len(want.Rejected))
+	}
+	found := r.orphans(want)
+	if !remove {
+		return found, nil
+	}
+	dconfTouched := false
+	r.backupSet = ""
+	defer r.pruneBackups()
+	for _, path := range found {
+		if inc := r.pamIncluders(path); len(inc) > 0 {
+			r.log.Warn("reconcile", "detail", "pam snippet still included; not removed", "path", path, "includedBy", strings.Join(inc, ","))
+			continue
+		}
+		if err := r.backupFile(path); err != nil {
+			r.log.Warn("reconcile", "err", err.Error(), "path", path, "detail", "not removed")
+			continue
+		}
+		if err := os.Remove(r.hostPath(path)); err != nil {
+			r.log.Warn("reconcile", "err", err.Error(), "path", path)
+			continue
+		}
+		r.log.Info("reconcile", "removed", path)
+		if isDconfPath(path) {
+			dconfTouched = true
+		}
+	}
+	if dconfTouched && r.cfg.Root == "" {
+		if err := retry(ctx, 4, 500*time.Millisecond, isBusy, func() error { return runDconfUpdate(ctx, r) }); err != nil {
+			r.log.Warn("dconf", "update failed", "err", err.Error())
+		}
+	}
+	return found, nil
+}
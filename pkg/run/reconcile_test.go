@@ -0,0 +1,64 @@
+package run
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestReconcileOrphans(t *testing.T) {
+	r, dir := newTestRunner(t, "")
+	policies := filepath.Join(dir, "repo", "policies")
+	writeFile(t, filepath.Join(policies, "a.yml"), polkitYAML("a"))
+	writeFile(t, filepath.Join(policies, "b.yml"), polkitYAML("b"))
+	ctx := context.Background()
+	if _, err := r.RunOnce(ctx, false, "test"); err != nil {
+		t.Fatal(err)
+	}
+	// b is still in managed.json: the next run's cleanup owns it, not reconcile
+	if err := os.Remove(filepath.Join(policies, "b.yml")); err != nil {
+		t.Fatal(err)
+	}
+	applied := []string{"/etc/polkit-1/rules.d/60-lgpo-a.rules", "/etc/polkit-1/rules.d/60-lgpo-b.rules"}
+	orphans := []string{"/etc/modprobe.d/60-lgpo-old.conf", "/etc/polkit-1/rules.d/60-lgpo-lost.rules"}
+	kept := []string{
+		"/etc/polkit-1/rules.d/49-site.rules",       // not lgpo naming
+		"/etc/polkit-1/rules.d/60-lgpo-x.rules.tmp", // an interrupted write
+		"/etc/modprobe.d/blacklist.conf",
+	}
+	for _, p := range append(append([]string{}, orphans...), kept...) {
+		writeFile(t, r.hostPath(p), "# left behind\n")
+	}
+
+	found, err := r.Reconcile(ctx, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(found, orphans) {
+		t.Errorf("orphans = %q, want %q", found, orphans)
+	}
+	for _, p := range orphans {
+		if _, err := os.Stat(r.hostPath(p)); err != nil {
+			t.Errorf("report-only reconcile removed %s", p)
+		}
+	}
+
+	if found, err = r.Reconcile(ctx, true); err != nil || !reflect.DeepEqual(found, orphans) {
+		t.Fatalf("remove = %q, %v", found, err)
+	}
+	for _, p := range orphans {
+		if _, err := os.Stat(r.hostPath(p)); err == nil {
+			t.Errorf("%s not removed", p)
+		}
+	}
+	for _, p := range append(kept, applied...) {
+		if _, err := os.Stat(r.hostPath(p)); err != nil {
+			t.Errorf("%s removed: %v", p, err)
+		}
+	}
+	if found, err = r.Reconcile(ctx, false); err != nil || len(found) != 0 {
+		t.Errorf("after removal orphans = %q, %v", found, err)
+	}
+}
@@ -0,0 +1,88 @@
+package run
+
+import (
+	"sort"
+	"strings"
+
+	lglog "github.com/lgpo-org/lgpod/pkg/log"
+)
+
+// mask replaces the values of redactKeys facts and tags wherever the agent
+// writes them: logs, audit, status.
+const mask = "***"
+
+func (r *Runner) redacted(key string) bool {
+	for _, k := range r.cfg.RedactKeys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// maskFacts is facts with redacted values replaced by mask.
+func (r *Runner) maskFacts(facts map[string]string) map[string]string {
+	if len(r.cfg.RedactKeys) == 0 {
+		return facts
+	}
+	out := make(map[string]string, len(facts))
+	for k, v := range facts {
+		if r.redacted(k) {
+			v = mask
+		}
+		out[k] = v
+	}
+	return out
+}
+
+// maskTags is tags with redacted values replaced by mask.
+func (r *Runner) maskTags(tags map[string][]string) map[string][]string {
+	if len(r.cfg.RedactKeys) == 0 {
+		return tags
+	}
+	out := make(map[string][]string, len(tags))
+	for k, vs := range tags {
+		if r.redacted(k) {
+			vs = []string{mask}
+		}
+		out[k] = vs
+	}
+	return out
+}
+
+// secrets are the current values of redacted facts and tags, longest first
+// so a value containing another is masked whole.
+func (r *Runner) secrets() []string {
+	var out []string
+	for _, k := range r.cfg.RedactKeys {
+		if v := r.lastFacts[k]; v != "" {
+			out = append(out, v)
+		}
+		for _, v := range r.lastTags[k] {
+			if v != "" {
+				out = append(out, v)
+			}
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return len(out[i]) > len(out[j]) })
+	return out
+}
+
+// updateRedaction points the logger at the current secret values; call it
+// whenever lastFacts or lastTags change.
+func (r *Runner) updateRedaction() {
+	if len(r.cfg.RedactKeys) > 0 {
+		r.log.Redact(r.cfg.RedactKeys, r.secrets())
+	}
+}
+
+// scrub masks secret values inside free text such as a status detail. Like
+// the logger it skips values shorter than MinSecretLen.
+func (r *Runner) scrub(s string) string {
+	for _, v := range r.secrets() {
+		if len(v) >= lglog.MinSecretLen {
+			s = strings.ReplaceAll(s, v, mask)
+		}
+	}
+	return s
+}
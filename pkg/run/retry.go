@@ -0,0 +1,54 @@
+package run
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// retry calls fn up to attempts times while retryable(err) holds, sleeping a
+// doubling, jittered backoff (base, 2*base, ...) between tries. It gives up
+// early when ctx is done and returns the last error.
+func retry(ctx context.Context, attempts int, base time.Duration, retryable func(error) bool, fn func() error) error {
+	var err error
+	delay := base
+	for i := 0; i < attempts; i++ {
+		if err = fn(); err == nil || !retryable(err) {
+			return err
+		}
+		if i == attempts-1 {
+			break
+		}
+		sleep := delay/2 + time.Duration(rand.Int63n(int64(delay)))
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(sleep):
+		}
+		delay *= 2
+	}
+	return err
+}
+
+// busyMessages are the strerror texts of EBUSY, ETXTBSY and EAGAIN as
+// post-step tools print them. Plain words like "lock" would also match paths
+// such as /etc/dconf/db/local.d/locks/.
+var busyMessages = []string{"device or resource busy", "text file busy", "resource temporarily unavailable"}
+
+// isBusy classifies transient lock/contention failures of post-step tools:
+// the errno itself, or its message in a tool's output.
+func isBusy(err error) bool {
+	if errors.Is(err, syscall.EBUSY) || errors.Is(err, syscall.ETXTBSY) || errors.Is(err, syscall.EAGAIN) {
+		return true
+	}
+	msg := strings.ToLower(err.Error())
+	for _, sig := range busyMessages {
+		if strings.Contains(msg, sig) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,60 @@
+package run
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestIsBusy(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{syscall.EBUSY, true},
+		{&fs.PathError{Op: "open", Path: "/usr/bin/dconf", Err: syscall.ETXTBSY}, true},
+		{fmt.Errorf("dconf update: %w", syscall.EAGAIN), true},
+		{errors.New("exit status 1 (output: error: Resource temporarily unavailable)"), true},
+		{errors.New("exit status 1 (output: modprobe: ERROR: could not remove 'uas': Device or resource busy)"), true},
+		{errors.New("exit status 1 (output: error: /etc/dconf/db/local.d/locks/60-lgpo-x: syntax error)"), false},
+		{errors.New("exit status 1 (output: unlock key not found)"), false},
+		{errors.New("exit status 1 (output: keyfile parse error)"), false},
+		{syscall.ENOENT, false},
+	}
+	for _, tc := range tests {
+		if got := isBusy(tc.err); got != tc.want {
+			t.Errorf("isBusy(%v) = %v, want %v", tc.err, got, tc.want)
+		}
+	}
+}
+
+func TestRetry(t *testing.T) {
+	tests := []struct {
+		name      string
+		errs      []error // returned by successive calls; nil after the last
+		wantCalls int
+		wantErr   bool
+	}{
+		{"first try", nil, 1, false},
+		{"busy then ok", []error{syscall.EBUSY}, 2, false},
+		{"not retryable", []error{errors.New("syntax error in locks/x")}, 1, true},
+		{"busy every time", []error{syscall.EBUSY, syscall.EBUSY, syscall.EBUSY}, 3, true},
+	}
+	for _, tc := range tests {
+		calls := 0
+		err := retry(context.Background(), 3, time.Millisecond, isBusy, func() error {
+			calls++
+			if calls <= len(tc.errs) {
+				return tc.errs[calls-1]
+			}
+			return nil
+		})
+		if calls != tc.wantCalls || (err != nil) != tc.wantErr {
+			t.Errorf("%s: %d calls, err %v; want %d calls, error %v", tc.name, calls, err, tc.wantCalls, tc.wantErr)
+		}
+	}
+}
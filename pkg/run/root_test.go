@@ -0,0 +1,85 @@
+package run
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestRunUnderRoot applies, re-applies and removes policies with root set and
+// checks every write lands under it.
+func TestRunUnderRoot(t *testing.T) {
+	r, dir := newTestRunner(t, "")
+	root := r.cfg.Root
+	pol := filepath.Join(dir, "repo", "policies")
+	writeFile(t, filepath.Join(pol, "pk.yml"), polkitYAML("pk"))
+	writeFile(t, filepath.Join(pol, "mp.yml"), modprobeYAML("mp", "usb-storage", true))
+	polkitFile := "/etc/polkit-1/rules.d/60-lgpo-pk.rules"
+	modprobeFile := "/etc/modprobe.d/60-lgpo-mp.conf"
+
+	steps := []struct {
+		name        string
+		dry         bool
+		remove      string // policy file deleted before the run
+		wantChanged int
+		wantRemoved int
+		present     []string
+		absent      []string
+	}{
+		{"dry run writes nothing", true, "", 2, 0, nil, []string{polkitFile, modprobeFile}},
+		{"first run", false, "", 2, 0, []string{polkitFile, modprobeFile}, nil},
+		{"second run is a no-op", false, "", 0, 0, []string{polkitFile, modprobeFile}, nil},
+		{"removed policy", false, "mp.yml", 0, 1, []string{polkitFile}, []string{modprobeFile}},
+	}
+	for _, s := range steps {
+		if s.remove != "" {
+			if err := os.Remove(filepath.Join(pol, s.remove)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		res, err := r.RunOnce(context.Background(), s.dry, "test")
+		if err != nil {
+			t.Fatalf("%s: %v", s.name, err)
+		}
+		if res.Changed != s.wantChanged || res.Removed != s.wantRemoved {
+			t.Errorf("%s: changed %d removed %d, want %d and %d (errors %v)", s.name, res.Changed, res.Removed, s.wantChanged, s.wantRemoved, res.Errors)
+		}
+		for _, p := range s.present {
+			if _, err := os.Stat(filepath.Join(root, p)); err != nil {
+				t.Errorf("%s: %s missing under root", s.name, p)
+			}
+		}
+		for _, p := range s.absent {
+			if _, err := os.Stat(filepath.Join(root, p)); err == nil {
+				t.Errorf("%s: %s present under root", s.name, p)
+			}
+		}
+	}
+
+	// The run's own outputs are under the root; only the repo cache and the
+	// inputs sit beside it.
+	for _, p := range []string{r.cfg.StatusFile, r.cfg.AuditLog, filepath.Join(dir, "managed.json"), filepath.Join(dir, "bundle.json")} {
+		if _, err := os.Stat(filepath.Join(root, p)); err != nil {
+			t.Errorf("%s not under root: %v", p, err)
+		}
+		if _, err := os.Stat(p); err == nil {
+			t.Errorf("%s written outside the root", p)
+		}
+	}
+	st, err := r.ReadStatus()
+	if err != nil || st.Result != "ok" {
+		t.Errorf("status %+v, %v; want ok", st, err)
+	}
+	ents, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range ents {
+		switch e.Name() {
+		case "root", "repo":
+		default:
+			t.Errorf("unexpected %s next to the root", e.Name())
+		}
+	}
+}
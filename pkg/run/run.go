@@ -4,30 +4,37 @@ package run
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/fs"
 	"os"
 	"os/exec"
+	"os/user"
 	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
-	"gopkg.in/yaml.v3"
-
 	"github.com/lgpo-org/lgpod/pkg/config"
 	dc "github.com/lgpo-org/lgpod/pkg/dconf"
 	"github.com/lgpo-org/lgpod/pkg/facts"
 	"github.com/lgpo-org/lgpod/pkg/git"
 	"github.com/lgpo-org/lgpod/pkg/inventory"
 	lglog "github.com/lgpo-org/lgpod/pkg/log"
-	mp "github.com/lgpo-org/lgpod/pkg/modprobe"
-	pk "github.com/lgpo-org/lgpod/pkg/polkit"
+	pm "github.com/lgpo-org/lgpod/pkg/pam"
 	"github.com/lgpo-org/lgpod/pkg/selector"
 	"github.com/lgpo-org/lgpod/pkg/status"
+	"github.com/lgpo-org/lgpod/pkg/tags"
+	"github.com/lgpo-org/lgpod/pkg/version"
 )
 
+// Kill-switch: a local sentinel file (cfg.HaltFile), or the inventory tag lgpo.halt=true.
+const haltTag = "lgpo.halt"
+
 type managedItem struct {
-	Path string `json:"path"`
+	Path      string `json:"path"`
+	Initramfs bool   `json:"initramfs,omitempty"` // removing it needs an initramfs rebuild
 }
 type managedState struct {
 	Version int           `json:"version"`
@@ -35,19 +42,34 @@ type managedState struct {
 }
 
 type Runner struct {
-	cfg       *config.Config
-	log       *lglog.Logger
-	lastFacts map[string]string
-	lastTags  map[string]string
+	cfg        *config.Config
+	log        *lglog.Logger
+	lastFacts  map[string]string
+	lastTags   map[string][]string
+	nextRun    time.Time
+	failStreak int    // consecutive RunOnce calls that returned an error
+	enrolled   *bool  // whether the last inventory sync found this device; nil when it failed
+	backupSet  string // backupDir subdir of the current run, once it saved a file
+	syncErr    error  // error of the last repo sync, nil after a successful one
+	force      bool   // rewrite desired files even when unchanged
 }
 
 func New(cfg *config.Config, l *lglog.Logger) *Runner {
 	return &Runner{cfg: cfg, log: l}
 }
 
+// managedPath is kept under the root prefix too, so a prefixed run never
+// claims files on the real system.
 func (r *Runner) managedPath() string {
-	return filepath.Join(filepath.Dir(r.cfg.StatusFile), "managed.json")
+	return r.hostPath(filepath.Join(filepath.Dir(r.cfg.StatusFile), "managed.json"))
 }
+
+// statusPath and auditPath are the run's outputs, under the root prefix as
+// well: a staging run must not overwrite what monitoring reads from the real
+// host. cacheDir stays on the host; it is a clone of the policy repo, not
+// state of the target.
+func (r *Runner) statusPath() string { return r.hostPath(r.cfg.StatusFile) }
+func (r *Runner) auditPath() string  { return r.hostPath(r.cfg.AuditLog) }
 func (r *Runner) loadManaged() managedState {
 	var s managedState
 	b, err := os.ReadFile(r.managedPath())
@@ -57,283 +79,595 @@ func (r *Runner) loadManaged() managedState {
 	_ = json.Unmarshal(b, &s)
 	return s
 }
+
+// reachedManaged drops the paths a run never got to apply from managed, so
+// managed.json does not claim a file lgpo has not written; a path the
+// previous run already managed keeps its old entry.
+func reachedManaged(managed, prev []managedItem, unreached map[string]bool) []managedItem {
+	if len(unreached) == 0 {
+		return managed
+	}
+	old := map[string]managedItem{}
+	for _, it := range prev {
+		old[it.Path] = it
+	}
+	var out []managedItem
+	for _, it := range managed {
+		if !unreached[it.Path] {
+			out = append(out, it)
+		} else if o, ok := old[it.Path]; ok {
+			out = append(out, o)
+		}
+	}
+	return out
+}
+
 func (r *Runner) saveManaged(items []managedItem) {
 	s := managedState{Version: 1, Items: items}
 	b, _ := json.MarshalIndent(s, "", "  ")
+	_ = os.MkdirAll(filepath.Dir(r.managedPath()), 0o755)
 	_ = os.WriteFile(r.managedPath(), b, 0o644)
 }
 
 func (r *Runner) Facts() map[string]string {
 	if r.lastFacts == nil {
-		r.lastFacts = facts.Discover()
+		r.lastFacts = r.discoverFacts()
+		r.updateRedaction()
 	}
 	return r.lastFacts
 }
 
-func (r *Runner) Tags() map[string]string {
+// discoverFacts is facts.Discover plus the static facts files in cfg.FactsDir.
+// Static values may only replace discovered facts with overrideFacts set.
+func (r *Runner) discoverFacts() map[string]string {
+	f, truncated := facts.Discover(facts.Limits{CommandTimeout: r.cfg.FactsCommandTimeout(), MaxOutput: r.cfg.FactsMaxOutput})
+	for _, k := range truncated {
+		r.log.Warn("facts", "key", k, "detail", "command output truncated at factsMaxOutput; value may be incomplete", "limit", strconv.Itoa(r.cfg.FactsMaxOutput))
+	}
+	static, errs := facts.LoadStatic(r.cfg.FactsDir)
+	for _, err := range errs {
+		r.log.Warn("facts", "err", err.Error())
+	}
+	for _, k := range facts.Merge(f, static, r.cfg.OverrideFacts) {
+		r.log.Warn("facts", "key", k, "detail", "static fact ignored: key is reserved (set overrideFacts to allow)")
+	}
+	if hash, _, err := inventory.ComputeDeviceHashPreferPub(r.DeviceKey()); err == nil {
+		f["device.id"], f["device.short_id"] = hash, inventory.ShortID(hash)
+	}
+	return f
+}
+
+func (r *Runner) Tags() map[string][]string {
 	if r.lastTags == nil {
-		r.lastTags = loadTags(r.cfg.TagsDir)
+		r.lastTags = tags.Load(r.cfg.TagsDir)
+		r.updateRedaction()
 	}
 	return r.lastTags
 }
 
+// Context is the selector context of this host: the facts and tags of the
+// last run, discovered or loaded on first use.
+func (r *Runner) Context() selector.Context {
+	return selector.NewContext(r.Facts(), r.Tags())
+}
+
+// refreshContext rediscovers facts and reloads tags from disk.
+func (r *Runner) refreshContext() {
+	r.lastFacts = r.discoverFacts()
+	r.lastTags = tags.Load(r.cfg.TagsDir)
+	r.updateRedaction()
+}
+
+// PlanTags syncs the repo cache and reports how the next inventory sync would
+// change this host's inventory tags, without writing any tag file.
+func (r *Runner) PlanTags() (string, []inventory.TagChange, error) {
+	if _, err := r.syncRepo(context.Background()); err != nil {
+		return "", nil, err
+	}
+	return inventory.PlanInventoryTags(r.cfg.RepoDir(), r.cfg.TagsDir, r.DeviceKey(), r.Facts()["hostname"], r.cfg.InventorySigningKey)
+}
+
 func (r *Runner) ReadStatus() (status.Status, error) {
-	return status.Read(r.cfg.StatusFile)
+	return status.Read(r.statusPath())
 }
 
-func (r *Runner) RunOnce(ctx context.Context, dry bool, trigger string) error {
+// RunResult summarizes one RunOnce for programmatic callers; status.json and
+// the audit log are still written as before.
+type RunResult struct {
+	Result   string // status.json result: ok, halted, conflict, ...
+	Commit   string
+	Changed  int
+	Removed  int
+	Failed   int     // policies that failed to render or apply
+	Errors   []error // every non-fatal step error (inventory, render, apply, post-steps)
+	Duration time.Duration
+}
+
+// RunOnce syncs, evaluates and applies policies once. The error is set when
+// the run was aborted (nothing or only part applied); non-fatal step errors
+// are only in the result.
+func (r *Runner) RunOnce(ctx context.Context, dry bool, trigger string) (*RunResult, error) {
+	start := time.Now()
+	res := &RunResult{}
+	err := r.runOnce(ctx, dry, trigger, res)
+	res.Duration = time.Since(start)
+	r.recordStreak(err)
+	return res, err
+}
+
+// FailureStreak is the number of consecutive failed runs, 0 after a success.
+func (r *Runner) FailureStreak() int { return r.failStreak }
+
+// recordStreak updates the failure streak after a run and mirrors it into
+// status.json, which failed runs otherwise leave untouched.
+func (r *Runner) recordStreak(err error) {
+	if err != nil {
+		r.failStreak++
+	} else {
+		r.failStreak = 0
+	}
+	if prev, rerr := r.ReadStatus(); rerr == nil && prev.FailureStreak != r.failStreak {
+		r.writeStatus(prev)
+	}
+}
+
+func (r *Runner) runOnce(ctx context.Context, dry bool, trigger string, res *RunResult) error {
 	start := time.Now()
+	r.backupSet = ""
 
 	// 1) Refresh facts
-	r.lastFacts = facts.Discover()
+	r.lastFacts = r.discoverFacts()
+	r.updateRedaction()
 
 	// 2) Update repo cache
-	commit, err := git.Ensure(r.cfg.Repo, r.cfg.Branch, r.cfg.CacheDir)
+	commit, err := r.syncRepo(ctx)
 	if err != nil {
-		lower := strings.ToLower(err.Error())
-		if strings.Contains(lower, "permission") || strings.Contains(lower, "access") || strings.Contains(lower, "auth") {
-			hash, _, _ := inventory.ComputeDeviceHashPreferPub("/etc/lgpo/device.key")
-			pub := ""
-			if b, readErr := os.ReadFile("/etc/lgpo/device.key.pub"); readErr == nil {
-				pub = strings.TrimSpace(string(b))
-			}
-			r.log.Warn("enrollment",
-				"hint", "Private policy repo? Add this device as READ-ONLY deploy key and put its hash into inventory/devices.yml",
-				"repo", r.cfg.Repo,
-				"branch", r.cfg.Branch,
-				"device", hash,
-				"pubkey", pub,
-			)
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			res.Result = "failed-timeout"
+			return r.timedOut(commit)
 		}
+		res.Result = "failed"
 		return err
 	}
 
 	// 3) Inventory sync → tags
-	deviceHash, wrote, invErr := inventory.SyncInventoryTags(
-		r.cfg.CacheDir,
-		r.cfg.TagsDir,
-		"/etc/lgpo/device.key",
-	)
+	var deviceHash string
+	var wrote int
+	var match inventory.Match
+	r.enrolled = nil
+	perms, invErr := r.tagPerms()
+	if invErr == nil {
+		deviceHash, wrote, match, invErr = inventory.SyncInventoryTags(
+			r.cfg.RepoDir(),
+			r.cfg.TagsDir,
+			r.DeviceKey(),
+			r.lastFacts["hostname"],
+			r.cfg.InventorySigningKey,
+			perms,
+		)
+	}
 	if invErr != nil {
 		r.log.Warn("inventory", invErr.Error(), "device", deviceHash)
+		res.Errors = append(res.Errors, fmt.Errorf("inventory: %w", invErr))
 	} else {
+		enrolled := match == inventory.ByKey
+		r.enrolled = &enrolled
+		switch match {
+		case inventory.NoMatch:
+			r.log.Warn("device not enrolled", "device", deviceHash, "hint", "add it to inventory/devices.yml")
+		case inventory.ByHostname:
+			r.log.Warn("inventory matched by hostname", "hostname", r.lastFacts["hostname"], "device", deviceHash,
+				"hint", "tags are less trusted until the device hash is added to inventory/devices.yml")
+		}
 		r.log.Warn("inventory", "synced", "device", deviceHash, "wrote", fmt.Sprintf("%d", wrote))
 	}
-	r.lastTags = loadTags(r.cfg.TagsDir)
+	r.lastTags = tags.Load(r.cfg.TagsDir)
+	r.updateRedaction()
+	channel, ring, err := r.channelCommit(ctx)
+	if err != nil {
+		r.log.Error("channel", "err", err.Error(), "tag", r.cfg.ChannelFromTag)
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			res.Result = "failed-timeout"
+			return r.timedOut(commit)
+		}
+		res.Result = "failed"
+		return fmt.Errorf("channel: %w", err)
+	}
+	branch := r.cfg.Branch
+	if channel != "" {
+		r.log.Info("channel", "detail", "following the ring's channel file", "ring", ring, "commit", channel)
+		commit = channel
+	} else {
+		commit, branch = r.followBranch(ctx, commit)
+	}
+	pinned, err := r.pinCommit(ctx)
+	if err != nil {
+		r.log.Error("pin", "err", err.Error(), "tag", pinTag)
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			res.Result = "failed-timeout"
+			return r.timedOut(commit)
+		}
+		res.Result = "failed"
+		return fmt.Errorf("pin: %w", err)
+	}
+	if pinned != "" {
+		r.log.Info("pin", "detail", "device pinned by inventory tag; branch head ignored", "commit", pinned, "branch", branch)
+		commit = pinned
+	}
+	res.Commit = commit
+
+	// Kill-switch: stop before any apply/remove step
+	if by := r.haltedBy(); by != "" {
+		r.log.Warn("halted", "detail", "kill-switch active; skipping apply and cleanup", "by", by)
+		r.writeStatus(status.Status{Result: "halted", Reason: "kill-switch", Detail: by, Commit: commit, Version: version.Version})
+		r.writeAudit(map[string]any{
+			"ts":         time.Now().UTC().Format(time.RFC3339),
+			"trigger":    trigger,
+			"repo":       r.cfg.Repo,
+			"branch":     branch,
+			"source":     r.source(),
+			"commit":     commit,
+			"version":    version.Version,
+			"facts":      r.lastFacts,
+			"tags":       r.lastTags,
+			"halted":     by,
+			"dryRun":     dry,
+			"durationMs": time.Since(start).Milliseconds(),
+		})
+		res.Result = "halted"
+		return nil
+	}
 
 	// 4) Evaluate policies
-	polDir := filepath.Join(r.cfg.CacheDir, r.cfg.PoliciesDir())
+	inc := r.incrementalSince(ctx, commit)
+	want := r.evaluateOnly(dry || r.cfg.CheckPrincipals, inc)
+	if inc != nil && len(want.Unlocks) > 0 {
+		// unlock reaches into other policies' locks files, carried ones too
+		r.log.Debug("incremental", "detail", "full evaluation: dconf unlock keys changed")
+		inc = nil
+		want = r.evaluate(dry || r.cfg.CheckPrincipals)
+	}
+	if inc != nil && want.hasKind("modprobe") {
+		// a changed modprobe policy may conflict with any other one
+		r.log.Debug("incremental", "detail", "full evaluation: a modprobe policy changed")
+		inc = nil
+		want = r.evaluate(dry || r.cfg.CheckPrincipals)
+	}
+	if want.Defaults != nil {
+		res.Result = "invalid-defaults"
+		r.writeStatus(status.Status{Result: "invalid-defaults", Reason: "defaults", Detail: want.Defaults.Error(), Commit: commit, Version: version.Version})
+		return fmt.Errorf("%w, nothing applied", want.Defaults)
+	}
+	if len(want.Rejected) > 0 {
+		for _, e := range want.Rejected {
+			r.log.Error("manifest", "err", e)
+		}
+		res.Result = "manifest-mismatch"
+		r.writeStatus(status.Status{Result: "manifest-mismatch", Reason: "manifest", Detail: want.Rejected[0], Commit: commit, Version: version.Version})
+		return fmt.Errorf("manifest verification failed for %d file(s), nothing applied", len(want.Rejected))
+	}
+	for _, c := range want.Conflicts {
+		r.log.Warn("conflict", "detail", c)
+	}
+	if r.cfg.Strict && len(want.Conflicts) > 0 {
+		res.Result = "conflict"
+		r.writeStatus(status.Status{Result: "conflict", Reason: "policy-conflict", Detail: want.Conflicts[0], Commit: commit, Version: version.Version})
+		return fmt.Errorf("strict: %d policy conflict(s), nothing applied", len(want.Conflicts))
+	}
+	for _, b := range want.Budget {
+		r.log.Warn("polkit budget", "detail", b)
+	}
+	if r.cfg.Strict && len(want.Budget) > 0 {
+		res.Result = "over-budget"
+		r.writeStatus(status.Status{Result: "over-budget", Reason: "polkit-budget", Detail: want.Budget[0], Commit: commit, Version: version.Version})
+		return fmt.Errorf("strict: %d polkit file(s) over budget, nothing applied", len(want.Budget))
+	}
 
-	var toApply []applyItem
 	dconfTouched := false
-	initramfsTouched := false
-
-	desiredPaths := map[string]struct{}{}
-	desiredManaged := make([]managedItem, 0, 64)
-
-	// NEW: instantApply support
-	var runtimeModprobe []string
 	changedModprobe := false
-
-	_ = filepath.WalkDir(polDir, func(path string, d fs.DirEntry, err error) error {
-		if err != nil || d.IsDir() {
-			return nil
+	changedUdev := false
+	var units []string // lgpo systemd unit files that changed or went away
+	initramfs := false // only when a file that asks for it changed or went away
+	// touch records the post-steps a changed or removed file needs
+	touch := func(path string, needsInitramfs bool) {
+		if isDconfPath(path) {
+			dconfTouched = true
 		}
-		if !strings.HasSuffix(d.Name(), ".yml") {
-			return nil
+		if strings.HasPrefix(path, "/etc/modprobe.d/") {
+			changedModprobe = true
 		}
-		b, err := os.ReadFile(path)
-		if err != nil {
-			r.log.Warn("read", err.Error(), "file", path)
-			return nil
+		if strings.HasPrefix(path, "/etc/udev/rules.d/") {
+			changedUdev = true
 		}
-
-		// Peek kind
-		var hdr struct{ Kind string `yaml:"kind"` }
-		if err := yaml.Unmarshal(b, &hdr); err != nil {
-			r.log.Warn("yaml", err.Error(), "file", path)
-			return nil
+		if reUnitPath.MatchString(path) {
+			units = append(units, path)
 		}
+		if needsInitramfs {
+			initramfs = true
+		}
+	}
 
-		switch hdr.Kind {
-		case "PolkitPolicy":
-			var p pk.Policy
-			if err := yaml.Unmarshal(b, &p); err != nil {
-				r.log.Warn("yaml", err.Error(), "file", path)
-				return nil
-			}
-			sel := selector.Sel{Facts: p.Selector.Facts, Tags: p.Selector.Tags, HostnameRegex: p.Selector.HostnameRegex}
-			if !sel.Match(selector.Context{Facts: r.lastFacts, Tags: r.lastTags}) {
-				return nil
-			}
-			js, _, err := pk.Render(&p)
-			if err != nil {
-				r.log.Warn("render", err.Error(), "file", path)
-				return nil
-			}
-			tgt := "/etc/polkit-1/rules.d/60-lgpo-" + p.Metadata.Name + ".rules"
-			toApply = append(toApply, applyItem{Path: tgt, Data: js, Mode: 0o644})
-			desiredPaths[tgt] = struct{}{}
-			desiredManaged = append(desiredManaged, managedItem{Path: tgt})
-
-		case "DconfPolicy":
-			var p dc.Policy
-			if err := yaml.Unmarshal(b, &p); err != nil {
-				r.log.Warn("yaml", err.Error(), "file", path)
-				return nil
-			}
-			sel := selector.Sel{Facts: p.Selector.Facts, Tags: p.Selector.Tags, HostnameRegex: p.Selector.HostnameRegex}
-			if !sel.Match(selector.Context{Facts: r.lastFacts, Tags: r.lastTags}) {
-				return nil
-			}
-			settings, locks, _, _, err := dc.Render(&p)
-			if err != nil {
-				r.log.Warn("render", err.Error(), "file", path)
-				return nil
-			}
-			sp, lp := dc.TargetPaths(p.Metadata.Name)
-			toApply = append(toApply,
-				applyItem{Path: sp, Data: settings, Mode: 0o644},
-				applyItem{Path: lp, Data: locks, Mode: 0o644},
-			)
-			desiredPaths[sp] = struct{}{}
-			desiredPaths[lp] = struct{}{}
-			desiredManaged = append(desiredManaged, managedItem{Path: sp}, managedItem{Path: lp})
-
-		case "ModprobePolicy":
-			var p mp.Policy
-			if err := yaml.Unmarshal(b, &p); err != nil {
-				r.log.Warn("yaml", err.Error(), "file", path)
-				return nil
-			}
-			sel := selector.Sel{Facts: p.Selector.Facts, Tags: p.Selector.Tags, HostnameRegex: p.Selector.HostnameRegex}
-			if !sel.Match(selector.Context{Facts: r.lastFacts, Tags: r.lastTags}) {
-				return nil
-			}
-			conf, mods, err := mp.Render(&p)
-			if err != nil {
-				r.log.Warn("render", err.Error(), "file", path)
-				return nil
-			}
-			tgt := mp.TargetPath(p.Metadata.Name)
-			toApply = append(toApply, applyItem{Path: tgt, Data: conf, Mode: 0o644})
-			desiredPaths[tgt] = struct{}{}
-			desiredManaged = append(desiredManaged, managedItem{Path: tgt})
-
-			if p.Spec.UpdateInitramfs {
-				initramfsTouched = true
-			}
-			if p.Spec.InstantApply {
-				runtimeModprobe = append(runtimeModprobe, mods...)
-			}
+	// files lists what changed (or would, on a dry run) for audit and status
+	var files []status.FileChange
+	record := func(path, op string) { files = append(files, status.FileChange{Path: path, Op: op}) }
 
-		default:
-			// ignore unknown kinds
-		}
-		return nil
-	})
+	// Transactional runs defer removals to the commit
+	tx := r.cfg.Transactional && !dry
+	var stale []managedItem
 
 	prev := r.loadManaged()
 	removed := 0
 
 	for _, it := range prev.Items {
 		path := it.Path
-		if _, stillDesired := desiredPaths[path]; stillDesired {
+		if _, stillDesired := want.Paths[path]; stillDesired {
 			continue
 		}
-		allowed := strings.HasPrefix(path, "/etc/polkit-1/rules.d/60-lgpo-") ||
-			strings.HasPrefix(path, "/etc/dconf/db/local.d/60-lgpo-") ||
-			strings.HasPrefix(path, "/etc/dconf/db/local.d/locks/60-lgpo-") ||
-			strings.HasPrefix(path, "/etc/modprobe.d/60-lgpo-")
-		if !allowed {
+		if !allowedPath(path) {
 			continue
 		}
-		if _, err := os.Stat(path); err == nil {
-			if dry {
-				removed++
-			} else {
-				_ = os.Remove(path)
+		if _, err := os.Stat(r.hostPath(path)); err == nil {
+			if inc := r.pamIncluders(path); len(inc) > 0 {
+				r.log.Warn("pam", "detail", "snippet still included; not removed", "path", path, "includedBy", strings.Join(inc, ","), "hint", "drop the include first")
+				want.Managed = append(want.Managed, it)
+				continue
+			}
+			switch {
+			case dry:
 				removed++
-				if strings.HasPrefix(path, "/etc/dconf/db/local.d/") {
-					dconfTouched = true
-				}
-				if strings.HasPrefix(path, "/etc/modprobe.d/") {
-					changedModprobe = true
+				record(path, "removed")
+			case tx:
+				stale = append(stale, it)
+			default:
+				if err := r.backupFile(path); err != nil {
+					r.log.Warn("backup", "err", err.Error(), "path", path, "detail", "not removed")
+					continue
 				}
+				_ = os.Remove(r.hostPath(path))
+				removed++
+				record(path, "removed")
+				touch(path, it.Initramfs)
 			}
 		}
 	}
 
+	for _, o := range r.orphans(want) {
+		r.log.Warn("orphan", "path", o, "hint", "not in managed.json; review and remove with: lgpod -sub reconcile -remove")
+	}
+
+	// Post-steps and hooks act on the live system: skipped under a root prefix
+	post := !dry && r.cfg.Root == ""
+
 	// Apply changes
 	changed := 0
-	for _, it := range toApply {
-		c, err := r.applyAtomic(it, dry)
+	applied := make([]applyItem, 0, len(want.Items))
+	byLabel := map[string]map[string]int{} // label key -> value -> changed files
+	changedPolicies := map[string]bool{}
+	note := func(it applyItem, existed bool) {
+		changed++
+		if existed {
+			record(it.Path, "modified")
+		} else {
+			record(it.Path, "created")
+		}
+		changedPolicies[it.Policy] = true
+		for k, v := range want.Labels[it.Policy] {
+			if byLabel[k] == nil {
+				byLabel[k] = map[string]int{}
+			}
+			byLabel[k][v]++
+		}
+		touch(it.Path, it.Initramfs)
+	}
+	if tx {
+		// All or nothing: preApply hooks, staged writes and the dconf check
+		// must all pass before any file is renamed into place.
+		err := r.preApplyAll(ctx, want, post)
+		var txChanged []staged
+		if err == nil {
+			txChanged, err = r.applyTransaction(ctx, want.Items, stale)
+		}
 		if err != nil {
-			r.log.Error("apply", err.Error(), "path", it.Path)
-			continue
+			r.log.Error("transaction", "err", err.Error())
+			res.Result = "aborted"
+			r.writeStatus(status.Status{Result: "aborted", Reason: "transaction", Detail: err.Error(), Commit: commit, Version: version.Version})
+			return fmt.Errorf("transactional: %w; nothing applied", err)
 		}
-		if c {
-			changed++
-			if strings.HasPrefix(it.Path, "/etc/dconf/db/local.d/") ||
-				strings.HasPrefix(it.Path, "/etc/dconf/db/local.d/locks/") {
-				dconfTouched = true
+		for _, it := range stale {
+			removed++
+			record(it.Path, "removed")
+			touch(it.Path, it.Initramfs)
+		}
+		for _, s := range txChanged {
+			note(s.it, s.existed)
+		}
+		applied = append(applied, want.Items...)
+	}
+	skip := ""                    // policy whose preApply hook failed
+	var unreached map[string]bool // paths the deadline cut off before applying
+	for i, it := range want.Items {
+		if tx {
+			break
+		}
+		if ctx.Err() != nil {
+			unreached = map[string]bool{}
+			for _, u := range want.Items[i:] {
+				unreached[u.Path] = true
 			}
-			if strings.HasPrefix(it.Path, "/etc/modprobe.d/") {
-				changedModprobe = true
+			break
+		}
+		// preApply runs once, before a policy's first item, if any item will change
+		if h := want.Hooks[it.Policy]; post && len(h.Pre) > 0 && (i == 0 || want.Items[i-1].Policy != it.Policy) && r.pending(want.Items, it.Policy) {
+			if err := r.runHooks(ctx, it.Policy, h.Pre); err != nil {
+				r.log.Error("hook", "policy", it.Policy, "err", err.Error())
+				want.Failures = append(want.Failures, failure{Policy: it.Policy, Severity: it.Severity, Error: err.Error()})
+				skip = it.Policy
 			}
 		}
-	}
-
-	// Post-steps: dconf
-	if !dry && dconfTouched {
-		if err := ensureDconfProfile(); err != nil {
-			r.log.Warn("dconf", "ensure profile failed", "err", err.Error())
+		if it.Policy == skip {
+			continue
 		}
-		// compile local.d for clearer errors first
-		if out, err := exec.CommandContext(ctx, "/usr/bin/dconf", "compile", "/tmp/local.dconf", "/etc/dconf/db/local.d").CombinedOutput(); err != nil {
-			r.log.Warn("dconf", "compile failed", "err", err.Error(), "out", strings.TrimSpace(string(out)))
+		_, statErr := os.Stat(r.hostPath(it.Path))
+		c, err := r.applyAtomic(it, dry)
+		if err != nil {
+			r.log.Error("apply", err.Error(), "path", it.Path)
+			want.Failures = append(want.Failures, failure{Policy: it.Policy, Severity: it.Severity, File: it.Path, Error: err.Error()})
+			continue
 		}
-		if err := runDconfUpdate(ctx, r); err != nil {
-			r.log.Warn("dconf", "update failed", "err", err.Error())
-		} else {
-			r.log.Info("dconf", "updated system database")
+		applied = append(applied, it)
+		if c {
+			note(it, statErr == nil)
 		}
 	}
 
-	// Post-steps: initramfs
-	if !dry && initramfsTouched {
-		_ = exec.CommandContext(ctx, "update-initramfs", "-u").Run()
+	// Verify before the post-steps, so a rewritten file still gets its own
+	if !dry && r.cfg.VerifyAfterApply {
+		r.verifyApplied(want, applied, func(it applyItem) {
+			touch(it.Path, it.Initramfs)
+			changedPolicies[it.Policy] = true
+		})
 	}
 
-	// Post-steps: instant modprobe (only if a modprobe file changed)
-	if !dry && changedModprobe && len(runtimeModprobe) > 0 {
-		uniq := unique(runtimeModprobe)
-		if err := runInstantModprobe(ctx, r, uniq); err != nil {
-			r.log.Warn("modprobe", "instant apply had errors", "err", err.Error())
-		} else {
+	// Post-steps, concurrently up to postStepConcurrency at a time
+	var steps []postStep
+	if !dry && dconfTouched {
+		steps = append(steps, postStep{"dconf", func() []error {
+			var errs []error
+			if err := ensureDconfProfile(r.hostPath("/etc/dconf/profile/"+r.cfg.DconfProfile), r.cfg.DconfDb); err != nil {
+				r.log.Warn("dconf", "ensure profile failed", "err", err.Error())
+			}
+			// compile the db dir for clearer errors first
+			if err := retry(ctx, 4, 500*time.Millisecond, isBusy, func() error {
+				out, err := exec.CommandContext(ctx, "/usr/bin/dconf", "compile", "/tmp/"+r.cfg.DconfDb+".dconf", dc.DbDir(r.cfg.DconfDb)).CombinedOutput()
+				if err != nil {
+					return fmt.Errorf("%v (output: %s)", err, strings.TrimSpace(string(out)))
+				}
+				return nil
+			}); err != nil {
+				r.log.Warn("dconf", "compile failed", "err", err.Error())
+				errs = append(errs, fmt.Errorf("dconf compile: %w", err))
+			}
+			if err := retry(ctx, 4, 500*time.Millisecond, isBusy, func() error { return runDconfUpdate(ctx, r) }); err != nil {
+				r.log.Warn("dconf", "update failed", "err", err.Error())
+				errs = append(errs, fmt.Errorf("dconf update: %w", err))
+			} else {
+				r.log.Info("dconf", "updated system database")
+			}
+			return errs
+		}})
+	}
+	if !dry && initramfs {
+		steps = append(steps, postStep{"initramfs", func() []error {
+			if err := exec.CommandContext(ctx, "update-initramfs", "-u").Run(); err != nil {
+				r.log.Warn("initramfs", "err", err.Error())
+				return []error{fmt.Errorf("update-initramfs: %w", err)}
+			}
+			return nil
+		}})
+	}
+	// instant modprobe only if a modprobe file changed
+	if !dry && changedModprobe && len(want.Modules) > 0 {
+		steps = append(steps, postStep{"modprobe", func() []error {
+			uniq := unique(want.Modules)
+			if err := runInstantModprobe(ctx, r, uniq); err != nil {
+				r.log.Warn("modprobe", "instant apply had errors", "err", err.Error())
+				return []error{fmt.Errorf("instant modprobe: %w", err)}
+			}
 			r.log.Info("modprobe", "instant apply attempted", "modules", strings.Join(uniq, ","))
+			return nil
+		}})
+	}
+	// udev: new rules apply to the next event; existing devices keep theirs until re-triggered
+	if !dry && changedUdev {
+		steps = append(steps, postStep{"udev", func() []error {
+			if out, err := exec.CommandContext(ctx, "udevadm", "control", "--reload").CombinedOutput(); err != nil {
+				r.log.Warn("udev", "err", err.Error(), "out", strings.TrimSpace(string(out)))
+				return []error{fmt.Errorf("udevadm control --reload: %w", err)}
+			}
+			r.log.Info("udev", "detail", "reloaded rules")
+			return nil
+		}})
+	}
+	if !dry && len(units) > 0 {
+		steps = append(steps, postStep{"systemd", func() []error { return r.reloadUnits(ctx, units) }})
+	}
+	if !post && len(steps) > 0 {
+		names := make([]string, len(steps))
+		for i, s := range steps {
+			names[i] = s.name
+		}
+		r.log.Debug("post-steps", "detail", "skipped under root", "steps", strings.Join(names, ","))
+		steps = nil
+	}
+	res.Errors = append(res.Errors, runPostSteps(steps, r.cfg.PostStepConcurrency)...)
+
+	// postApply hooks of changed policies, after the built-in post-steps so
+	// they see the compiled dconf db and loaded modprobe config
+	if post {
+		for _, it := range want.Items {
+			h := want.Hooks[it.Policy]
+			if !changedPolicies[it.Policy] || len(h.Post) == 0 {
+				continue
+			}
+			delete(changedPolicies, it.Policy)
+			if err := r.runHooks(ctx, it.Policy, h.Post); err != nil {
+				r.log.Warn("hook", "err", err.Error(), "policy", it.Policy)
+				want.Failures = append(want.Failures, failure{Policy: it.Policy, Severity: it.Severity, Error: err.Error()})
+			}
 		}
 	}
 
 	if !dry {
-		r.saveManaged(desiredManaged)
+		r.saveManaged(reachedManaged(want.Managed, prev.Items, unreached))
+		r.saveBundle(commit, applied, want)
+		r.pruneBackups()
 	}
+	res.Changed, res.Removed, res.Failed = changed, removed, len(want.Failures)
+	for _, f := range want.Failures {
+		res.Errors = append(res.Errors, fmt.Errorf("policy %s: %s", f.Policy, f.Error))
+	}
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		res.Result = "failed-timeout"
+		return r.timedOut(commit)
+	}
+	res.Result = "ok"
 
 	// Status + audit
 	st := status.Status{
 		LastApply: time.Now().UTC().Format(time.RFC3339),
 		Result:    "ok",
 		Changed:   changed,
-		Failed:    0,
+		Failed:    len(want.Failures),
 		Commit:    commit,
+		Version:   version.Version,
+		Reason:    okReason(dry, len(want.Items), changed+removed),
+	}
+	if prev, err := r.ReadStatus(); err == nil {
+		st.AvgDurationMs = status.EMA(prev.AvgDurationMs, time.Since(start).Milliseconds())
+	} else {
+		st.AvgDurationMs = time.Since(start).Milliseconds()
+	}
+	if len(byLabel) > 0 {
+		st.ChangedByLabel = byLabel
+	}
+	byKind := want.byKind(applied)
+	if len(byKind) > 0 {
+		st.PoliciesByKind = byKind
 	}
-	_ = status.Write(r.cfg.StatusFile, st)
+	shown, omitted := capFiles(files)
+	if r.cfg.StatusChangedFiles && len(shown) > 0 {
+		st.ChangedFiles, st.ChangedFilesOmitted = shown, omitted
+	}
+	r.writeStatus(st)
 
 	rec := map[string]any{
 		"ts":         time.Now().UTC().Format(time.RFC3339),
 		"trigger":    trigger,
 		"repo":       r.cfg.Repo,
+		"branch":     branch,
+		"source":     r.source(),
 		"commit":     commit,
+		"version":    version.Version,
 		"facts":      r.lastFacts,
 		"tags":       r.lastTags,
 		"changed":    changed,
@@ -341,69 +675,603 @@ func (r *Runner) RunOnce(ctx context.Context, dry bool, trigger string) error {
 		"durationMs": time.Since(start).Milliseconds(),
 		"removed":    removed,
 	}
-	if f, err := os.OpenFile(r.cfg.AuditLog, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644); err == nil {
+	if len(byLabel) > 0 {
+		rec["changedByLabel"] = byLabel
+	}
+	if len(byKind) > 0 {
+		rec["policiesByKind"] = byKind
+	}
+	if pinned != "" {
+		rec["pinned"] = true
+	}
+	if channel != "" {
+		rec["channel"] = ring
+	}
+	if match == inventory.ByHostname {
+		rec["inventoryMatch"] = match.String()
+	}
+	if r.backupSet != "" {
+		rec["backup"] = filepath.Join(r.cfg.BackupDir, r.backupSet)
+	}
+	if inc != nil {
+		rec["incremental"] = true
+	}
+	if len(shown) > 0 {
+		rec["changedFiles"] = shown
+		if omitted > 0 {
+			rec["changedFilesOmitted"] = omitted
+		}
+	}
+	if len(want.Failures) > 0 {
+		rec["failures"] = want.Failures
+		rec["severity"] = maxSeverity(want.Failures)
+	}
+	r.writeAudit(rec)
+
+	return nil
+}
+
+// maxChangedFiles caps the changed-files list in audit and status; a
+// first run on a big policy set could otherwise write thousands of entries.
+const maxChangedFiles = 200
+
+// capFiles is files cut to maxChangedFiles plus how many were left out.
+func capFiles(files []status.FileChange) ([]status.FileChange, int) {
+	if len(files) <= maxChangedFiles {
+		return files, 0
+	}
+	return files[:maxChangedFiles], len(files) - maxChangedFiles
+}
+
+// maxSeverity is the most urgent severity among fs, for alert routing.
+func maxSeverity(fs []failure) string {
+	rank := map[string]int{"info": 0, "warning": 1, "critical": 2}
+	best := "info"
+	for _, f := range fs {
+		if rank[f.Severity] > rank[best] {
+			best = f.Severity
+		}
+	}
+	return best
+}
+
+// okReason tells a healthy no-op apart from a host that matches nothing.
+func okReason(dry bool, items, changes int) string {
+	switch {
+	case items == 0 && changes == 0:
+		return "no-matching-policies"
+	case changes == 0:
+		return "up-to-date"
+	case dry:
+		return "pending-changes"
+	default:
+		return "applied"
+	}
+}
+
+// timedOut records a run cut short by its deadline (cfg.RunTimeout); the
+// context has already killed any git/dconf/modprobe subprocess still running.
+func (r *Runner) timedOut(commit string) error {
+	r.writeStatus(status.Status{Result: "failed-timeout", Reason: "deadline", Detail: r.cfg.RunTimeout().String(), Commit: commit, Version: version.Version})
+	return fmt.Errorf("run exceeded its %s deadline", r.cfg.RunTimeout())
+}
+
+// source names where policies came from, for the audit record.
+func (r *Runner) source() string {
+	if dir := r.cfg.LocalDir(); dir != "" {
+		return "local:" + dir
+	}
+	return "git"
+}
+
+// DeviceKey is the identity this device is known by. With deviceKeys set it
+// is the first of DeviceKeyPaths whose hash the inventory lists, else the
+// first that exists; the inventory is only seen once the cache is synced.
+func (r *Runner) DeviceKey() string {
+	keys := r.cfg.DeviceKeyPaths()
+	if len(keys) == 1 {
+		return keys[0]
+	}
+	for _, k := range keys {
+		if _, _, m, err := inventory.LookupDevice(r.cfg.RepoDir(), k, "", r.cfg.InventorySigningKey); err == nil && m == inventory.ByKey {
+			return k
+		}
+	}
+	for _, k := range keys {
+		if _, err := os.Stat(k); err == nil {
+			return k
+		}
+	}
+	return keys[0]
+}
+
+func (r *Runner) gitOptions() git.Options {
+	return git.Options{
+		ResetCorrupt: r.cfg.ResetCorruptCache,
+		OnReset: func(reason string) {
+			r.log.Warn("git", "detail", "cache looks corrupt; moving it aside and re-cloning", "dir", r.cfg.CacheDir, "err", reason)
+		},
+		DeviceKey:  r.cfg.DeviceKey,
+		DeviceKeys: r.cfg.DeviceKeyPaths()[1:],
+		Depth:      r.cfg.FetchDepth,
+		HTTPProxy:  r.cfg.HTTPProxy,
+		HTTPSProxy: r.cfg.HTTPSProxy,
+		NoProxy:    r.cfg.NoProxy,
+	}
+}
+
+// tagPerms resolves tagsOwner/tagsGroup (a name or numeric id) into the
+// permissions the inventory sync applies.
+func (r *Runner) tagPerms() (inventory.TagPerms, error) {
+	p := inventory.TagPerms{DirMode: r.cfg.TagsDirMode(), FileMode: r.cfg.TagsFileMode(), UID: -1, GID: -1}
+	if o := r.cfg.TagsOwner; o != "" {
+		id := o
+		if _, err := strconv.Atoi(o); err != nil {
+			u, err := user.Lookup(o)
+			if err != nil {
+				return p, fmt.Errorf("tagsOwner: %w", err)
+			}
+			id = u.Uid
+		}
+		p.UID, _ = strconv.Atoi(id)
+	}
+	if g := r.cfg.TagsGroup; g != "" {
+		id := g
+		if _, err := strconv.Atoi(g); err != nil {
+			grp, err := user.LookupGroup(g)
+			if err != nil {
+				return p, fmt.Errorf("tagsGroup: %w", err)
+			}
+			id = grp.Gid
+		}
+		p.GID, _ = strconv.Atoi(id)
+	}
+	return p, nil
+}
+
+// SetNextRun records when the service loop will run next; it is written to
+// status.json by every following run.
+func (r *Runner) SetNextRun(t time.Time) { r.nextRun = t }
+
+// Reload switches to a new config (e.g. after agent.yaml changed). Cached
+// facts and tags are dropped; the failure streak is kept.
+func (r *Runner) Reload(cfg *config.Config) {
+	r.cfg = cfg
+	r.lastFacts, r.lastTags = nil, nil
+}
+
+// SetForce makes following runs rewrite every desired file (fresh inode,
+// mode and owner) and re-run post-steps, even when the content is unchanged.
+func (r *Runner) SetForce(on bool) { r.force = on }
+
+// Defer moves the next run out to t (failure backoff) and updates nextRun in
+// the existing status.json right away.
+func (r *Runner) Defer(t time.Time) {
+	r.nextRun = t
+	if prev, err := r.ReadStatus(); err == nil {
+		r.writeStatus(prev)
+	}
+}
+
+func (r *Runner) writeStatus(st status.Status) {
+	if st.AvgDurationMs == 0 {
+		// aborted runs keep the average of completed ones
+		if prev, err := r.ReadStatus(); err == nil {
+			st.AvgDurationMs = prev.AvgDurationMs
+		}
+	}
+	if !r.nextRun.IsZero() {
+		st.NextRun = r.nextRun.UTC().Format(time.RFC3339)
+	}
+	st.FailureStreak = r.failStreak
+	if st.Device == "" {
+		f := r.maskFacts(r.lastFacts)
+		st.Device, st.DeviceShortID = f["device.id"], f["device.short_id"]
+	}
+	if st.Enrolled == nil {
+		st.Enrolled = r.enrolled
+	}
+	st.Detail = r.scrub(st.Detail)
+	_ = os.MkdirAll(filepath.Dir(r.statusPath()), 0o755)
+	_ = status.Write(r.statusPath(), st, r.cfg.StatusFormat)
+}
+
+func (r *Runner) writeAudit(rec map[string]any) {
+	if r.cfg.AuditLog == "" {
+		return
+	}
+	if _, ok := rec["enrolled"]; !ok && r.enrolled != nil {
+		rec["enrolled"] = *r.enrolled
+	}
+	if f, ok := rec["facts"].(map[string]string); ok {
+		rec["facts"] = r.maskFacts(f)
+	}
+	if t, ok := rec["tags"].(map[string][]string); ok {
+		rec["tags"] = r.maskTags(t)
+	}
+	if fs, ok := rec["failures"].([]failure); ok && len(r.cfg.RedactKeys) > 0 {
+		clean := make([]failure, len(fs))
+		for i, f := range fs {
+			f.Error = r.scrub(f.Error)
+			clean[i] = f
+		}
+		rec["failures"] = clean
+	}
+	_ = os.MkdirAll(filepath.Dir(r.auditPath()), 0o755)
+	if f, err := os.OpenFile(r.auditPath(), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644); err == nil {
 		_ = json.NewEncoder(f).Encode(rec)
 		_ = f.Close()
 	}
+}
 
-	return nil
+// haltedBy reports what activated the kill-switch, or "" when inactive.
+func (r *Runner) haltedBy() string {
+	if _, err := os.Stat(r.cfg.HaltFile); err == nil {
+		return r.cfg.HaltFile
+	}
+	if tags.Has(r.lastTags[haltTag], "true") {
+		return "tag " + haltTag
+	}
+	return ""
+}
+
+// hostPath maps a managed target path (always spelled /etc/...) to where it
+// lives on disk: under cfg.Root when set. The allow-list, managed.json and
+// cleanup all work on the unprefixed path.
+func (r *Runner) hostPath(path string) string {
+	if r.cfg.Root == "" {
+		return path
+	}
+	return filepath.Join(r.cfg.Root, path)
+}
+
+// rePolkitPath matches polkit rules at any priority prefix (NN-lgpo-).
+var rePolkitPath = regexp.MustCompile(`^/etc/polkit-1/rules\.d/[0-9]{2}-lgpo-`)
+
+// reUnitPath matches the unit files of ScheduledTaskPolicy timers.
+var reUnitPath = regexp.MustCompile(`^/etc/systemd/system/lgpo-[A-Za-z0-9_-]+\.(service|timer)$`)
+
+// reDconfPath matches lgpo keyfiles and locks in any system db dir, so files
+// written for a previous dconfDb can still be cleaned up.
+var reDconfPath = regexp.MustCompile(`^/etc/dconf/db/[A-Za-z0-9_-]+\.d/(locks/)?60-lgpo-`)
+
+func isDconfPath(path string) bool { return strings.HasPrefix(path, "/etc/dconf/db/") }
+
+// allowedPath is the write/remove allow-list for managed files.
+func allowedPath(path string) bool {
+	return rePolkitPath.MatchString(path) ||
+		reDconfPath.MatchString(path) ||
+		strings.HasPrefix(path, "/etc/modprobe.d/60-lgpo-") ||
+		strings.HasPrefix(path, "/etc/security/limits.d/60-lgpo-") ||
+		strings.HasPrefix(path, "/etc/udev/rules.d/60-lgpo-") ||
+		strings.HasPrefix(path, "/etc/environment.d/60-lgpo-") ||
+		strings.HasPrefix(path, "/etc/sudoers.d/60-lgpo-") ||
+		strings.HasPrefix(path, "/etc/cron.d/60-lgpo-") ||
+		strings.HasPrefix(path, "/etc/pam.d/60-lgpo-") ||
+		reUnitPath.MatchString(path)
+}
+
+// pinTag holds a full commit sha the device stays on instead of the branch
+// head, e.g. lgpo.pin_commit=<sha> in its inventory entry.
+const pinTag = "lgpo.pin_commit"
+
+var reCommit = regexp.MustCompile(`^([0-9a-f]{40}|[0-9a-f]{64})$`)
+
+// pinCommit checks out the commit named by the pinTag tag and returns it, or
+// "" when the device is not pinned. A local policies dir has no history to
+// pin to, so the tag is only logged there.
+func (r *Runner) pinCommit(ctx context.Context) (string, error) {
+	vals := r.lastTags[pinTag]
+	if len(vals) == 0 {
+		return "", nil
+	}
+	sha := strings.ToLower(vals[0])
+	if !reCommit.MatchString(sha) {
+		return "", fmt.Errorf("want a full commit sha, got %q", vals[0])
+	}
+	if r.cfg.LocalDir() != "" {
+		r.log.Warn("pin", "detail", "ignored with a local policies dir", "tag", pinTag, "commit", sha)
+		return "", nil
+	}
+	return git.Pin(ctx, r.cfg.CacheDir, sha, r.gitOptions())
+}
+
+// reRing is a channel name from the channelFromTag tag; it becomes a file name.
+var reRing = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// channelCommit checks out the commit the device's ring should run: the
+// first value of the channelFromTag tag names channels/<ring>.txt, read
+// from origin/<branch> as last fetched (not the working tree, which may be
+// pinned to an older commit), whose first line that is not a comment is a
+// full sha. It returns "" when no channel applies, including a ring without
+// a channel file, so the device follows its branch; a file that does not
+// hold a sha is an error.
+func (r *Runner) channelCommit(ctx context.Context) (string, string, error) {
+	vals := r.lastTags[r.cfg.ChannelFromTag]
+	if r.cfg.ChannelFromTag == "" || len(vals) == 0 {
+		return "", "", nil
+	}
+	ring := vals[0]
+	if !reRing.MatchString(ring) {
+		return "", ring, fmt.Errorf("invalid channel name %q", ring)
+	}
+	if r.cfg.LocalDir() != "" {
+		r.log.Warn("channel", "detail", "ignored with a local policies dir", "ring", ring)
+		return "", ring, nil
+	}
+	file := "channels/" + ring + ".txt"
+	b, err := git.ShowFile(ctx, r.cfg.CacheDir, "origin/"+r.cfg.Branch, file)
+	if r.syncErr != nil && err == nil {
+		r.log.Warn("channel", "detail", "repo sync failed; the channel file may be stale", "file", file, "err", r.syncErr.Error())
+	}
+	if errors.Is(err, os.ErrNotExist) {
+		r.log.Warn("channel", "detail", "no channel file; following the branch", "file", file, "branch", r.branch())
+		return "", ring, nil
+	}
+	if err != nil {
+		return "", ring, err
+	}
+	sha := ""
+	for _, line := range strings.Split(string(b), "\n") {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+			sha = strings.ToLower(line)
+			break
+		}
+	}
+	if !reCommit.MatchString(sha) {
+		return "", ring, fmt.Errorf("%s: want a full commit sha, got %q", file, sha)
+	}
+	c, err := git.Pin(ctx, r.cfg.CacheDir, sha, r.gitOptions())
+	return c, ring, err
+}
+
+// reBranch accepts tag-derived branch names; anything else falls back to cfg.Branch.
+var reBranch = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._/-]*$`)
+
+// branch returns the branch this host tracks: with branchFromTag set, the
+// first value of that tag (mapped through branchMap), else cfg.Branch.
+func (r *Runner) branch() string {
+	vals := r.lastTags[r.cfg.BranchFromTag]
+	if r.cfg.BranchFromTag == "" || len(vals) == 0 {
+		return r.cfg.Branch
+	}
+	b := vals[0]
+	if m, ok := r.cfg.BranchMap[b]; ok {
+		b = m
+	}
+	if !reBranch.MatchString(b) || strings.Contains(b, "..") {
+		r.log.Warn("branch", "err", "invalid branch from tag", "tag", r.cfg.BranchFromTag, "value", b, "fallback", r.cfg.Branch)
+		return r.cfg.Branch
+	}
+	return b
+}
+
+// followBranch moves the cache from the default branch (always synced first,
+// so the inventory is read from it) to the tag-selected branch and returns
+// the resulting commit and branch. If that fails, the cache stays at the
+// default branch.
+func (r *Runner) followBranch(ctx context.Context, commit string) (string, string) {
+	b := r.branch()
+	if b == r.cfg.Branch || r.cfg.LocalDir() != "" {
+		return commit, r.cfg.Branch
+	}
+	c, err := git.Ensure(ctx, r.cfg.Repo, b, r.cfg.CacheDir, r.gitOptions())
+	if err != nil {
+		r.log.Warn("branch", "err", err.Error(), "branch", b, "fallback", r.cfg.Branch)
+		return commit, r.cfg.Branch
+	}
+	return c, b
+}
+
+// enrollHint is logged when the repo rejects this device's credentials.
+const enrollHint = "Private policy repo? Add this device as READ-ONLY deploy key and put its hash into inventory/devices.yml"
+
+// syncRepo updates the repo cache and returns the checked-out commit. Auth
+// failures log an enrollment hint. With a local source, git is not touched
+// and the commit is unknown ("").
+func (r *Runner) syncRepo(ctx context.Context) (string, error) {
+	if dir := r.cfg.LocalDir(); dir != "" {
+		if _, err := os.Stat(dir); err != nil {
+			return "", fmt.Errorf("local policies dir: %w", err)
+		}
+		return "", nil
+	}
+	commit, err := git.Ensure(ctx, r.cfg.Repo, r.cfg.Branch, r.cfg.CacheDir, r.gitOptions())
+	r.syncErr = err
+	if err != nil {
+		lower := strings.ToLower(err.Error())
+		if strings.Contains(lower, "permission") || strings.Contains(lower, "access") || strings.Contains(lower, "auth") {
+			key := r.DeviceKey()
+			hash, _, _ := inventory.ComputeDeviceHashPreferPub(key)
+			pub := ""
+			if b, readErr := os.ReadFile(key + ".pub"); readErr == nil {
+				pub = strings.TrimSpace(string(b))
+			}
+			r.log.Warn("enrollment",
+				"hint", enrollHint,
+				"repo", r.cfg.Repo,
+				"branch", r.cfg.Branch,
+				"device", hash,
+				"shortId", inventory.ShortID(hash),
+				"pubkey", pub,
+			)
+		}
+		return "", err
+	}
+	return commit, nil
 }
 
 type applyItem struct {
-	Path string
-	Data []byte
-	Mode fs.FileMode
+	Path      string
+	Data      []byte
+	Mode      fs.FileMode
+	Initramfs bool      // changing this file needs an initramfs rebuild
+	SHA256    string    // content hash from the renderer, if it computed one
+	Visudo    bool      // check the temp file with visudo -c before it replaces the target
+	Pam       bool      // check the modules before install, re-check the installed file and roll back if that fails
+	Source    string    // owning policy file, relative to the policies dir
+	Expires   time.Time // the owning policy's metadata.expires
+
+	Policy, Severity string // owning policy, for failure reports
 }
 
 func (r *Runner) applyAtomic(it applyItem, dry bool) (bool, error) {
-	okPath := strings.HasPrefix(it.Path, "/etc/polkit-1/rules.d/60-lgpo-") ||
-		strings.HasPrefix(it.Path, "/etc/dconf/db/local.d/60-lgpo-") ||
-		strings.HasPrefix(it.Path, "/etc/dconf/db/local.d/locks/60-lgpo-") ||
-		strings.HasPrefix(it.Path, "/etc/modprobe.d/60-lgpo-")
-	if !okPath {
+	if !allowedPath(it.Path) {
 		return false, fmt.Errorf("path not allowed: %s", it.Path)
 	}
 
-	if b, err := os.ReadFile(it.Path); err == nil {
-		if string(b) == string(it.Data) {
-			return false, nil
-		}
+	dst := r.hostPath(it.Path)
+	old, readErr := os.ReadFile(dst)
+	if readErr == nil && !r.force && string(old) == string(it.Data) {
+		return false, nil
 	}
 
 	if dry {
 		return true, nil
 	}
 
-	if err := os.MkdirAll(filepath.Dir(it.Path), 0o755); err != nil {
+	tmp, err := writeTemp(dst, it.Data, it.Mode)
+	if err != nil {
 		return false, err
 	}
-	tmp := it.Path + ".lgpo-tmp"
-	if err := os.WriteFile(tmp, it.Data, 0o600); err != nil {
+	if err := r.checkTemp(it, tmp); err != nil {
+		_ = os.Remove(tmp)
 		return false, err
 	}
-	if err := os.Chmod(tmp, it.Mode); err != nil {
+	if err := r.backupFile(it.Path); err != nil {
 		_ = os.Remove(tmp)
 		return false, err
 	}
-	if err := os.Rename(tmp, it.Path); err != nil {
+	if err := os.Rename(tmp, dst); err != nil {
 		_ = os.Remove(tmp)
 		return false, err
 	}
+	if err := r.verifyInstalled(it, dst); err != nil {
+		r.rollback([]staged{{it: it, dst: dst, old: old, existed: readErr == nil}})
+		return false, fmt.Errorf("%w; previous version restored", err)
+	}
+	if r.force {
+		if err := resetOwnership(dst, it.Mode); err != nil {
+			return true, err
+		}
+	}
 	return true, nil
 }
 
-// ---------- dconf helpers ----------
+// resetOwnership sets a forced file's owner to root:root (when the agent
+// runs as root) and its mode to the rendered one, whatever a setgid parent
+// dir or the umask gave the temp file it was renamed from.
+func resetOwnership(dst string, mode fs.FileMode) error {
+	if os.Geteuid() == 0 {
+		if err := os.Lchown(dst, 0, 0); err != nil {
+			return err
+		}
+	}
+	return os.Chmod(dst, mode)
+}
+
+// writeTemp writes data next to dst (dst.lgpo-tmp) with mode, ready to be
+// renamed into place.
+func writeTemp(dst string, data []byte, mode fs.FileMode) (string, error) {
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return "", err
+	}
+	tmp := dst + ".lgpo-tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return "", err
+	}
+	if err := os.Chmod(tmp, mode); err != nil {
+		_ = os.Remove(tmp)
+		return "", err
+	}
+	return tmp, nil
+}
+
+// checkTemp runs the item's syntax check on its temp file. A sudoers file
+// visudo rejects would break sudo for everyone, so without visudo the file
+// is not installed at all; a PAM file must name modules this host has.
+func (r *Runner) checkTemp(it applyItem, tmp string) error {
+	if it.Pam {
+		b, err := os.ReadFile(tmp)
+		if err == nil {
+			err = pm.Check(r.cfg.Root, b)
+		}
+		if err != nil {
+			return fmt.Errorf("pam check rejected %s: %w", it.Path, err)
+		}
+		return nil
+	}
+	if !it.Visudo {
+		return nil
+	}
+	bin, err := exec.LookPath("visudo")
+	if err != nil {
+		if _, st := os.Stat("/usr/sbin/visudo"); st != nil {
+			return fmt.Errorf("visudo not found; refusing to install %s unchecked", it.Path)
+		}
+		bin = "/usr/sbin/visudo"
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if out, err := exec.CommandContext(ctx, bin, "-c", "-q", "-f", tmp).CombinedOutput(); err != nil {
+		return fmt.Errorf("visudo -c rejected %s: %v (output: %s)", it.Path, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// verifyInstalled re-reads a PAM file after it was renamed into place and
+// checks the stack it now sits in: it must be what was written, and every
+// service file including it must parse with all its includes and modules
+// present. A file that fails is not left in the login path.
+func (r *Runner) verifyInstalled(it applyItem, dst string) error {
+	if !it.Pam {
+		return nil
+	}
+	b, err := os.ReadFile(dst)
+	if err != nil {
+		return fmt.Errorf("verify %s: %w", it.Path, err)
+	}
+	if string(b) != string(it.Data) {
+		return fmt.Errorf("verify %s: content changed while installing", it.Path)
+	}
+	if err := pm.CheckStack(r.cfg.Root, filepath.Dir(dst), filepath.Base(dst)); err != nil {
+		return fmt.Errorf("verify %s: %w", it.Path, err)
+	}
+	return nil
+}
 
-func ensureDconfProfile() error {
-	const path = "/etc/dconf/profile/user"
-	if _, err := os.Stat(path); err == nil {
+// pamIncluders lists the pam.d files still including the managed PAM
+// snippet at path; nil for any other file. Such a snippet is not removed.
+func (r *Runner) pamIncluders(path string) []string {
+	if !strings.HasPrefix(path, "/etc/pam.d/60-lgpo-") {
 		return nil
 	}
+	return pm.Includers(r.hostPath("/etc/pam.d"), filepath.Base(path))
+}
+
+// ---------- dconf helpers ----------
+
+// ensureDconfProfile makes the dconf profile at path read system db db
+// after user-db, so its keys act as defaults and its locks override user
+// settings. An existing profile without the system-db line gets it appended.
+func ensureDconfProfile(path, db string) error {
+	want := "system-db:" + db
+	content := []byte("user-db:user\n" + want + "\n")
+	if b, err := os.ReadFile(path); err == nil {
+		for _, line := range strings.Split(string(b), "\n") {
+			if strings.TrimSpace(line) == want {
+				return nil
+			}
+		}
+		if len(b) > 0 && !strings.HasSuffix(string(b), "\n") {
+			b = append(b, '\n')
+		}
+		content = append(b, want+"\n"...)
+	}
 	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
 		return err
 	}
 	tmp := path + ".tmp"
-	content := []byte("user-db:user\nsystem-db:local\n")
 	if err := os.WriteFile(tmp, content, 0o644); err != nil {
 		return err
 	}
@@ -485,38 +1353,3 @@ func moduleLoaded(name string) bool {
 	alt := strings.ReplaceAll(name, "_", "-") + " "
 	return strings.Contains(s, needle) || strings.Contains(s, alt)
 }
-
-// ---------- tags reader ----------
-
-func loadTags(dir string) map[string]string {
-	m := map[string]string{}
-	ents, err := os.ReadDir(dir)
-	if err != nil {
-		return m
-	}
-	for _, e := range ents {
-		if e.IsDir() {
-			continue
-		}
-		name := e.Name()
-		if !strings.HasSuffix(name, ".tag") {
-			continue
-		}
-		b, err := os.ReadFile(filepath.Join(dir, name))
-		if err != nil {
-			continue
-		}
-		val := ""
-		for _, line := range strings.Split(string(b), "\n") {
-			line = strings.TrimSpace(line)
-			if line == "" || strings.HasPrefix(line, "#") {
-				continue
-			}
-			val = line
-			break
-		}
-		k := strings.TrimSuffix(name, ".tag")
-		m[k] = val
-	}
-	return m
-}
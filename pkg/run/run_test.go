@@ -0,0 +1,39 @@
+package run
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunResultErrors(t *testing.T) {
+	r, dir := newTestRunner(t, "")
+	policies := filepath.Join(dir, "repo", "policies")
+	writeFile(t, filepath.Join(policies, "ok.yml"), polkitYAML("ok"))
+	writeFile(t, filepath.Join(policies, "bad.yml"), strings.Replace(polkitYAML("bad"), "result: YES", "result: YES\n      message: denied", 1))
+	writeFile(t, filepath.Join(policies, "mp.yml"), modprobeYAML("mp", "usb-storage", true))
+	// a file where the modprobe dir should be makes the write fail
+	writeFile(t, r.hostPath("/etc/modprobe.d"), "")
+
+	res, err := r.RunOnce(context.Background(), false, "test")
+	if err != nil {
+		t.Fatalf("a partly failing run is not aborted: %v", err)
+	}
+	if res.Result != "ok" || res.Changed != 1 || res.Failed != 2 {
+		t.Errorf("result %s changed %d failed %d, want ok 1 2", res.Result, res.Changed, res.Failed)
+	}
+	var got []string
+	for _, e := range res.Errors {
+		got = append(got, e.Error())
+	}
+	prefixes := []string{"inventory: ", "policy bad: ", "policy mp: "} // no device key, no inventory
+	if len(got) != len(prefixes) {
+		t.Fatalf("errors = %q, want one per %q", got, prefixes)
+	}
+	for i, p := range prefixes {
+		if !strings.HasPrefix(got[i], p) {
+			t.Errorf("error %d = %q, want prefix %q", i, got[i], p)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package run
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lgpo-org/lgpod/pkg/selector"
+)
+
+// ShowResult describes a single policy as seen from this host.
+type ShowResult struct {
+	File        string
+	Kind        string
+	Name        string
+	Matches     bool
+	Expires     string   // metadata.expires, if set
+	Expired     bool     // past expiry: not applied, matching or not
+	DecidedBy   []string // selector clauses with this host's values
+	Files       []ShowFile
+	RenderError string
+}
+
+type ShowFile struct {
+	Path string
+	Data []byte
+}
+
+// Show finds the policy named name in the repo cache, evaluates its selector
+// against current facts/tags and renders it. Nothing is written.
+func (r *Runner) Show(name string) (*ShowResult, error) {
+	ctx := r.Context()
+
+	var res *ShowResult
+	_, err := r.walkPolicies(func(p *policy) {
+		if res != nil || p.Name != name {
+			return
+		}
+		res = &ShowResult{
+			File:      p.Path,
+			Kind:      p.Kind,
+			Name:      p.Name,
+			Matches:   p.Selector.Match(ctx),
+			DecidedBy: selectorInputs(p.Selector, ctx),
+			Expired:   p.expired(time.Now()),
+		}
+		if !p.Expires.IsZero() {
+			res.Expires = p.Expires.Format(time.RFC3339)
+		}
+		if err := p.render(ctx); err != nil {
+			res.RenderError = err.Error()
+			return
+		}
+		for _, it := range p.Items {
+			res.Files = append(res.Files, ShowFile{Path: it.Path, Data: it.Data})
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	if res == nil {
+		return nil, fmt.Errorf("policy %q not found in %s", name, r.policiesDir())
+	}
+	return res, nil
+}
+
+// selectorInputs lists every selector clause next to the host value it was
+// compared against, e.g. `fact os.id want="ubuntu" got="debian"`.
+func selectorInputs(s selector.Sel, ctx selector.Context) []string {
+	var out []string
+	if s.HostnameRegex != "" {
+		out = append(out, fmt.Sprintf("hostname want=/%s/ got=%q", s.HostnameRegex, ctx.Facts["hostname"]))
+	}
+	for _, k := range sortedKeys(s.Facts) {
+		out = append(out, fmt.Sprintf("fact %s want=%q got=%q", k, s.Facts[k], ctx.Facts[k]))
+	}
+	for _, k := range sortedKeys(s.Tags) {
+		if name, all := strings.CutSuffix(k, selector.AllSuffix); all {
+			out = append(out, fmt.Sprintf("tag %s want=all of %v got=%q", name, s.Tags[k], ctx.Tags[name]))
+			continue
+		}
+		out = append(out, fmt.Sprintf("tag %s want=%v got=%q", k, s.Tags[k], ctx.Tags[k]))
+	}
+	for _, k := range s.FactsPresent {
+		_, ok := ctx.Facts[k]
+		out = append(out, fmt.Sprintf("fact %s want=present got=%s", k, presence(ok)))
+	}
+	for _, k := range s.FactsAbsent {
+		_, ok := ctx.Facts[k]
+		out = append(out, fmt.Sprintf("fact %s want=absent got=%s", k, presence(ok)))
+	}
+	for _, k := range s.TagsPresent {
+		_, ok := ctx.Tags[k]
+		out = append(out, fmt.Sprintf("tag %s want=present got=%s", k, presence(ok)))
+	}
+	for _, k := range s.TagsAbsent {
+		_, ok := ctx.Tags[k]
+		out = append(out, fmt.Sprintf("tag %s want=absent got=%s", k, presence(ok)))
+	}
+	return out
+}
+
+func presence(ok bool) string {
+	if ok {
+		return "present"
+	}
+	return "absent"
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
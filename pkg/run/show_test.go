@@ -0,0 +1,87 @@
+package run
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/lgpo-org/lgpod/pkg/selector"
+)
+
+func TestShow(t *testing.T) {
+	r, dir := newTestRunner(t, "")
+	policies := filepath.Join(dir, "repo", "policies")
+	withSel := func(name, extra string) string {
+		return strings.Replace(polkitYAML(name), "spec:\n", extra+"spec:\n", 1)
+	}
+	writeFile(t, filepath.Join(policies, "kiosk.yml"), withSel("kiosk", "selector:\n  tags: {role: kiosk}\n  tagsAbsent: [legacy]\n"))
+	writeFile(t, filepath.Join(policies, "lab.yml"), withSel("lab", "selector:\n  tags: {role: lab}\n"))
+	writeFile(t, filepath.Join(policies, "old.yml"), strings.Replace(polkitYAML("old"), "  name: old\n", "  name: old\n  expires: 2020-01-01T00:00:00Z\n", 1))
+	writeFile(t, filepath.Join(policies, "bad.yml"), strings.Replace(polkitYAML("bad"), "result: YES", "result: YES\n      message: denied", 1))
+	writeFile(t, filepath.Join(dir, "tags", "role.tag"), "kiosk\n")
+
+	tests := []struct {
+		name      string
+		matches   bool
+		decidedBy []string
+		expired   bool
+		renderErr string
+		files     []string
+	}{
+		{"kiosk", true, []string{`tag role want=kiosk got=["kiosk"]`, "tag legacy want=absent got=absent"}, false, "", []string{"/etc/polkit-1/rules.d/60-lgpo-kiosk.rules"}},
+		{"lab", false, []string{`tag role want=lab got=["kiosk"]`}, false, "", []string{"/etc/polkit-1/rules.d/60-lgpo-lab.rules"}},
+		{"old", true, nil, true, "", []string{"/etc/polkit-1/rules.d/60-lgpo-old.rules"}},
+		{"bad", true, nil, false, "message needs a NO result", nil},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			res, err := r.Show(tc.name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.Name != tc.name || res.Kind != "PolkitPolicy" || res.File != filepath.Join(policies, tc.name+".yml") {
+				t.Errorf("got %s %s from %s", res.Kind, res.Name, res.File)
+			}
+			if res.Matches != tc.matches || res.Expired != tc.expired {
+				t.Errorf("matches %v expired %v, want %v %v", res.Matches, res.Expired, tc.matches, tc.expired)
+			}
+			if !reflect.DeepEqual(res.DecidedBy, tc.decidedBy) {
+				t.Errorf("decidedBy = %q, want %q", res.DecidedBy, tc.decidedBy)
+			}
+			if tc.expired && res.Expires != "2020-01-01T00:00:00Z" {
+				t.Errorf("expires = %q", res.Expires)
+			}
+			if !strings.Contains(res.RenderError, tc.renderErr) || (tc.renderErr == "") != (res.RenderError == "") {
+				t.Errorf("render error = %q, want %q", res.RenderError, tc.renderErr)
+			}
+			var paths []string
+			for _, f := range res.Files {
+				paths = append(paths, f.Path)
+				if !strings.Contains(string(f.Data), "org.example.test") {
+					t.Errorf("%s does not render the rule:\n%s", f.Path, f.Data)
+				}
+				if _, err := os.Stat(r.hostPath(f.Path)); err == nil {
+					t.Errorf("show wrote %s", f.Path)
+				}
+			}
+			if !reflect.DeepEqual(paths, tc.files) {
+				t.Errorf("files = %q, want %q", paths, tc.files)
+			}
+		})
+	}
+
+	if _, err := r.Show("missing"); err == nil || !strings.Contains(err.Error(), `policy "missing" not found`) {
+		t.Errorf("Show(missing) = %v, want not found", err)
+	}
+}
+
+func TestSelectorInputsAllOf(t *testing.T) {
+	sel := selector.Sel{Tags: map[string]any{"roles" + selector.AllSuffix: []any{"web", "tls"}, "site": "hq"}}
+	ctx := selector.NewContext(nil, map[string][]string{"roles": {"web"}, "site": {"hq"}})
+	want := []string{`tag roles want=all of [web tls] got=["web"]`, `tag site want=hq got=["hq"]`}
+	if got := selectorInputs(sel, ctx); !reflect.DeepEqual(got, want) {
+		t.Errorf("selectorInputs = %q, want %q", got, want)
+	}
+}
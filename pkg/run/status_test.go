@@ -0,0 +1,125 @@
+package run
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStatusFormat(t *testing.T) {
+	for format, oneLine := range map[string]bool{"": false, "pretty": false, "compact": true} {
+		t.Run("format="+format, func(t *testing.T) {
+			extra := ""
+			if format != "" {
+				extra = "statusFormat: " + format + "\n"
+			}
+			r, dir := newTestRunner(t, extra)
+			writeFile(t, filepath.Join(dir, "repo", "policies", "a.yml"), polkitYAML("a"))
+			if _, err := r.RunOnce(context.Background(), false, "test"); err != nil {
+				t.Fatal(err)
+			}
+			b, err := os.ReadFile(r.statusPath())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := bytes.Count(b, []byte("\n")) == 1; got != oneLine {
+				t.Errorf("one line = %v, want %v:\n%s", got, oneLine, b)
+			}
+		})
+	}
+}
+
+func TestStatusReason(t *testing.T) {
+	r, dir := newTestRunner(t, "")
+	file := filepath.Join(dir, "repo", "policies", "a.yml")
+	writeFile(t, filepath.Join(dir, "repo", "policies", "README.md"), "no policies yet\n")
+	steps := []struct {
+		name   string
+		dry    bool
+		setup  func()
+		reason string
+	}{
+		{"nothing to apply", false, nil, "no-matching-policies"},
+		{"dry run with changes", true, func() { writeFile(t, file, polkitYAML("a")) }, "pending-changes"},
+		{"apply", false, nil, "applied"},
+		{"second run", false, nil, "up-to-date"},
+		{"dry run in sync", true, nil, "up-to-date"},
+		{"removal counts as a change", false, func() { os.Remove(file) }, "applied"},
+		{"nothing left", false, nil, "no-matching-policies"},
+	}
+	for _, s := range steps {
+		if s.setup != nil {
+			s.setup()
+		}
+		if _, err := r.RunOnce(context.Background(), s.dry, "test"); err != nil {
+			t.Fatalf("%s: %v", s.name, err)
+		}
+		st, err := r.ReadStatus()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if st.Result != "ok" || st.Reason != s.reason {
+			t.Errorf("%s: status %s/%s, want ok/%s", s.name, st.Result, st.Reason, s.reason)
+		}
+	}
+}
+
+func TestStatusAvgDuration(t *testing.T) {
+	r, dir := newTestRunner(t, "")
+	writeFile(t, filepath.Join(dir, "repo", "policies", "a.yml"), polkitYAML("a"))
+	ctx := context.Background()
+	if _, err := r.RunOnce(ctx, false, "test"); err != nil {
+		t.Fatal(err)
+	}
+	st, err := r.ReadStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a huge previous average is pulled down, not replaced
+	st.AvgDurationMs = 100000
+	r.writeStatus(st)
+	if _, err := r.RunOnce(ctx, false, "test"); err != nil {
+		t.Fatal(err)
+	}
+	if st, err = r.ReadStatus(); err != nil {
+		t.Fatal(err)
+	}
+	if st.AvgDurationMs < 79000 || st.AvgDurationMs > 81000 {
+		t.Errorf("avgDurationMs = %d, want about 80000", st.AvgDurationMs)
+	}
+}
+
+func TestFailureStreak(t *testing.T) {
+	r, dir := newTestRunner(t, "")
+	policies := filepath.Join(dir, "repo", "policies")
+	writeFile(t, filepath.Join(policies, "a.yml"), polkitYAML("a"))
+	ctx := context.Background()
+	steps := []struct {
+		name   string
+		setup  func()
+		failed bool
+		want   int
+	}{
+		{"success", nil, false, 0},
+		{"first failure", func() { writeFile(t, filepath.Join(policies, defaultsFile), "selector: [\n") }, true, 1},
+		{"second failure", nil, true, 2},
+		{"recovered", func() { os.Remove(filepath.Join(policies, defaultsFile)) }, false, 0},
+	}
+	for _, s := range steps {
+		if s.setup != nil {
+			s.setup()
+		}
+		if _, err := r.RunOnce(ctx, false, "test"); (err != nil) != s.failed {
+			t.Fatalf("%s: err = %v", s.name, err)
+		}
+		st, err := r.ReadStatus()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.FailureStreak() != s.want || st.FailureStreak != s.want {
+			t.Errorf("%s: streak %d, status %d; want %d", s.name, r.FailureStreak(), st.FailureStreak, s.want)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package run
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// stubVisudo puts a visudo on PATH that rejects files containing BAD and
+// logs the file it checked to <dir>/checked. It uses shell builtins only,
+// as PATH holds nothing else.
+func stubVisudo(t *testing.T, dir string) {
+	t.Helper()
+	script := "#!/bin/sh\necho \"$4\" >> " + filepath.Join(dir, "checked") + "\n" +
+		"read -r line < \"$4\"\ncase \"$line\" in *BAD*) echo \"syntax error near line 1\" >&2; exit 1;; esac\n"
+	writeFile(t, filepath.Join(dir, "visudo"), script)
+	if err := os.Chmod(filepath.Join(dir, "visudo"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVisudoGate(t *testing.T) {
+	const path = "/etc/sudoers.d/60-lgpo-admins"
+	const old = "# previous\n"
+	tests := []struct {
+		name    string
+		visudo  bool
+		data    string
+		wantErr string
+	}{
+		{"accepted", true, "%ops ALL=(root) /usr/bin/id\n", ""},
+		{"rejected", true, "BAD ALL=\n", "visudo -c rejected " + path},
+		{"no visudo", false, "%ops ALL=(root) /usr/bin/id\n", "visudo not found; refusing to install " + path + " unchecked"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := os.Stat("/usr/sbin/visudo"); err == nil && !tc.visudo {
+				t.Skip("/usr/sbin/visudo is installed")
+			}
+			r, dir := newTestRunner(t, "")
+			bin := filepath.Join(dir, "bin")
+			if err := os.MkdirAll(bin, 0o755); err != nil {
+				t.Fatal(err)
+			}
+			if tc.visudo {
+				stubVisudo(t, bin)
+			}
+			t.Setenv("PATH", bin)
+			dst := r.hostPath(path)
+			writeFile(t, dst, old)
+
+			_, err := r.applyAtomic(applyItem{Path: path, Data: []byte(tc.data), Mode: 0o440, Visudo: true}, false)
+			b, _ := os.ReadFile(dst)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tc.wantErr)
+				}
+				if string(b) != old {
+					t.Errorf("%s = %q, want the previous content kept", path, b)
+				}
+			} else {
+				if err != nil {
+					t.Fatal(err)
+				}
+				fi, _ := os.Stat(dst)
+				if string(b) != tc.data || fi.Mode().Perm() != 0o440 {
+					t.Errorf("%s = %q mode %v, want %q mode 0440", path, b, fi.Mode().Perm(), tc.data)
+				}
+			}
+			if _, err := os.Stat(dst + ".lgpo-tmp"); !os.IsNotExist(err) {
+				t.Errorf("temp file left behind: %v", err)
+			}
+			if tc.visudo {
+				checked, _ := os.ReadFile(filepath.Join(bin, "checked"))
+				if got := strings.TrimSpace(string(checked)); got != dst+".lgpo-tmp" {
+					t.Errorf("visudo checked %q, want the temp file", got)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package run
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// timersWants is where systemctl enable links timers wanted by timers.target.
+const timersWants = "/etc/systemd/system/timers.target.wants"
+
+// reloadUnits makes systemd pick up changed lgpo unit files (paths). A timer
+// whose file went away is stopped and unlinked from timers.target first;
+// after daemon-reload, a timer that was written is enabled and restarted so
+// a new schedule takes effect now. Service files only need the reload.
+func (r *Runner) reloadUnits(ctx context.Context, paths []string) []error {
+	var errs []error
+	systemctl := func(args ...string) {
+		if out, err := exec.CommandContext(ctx, "systemctl", args...).CombinedOutput(); err != nil {
+			r.log.Warn("systemd", "err", err.Error(), "out", strings.TrimSpace(string(out)))
+			errs = append(errs, fmt.Errorf("systemctl %s: %w", strings.Join(args, " "), err))
+		}
+	}
+	var started []string
+	for _, p := range unique(paths) {
+		if !strings.HasSuffix(p, ".timer") {
+			continue
+		}
+		unit := filepath.Base(p)
+		if _, err := os.Stat(p); err == nil {
+			started = append(started, unit)
+			continue
+		}
+		systemctl("stop", unit)
+		link := filepath.Join(timersWants, unit)
+		if fi, err := os.Lstat(link); err == nil && fi.Mode()&os.ModeSymlink != 0 {
+			_ = os.Remove(link)
+		}
+	}
+	systemctl("daemon-reload")
+	for _, unit := range started {
+		systemctl("enable", unit)
+		systemctl("restart", unit)
+	}
+	if len(errs) == 0 {
+		r.log.Info("systemd", "detail", "reloaded units", "timers", strings.Join(started, ","))
+	}
+	return errs
+}
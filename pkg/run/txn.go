@@ -0,0 +1,214 @@
+package run
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	dc "github.com/lgpo-org/lgpod/pkg/dconf"
+)
+
+// staged is one file written to its temp location, waiting for the commit.
+type staged struct {
+	it      applyItem
+	dst     string
+	tmp     string
+	old     []byte // previous content, restored if a later rename fails
+	existed bool
+}
+
+// preApplyAll runs the preApply hooks of every policy with pending changes.
+// In a transaction any failure aborts the whole run.
+func (r *Runner) preApplyAll(ctx context.Context, want *desired, post bool) error {
+	if !post {
+		return nil
+	}
+	done := map[string]bool{}
+	for _, it := range want.Items {
+		h := want.Hooks[it.Policy]
+		if done[it.Policy] || len(h.Pre) == 0 {
+			continue
+		}
+		done[it.Policy] = true
+		if !r.pending(want.Items, it.Policy) {
+			continue
+		}
+		if err := r.runHooks(ctx, it.Policy, h.Pre); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyTransaction stages every changed item to a temp file, checks the
+// resulting dconf database still compiles, then renames all of them into
+// place and removes stale files. If anything fails before the last rename,
+// temps are removed and already renamed files are put back, so the system is
+// left as it was. It returns the files that changed.
+func (r *Runner) applyTransaction(ctx context.Context, items []applyItem, stale []managedItem) ([]staged, error) {
+	var st []staged
+	abort := func() {
+		for _, s := range st {
+			_ = os.Remove(s.tmp)
+		}
+	}
+	for _, it := range items {
+		if ctx.Err() != nil {
+			abort()
+			return nil, ctx.Err()
+		}
+		if !allowedPath(it.Path) {
+			abort()
+			return nil, fmt.Errorf("path not allowed: %s", it.Path)
+		}
+		dst := r.hostPath(it.Path)
+		old, err := os.ReadFile(dst)
+		existed := err == nil
+		if existed && !r.force && string(old) == string(it.Data) {
+			continue
+		}
+		tmp, err := writeTemp(dst, it.Data, it.Mode)
+		if err != nil {
+			abort()
+			return nil, fmt.Errorf("stage %s: %w", it.Path, err)
+		}
+		if err := r.checkTemp(it, tmp); err != nil {
+			_ = os.Remove(tmp)
+			abort()
+			return nil, err
+		}
+		st = append(st, staged{it: it, dst: dst, tmp: tmp, old: old, existed: existed})
+	}
+
+	if err := r.validateStagedDconf(ctx, st, stale); err != nil {
+		abort()
+		return nil, err
+	}
+
+	for _, s := range st {
+		if err := r.backupFile(s.it.Path); err != nil {
+			abort()
+			return nil, err
+		}
+	}
+	for _, it := range stale {
+		if err := r.backupFile(it.Path); err != nil {
+			abort()
+			return nil, err
+		}
+	}
+	for i, s := range st {
+		if err := os.Rename(s.tmp, s.dst); err != nil {
+			abort()
+			r.rollback(st[:i])
+			return nil, fmt.Errorf("commit %s: %w", s.it.Path, err)
+		}
+	}
+	for _, s := range st {
+		if err := r.verifyInstalled(s.it, s.dst); err != nil {
+			r.rollback(st)
+			return nil, err
+		}
+	}
+	if r.force {
+		for _, s := range st {
+			if err := resetOwnership(s.dst, s.it.Mode); err != nil {
+				r.log.Warn("transaction", "detail", "reset ownership failed", "path", s.it.Path, "err", err.Error())
+			}
+		}
+	}
+	for _, it := range stale {
+		if err := os.Remove(r.hostPath(it.Path)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			r.log.Warn("transaction", "detail", "remove stale failed", "path", it.Path, "err", err.Error())
+		}
+	}
+	return st, nil
+}
+
+// rollback restores files that were already renamed into place.
+func (r *Runner) rollback(done []staged) {
+	for _, s := range done {
+		var err error
+		if s.existed {
+			var tmp string
+			if tmp, err = writeTemp(s.dst, s.old, s.it.Mode); err == nil {
+				err = os.Rename(tmp, s.dst)
+			}
+		} else {
+			err = os.Remove(s.dst)
+		}
+		if err != nil {
+			r.log.Error("transaction", "detail", "rollback failed", "path", s.it.Path, "err", err.Error())
+		}
+	}
+}
+
+// validateStagedDconf compiles a copy of the db dir with the staged files in
+// place and stale ones removed, so a bad keyfile aborts the transaction
+// before the real database is touched. It is skipped when no dconf file is
+// involved or the dconf binary is missing.
+func (r *Runner) validateStagedDconf(ctx context.Context, st []staged, stale []managedItem) error {
+	localD := dc.DbDir(r.cfg.DconfDb) + "/"
+	drop := map[string]bool{}
+	overlay := map[string][]byte{}
+	for _, it := range stale {
+		if strings.HasPrefix(it.Path, localD) {
+			drop[strings.TrimPrefix(it.Path, localD)] = true
+		}
+	}
+	for _, s := range st {
+		if strings.HasPrefix(s.it.Path, localD) {
+			overlay[strings.TrimPrefix(s.it.Path, localD)] = s.it.Data
+		}
+	}
+	if len(drop) == 0 && len(overlay) == 0 {
+		return nil
+	}
+	if _, err := os.Stat("/usr/bin/dconf"); err != nil {
+		r.log.Warn("transaction", "detail", "dconf not installed; skipping staged compile check")
+		return nil
+	}
+
+	tmp, err := os.MkdirTemp("", "lgpo-txn-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+	src := r.hostPath(localD)
+	dir := filepath.Join(tmp, "db.d")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	_ = filepath.WalkDir(src, func(p string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() || strings.HasSuffix(p, ".lgpo-tmp") {
+			return nil
+		}
+		rel, _ := filepath.Rel(src, p)
+		if drop[rel] {
+			return nil
+		}
+		if _, ok := overlay[rel]; ok {
+			return nil
+		}
+		if b, err := os.ReadFile(p); err == nil {
+			_ = os.MkdirAll(filepath.Dir(filepath.Join(dir, rel)), 0o755)
+			_ = os.WriteFile(filepath.Join(dir, rel), b, 0o644)
+		}
+		return nil
+	})
+	for rel, b := range overlay {
+		_ = os.MkdirAll(filepath.Dir(filepath.Join(dir, rel)), 0o755)
+		if err := os.WriteFile(filepath.Join(dir, rel), b, 0o644); err != nil {
+			return err
+		}
+	}
+	out, err := exec.CommandContext(ctx, "/usr/bin/dconf", "compile", filepath.Join(tmp, "out"), dir).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("dconf compile of staged files: %v (output: %s)", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
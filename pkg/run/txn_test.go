@@ -0,0 +1,89 @@
+package run
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestApplyTransactionMidBatchFailure(t *testing.T) {
+	const (
+		modified = "/etc/polkit-1/rules.d/60-lgpo-a.rules"
+		created  = "/etc/udev/rules.d/60-lgpo-b.rules"
+		stale    = "/etc/modprobe.d/60-lgpo-old.conf"
+	)
+	tests := []struct {
+		name    string
+		failing applyItem
+		setup   func(t *testing.T, r *Runner) // makes failing fail
+		wantErr string
+	}{
+		{
+			name:    "path not allowed",
+			failing: applyItem{Path: "/etc/passwd", Data: []byte("x\n"), Mode: 0o644},
+			wantErr: "path not allowed",
+		},
+		{
+			name:    "stage fails",
+			failing: applyItem{Path: "/etc/security/limits.d/60-lgpo-c.conf", Data: []byte("* soft nofile 1024\n"), Mode: 0o644},
+			setup: func(t *testing.T, r *Runner) {
+				// a file where the dir should be
+				writeFile(t, r.hostPath("/etc/security/limits.d"), "")
+			},
+			wantErr: "stage /etc/security/limits.d/60-lgpo-c.conf",
+		},
+		{
+			name:    "check fails",
+			failing: applyItem{Path: "/etc/pam.d/60-lgpo-c", Data: []byte("auth required pam_nosuch.so\n"), Mode: 0o644, Pam: true},
+			wantErr: "pam check rejected",
+		},
+		{
+			name:    "rename fails after earlier renames",
+			failing: applyItem{Path: "/etc/environment.d/60-lgpo-c.conf", Data: []byte("A=1\n"), Mode: 0o644},
+			setup: func(t *testing.T, r *Runner) {
+				// a non-empty dir cannot be replaced by a file
+				writeFile(t, r.hostPath("/etc/environment.d/60-lgpo-c.conf/keep"), "")
+			},
+			wantErr: "commit /etc/environment.d/60-lgpo-c.conf",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r, _ := newTestRunner(t, "")
+			writeFile(t, r.hostPath(modified), "old\n")
+			writeFile(t, r.hostPath(stale), "blacklist x\n")
+			if tc.setup != nil {
+				tc.setup(t, r)
+			}
+			items := []applyItem{
+				{Path: modified, Data: []byte("new\n"), Mode: 0o644},
+				{Path: created, Data: []byte("new\n"), Mode: 0o644},
+				tc.failing,
+			}
+			st, err := r.applyTransaction(context.Background(), items, []managedItem{{Path: stale}})
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("err = %v, want %q", err, tc.wantErr)
+			}
+			if st != nil {
+				t.Errorf("staged = %v, want nil", st)
+			}
+			if b, err := os.ReadFile(r.hostPath(modified)); err != nil || string(b) != "old\n" {
+				t.Errorf("%s = %q, %v; want old content", modified, b, err)
+			}
+			if _, err := os.Stat(r.hostPath(created)); !os.IsNotExist(err) {
+				t.Errorf("%s exists after abort: %v", created, err)
+			}
+			if _, err := os.Stat(r.hostPath(stale)); err != nil {
+				t.Errorf("stale file removed: %v", err)
+			}
+			_ = filepath.WalkDir(r.cfg.Root, func(p string, d os.DirEntry, err error) error {
+				if err == nil && strings.HasSuffix(p, ".lgpo-tmp") {
+					t.Errorf("temp file left behind: %s", p)
+				}
+				return nil
+			})
+		})
+	}
+}
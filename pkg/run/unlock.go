@@ -0,0 +1,50 @@
+package run
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	dc "github.com/lgpo-org/lgpod/pkg/dconf"
+)
+
+// applyUnlocks drops the keys of want.Unlocks from every lgpo locks file in
+// want, whichever policy locked them. Changed locks files go through the
+// normal apply, so dconf update runs as for any other change. Locks in
+// other tools' files are left alone and only warned about.
+func (r *Runner) applyUnlocks(want *desired) {
+	if len(want.Unlocks) == 0 {
+		return
+	}
+	keys := map[string]bool{}
+	for _, k := range want.Unlocks {
+		keys[k] = true
+	}
+	dir := dc.DbDir(r.cfg.DconfDb) + "/locks"
+	for i, it := range want.Items {
+		if filepath.Dir(it.Path) != dir {
+			continue
+		}
+		data, dropped := dc.Unlock(it.Data, keys)
+		if len(dropped) == 0 {
+			continue
+		}
+		want.Items[i].Data, want.Items[i].SHA256 = data, sha256Hex(data)
+		for _, k := range dropped {
+			r.log.Info("dconf", "detail", "lock dropped by an unlock", "key", k, "policy", it.Policy)
+		}
+	}
+	ents, _ := os.ReadDir(r.hostPath(dir))
+	for _, e := range ents {
+		if e.IsDir() || strings.HasPrefix(e.Name(), "60-lgpo-") {
+			continue
+		}
+		b, err := os.ReadFile(r.hostPath(filepath.Join(dir, e.Name())))
+		if err != nil {
+			continue
+		}
+		if _, dropped := dc.Unlock(b, keys); len(dropped) > 0 {
+			r.log.Warn("dconf", "warning", "still locked by a file lgpo does not manage", "file", filepath.Join(dir, e.Name()), "keys", strings.Join(dropped, ","))
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package run
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+)
+
+// verifyApplied re-reads every applied file before the post-steps and
+// compares it with what was rendered, catching a write another process raced
+// or a filesystem that lost it. A mismatched file is rewritten once and
+// passed to rewrote, so its post-steps run; if it still does not match it is
+// reported as a failure.
+func (r *Runner) verifyApplied(want *desired, applied []applyItem, rewrote func(applyItem)) {
+	for _, it := range applied {
+		if r.matches(it) {
+			continue
+		}
+		r.log.Warn("verify", "detail", "content differs after apply; rewriting", "path", it.Path)
+		_, err := r.applyAtomic(it, false)
+		if err == nil {
+			rewrote(it)
+		}
+		if err == nil && !r.matches(it) {
+			err = fmt.Errorf("content still differs after rewrite")
+		}
+		if err != nil {
+			r.log.Error("verify", "err", err.Error(), "path", it.Path)
+			want.Failures = append(want.Failures, failure{Policy: it.Policy, Severity: it.Severity, File: it.Path, Error: "verify: " + err.Error()})
+		}
+	}
+}
+
+// matches reports whether the file on disk holds exactly it.Data.
+func (r *Runner) matches(it applyItem) bool {
+	b, err := os.ReadFile(r.hostPath(it.Path))
+	return err == nil && bytes.Equal(b, it.Data)
+}
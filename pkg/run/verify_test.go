@@ -0,0 +1,44 @@
+package run
+
+import (
+	"os"
+	"testing"
+)
+
+func TestVerifyApplied(t *testing.T) {
+	const path = "/etc/modprobe.d/60-lgpo-t.conf"
+	tests := []struct {
+		name        string
+		onDisk      string // empty removes the file
+		item        applyItem
+		wantRewrote bool
+		wantFailed  bool
+	}{
+		{"unchanged", "blacklist uas\n", applyItem{Path: path, Data: []byte("blacklist uas\n"), Mode: 0o644}, false, false},
+		{"raced write", "something else\n", applyItem{Path: path, Data: []byte("blacklist uas\n"), Mode: 0o644}, true, false},
+		{"lost file", "", applyItem{Path: path, Data: []byte("blacklist uas\n"), Mode: 0o644}, true, false},
+		{"rewrite refused", "x\n", applyItem{Path: "/etc/passwd", Data: []byte("y\n"), Mode: 0o644}, false, true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r, _ := newTestRunner(t, "")
+			if tc.onDisk != "" {
+				writeFile(t, r.hostPath(tc.item.Path), tc.onDisk)
+			}
+			want := &desired{}
+			var rewrote []string
+			r.verifyApplied(want, []applyItem{tc.item}, func(it applyItem) { rewrote = append(rewrote, it.Path) })
+			if got := len(rewrote) == 1; got != tc.wantRewrote {
+				t.Errorf("rewrote %v, want rewrite %v", rewrote, tc.wantRewrote)
+			}
+			if got := len(want.Failures) > 0; got != tc.wantFailed {
+				t.Errorf("failures %+v, want failure %v", want.Failures, tc.wantFailed)
+			}
+			if !tc.wantFailed {
+				if b, _ := os.ReadFile(r.hostPath(tc.item.Path)); string(b) != string(tc.item.Data) {
+					t.Errorf("on disk %q, want %q", b, tc.item.Data)
+				}
+			}
+		})
+	}
+}
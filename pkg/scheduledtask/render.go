@@ -0,0 +1,55 @@
+package scheduledtask
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+)
+
+// Render returns the files for p: one cron.d file, or a service and a timer
+// unit. The timer is wanted by timers.target; enabling it is left to the
+// agent's post-step. commandDirs is passed to Validate.
+func Render(p *Policy, commandDirs []string) ([]File, error) {
+	if err := p.Validate(commandDirs); err != nil {
+		return nil, err
+	}
+	s := p.Spec
+	user := s.User
+	if user == "" {
+		user = "root"
+	}
+	desc := s.Description
+	if desc == "" {
+		desc = "lgpo scheduled task " + p.Metadata.Name
+	}
+
+	if s.Backend == "cron" {
+		out := &bytes.Buffer{}
+		fmt.Fprintf(out, "# generated by lgpo (scheduledtask) for policy %s\n# %s\n", p.Metadata.Name, desc)
+		out.WriteString("SHELL=/bin/sh\nPATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin\n")
+		fmt.Fprintf(out, "%s %s %s\n", s.Schedule, user, s.Command)
+		return []File{{Path: CronPath(p.Metadata.Name), Data: out.Bytes()}}, nil
+	}
+
+	svcPath, timerPath := UnitPaths(p.Metadata.Name)
+	svc := &bytes.Buffer{}
+	fmt.Fprintf(svc, "# generated by lgpo (scheduledtask) for policy %s\n", p.Metadata.Name)
+	fmt.Fprintf(svc, "[Unit]\nDescription=%s\n\n[Service]\nType=oneshot\n", desc)
+	if user != "root" {
+		fmt.Fprintf(svc, "User=%s\n", user)
+	}
+	fmt.Fprintf(svc, "ExecStart=%s\n", s.Command)
+
+	timer := &bytes.Buffer{}
+	fmt.Fprintf(timer, "# generated by lgpo (scheduledtask) for policy %s\n", p.Metadata.Name)
+	fmt.Fprintf(timer, "[Unit]\nDescription=%s (timer)\n\n[Timer]\nOnCalendar=%s\n", desc, s.OnCalendar)
+	if s.RandomizedDelay != "" {
+		d, _ := time.ParseDuration(s.RandomizedDelay)
+		fmt.Fprintf(timer, "RandomizedDelaySec=%d\n", int(d.Seconds()))
+	}
+	if s.Persistent {
+		timer.WriteString("Persistent=true\n")
+	}
+	timer.WriteString("\n[Install]\nWantedBy=timers.target\n")
+	return []File{{Path: svcPath, Data: svc.Bytes()}, {Path: timerPath, Data: timer.Bytes()}}, nil
+}
@@ -0,0 +1,202 @@
+package scheduledtask
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var cronMacros = map[string]bool{
+	"@reboot": true, "@yearly": true, "@annually": true, "@monthly": true,
+	"@weekly": true, "@daily": true, "@midnight": true, "@hourly": true,
+}
+
+var (
+	monthNames = []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}
+	dayNames   = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+)
+
+// cronFields are the five crontab time fields with their value ranges.
+var cronFields = []struct {
+	name     string
+	min, max int
+	names    []string // accepted instead of a number, alone (not in lists or ranges)
+}{
+	{"minute", 0, 59, nil},
+	{"hour", 0, 23, nil},
+	{"day of month", 1, 31, nil},
+	{"month", 1, 12, monthNames},
+	{"day of week", 0, 7, dayNames},
+}
+
+// validCron accepts a five-field crontab schedule or one of the @ macros.
+// Each field is a comma list of *, N or N-M, each optionally /step.
+func validCron(s string) error {
+	if cronMacros[s] {
+		return nil
+	}
+	fields := strings.Fields(s)
+	if len(fields) != len(cronFields) {
+		return fmt.Errorf("schedule %q must have 5 fields (minute hour day-of-month month day-of-week) or be an @ macro", s)
+	}
+	for i, f := range fields {
+		spec := cronFields[i]
+		if contains(spec.names, strings.ToLower(f)) {
+			continue
+		}
+		for _, item := range strings.Split(f, ",") {
+			if err := cronItem(item, spec.min, spec.max); err != nil {
+				return fmt.Errorf("schedule %q: %s: %v", s, spec.name, err)
+			}
+		}
+	}
+	return nil
+}
+
+func cronItem(item string, min, max int) error {
+	rng, step, hasStep := strings.Cut(item, "/")
+	if hasStep {
+		if n, err := strconv.Atoi(step); err != nil || n < 1 || n > max {
+			return fmt.Errorf("bad step %q", step)
+		}
+	}
+	if rng == "*" {
+		return nil
+	}
+	lo, hi, isRange := strings.Cut(rng, "-")
+	a, err := number(lo, min, max)
+	if err != nil {
+		return err
+	}
+	if !isRange {
+		if hasStep {
+			return fmt.Errorf("%q: a step needs * or a range", item)
+		}
+		return nil
+	}
+	b, err := number(hi, min, max)
+	if err != nil {
+		return err
+	}
+	if b < a {
+		return fmt.Errorf("range %q is backwards", rng)
+	}
+	return nil
+}
+
+// calendarShorthands are the OnCalendar keywords systemd accepts.
+var calendarShorthands = map[string]bool{
+	"minutely": true, "hourly": true, "daily": true, "weekly": true, "monthly": true,
+	"yearly": true, "annually": true, "quarterly": true, "semiannually": true,
+}
+
+var weekdays = map[string]bool{
+	"Mon": true, "Tue": true, "Wed": true, "Thu": true, "Fri": true, "Sat": true, "Sun": true,
+	"Monday": true, "Tuesday": true, "Wednesday": true, "Thursday": true, "Friday": true, "Saturday": true, "Sunday": true,
+}
+
+// validCalendar accepts a subset of systemd.time(7) calendar events: a
+// shorthand like daily, or "[weekdays] [Y-M-D] H:M[:S]" where each number
+// is a comma list of *, N, N..M or N/step. Time zones and the ~ last-day
+// syntax are not accepted.
+func validCalendar(s string) error {
+	if calendarShorthands[s] {
+		return nil
+	}
+	fields := strings.Fields(s)
+	if len(fields) == 0 || len(fields) > 3 || !strings.Contains(s, ":") {
+		return fmt.Errorf("onCalendar %q must be a shorthand (daily, weekly, ...) or [weekdays] [Y-M-D] H:M[:S]", s)
+	}
+	hms := strings.Split(fields[len(fields)-1], ":")
+	if len(hms) > 3 {
+		return fmt.Errorf("onCalendar %q must end in a time H:M or H:M:S", s)
+	}
+	limits := [][2]int{{0, 23}, {0, 59}, {0, 59}}
+	for i, c := range hms {
+		if err := calendarComponent(c, limits[i][0], limits[i][1]); err != nil {
+			return fmt.Errorf("onCalendar %q: time: %v", s, err)
+		}
+	}
+	rest := fields[:len(fields)-1]
+	if len(rest) > 0 && strings.Contains(rest[len(rest)-1], "-") && !isWeekdays(rest[len(rest)-1]) {
+		ymd := strings.Split(rest[len(rest)-1], "-")
+		if len(ymd) != 3 {
+			return fmt.Errorf("onCalendar %q: date must be Y-M-D", s)
+		}
+		for i, lim := range [][2]int{{1970, 2199}, {1, 12}, {1, 31}} {
+			if err := calendarComponent(ymd[i], lim[0], lim[1]); err != nil {
+				return fmt.Errorf("onCalendar %q: date: %v", s, err)
+			}
+		}
+		rest = rest[:len(rest)-1]
+	}
+	switch {
+	case len(rest) > 1:
+		return fmt.Errorf("onCalendar %q: want at most one weekday list and one date", s)
+	case len(rest) == 1 && !isWeekdays(rest[0]):
+		return fmt.Errorf("onCalendar %q: bad weekdays %q (e.g. Mon..Fri or Sat,Sun)", s, rest[0])
+	}
+	return nil
+}
+
+func calendarComponent(c string, min, max int) error {
+	for _, item := range strings.Split(c, ",") {
+		if item == "*" {
+			continue
+		}
+		start, step, hasStep := strings.Cut(item, "/")
+		if hasStep {
+			if n, err := strconv.Atoi(step); err != nil || n < 1 || n > max {
+				return fmt.Errorf("bad step %q", step)
+			}
+		}
+		lo, hi, isRange := strings.Cut(start, "..")
+		if hasStep && isRange {
+			return fmt.Errorf("%q: use either a range or a step", item)
+		}
+		a, err := number(lo, min, max)
+		if err != nil {
+			return err
+		}
+		if isRange {
+			b, err := number(hi, min, max)
+			if err != nil {
+				return err
+			}
+			if b < a {
+				return fmt.Errorf("range %q is backwards", start)
+			}
+		}
+	}
+	return nil
+}
+
+func isWeekdays(s string) bool {
+	for _, item := range strings.Split(s, ",") {
+		lo, hi, isRange := strings.Cut(item, "..")
+		if !weekdays[lo] || (isRange && !weekdays[hi]) {
+			return false
+		}
+	}
+	return true
+}
+
+func number(s string, min, max int) (int, error) {
+	n, err := strconv.Atoi(s)
+	if err != nil || s == "" || s[0] == '+' || s[0] == '-' {
+		return 0, fmt.Errorf("%q is not a number", s)
+	}
+	if n < min || n > max {
+		return 0, fmt.Errorf("%d is out of range %d-%d", n, min, max)
+	}
+	return n, nil
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,55 @@
+package scheduledtask
+
+import (
+	"github.com/lgpo-org/lgpod/pkg/selector"
+)
+
+type Policy struct {
+	APIVersion string       `yaml:"apiVersion"`
+	Kind       string       `yaml:"kind"`
+	Metadata   Meta         `yaml:"metadata"`
+	Selector   selector.Sel `yaml:"selector"`
+	Spec       Spec         `yaml:"spec"`
+}
+
+type Meta struct {
+	Name string `yaml:"name"`
+}
+
+// Spec is one task. Backend cron takes a crontab Schedule; backend timer
+// takes a systemd OnCalendar expression and renders a service+timer pair.
+type Spec struct {
+	Backend     string `yaml:"backend"`     // cron or timer
+	Schedule    string `yaml:"schedule"`    // cron: "*/15 * * * *" or @daily, @hourly, ...
+	OnCalendar  string `yaml:"onCalendar"`  // timer: "daily", "Mon..Fri *-*-* 02:30:00", ...
+	User        string `yaml:"user"`        // default root
+	Command     string `yaml:"command"`     // absolute path under taskCommandDirs, optionally with fixed arguments
+	Description string `yaml:"description"` // optional, one line
+
+	// Timer only.
+	RandomizedDelay string `yaml:"randomizedDelay"` // Go duration, e.g. 10m
+	Persistent      bool   `yaml:"persistent"`      // run a missed activation at boot
+}
+
+// File is one rendered target file.
+type File struct {
+	Path string
+	Data []byte
+}
+
+// CronPath is the cron.d file of a cron task. It has no extension: cron
+// skips cron.d files whose name contains a dot.
+func CronPath(name string) string {
+	return "/etc/cron.d/60-lgpo-" + name
+}
+
+// UnitName is the systemd unit name (without suffix) of a timer task.
+func UnitName(name string) string {
+	return "lgpo-" + name
+}
+
+// UnitPaths are the service and timer unit files of a timer task.
+func UnitPaths(name string) (service, timer string) {
+	base := "/etc/systemd/system/" + UnitName(name)
+	return base + ".service", base + ".timer"
+}
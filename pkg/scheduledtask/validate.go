@@ -0,0 +1,80 @@
+package scheduledtask
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var (
+	// No dots: cron skips cron.d files with a dot in the name.
+	nameRe = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+	userRe = regexp.MustCompile(`^[a-z_][a-z0-9_-]*\$?$`)
+	// An absolute path plus plain arguments. % (a newline to cron, a
+	// specifier to systemd), $, quotes and shell metacharacters are refused
+	// rather than escaped.
+	cmdRe = regexp.MustCompile(`^/[A-Za-z0-9._+/-]+( [A-Za-z0-9._+/@=:,-]+)*$`)
+)
+
+// Validate checks the spec for the chosen backend: the schedule syntax, the
+// user, and that the command is a plain path under one of commandDirs (the
+// agent's taskCommandDirs: site-provided scripts, not arbitrary system
+// binaries). Each dir ends in a slash.
+func (p *Policy) Validate(commandDirs []string) error {
+	if p.Kind != "ScheduledTaskPolicy" {
+		return fmt.Errorf("kind must be ScheduledTaskPolicy")
+	}
+	if !nameRe.MatchString(p.Metadata.Name) {
+		return fmt.Errorf("invalid metadata.name %q (letters, digits, _ and - only)", p.Metadata.Name)
+	}
+	s := p.Spec
+	switch s.Backend {
+	case "cron":
+		if s.OnCalendar != "" || s.RandomizedDelay != "" || s.Persistent {
+			return fmt.Errorf("spec.onCalendar, randomizedDelay and persistent are for backend timer")
+		}
+		if err := validCron(s.Schedule); err != nil {
+			return err
+		}
+	case "timer":
+		if s.Schedule != "" {
+			return fmt.Errorf("spec.schedule is for backend cron; timers use spec.onCalendar")
+		}
+		if err := validCalendar(s.OnCalendar); err != nil {
+			return err
+		}
+		if s.RandomizedDelay != "" {
+			if d, err := time.ParseDuration(s.RandomizedDelay); err != nil || d < time.Second {
+				return fmt.Errorf("spec.randomizedDelay %q must be a duration of at least 1s, e.g. 10m", s.RandomizedDelay)
+			}
+		}
+	default:
+		return fmt.Errorf("spec.backend must be cron or timer, got %q", s.Backend)
+	}
+	if s.User != "" && !userRe.MatchString(s.User) {
+		return fmt.Errorf("invalid spec.user %q", s.User)
+	}
+	if !cmdRe.MatchString(s.Command) {
+		return fmt.Errorf("invalid spec.command %q (absolute path and plain arguments; no %%, $, quotes or shell metacharacters)", s.Command)
+	}
+	bin := strings.Fields(s.Command)[0]
+	if path.Clean(bin) != bin {
+		return fmt.Errorf("spec.command path %q must be clean", bin)
+	}
+	allowed := false
+	for _, dir := range commandDirs {
+		allowed = allowed || strings.HasPrefix(bin, dir)
+	}
+	if !allowed && len(commandDirs) == 0 {
+		return fmt.Errorf("spec.command %s not allowed (taskCommandDirs is empty)", bin)
+	}
+	if !allowed {
+		return fmt.Errorf("spec.command %s not allowed (use a script under %s)", bin, strings.Join(commandDirs, ", "))
+	}
+	if strings.Contains(s.Description, "%") || strings.ContainsFunc(s.Description, func(r rune) bool { return r < 32 }) {
+		return fmt.Errorf("spec.description must be one line without %%")
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package scheduledtask
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateCommandDirs(t *testing.T) {
+	defaults := []string{"/usr/local/libexec/lgpo/", "/usr/local/sbin/", "/usr/local/bin/"}
+	tests := []struct {
+		name    string
+		command string
+		dirs    []string
+		wantErr string
+	}{
+		{"default dir", "/usr/local/bin/backup --quick", defaults, ""},
+		{"outside the defaults", "/opt/site/bin/backup", defaults, "not allowed (use a script under /usr/local/libexec/lgpo/"},
+		{"configured dir", "/opt/site/bin/backup", []string{"/opt/site/bin/"}, ""},
+		{"prefix is a dir, not a name", "/opt/site/binx/backup", []string{"/opt/site/bin/"}, "not allowed"},
+		{"no dirs", "/usr/local/bin/backup", nil, "taskCommandDirs is empty"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			p := &Policy{Kind: "ScheduledTaskPolicy", Metadata: Meta{Name: "t"}, Spec: Spec{Backend: "cron", Schedule: "@daily", Command: tc.command}}
+			err := p.Validate(tc.dirs)
+			if tc.wantErr == "" && err != nil {
+				t.Fatal(err)
+			}
+			if tc.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tc.wantErr)) {
+				t.Fatalf("err = %v, want %q", err, tc.wantErr)
+			}
+		})
+	}
+}
@@ -1,38 +1,121 @@
 package selector
 
-import "regexp"
+import (
+    "fmt"
+    "regexp"
+    "sort"
+    "strings"
+
+    "github.com/lgpo-org/lgpod/pkg/tags"
+)
 
 type Context struct {
     Facts map[string]string
-    Tags  map[string]string
+    Tags  map[string][]string // a tag matches if any of its values does
+}
+
+// NewContext builds the context selectors are matched against. Nil maps are
+// replaced with empty ones so callers can index them freely.
+func NewContext(facts map[string]string, tags map[string][]string) Context {
+    if facts == nil { facts = map[string]string{} }
+    if tags == nil { tags = map[string][]string{} }
+    return Context{Facts: facts, Tags: tags}
 }
 
+// AllSuffix on a tag key makes a list value all-of instead of any-of:
+// `roles!all: [web, tls]` needs both values, `roles: [web, tls]` either.
+const AllSuffix = "!all"
+
 type Sel struct {
     Facts map[string]string `yaml:"facts"`
-    Tags  map[string]any    `yaml:"tags"`
+    Tags  map[string]any    `yaml:"tags"` // string, or list (any-of; all-of with AllSuffix on the key)
     HostnameRegex string    `yaml:"hostnameRegex"`
+
+    // Key existence only, whatever the value (an empty value still counts as present).
+    FactsPresent []string `yaml:"factsPresent"`
+    FactsAbsent  []string `yaml:"factsAbsent"`
+    TagsPresent  []string `yaml:"tagsPresent"`
+    TagsAbsent   []string `yaml:"tagsAbsent"`
+
+    // CaseInsensitive compares fact/tag values and hostnameRegex ignoring case.
+    CaseInsensitive bool `yaml:"caseInsensitive"`
 }
 
 func (s Sel) Match(ctx Context) bool {
+    ok, _ := s.MatchExplain(ctx)
+    return ok
+}
+
+// MatchExplain is Match plus, on a miss, the first clause that failed, e.g.
+// `fact os.id want="ubuntu" got="debian"`. Clauses are checked in a fixed
+// order (hostname, facts, presence, tags; keys sorted) so the reason is stable.
+func (s Sel) MatchExplain(ctx Context) (bool, string) {
     if s.HostnameRegex != "" {
-        if !regexp.MustCompile(s.HostnameRegex).MatchString(ctx.Facts["hostname"]) { return false }
+        re := s.HostnameRegex
+        if s.CaseInsensitive { re = "(?i)" + re }
+        rx, err := regexp.Compile(re)
+        if err != nil { return false, fmt.Sprintf("hostname: invalid regex %q: %v", s.HostnameRegex, err) }
+        if !rx.MatchString(ctx.Facts["hostname"]) {
+            return false, fmt.Sprintf("hostname want=/%s/ got=%q", s.HostnameRegex, ctx.Facts["hostname"])
+        }
+    }
+    for _, k := range sortedKeys(s.Facts) {
+        if v := s.Facts[k]; !s.eq(ctx.Facts[k], v) { return false, fmt.Sprintf("fact %s want=%q got=%q", k, v, ctx.Facts[k]) }
+    }
+    for _, k := range s.FactsPresent {
+        if _, ok := ctx.Facts[k]; !ok { return false, fmt.Sprintf("fact %s want=present got=absent", k) }
     }
-    for k, v := range s.Facts {
-        if ctx.Facts[k] != v { return false }
+    for _, k := range s.FactsAbsent {
+        if _, ok := ctx.Facts[k]; ok { return false, fmt.Sprintf("fact %s want=absent got=present", k) }
     }
-    for k, v := range s.Tags {
-        switch vv := v.(type) {
+    for _, k := range s.TagsPresent {
+        if _, ok := ctx.Tags[k]; !ok { return false, fmt.Sprintf("tag %s want=present got=absent", k) }
+    }
+    for _, k := range s.TagsAbsent {
+        if _, ok := ctx.Tags[k]; ok { return false, fmt.Sprintf("tag %s want=absent got=present", k) }
+    }
+    for _, key := range sortedKeys(s.Tags) {
+        k, all := strings.CutSuffix(key, AllSuffix)
+        switch vv := s.Tags[key].(type) {
         case string:
-            if ctx.Tags[k] != vv { return false }
+            if !s.has(ctx.Tags[k], vv) { return false, fmt.Sprintf("tag %s want=%q got=%q", k, vv, ctx.Tags[k]) }
         case []any:
+            if all && len(vv) > 0 { // an empty all-of list matches nothing, like an empty any-of
+                for _, it := range vv {
+                    if ss, ok := it.(string); !ok || !s.has(ctx.Tags[k], ss) {
+                        return false, fmt.Sprintf("tag %s want=all of %v got=%q (missing %v)", k, vv, ctx.Tags[k], it)
+                    }
+                }
+                continue
+            }
             ok := false
             for _, it := range vv {
-                if ss, ok2 := it.(string); ok2 && ctx.Tags[k] == ss { ok = true; break }
+                if ss, ok2 := it.(string); ok2 && s.has(ctx.Tags[k], ss) { ok = true; break }
             }
-            if !ok { return false }
+            if !ok { return false, fmt.Sprintf("tag %s want=any of %v got=%q", k, vv, ctx.Tags[k]) }
         default:
-            return false
+            return false, fmt.Sprintf("tag %s: unsupported selector value %v", k, vv)
         }
     }
-    return true
+    return true, ""
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+    keys := make([]string, 0, len(m))
+    for k := range m { keys = append(keys, k) }
+    sort.Strings(keys)
+    return keys
+}
+
+func (s Sel) eq(a, b string) bool {
+    if s.CaseInsensitive { return strings.EqualFold(a, b) }
+    return a == b
+}
+
+func (s Sel) has(vals []string, want string) bool {
+    if !s.CaseInsensitive { return tags.Has(vals, want) }
+    for _, v := range vals {
+        if strings.EqualFold(v, want) { return true }
+    }
+    return false
 }
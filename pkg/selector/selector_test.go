@@ -0,0 +1,108 @@
+package selector
+
+import (
+    "testing"
+
+    "gopkg.in/yaml.v3"
+)
+
+func TestMatchExplain(t *testing.T) {
+    ctx := NewContext(
+        map[string]string{"hostname": "lab-01", "os.id": "debian", "firmware": "uefi"},
+        map[string][]string{"role": {"kiosk", "lab"}, "site": {"hq"}},
+    )
+    tests := []struct {
+        name string
+        sel  Sel
+        want string // "" for a match
+    }{
+        {"empty matches", Sel{}, ""},
+        {"all clauses pass", Sel{HostnameRegex: "^lab-", Facts: map[string]string{"os.id": "debian"}, FactsPresent: []string{"firmware"},
+            TagsAbsent: []string{"legacy"}, Tags: map[string]any{"role": "lab"}}, ""},
+        {"hostname", Sel{HostnameRegex: "^kiosk-"}, `hostname want=/^kiosk-/ got="lab-01"`},
+        {"invalid hostname regex", Sel{HostnameRegex: "lab-("}, "hostname: invalid regex \"lab-(\": error parsing regexp: missing closing ): `lab-(`"},
+        {"invalid regex case-insensitive", Sel{HostnameRegex: "[", CaseInsensitive: true}, "hostname: invalid regex \"[\": error parsing regexp: missing closing ]: `[`"},
+        {"fact", Sel{Facts: map[string]string{"os.id": "ubuntu"}}, `fact os.id want="ubuntu" got="debian"`},
+        {"fact present", Sel{FactsPresent: []string{"virt"}}, "fact virt want=present got=absent"},
+        {"fact absent", Sel{FactsAbsent: []string{"firmware"}}, "fact firmware want=absent got=present"},
+        {"tag present", Sel{TagsPresent: []string{"tenant"}}, "tag tenant want=present got=absent"},
+        {"tag absent", Sel{TagsAbsent: []string{"site"}}, "tag site want=absent got=present"},
+        {"tag string", Sel{Tags: map[string]any{"site": "branch"}}, `tag site want="branch" got=["hq"]`},
+        {"tag any of", Sel{Tags: map[string]any{"role": []any{"web", "db"}}}, `tag role want=any of [web db] got=["kiosk" "lab"]`},
+        {"tag all of", Sel{Tags: map[string]any{"role" + AllSuffix: []any{"lab", "web"}}}, `tag role want=all of [lab web] got=["kiosk" "lab"] (missing web)`},
+        {"tag unsupported value", Sel{Tags: map[string]any{"site": 3}}, "tag site: unsupported selector value 3"},
+        {"first failing clause wins", Sel{HostnameRegex: "^x", Facts: map[string]string{"os.id": "ubuntu"}}, `hostname want=/^x/ got="lab-01"`},
+        {"facts in key order", Sel{Facts: map[string]string{"os.id": "ubuntu", "firmware": "bios"}}, `fact firmware want="bios" got="uefi"`},
+    }
+    for _, tc := range tests {
+        t.Run(tc.name, func(t *testing.T) {
+            ok, why := tc.sel.MatchExplain(ctx)
+            if ok != (tc.want == "") || why != tc.want {
+                t.Errorf("MatchExplain = %v, %q; want %q", ok, why, tc.want)
+            }
+            if tc.sel.Match(ctx) != ok {
+                t.Errorf("Match disagrees with MatchExplain")
+            }
+        })
+    }
+}
+
+func TestPresentAbsent(t *testing.T) {
+    var sel Sel
+    y := "factsPresent: [virt]\nfactsAbsent: [container]\ntagsPresent: [tenant]\ntagsAbsent: [legacy]\n"
+    if err := yaml.Unmarshal([]byte(y), &sel); err != nil { t.Fatal(err) }
+    tests := []struct {
+        name  string
+        facts map[string]string
+        tags  map[string][]string
+        want  bool
+    }{
+        {"all hold", map[string]string{"virt": "kvm"}, map[string][]string{"tenant": {"acme"}}, true},
+        {"empty values still count as present", map[string]string{"virt": ""}, map[string][]string{"tenant": {}}, true},
+        {"fact missing", nil, map[string][]string{"tenant": {"acme"}}, false},
+        {"tag missing", map[string]string{"virt": "kvm"}, nil, false},
+        {"absent fact set", map[string]string{"virt": "kvm", "container": ""}, map[string][]string{"tenant": {"acme"}}, false},
+        {"absent tag set", map[string]string{"virt": "kvm"}, map[string][]string{"tenant": {"acme"}, "legacy": {}}, false},
+    }
+    for _, tc := range tests {
+        if got := sel.Match(NewContext(tc.facts, tc.tags)); got != tc.want { t.Errorf("%s: Match = %v, want %v", tc.name, got, tc.want) }
+    }
+}
+
+func TestNewContext(t *testing.T) {
+    ctx := NewContext(nil, nil)
+    if ctx.Facts == nil || ctx.Tags == nil { t.Fatal("nil maps left in the context") }
+    // indexing and writing both work on the replacements
+    ctx.Facts["hostname"] = "lab-01"
+    ctx.Tags["role"] = []string{"kiosk"}
+    if !(Sel{Facts: map[string]string{"hostname": "lab-01"}, Tags: map[string]any{"role": "kiosk"}}).Match(ctx) { t.Error("match on a filled context failed") }
+    if (Sel{TagsPresent: []string{"site"}}).Match(NewContext(nil, nil)) { t.Error("tagsPresent matched an empty context") }
+
+    facts := map[string]string{"os.id": "debian"}
+    if got := NewContext(facts, nil); got.Facts["os.id"] != "debian" || len(got.Tags) != 0 { t.Errorf("context = %+v", got) }
+}
+
+func TestAllOf(t *testing.T) {
+    tests := []struct {
+        name string
+        y    string
+        tags []string // the host's roles
+        want bool
+    }{
+        {"all present", "tags: {roles!all: [web, tls]}\n", []string{"tls", "db", "web"}, true},
+        {"one missing", "tags: {roles!all: [web, tls]}\n", []string{"web"}, false},
+        {"any-of without the suffix", "tags: {roles: [web, tls]}\n", []string{"web"}, true},
+        {"string value", "tags: {roles!all: web}\n", []string{"web"}, true},
+        {"empty list", "tags: {roles!all: []}\n", []string{"web"}, false},
+        {"untagged host", "tags: {roles!all: [web]}\n", nil, false},
+        {"case-insensitive", "caseInsensitive: true\ntags: {roles!all: [Web, TLS]}\n", []string{"web", "tls"}, true},
+        {"with an any-of on the same key", "tags: {roles!all: [web], roles: [db, tls]}\n", []string{"web", "tls"}, true},
+    }
+    for _, tc := range tests {
+        var sel Sel
+        if err := yaml.Unmarshal([]byte(tc.y), &sel); err != nil { t.Fatal(err) }
+        ctx := NewContext(nil, map[string][]string{})
+        if tc.tags != nil { ctx.Tags["roles"] = tc.tags }
+        if got := sel.Match(ctx); got != tc.want { t.Errorf("%s: Match = %v, want %v", tc.name, got, tc.want) }
+    }
+}
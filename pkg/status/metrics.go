@@ -0,0 +1,31 @@
+package status
+
+import (
+  "bytes"
+  "fmt"
+  "sort"
+)
+
+// Metrics renders the per-kind policy counts of s in the Prometheus text
+// format, for node_exporter's textfile collector, e.g.
+// `lgpo_policies_matched{kind="dconf"} 1`.
+func Metrics(s Status) []byte {
+  kinds := make([]string, 0, len(s.PoliciesByKind))
+  for k := range s.PoliciesByKind { kinds = append(kinds, k) }
+  sort.Strings(kinds)
+
+  var b bytes.Buffer
+  for _, m := range []struct {
+    name, help string
+    val        func(KindCount) int
+  }{
+    {"lgpo_policies_matched", "Policies whose selector matched this host in the last run.", func(c KindCount) int { return c.Matched }},
+    {"lgpo_policies_applied", "Matched policies applied without a failure in the last run.", func(c KindCount) int { return c.Applied }},
+  } {
+    fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s gauge\n", m.name, m.help, m.name)
+    for _, k := range kinds {
+      fmt.Fprintf(&b, "%s{kind=%q} %d\n", m.name, k, m.val(s.PoliciesByKind[k]))
+    }
+  }
+  return b.Bytes()
+}
@@ -0,0 +1,29 @@
+package status
+
+import "testing"
+
+func TestMetrics(t *testing.T) {
+  s := Status{PoliciesByKind: map[string]KindCount{
+    "udev":   {Matched: 3, Applied: 1},
+    "dconf":  {Matched: 1, Applied: 1},
+    "polkit": {Matched: 2, Applied: 2},
+  }}
+  want := `# HELP lgpo_policies_matched Policies whose selector matched this host in the last run.
+# TYPE lgpo_policies_matched gauge
+lgpo_policies_matched{kind="dconf"} 1
+lgpo_policies_matched{kind="polkit"} 2
+lgpo_policies_matched{kind="udev"} 3
+# HELP lgpo_policies_applied Matched policies applied without a failure in the last run.
+# TYPE lgpo_policies_applied gauge
+lgpo_policies_applied{kind="dconf"} 1
+lgpo_policies_applied{kind="polkit"} 2
+lgpo_policies_applied{kind="udev"} 1
+`
+  if got := string(Metrics(s)); got != want {
+    t.Errorf("Metrics =\n%s\nwant\n%s", got, want)
+  }
+  // no matched policies still declares the metrics
+  if got := string(Metrics(Status{})); got != "# HELP lgpo_policies_matched Policies whose selector matched this host in the last run.\n# TYPE lgpo_policies_matched gauge\n# HELP lgpo_policies_applied Matched policies applied without a failure in the last run.\n# TYPE lgpo_policies_applied gauge\n" {
+    t.Errorf("Metrics of an empty status = %q", got)
+  }
+}
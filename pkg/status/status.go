@@ -12,12 +12,73 @@ type Status struct {
   Changed   int    `json:"changed"`
   Failed    int    `json:"failed"`
   Commit    string `json:"commit"`
+  Version   string `json:"version"`
+  // Reason is a stable code for the outcome (see README); Detail is free text.
+  Reason    string `json:"reason,omitempty"`
+  Detail    string `json:"detail,omitempty"`
+  NextRun   string `json:"nextRun,omitempty"` // when the service loop runs next (RFC3339)
+  // ChangedByLabel counts changed files per policy metadata.labels key/value.
+  ChangedByLabel map[string]map[string]int `json:"changedByLabel,omitempty"`
+  // PoliciesByKind counts, per kind (polkit, dconf, ...), the policies whose
+  // selector matched this host and those of them now fully applied.
+  PoliciesByKind map[string]KindCount `json:"policiesByKind,omitempty"`
+  // ChangedFiles lists the files the run created, modified or removed
+  // (only with statusChangedFiles; capped, the rest counted in ChangedFilesOmitted).
+  ChangedFiles        []FileChange `json:"changedFiles,omitempty"`
+  ChangedFilesOmitted int          `json:"changedFilesOmitted,omitempty"`
+  // AvgDurationMs is an exponential moving average of completed runs.
+  AvgDurationMs int64 `json:"avgDurationMs,omitempty"`
+  // FailureStreak counts consecutive failed runs; the service backs off while it is > 0.
+  FailureStreak int `json:"failureStreak,omitempty"`
+  // Device is the full device hash; DeviceShortID its first 12 hex chars.
+  Device        string `json:"device,omitempty"`
+  DeviceShortID string `json:"deviceShortId,omitempty"`
+  // Enrolled is whether the inventory has an entry for this device (false
+  // means no inventory tags at all, not an entry with none); unset when the
+  // inventory could not be read.
+  Enrolled *bool `json:"enrolled,omitempty"`
 }
 
-func Write(path string, s Status) error {
-  if s.LastApply == "" { s.LastApply = time.Now().UTC().Format(time.RFC3339) }
+// FileChange is one changed target path; Op is created, modified or removed.
+type FileChange struct {
+  Path string `json:"path"`
+  Op   string `json:"op"`
+}
+
+type KindCount struct {
+  Matched int `json:"matched"`
+  Applied int `json:"applied"`
+}
+
+// emaWeight is how much the latest run moves AvgDurationMs.
+const emaWeight = 0.2
+
+// EMA folds the latest duration into the previous average; a zero prev
+// (first run) starts the average at cur.
+func EMA(prev, cur int64) int64 {
+  if prev <= 0 { return cur }
+  return int64(emaWeight*float64(cur) + (1-emaWeight)*float64(prev) + 0.5)
+}
+
+// Formats for Encode/Write: indented JSON (default) or a single line.
+const (
+  Pretty  = "pretty"
+  Compact = "compact"
+)
+
+// Encode renders s as JSON in the given format; anything but Compact is pretty.
+func Encode(s Status, format string) []byte {
+  if format == Compact {
+    b, _ := json.Marshal(s)
+    return append(b, '\n')
+  }
   b, _ := json.MarshalIndent(s, "", "  ")
-  return os.WriteFile(path, b, 0o644)
+  return b
+}
+
+func Write(path string, s Status, format string) error {
+  if s.LastApply == "" { s.LastApply = time.Now().UTC().Format(time.RFC3339) }
+  return os.WriteFile(path, Encode(s, format), 0o644)
 }
 
 func Read(path string) (Status, error) {
@@ -0,0 +1,59 @@
+package status
+
+import (
+  "bytes"
+  "encoding/json"
+  "path/filepath"
+  "reflect"
+  "testing"
+)
+
+func TestEncode(t *testing.T) {
+  s := Status{LastApply: "2026-10-14T12:00:00Z", Result: "ok", Changed: 2, Commit: "abc", Version: "v1"}
+  compact := Encode(s, Compact)
+  if n := bytes.Count(compact, []byte("\n")); n != 1 || compact[len(compact)-1] != '\n' {
+    t.Errorf("compact is not one line: %q", compact)
+  }
+  pretty := Encode(s, Pretty)
+  if !bytes.Contains(pretty, []byte("\n  \"result\": \"ok\"")) {
+    t.Errorf("pretty is not indented: %s", pretty)
+  }
+  if got := Encode(s, ""); !bytes.Equal(got, pretty) {
+    t.Errorf("default format = %s, want pretty", got)
+  }
+  for _, b := range [][]byte{compact, pretty} {
+    var back Status
+    if err := json.Unmarshal(b, &back); err != nil || !reflect.DeepEqual(back, s) {
+      t.Errorf("decoded %+v, %v; want %+v", back, err, s)
+    }
+  }
+}
+
+func TestWriteRead(t *testing.T) {
+  path := filepath.Join(t.TempDir(), "status.json")
+  for _, format := range []string{Pretty, Compact} {
+    if err := Write(path, Status{Result: "ok", Reason: "applied"}, format); err != nil { t.Fatal(err) }
+    s, err := Read(path)
+    if err != nil { t.Fatal(err) }
+    if s.Result != "ok" || s.Reason != "applied" || s.LastApply == "" {
+      t.Errorf("%s: read back %+v", format, s)
+    }
+  }
+}
+
+func TestEMA(t *testing.T) {
+  tests := []struct {
+    prev, cur, want int64
+  }{
+    {0, 500, 500}, // first run starts the average
+    {-1, 500, 500},
+    {1000, 1000, 1000},
+    {1000, 2000, 1200}, // a slow run moves it a fifth of the way
+    {1000, 0, 800},
+    {3, 4, 3}, // rounds to nearest: 3.2
+    {3, 6, 4}, // 3.6
+  }
+  for _, tc := range tests {
+    if got := EMA(tc.prev, tc.cur); got != tc.want { t.Errorf("EMA(%d, %d) = %d, want %d", tc.prev, tc.cur, got, tc.want) }
+  }
+}
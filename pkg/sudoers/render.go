@@ -0,0 +1,34 @@
+// pkg/sudoers/render.go
+package sudoers
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// Render returns the sudoers.d file for p, one user specification per rule
+// in spec order (sudo uses the last matching one).
+func Render(p *Policy) ([]byte, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	out := &bytes.Buffer{}
+	fmt.Fprintf(out, "# generated by lgpo (sudoers) for policy %s\n", p.Metadata.Name)
+	for _, r := range p.Spec.Rules {
+		hosts, runAs := r.Hosts, r.RunAs
+		if len(hosts) == 0 {
+			hosts = []string{"ALL"}
+		}
+		if len(runAs) == 0 {
+			runAs = []string{"root"}
+		}
+		tag := ""
+		if r.NoPasswd {
+			tag = "NOPASSWD: "
+		}
+		fmt.Fprintf(out, "%s %s=(%s) %s%s\n", strings.Join(r.Users, ", "), strings.Join(hosts, ", "),
+			strings.Join(runAs, ", "), tag, strings.Join(r.Commands, ", "))
+	}
+	return out.Bytes(), nil
+}
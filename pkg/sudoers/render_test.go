@@ -0,0 +1,59 @@
+package sudoers
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	pol := func(rules ...Rule) *Policy {
+		return &Policy{Kind: "SudoersPolicy", Metadata: Meta{Name: "admins"}, Spec: Spec{Rules: rules}}
+	}
+	tests := []struct {
+		name    string
+		p       *Policy
+		want    string // the rule lines
+		wantErr string
+	}{
+		{"defaults", pol(Rule{Users: []string{"%ops"}, Commands: []string{"/usr/bin/systemctl restart nginx"}}),
+			"%ops ALL=(root) /usr/bin/systemctl restart nginx\n", ""},
+		{"all fields", pol(Rule{Users: []string{"alice", "%ops"}, Hosts: []string{"web1.example.com"}, RunAs: []string{"www-data"},
+			Commands: []string{"/usr/bin/journalctl -u nginx", "/usr/sbin/nginx -t"}, NoPasswd: true}),
+			"alice, %ops web1.example.com=(www-data) NOPASSWD: /usr/bin/journalctl -u nginx, /usr/sbin/nginx -t\n", ""},
+		{"two rules in order", pol(Rule{Users: []string{"bob"}, Commands: []string{"/usr/bin/id"}}, Rule{Users: []string{"bob"}, RunAs: []string{"ALL"}, Commands: []string{"/usr/bin/whoami"}}),
+			"bob ALL=(root) /usr/bin/id\nbob ALL=(ALL) /usr/bin/whoami\n", ""},
+		{"wrong kind", &Policy{Kind: "PolkitPolicy", Metadata: Meta{Name: "x"}}, "", "kind must be SudoersPolicy"},
+		{"dotted name", &Policy{Kind: "SudoersPolicy", Metadata: Meta{Name: "a.b"}, Spec: Spec{Rules: []Rule{{Users: []string{"bob"}, Commands: []string{"/usr/bin/id"}}}}}, "", "invalid metadata.name"},
+		{"no rules", pol(), "", "spec.rules must be non-empty"},
+		{"no users", pol(Rule{Commands: []string{"/usr/bin/id"}}), "", "users must be non-empty"},
+		{"user ALL", pol(Rule{Users: []string{"ALL"}, Commands: []string{"/usr/bin/id"}}), "", "invalid user"},
+		{"bad host", pol(Rule{Users: []string{"bob"}, Hosts: []string{"-web"}, Commands: []string{"/usr/bin/id"}}), "", "invalid host"},
+		{"bad runAs", pol(Rule{Users: []string{"bob"}, RunAs: []string{"Root!"}, Commands: []string{"/usr/bin/id"}}), "", "invalid runAs"},
+		{"no commands", pol(Rule{Users: []string{"bob"}}), "", "commands must be non-empty"},
+		{"command ALL", pol(Rule{Users: []string{"bob"}, Commands: []string{"ALL"}}), "", "command ALL is not allowed"},
+		{"relative command", pol(Rule{Users: []string{"bob"}, Commands: []string{"id"}}), "", "invalid command"},
+		{"wildcard", pol(Rule{Users: []string{"bob"}, Commands: []string{"/usr/bin/*"}}), "", "invalid command"},
+		{"sudoers separator", pol(Rule{Users: []string{"bob"}, Commands: []string{"/usr/bin/id, /bin/sh"}}), "", "invalid command"},
+		{"unclean path", pol(Rule{Users: []string{"bob"}, Commands: []string{"/usr/bin/../bin/id"}}), "", "must be clean"},
+		{"shell", pol(Rule{Users: []string{"bob"}, Commands: []string{"/bin/bash"}}), "", "shell or privilege tool"},
+		{"sudo itself", pol(Rule{Users: []string{"bob"}, Commands: []string{"/usr/bin/sudo -i"}}), "", "shell or privilege tool"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			out, err := Render(tc.p)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			head := "# generated by lgpo (sudoers) for policy admins\n"
+			if string(out) != head+tc.want {
+				t.Errorf("Render =\n%s\nwant\n%s%s", out, head, tc.want)
+			}
+		})
+	}
+}
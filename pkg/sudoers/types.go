@@ -0,0 +1,38 @@
+// pkg/sudoers/types.go
+package sudoers
+
+import (
+	"github.com/lgpo-org/lgpod/pkg/selector"
+)
+
+type Policy struct {
+	APIVersion string       `yaml:"apiVersion"`
+	Kind       string       `yaml:"kind"`
+	Metadata   Meta         `yaml:"metadata"`
+	Selector   selector.Sel `yaml:"selector"`
+	Spec       Spec         `yaml:"spec"`
+}
+
+type Meta struct {
+	Name string `yaml:"name"`
+}
+
+type Spec struct {
+	Rules []Rule `yaml:"rules"`
+}
+
+// Rule is one sudoers user specification:
+// <users> <hosts>=(<runAs>) [NOPASSWD:] <commands>.
+type Rule struct {
+	Users    []string `yaml:"users"`    // user names or %group
+	Hosts    []string `yaml:"hosts"`    // default ALL
+	RunAs    []string `yaml:"runAs"`    // default root
+	Commands []string `yaml:"commands"` // absolute path, optionally with fixed arguments
+	NoPasswd bool     `yaml:"noPasswd"`
+}
+
+// TargetPath returns the rendered file path for this policy. It has no
+// extension: sudo skips sudoers.d files whose name contains a dot.
+func TargetPath(name string) string {
+	return "/etc/sudoers.d/60-lgpo-" + name
+}
@@ -0,0 +1,80 @@
+package sudoers
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+var (
+	// No dots: sudo ignores sudoers.d files with a dot in the name.
+	nameRe = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+	userRe = regexp.MustCompile(`^%?[a-z_][a-z0-9_-]*\$?$`)
+	hostRe = regexp.MustCompile(`^(ALL|[A-Za-z0-9]([A-Za-z0-9-]*[A-Za-z0-9])?(\.[A-Za-z0-9]([A-Za-z0-9-]*[A-Za-z0-9])?)*)$`)
+	// A command is an absolute path plus plain arguments. Characters sudoers
+	// treats specially (, : = \ # and wildcards) are refused rather than escaped.
+	cmdRe = regexp.MustCompile(`^/[A-Za-z0-9._+/-]+( [A-Za-z0-9._+/@%-]+)*$`)
+)
+
+// shells are commands that hand out a full root shell however they are
+// restricted; granting them is the same as granting ALL.
+var shells = map[string]bool{
+	"sh": true, "bash": true, "dash": true, "zsh": true, "ksh": true, "csh": true,
+	"tcsh": true, "fish": true, "su": true, "sudo": true, "sudoedit": true, "env": true,
+	"visudo": true,
+}
+
+// Validate only accepts rules it can render unambiguously. Anything that
+// amounts to unrestricted root (ALL, shells, wildcards) is refused: a fleet
+// policy should name the commands it grants.
+func (p *Policy) Validate() error {
+	if p.Kind != "SudoersPolicy" {
+		return fmt.Errorf("kind must be SudoersPolicy")
+	}
+	if !nameRe.MatchString(p.Metadata.Name) {
+		return fmt.Errorf("invalid metadata.name %q (letters, digits, _ and - only)", p.Metadata.Name)
+	}
+	if len(p.Spec.Rules) == 0 {
+		return fmt.Errorf("spec.rules must be non-empty")
+	}
+	for i, r := range p.Spec.Rules {
+		if len(r.Users) == 0 {
+			return fmt.Errorf("rules[%d]: users must be non-empty", i)
+		}
+		for _, u := range r.Users {
+			if !userRe.MatchString(u) {
+				return fmt.Errorf("rules[%d]: invalid user %q (user name or %%group; ALL is not allowed)", i, u)
+			}
+		}
+		for _, h := range r.Hosts {
+			if !hostRe.MatchString(h) {
+				return fmt.Errorf("rules[%d]: invalid host %q", i, h)
+			}
+		}
+		for _, u := range r.RunAs {
+			if u != "ALL" && !userRe.MatchString(u) {
+				return fmt.Errorf("rules[%d]: invalid runAs %q", i, u)
+			}
+		}
+		if len(r.Commands) == 0 {
+			return fmt.Errorf("rules[%d]: commands must be non-empty", i)
+		}
+		for _, c := range r.Commands {
+			if c == "ALL" {
+				return fmt.Errorf("rules[%d]: command ALL is not allowed; list the commands", i)
+			}
+			if !cmdRe.MatchString(c) {
+				return fmt.Errorf("rules[%d]: invalid command %q (absolute path and plain arguments; no wildcards or , : = \\ #)", i, c)
+			}
+			bin := strings.Fields(c)[0]
+			if path.Clean(bin) != bin || strings.HasSuffix(bin, "/") {
+				return fmt.Errorf("rules[%d]: command path %q must be clean", i, bin)
+			}
+			if shells[path.Base(bin)] {
+				return fmt.Errorf("rules[%d]: command %s is a shell or privilege tool; granting it equals ALL", i, bin)
+			}
+		}
+	}
+	return nil
+}
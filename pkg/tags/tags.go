@@ -6,17 +6,41 @@ import (
     "strings"
 )
 
-func Load(dir string) map[string]string {
-    m := map[string]string{}
+// InventoryDir is the subdirectory of the tags dir owned by the inventory
+// sync. Admin-created tags live directly in the tags dir.
+const InventoryDir = "inventory"
+
+// Load reads <dir>/<key>.tag (admin) and <dir>/inventory/<key>.tag (inventory)
+// files. Every non-empty, non-comment line is one value, so a tag may carry a
+// set of values. When both namespaces define a key, the inventory wins.
+func Load(dir string) map[string][]string {
+    m := map[string][]string{}
+    loadDir(dir, m)
+    loadDir(filepath.Join(dir, InventoryDir), m)
+    return m
+}
+
+func loadDir(dir string, m map[string][]string) {
     entries, err := os.ReadDir(dir)
-    if err != nil { return m }
+    if err != nil { return }
     for _, e := range entries {
         if e.IsDir() || !strings.HasSuffix(e.Name(), ".tag") { continue }
         b, err := os.ReadFile(filepath.Join(dir, e.Name()))
-        if err == nil {
-            k := strings.TrimSuffix(e.Name(), ".tag")
-            m[k] = strings.TrimSpace(string(b))
+        if err != nil { continue }
+        vals := []string{}
+        for _, line := range strings.Split(string(b), "\n") {
+            line = strings.TrimSpace(line)
+            if line == "" || strings.HasPrefix(line, "#") { continue }
+            vals = append(vals, line)
         }
+        m[strings.TrimSuffix(e.Name(), ".tag")] = vals
     }
-    return m
+}
+
+// Has reports whether vals contains want.
+func Has(vals []string, want string) bool {
+    for _, v := range vals {
+        if v == want { return true }
+    }
+    return false
 }
@@ -0,0 +1,44 @@
+package tags
+
+import (
+    "os"
+    "path/filepath"
+    "reflect"
+    "testing"
+)
+
+func TestLoad(t *testing.T) {
+    dir := t.TempDir()
+    files := map[string]string{
+        "site.tag":                  "hq\n",
+        "roles.tag":                 "# set by hand\nweb\n\n  cache  \n",
+        "group.tag":                 "staff\n",
+        "notes.txt":                 "ignored\n",
+        "empty.tag":                 "# nothing yet\n",
+        "old/zone.tag":              "a\n",
+        InventoryDir + "/group.tag": "# managed-by: lgpod-inventory\nkiosk\n",
+        InventoryDir + "/ring.tag":  "canary\n",
+    }
+    for name, content := range files {
+        p := filepath.Join(dir, name)
+        if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil { t.Fatal(err) }
+        if err := os.WriteFile(p, []byte(content), 0o644); err != nil { t.Fatal(err) }
+    }
+    want := map[string][]string{
+        "site":  {"hq"},
+        "roles": {"web", "cache"},
+        "group": {"kiosk"}, // the inventory wins over the admin tag
+        "empty": {},
+        "ring":  {"canary"},
+    }
+    if got := Load(dir); !reflect.DeepEqual(got, want) { t.Errorf("Load = %q, want %q", got, want) }
+}
+
+func TestLoadMissingDir(t *testing.T) {
+    if got := Load(filepath.Join(t.TempDir(), "none")); len(got) != 0 { t.Errorf("Load = %q, want empty", got) }
+}
+
+func TestHas(t *testing.T) {
+    vals := []string{"web", "cache"}
+    if !Has(vals, "cache") || Has(vals, "db") || Has(nil, "web") { t.Error("Has mismatch") }
+}
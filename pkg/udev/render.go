@@ -0,0 +1,21 @@
+// pkg/udev/render.go
+package udev
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// Render returns the rules.d file for p, one rule per line in spec order.
+func Render(p *Policy) ([]byte, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	out := &bytes.Buffer{}
+	fmt.Fprintf(out, "# generated by lgpo (udev) for policy %s\n", p.Metadata.Name)
+	for _, r := range p.Spec.Rules {
+		fmt.Fprintln(out, strings.TrimSpace(r))
+	}
+	return out.Bytes(), nil
+}
@@ -0,0 +1,29 @@
+// pkg/udev/types.go
+package udev
+
+import (
+	"github.com/lgpo-org/lgpod/pkg/selector"
+)
+
+type Policy struct {
+	APIVersion string       `yaml:"apiVersion"`
+	Kind       string       `yaml:"kind"`
+	Metadata   Meta         `yaml:"metadata"`
+	Selector   selector.Sel `yaml:"selector"`
+	Spec       Spec         `yaml:"spec"`
+}
+
+type Meta struct {
+	Name string `yaml:"name"`
+}
+
+type Spec struct {
+	// Rules are udev rule lines, e.g.
+	// SUBSYSTEM=="usb", ATTR{idVendor}=="1050", MODE="0660", GROUP="plugdev"
+	Rules []string `yaml:"rules"`
+}
+
+// TargetPath returns the rendered file path for this policy.
+func TargetPath(name string) string {
+	return "/etc/udev/rules.d/60-lgpo-" + name + ".rules"
+}
@@ -0,0 +1,66 @@
+package udev
+
+import (
+	"strings"
+	"testing"
+)
+
+func udevPolicy(rules ...string) *Policy {
+	return &Policy{Kind: "UdevPolicy", Metadata: Meta{Name: "yubikey"}, Spec: Spec{Rules: rules}}
+}
+
+func TestRender(t *testing.T) {
+	got, err := Render(udevPolicy(
+		`  SUBSYSTEM=="usb", ATTR{idVendor}=="1050", MODE="0660", GROUP="plugdev"  `,
+		`ACTION=="add", SUBSYSTEM=="block", ENV{ID_BUS}=="usb", ENV{UDISKS_IGNORE}="1"`,
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "# generated by lgpo (udev) for policy yubikey\n" +
+		`SUBSYSTEM=="usb", ATTR{idVendor}=="1050", MODE="0660", GROUP="plugdev"` + "\n" +
+		`ACTION=="add", SUBSYSTEM=="block", ENV{ID_BUS}=="usb", ENV{UDISKS_IGNORE}="1"` + "\n"
+	if string(got) != want {
+		t.Errorf("Render =\n%s\nwant\n%s", got, want)
+	}
+	if TargetPath("yubikey") != "/etc/udev/rules.d/60-lgpo-yubikey.rules" {
+		t.Errorf("TargetPath = %s", TargetPath("yubikey"))
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		rule    string
+		wantErr string
+	}{
+		{`SUBSYSTEM=="usb", ATTRS{idProduct}!="0407", TAG+="uaccess"`, ""},
+		{`KERNEL=="sd*", RUN{builtin}+="kmod load usb-storage"`, ""},
+		{`ATTR{name}=="a, b", MODE:="0600"`, ""}, // a comma inside a value
+		{`SUBSYSTEM=="usb", RUN+="/usr/bin/logger plugged"`, "RUN is not allowed"},
+		{`RUN{program}+="/bin/sh"`, "RUN{program} is not allowed"},
+		{`PROGRAM=="/bin/true"`, "PROGRAM is not allowed"},
+		{`IMPORT{program}="/bin/id"`, "IMPORT{program} is not allowed"},
+		{`ENV{X}="$(reboot)|x"`, "shell metacharacters"},
+		{`MODE="0660`, "bad key/value"},
+		{`mode="0660"`, "bad key/value"},
+		{`MODE="06\"60"`, "bad key/value"},
+		{`# a comment`, "single non-comment rule line"},
+		{"MODE=\"0660\"\nRUN+=\"/bin/sh\"", "single non-comment rule line"},
+		{"  ", "single non-comment rule line"},
+	}
+	for _, tc := range tests {
+		err := udevPolicy(tc.rule).Validate()
+		if tc.wantErr == "" {
+			if err != nil {
+				t.Errorf("%s: %v", tc.rule, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+			t.Errorf("%s: err = %v, want %q", tc.rule, err, tc.wantErr)
+		}
+	}
+	if err := udevPolicy().Validate(); err == nil {
+		t.Error("no rules validated")
+	}
+}
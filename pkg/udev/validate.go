@@ -0,0 +1,79 @@
+package udev
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	nameRe = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+	// one KEY{attr}<op>"value" pair; values may not contain quotes or backslashes
+	pairRe = regexp.MustCompile(`^\s*([A-Z_]+)(\{[A-Za-z0-9_./*-]+\})?\s*(==|!=|\+=|-=|:=|=)\s*"([^"\\]*)"\s*$`)
+)
+
+// forbidden keys run programs from the rule (RUN{builtin} is allowed: it
+// only calls udev's own builtins, never a shell or binary).
+var forbidden = map[string]bool{"RUN": true, "PROGRAM": true}
+
+// Validate accepts only plain comma-separated KEY<op>"value" rules that run
+// no external program.
+func (p *Policy) Validate() error {
+	if p.Kind != "UdevPolicy" {
+		return fmt.Errorf("kind must be UdevPolicy")
+	}
+	if !nameRe.MatchString(p.Metadata.Name) {
+		return fmt.Errorf("invalid metadata.name %q", p.Metadata.Name)
+	}
+	if len(p.Spec.Rules) == 0 {
+		return fmt.Errorf("spec.rules must be non-empty")
+	}
+	for i, r := range p.Spec.Rules {
+		if err := validRule(r); err != nil {
+			return fmt.Errorf("rules[%d]: %w", i, err)
+		}
+	}
+	return nil
+}
+
+func validRule(r string) error {
+	if strings.TrimSpace(r) == "" || strings.ContainsAny(r, "\r\n") || strings.HasPrefix(strings.TrimSpace(r), "#") {
+		return fmt.Errorf("must be a single non-comment rule line")
+	}
+	for _, part := range splitPairs(r) {
+		m := pairRe.FindStringSubmatch(part)
+		if m == nil {
+			return fmt.Errorf("bad key/value %q (want KEY==\"value\" or KEY=\"value\")", strings.TrimSpace(part))
+		}
+		key, attr, val := m[1], m[2], m[4]
+		switch {
+		case key == "RUN" && attr == "{builtin}":
+		case forbidden[key]:
+			return fmt.Errorf("%s%s is not allowed: rules must not run programs", key, attr)
+		case key == "IMPORT" && attr == "{program}":
+			return fmt.Errorf("IMPORT{program} is not allowed: rules must not run programs")
+		}
+		if strings.ContainsAny(val, "`;|&<>") {
+			return fmt.Errorf("%s: value %q contains shell metacharacters", key, val)
+		}
+	}
+	return nil
+}
+
+// splitPairs splits a rule at commas outside of quoted values.
+func splitPairs(r string) []string {
+	var out []string
+	start, quoted := 0, false
+	for i := 0; i < len(r); i++ {
+		switch r[i] {
+		case '"':
+			quoted = !quoted
+		case ',':
+			if !quoted {
+				out = append(out, r[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(out, r[start:])
+}
@@ -0,0 +1,16 @@
+// Package version carries build metadata, injected at build time:
+//
+//	go build -ldflags "-X github.com/lgpo-org/lgpod/pkg/version.Version=v0.3.0 \
+//	  -X github.com/lgpo-org/lgpod/pkg/version.Commit=$(git rev-parse --short HEAD) \
+//	  -X github.com/lgpo-org/lgpod/pkg/version.Date=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+package version
+
+var (
+	Version = "dev"
+	Commit  = "unknown"
+	Date    = "unknown"
+)
+
+func String() string {
+	return Version + " (commit " + Commit + ", built " + Date + ")"
+}
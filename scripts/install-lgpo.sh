@@ -62,7 +62,12 @@ fi
 
 echo "[3/8] Building lgpod..."
 install -d -m 0755 "$(dirname "$BIN")"
-( cd "$SRC_DIR/cmd/lgpod" && go build -trimpath -ldflags="-s -w" -o "$BIN" )
+LDPKG="github.com/lgpo-org/lgpod/pkg/version"
+LDVERSION="$(git -C "$SRC_DIR" describe --tags --always 2>/dev/null || echo dev)"
+LDCOMMIT="$(git -C "$SRC_DIR" rev-parse --short HEAD 2>/dev/null || echo unknown)"
+LDDATE="$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+( cd "$SRC_DIR/cmd/lgpod" && go build -trimpath \
+    -ldflags="-s -w -X $LDPKG.Version=$LDVERSION -X $LDPKG.Commit=$LDCOMMIT -X $LDPKG.Date=$LDDATE" -o "$BIN" )
 chmod 0755 "$BIN"
 chown root:root "$BIN"
 
@@ -187,6 +192,7 @@ echo "Installation complete."
 echo
 echo "LGPO device ID (SHA-256 of RAW Ed25519 public key derived from *private* key):"
 echo "  $DEVICE_HASH"
+echo "  short id: ${DEVICE_HASH:0:12}"
 echo
 echo "LGPO device SSH public key (paste into GitHub → Deploy keys, Read-only):"
 echo "  $(cat "$DEVICE_PUB")"